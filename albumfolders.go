@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// albumsDir holds one folder per album with links to the sorted files (--album-folders)
+var albumsDir = filepath.Join(destDir, "albums")
+
+// Ways --album-folders links album members to the sorted files
+const (
+	albumLinkSymlink  = "symlink"
+	albumLinkHardlink = "hardlink"
+)
+
+// albumNameReplacer makes album titles safe as folder names on every platform
+var albumNameReplacer = strings.NewReplacer("/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_")
+
+// writeAlbumFolders links this run's album members into albums/<Album>, next to albums.json
+func writeAlbumFolders() {
+	if *albumFolders == "" {
+		return
+	}
+	albumsMu.Lock()
+	defer albumsMu.Unlock()
+	linked, failed := 0, 0
+	for album, files := range albumContents {
+		dir := filepath.Join(albumsDir, albumFolderName(album))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Printf("Could not create album folder '%s': %v", dir, err)
+			failed += len(files)
+			continue
+		}
+		for _, rel := range files {
+			if err := linkAlbumFile(dir, filepath.Join(destDir, filepath.FromSlash(rel))); err != nil {
+				log.Printf("Could not link '%s' into album '%s': %v", rel, album, err)
+				failed++
+				continue
+			}
+			linked++
+		}
+	}
+	if linked > 0 || failed > 0 {
+		log.Printf("Album folders updated in '%s': %d files linked, %d failed", albumsDir, linked, failed)
+	}
+}
+
+// albumFolderName turns an album title into a folder name
+func albumFolderName(album string) string {
+	name := strings.Trim(albumNameReplacer.Replace(album), " .")
+	if name == "" {
+		return "Untitled"
+	}
+	return name
+}
+
+// linkAlbumFile places a link to target in an album folder, under target's name. A link already
+// there for the same file is left alone.
+func linkAlbumFile(dir, target string) error {
+	link := filepath.Join(dir, filepath.Base(target))
+	if info, err := os.Stat(link); err == nil {
+		if t, err := os.Stat(target); err == nil && os.SameFile(info, t) {
+			return nil
+		}
+		link = uniquePath(link)
+	}
+	switch *albumFolders {
+	case albumLinkHardlink:
+		return os.Link(target, link)
+	case albumLinkSymlink:
+		// Relative, so the library can be moved as a whole
+		rel, err := filepath.Rel(dir, target)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(rel, link)
+	}
+	return fmt.Errorf("unknown album link type %q", *albumFolders)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// genericAlbumName matches archive and folder names that say nothing about their photos: Takeout
+// chunks, camera folders (DCIM, 100CANON) and the like
+var genericAlbumName = regexp.MustCompile(`(?i)^(takeout(-\d.*)?|google photos|dcim|photos?|pictures|images|camera( roll)?|archive|backup|export|\d{3}[a-z0-9_]{5})$`)
+
+// archiveAlbums returns the albums a file extracted from an archive is recorded in with
+// --archive-albums: one for each archive it came from (Summer Trip 2019.zip), and one for the
+// folder it was in inside the innermost archive (Holiday/). Generic names are left out, as is the
+// name of a single compressed file (photo.jpg.gz).
+func archiveAlbums(path string) []string {
+	if !*archiveAlbumHints {
+		return nil
+	}
+	e := extractionOf(path)
+	if e == nil {
+		return nil
+	}
+	var names []string
+	for _, archive := range strings.Split(e.chain, " > ") {
+		names = append(names, archiveStem(archive))
+	}
+	if dir := filepath.Dir(e.innerPath(path)); dir != "." {
+		names = append(names, filepath.Base(dir))
+	}
+
+	var albums []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] || genericAlbumName.MatchString(name) || takeoutYearFolder.MatchString(name) {
+			continue
+		}
+		seen[name] = true
+		albums = append(albums, name)
+	}
+	return albums
+}
+
+// archiveStem is an archive's name without its archive extensions (Trip.tar.gz -> Trip), or ""
+// for a single compressed media file
+func archiveStem(name string) string {
+	for archiveExts[strings.ToLower(filepath.Ext(name))] {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	if ext := strings.ToLower(filepath.Ext(name)); imageExts[ext] || videoExts[ext] {
+		return ""
+	}
+	return name
+}
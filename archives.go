@@ -0,0 +1,624 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Archive formats extractArchive can unpack
+const (
+	formatZip    = "zip"
+	formatTar    = "tar"
+	formatTarGz  = "tar.gz"
+	formatTarBz2 = "tar.bz2"
+	format7z     = "7z"  // With an external tool (see archiveTools)
+	formatRar    = "rar" // With an external tool (see archiveTools)
+	formatGz     = "gz"  // A single compressed file, e.g. photo.jpg.gz
+	formatBz2    = "bz2"
+	formatXz     = "xz" // With an external tool (see archiveTools)
+)
+
+var (
+	extractorMu    sync.Mutex
+	extractorPaths = make(map[string]string) // Format -> its extractor, "" when none is installed
+)
+
+// extraction is an archive whose contents are being sorted: where they were extracted to, and the
+// archives it is nested in
+type extraction struct {
+	dir    string
+	chain  string            // Archive names from the outermost, e.g. "backup.zip > 2019.zip"
+	depth  int               // 1 for an archive found in the source
+	budget *extractionBudget // Shared by all archives nested in the same outermost one
+}
+
+// extractionBudget is how much an outermost archive and the archives nested in it have extracted
+// (--archive-budget)
+type extractionBudget struct {
+	mu   sync.Mutex
+	used int64
+}
+
+var (
+	extractionsMu sync.Mutex
+	extractions   = make(map[string]*extraction) // Extraction dir -> extraction in progress
+)
+
+// beginExtraction registers the extraction of an archive into dir. An archive extracted from
+// another one is nested in it: it shares its budget, and is refused past --archive-depth.
+func beginExtraction(archivePath, dir string) (*extraction, error) {
+	e := &extraction{dir: dir, chain: filepath.Base(archivePath), depth: 1, budget: &extractionBudget{}}
+	if parent := extractionOf(archivePath); parent != nil {
+		e.chain = parent.chain + " > " + e.chain
+		e.depth = parent.depth + 1
+		e.budget = parent.budget
+	}
+	if e.depth > *archiveDepth {
+		return nil, fmt.Errorf("nested %d archives deep (%s), past --archive-depth %d", e.depth, e.chain, *archiveDepth)
+	}
+	extractionsMu.Lock()
+	extractions[dir] = e
+	extractionsMu.Unlock()
+	return e, nil
+}
+
+// innerPath returns where a file extracted by e was inside the archive, e.g. "Holiday/IMG_1.jpg"
+func (e *extraction) innerPath(path string) string {
+	rel, err := filepath.Rel(e.dir, path)
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// endExtraction forgets an extraction once its contents have been sorted
+func endExtraction(e *extraction) {
+	extractionsMu.Lock()
+	delete(extractions, e.dir)
+	extractionsMu.Unlock()
+}
+
+// extractionOf returns the extraction a file came out of, or nil for a file that is not from an
+// archive
+func extractionOf(path string) *extraction {
+	if !isRunTemp(path) {
+		return nil
+	}
+	extractionsMu.Lock()
+	defer extractionsMu.Unlock()
+	for dir, e := range extractions {
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return e
+		}
+	}
+	return nil
+}
+
+// spend charges extracted bytes to the budget, reporting false once --archive-budget is exceeded
+func (b *extractionBudget) spend(n int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used += n
+	return archiveBudget == 0 || b.used <= int64(archiveBudget)
+}
+
+// exceeds reports whether n more bytes would take the budget past --archive-budget
+func (b *extractionBudget) exceeds(n int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return archiveBudget > 0 && b.used+n > int64(archiveBudget)
+}
+
+// ratioMinSize is the size below which entries and archives are not checked for how much they
+// expand: small text files of spaces compress very well without being bombs
+const ratioMinSize = 1 << 20
+
+// archiveGuard checks the entries of an archive against the zip bomb limits before they are
+// written: how many there are, how much they expand, and where they would be written
+type archiveGuard struct {
+	dir     string // The extraction directory
+	size    int64  // The archive's own size
+	entries int
+	total   int64 // Bytes of the entries admitted so far
+	budget  *extractionBudget
+	free    int64 // Free space on the extraction volume less --space-margin, -1 when unknown
+}
+
+// newArchiveGuard starts checking the entries of an archive extracted to dir
+func newArchiveGuard(archivePath, dir string, e *extraction) *archiveGuard {
+	g := &archiveGuard{dir: dir, budget: e.budget, free: -1}
+	if info, err := os.Stat(archivePath); err == nil {
+		g.size = info.Size()
+	}
+	if free, err := freeSpace(runTmpDir); err == nil {
+		g.free = int64(free) - int64(spaceMargin)
+	}
+	return g
+}
+
+// admit checks an entry of size bytes (compressed to compressed bytes, 0 when unknown) and
+// returns where it is extracted to, or why the archive must not be extracted
+func (g *archiveGuard) admit(name string, size, compressed int64) (string, error) {
+	g.entries++
+	if *archiveMaxEntries > 0 && g.entries > *archiveMaxEntries {
+		return "", fmt.Errorf("more than %d entries, past --archive-max-entries", *archiveMaxEntries)
+	}
+	path, err := archiveEntryPath(g.dir, name)
+	if err != nil {
+		return "", err
+	}
+	return path, g.grow(name, size, compressed)
+}
+
+// grow adds size bytes of an entry to the contents checked against the limits
+func (g *archiveGuard) grow(name string, size, compressed int64) error {
+	g.total += size
+	if ratio := int64(*archiveMaxRatio); ratio > 0 {
+		if compressed > 0 && size > ratioMinSize && size/compressed > ratio {
+			return fmt.Errorf("entry '%s' expands %d times (%s from %s), past --archive-max-ratio %d", name, size/compressed, formatBytes(size), formatBytes(compressed), ratio)
+		}
+		if g.total > ratioMinSize && g.total/max(g.size, 1) > ratio {
+			return fmt.Errorf("contents expand more than %d times (%s from %s), past --archive-max-ratio", ratio, formatBytes(g.total), formatBytes(g.size))
+		}
+	}
+	if g.budget.exceeds(g.total) {
+		return fmt.Errorf("contents are past --archive-budget %s", archiveBudget.String())
+	}
+	if g.free >= 0 && g.total > g.free {
+		return fmt.Errorf("contents (over %s) do not fit in the free space of the destination volume", formatBytes(g.total))
+	}
+	return nil
+}
+
+// archiveEntryPath returns where an archive entry is extracted to in dir. Leading slashes are
+// dropped, as tar does; names that would climb out of dir ("../../.bashrc") are refused.
+func archiveEntryPath(dir, name string) (string, error) {
+	rel := filepath.FromSlash(strings.TrimLeft(strings.ReplaceAll(name, "\\", "/"), "/"))
+	if rel == "" || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("entry '%s' would be written outside the extraction folder", name)
+	}
+	return filepath.Join(dir, rel), nil
+}
+
+// archiveFormat names the format of an archive by its (possibly double) extension: photos.tar.gz
+// and photos.tgz are both gzip-compressed tar archives. It returns "" for formats that cannot be
+// extracted.
+func archiveFormat(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return formatZip
+	case strings.HasSuffix(name, ".tar"):
+		return formatTar
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return formatTarGz
+	case strings.HasSuffix(name, ".tar.bz2"), strings.HasSuffix(name, ".tbz2"), strings.HasSuffix(name, ".tbz"):
+		return formatTarBz2
+	case strings.HasSuffix(name, ".7z"):
+		return format7z
+	case strings.HasSuffix(name, ".rar"):
+		return formatRar
+	case strings.HasSuffix(name, ".gz"):
+		return formatGz
+	case strings.HasSuffix(name, ".bz2"):
+		return formatBz2
+	case strings.HasSuffix(name, ".xz"):
+		return formatXz // A .tar.xz gives a .tar, extracted in turn as a nested archive
+	}
+	return ""
+}
+
+// extractTar extracts a tar archive, gzip- or bzip2-compressed by format, to the specified
+// directory. Only regular files are extracted, keeping their modification time (NAS and Linux
+// backups often have nothing else to date a photo by). A damaged archive, or one with an entry the
+// guard refuses, is not extracted at all, so it is kept rather than deleted after a partial
+// extraction.
+func extractTar(tarPath, destDir, format string, g *archiveGuard) bool {
+	filename := filepath.Base(tarPath)
+	f, err := os.Open(tarPath)
+	if err != nil {
+		log.Printf("Error opening TAR file '%s': %v", filename, err)
+		return false
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReaderSize(f, 1<<20)
+	switch format {
+	case formatTarGz:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			log.Printf("Error opening TAR file '%s': %v", filename, err)
+			return false
+		}
+		defer gz.Close()
+		r = gz
+	case formatTarBz2:
+		r = bzip2.NewReader(r)
+	}
+
+	// Create destination directory
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		log.Printf("Error creating extraction directory '%s': %v", destDir, err)
+		return false
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			log.Printf("Error reading TAR file '%s': %v", filename, err)
+			return false
+		}
+		// Skip directories, links and devices
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		filePath, err := g.admit(hdr.Name, hdr.Size, 0)
+		if err != nil {
+			log.Printf("⚠️  Not extracting TAR file '%s': %v", filename, err)
+			return false
+		}
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			log.Printf("Error creating directory structure for '%s': %v", hdr.Name, err)
+			continue
+		}
+		outFile, err := os.Create(filePath)
+		if err != nil {
+			log.Printf("Error creating extracted file '%s': %v", filePath, err)
+			continue
+		}
+		_, err = io.Copy(outFile, tr)
+		outFile.Close()
+		if err != nil {
+			log.Printf("Error extracting file '%s': %v", hdr.Name, err)
+			os.Remove(filePath)
+			return false // The stream cannot be read past this point
+		}
+		os.Chtimes(filePath, hdr.ModTime, hdr.ModTime)
+		log.Printf("Extracted: %s", hdr.Name)
+	}
+}
+
+// archiveTool lists the external extractors tried, in order, for a format Go cannot read
+type archiveTool struct {
+	names []string
+	hint  string // What to install, for the warning when none is found
+}
+
+// archiveTools are the extractors of each format extracted with an external tool. bsdtar
+// (libarchive) reads both 7z and RAR; p7zip's 7za reads 7z only.
+var archiveTools = map[string]archiveTool{
+	format7z:  {names: []string{"7zz", "7z", "7za", "bsdtar"}, hint: "7-Zip or bsdtar"},
+	formatRar: {names: []string{"unrar", "7zz", "7z", "bsdtar"}, hint: "unrar, 7-Zip or bsdtar"},
+	formatXz:  {names: []string{"xz"}, hint: "xz-utils"},
+}
+
+// extractorTool locates the external extractor of a format, the first of its archiveTools found
+// on the PATH. It returns "" when none is installed.
+func extractorTool(format string) string {
+	extractorMu.Lock()
+	defer extractorMu.Unlock()
+	if p, ok := extractorPaths[format]; ok {
+		return p
+	}
+	tools := archiveTools[format]
+	for _, name := range tools.names {
+		if p, err := exec.LookPath(name); err == nil {
+			extractorPaths[format] = p
+			log.Printf("%s extraction will use '%s'", strings.ToUpper(format), p)
+			return p
+		}
+	}
+	extractorPaths[format] = ""
+	name := strings.ToUpper(format)
+	log.Printf("⚠️  No %s extractor found (install %s); %s archives will be moved to the archives folder", name, tools.hint, name)
+	return ""
+}
+
+// extractExternal extracts a 7z or RAR archive to the specified directory with its extractorTool.
+// The tool's listing of the archive goes through the guard first, and what it then writes is held
+// to that listing, so a bomb is refused like a ZIP or TAR one. An archive the tool reports errors
+// for is not used, so it is kept rather than deleted after a partial extraction.
+func extractExternal(archivePath, destDir, format string, g *archiveGuard) bool {
+	tool := extractorTool(format)
+	if tool == "" {
+		return false
+	}
+	filename, name := filepath.Base(archivePath), strings.ToUpper(format)
+	entries, err := listExternal(tool, archivePath)
+	if err != nil {
+		log.Printf("Error listing %s file '%s': %v", name, filename, err)
+		return false
+	}
+	for _, entry := range entries {
+		if _, err := g.admit(entry.name, entry.size, entry.compressed); err != nil {
+			log.Printf("⚠️  Not extracting %s file '%s': %v", name, filename, err)
+			return false
+		}
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		log.Printf("Error creating extraction directory '%s': %v", destDir, err)
+		return false
+	}
+	if err := runExtractor(tool, archivePath, destDir); err != nil {
+		log.Printf("Error extracting %s file '%s': %v", name, filename, err)
+		return false
+	}
+	files, size := extractedTree(destDir)
+	if files > g.entries || size > g.total {
+		log.Printf("⚠️  Not using %s file '%s': it extracted %d files (%s) where its listing showed %d (%s)", name, filename, files, formatBytes(size), g.entries, formatBytes(g.total))
+		return false
+	}
+	return true
+}
+
+// archiveEntry is a file in an archive as an external extractor lists it
+type archiveEntry struct {
+	name       string
+	size       int64
+	compressed int64 // 0 when the tool does not tell, as for files in a solid block
+}
+
+// listExternal lists the files in an archive with an external extractor (unrar, 7-Zip or bsdtar)
+// without extracting anything
+func listExternal(tool, archivePath string) ([]archiveEntry, error) {
+	var args []string
+	var parse func(string) []archiveEntry
+	switch name := filepath.Base(tool); {
+	case strings.HasPrefix(name, "bsdtar"):
+		args, parse = []string{"-t", "-v", "-f", archivePath}, parseBsdtarList
+	case strings.HasPrefix(name, "unrar"):
+		args, parse = []string{"lt", "-p-", archivePath}, parseUnrarList
+	default:
+		args, parse = []string{"l", "-slt", archivePath}, parse7zList
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(tool, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", filepath.Base(tool), err, strings.TrimSpace(stderr.String()))
+	}
+	return parse(stdout.String()), nil
+}
+
+// parse7zList reads the files from 7-Zip's technical listing (7z l -slt): one "Key = value" block
+// per entry after the "----------" line, which ends the block describing the archive itself
+func parse7zList(out string) []archiveEntry {
+	_, out, _ = strings.Cut(strings.ReplaceAll(out, "\r\n", "\n"), "\n----------\n")
+	var entries []archiveEntry
+	for _, block := range strings.Split(out, "\n\n") {
+		var entry archiveEntry
+		dir := false
+		for _, line := range strings.Split(block, "\n") {
+			key, value, _ := strings.Cut(line, " = ")
+			switch key {
+			case "Path":
+				entry.name = value
+			case "Size":
+				entry.size, _ = strconv.ParseInt(value, 10, 64)
+			case "Packed Size":
+				entry.compressed, _ = strconv.ParseInt(value, 10, 64)
+			case "Folder":
+				dir = dir || value == "+"
+			case "Attributes":
+				dir = dir || strings.HasPrefix(value, "D")
+			}
+		}
+		if entry.name != "" && !dir {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// parseUnrarList reads the files from unrar's technical listing (unrar lt): "Key: value" lines,
+// starting with "Name" for each entry
+func parseUnrarList(out string) []archiveEntry {
+	var entries []archiveEntry
+	var entry *archiveEntry
+	for _, line := range strings.Split(out, "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), ": ")
+		switch {
+		case key == "Name":
+			entries = append(entries, archiveEntry{name: value})
+			entry = &entries[len(entries)-1]
+		case entry == nil:
+		case key == "Type" && value != "File":
+			entries, entry = entries[:len(entries)-1], nil // Directories and links
+		case key == "Size":
+			entry.size, _ = strconv.ParseInt(value, 10, 64)
+		case key == "Packed size":
+			entry.compressed, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	return entries
+}
+
+// bsdtarListLine is a regular file in bsdtar's verbose listing, as ls -l prints it: mode, links,
+// owner, group, size, three date fields, then the name
+var bsdtarListLine = regexp.MustCompile(`^-\S*\s+\d+\s+\S+\s+\S+\s+(\d+)\s+\S+\s+\S+\s+\S+\s(.+)$`)
+
+// parseBsdtarList reads the files from bsdtar's verbose listing (bsdtar -tvf), which has no
+// compressed sizes
+func parseBsdtarList(out string) []archiveEntry {
+	var entries []archiveEntry
+	for _, line := range strings.Split(out, "\n") {
+		if m := bsdtarListLine.FindStringSubmatch(strings.TrimRight(line, "\r")); m != nil {
+			size, _ := strconv.ParseInt(m[1], 10, 64)
+			entries = append(entries, archiveEntry{name: m[2], size: size})
+		}
+	}
+	return entries
+}
+
+// extractedTree counts the regular files under dir and their bytes
+func extractedTree(dir string) (int, int64) {
+	files, size := 0, int64(0)
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				files++
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return files, size
+}
+
+// runExtractor runs an external extractor (unrar, 7-Zip or bsdtar) on an archive. Its standard
+// input is empty, so an archive asking for a password fails instead of waiting for one.
+func runExtractor(tool, archivePath, destDir string) error {
+	var args []string
+	switch name := filepath.Base(tool); {
+	case strings.HasPrefix(name, "bsdtar"):
+		args = []string{"-x", "-f", archivePath, "-C", destDir}
+	case strings.HasPrefix(name, "unrar"):
+		args = []string{"x", "-y", "-p-", archivePath, destDir + string(filepath.Separator)}
+	default:
+		args = []string{"x", "-y", "-o" + destDir, archivePath}
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(tool, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %v: %s", filepath.Base(tool), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// extractCompressed decompresses a single gzip-, bzip2- or xz-compressed file (photo.jpg.gz) to
+// the specified directory, under its name without the compression extension, so it is sorted like
+// any other file. It keeps the modification time the gzip header records, or else the compressed
+// file's. Output is capped by --archive-max-ratio as it is written, since its size is not known
+// beforehand.
+func extractCompressed(path, destDir, format string, g *archiveGuard) bool {
+	filename := filepath.Base(path)
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("Error opening compressed file '%s': %v", filename, err)
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		log.Printf("Error opening compressed file '%s': %v", filename, err)
+		return false
+	}
+	modTime := info.ModTime()
+
+	var r io.Reader = bufio.NewReaderSize(f, 1<<20)
+	var wait func() error
+	stop := func() {} // Abandons decompression before the end of the output
+	switch format {
+	case formatGz:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			log.Printf("Error opening compressed file '%s': %v", filename, err)
+			return false
+		}
+		defer gz.Close()
+		gz.Multistream(true)
+		if !gz.ModTime.IsZero() {
+			modTime = gz.ModTime
+		}
+		r = gz
+	case formatBz2:
+		r = bzip2.NewReader(r)
+	case formatXz:
+		tool := extractorTool(format)
+		if tool == "" {
+			return false
+		}
+		var stderr bytes.Buffer
+		cmd := exec.Command(tool, "-dc")
+		cmd.Stdin, cmd.Stderr = r, &stderr
+		out, err := cmd.StdoutPipe()
+		if err != nil || cmd.Start() != nil {
+			log.Printf("Error decompressing '%s' with '%s'", filename, tool)
+			return false
+		}
+		r = out
+		wait = func() error {
+			if err := cmd.Wait(); err != nil {
+				return fmt.Errorf("%s: %v: %s", filepath.Base(tool), err, strings.TrimSpace(stderr.String()))
+			}
+			return nil
+		}
+		stop = func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}
+	}
+
+	name := filename[:len(filename)-len(filepath.Ext(filename))]
+	if name == "" {
+		name = "decompressed"
+	}
+	filePath, err := g.admit(name, 0, 0)
+	if err == nil {
+		err = os.MkdirAll(destDir, 0755)
+	}
+	if err != nil {
+		log.Printf("⚠️  Not decompressing '%s': %v", filename, err)
+		stop()
+		return false
+	}
+
+	// Without --archive-max-ratio the output is not capped; with it, one byte past the limit is
+	// read to tell a file of exactly the limit from a bomb, which is abandoned there
+	src, limit := r, int64(-1)
+	if *archiveMaxRatio > 0 {
+		limit = max(g.size*int64(*archiveMaxRatio), ratioMinSize)
+		src = io.LimitReader(r, limit+1)
+	}
+	outFile, err := os.Create(filePath)
+	if err != nil {
+		log.Printf("Error creating extracted file '%s': %v", filePath, err)
+		stop()
+		return false
+	}
+	n, err := io.Copy(outFile, src)
+	outFile.Close()
+	if limit >= 0 && n > limit {
+		err = fmt.Errorf("expands more than %d times, past --archive-max-ratio", *archiveMaxRatio)
+		stop()
+		wait = nil
+	} else if err != nil {
+		stop()
+		wait = nil
+	} else {
+		err = g.grow(name, n, info.Size())
+	}
+	if wait != nil {
+		if werr := wait(); err == nil {
+			err = werr
+		}
+	}
+	if err != nil {
+		log.Printf("Error decompressing '%s': %v", filename, err)
+		os.Remove(filePath)
+		return false
+	}
+	os.Chtimes(filePath, modTime, modTime)
+	log.Printf("Decompressed: %s", name)
+	return true
+}
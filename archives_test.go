@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeGzip compresses data into name.gz in dir and returns its path
+func writeGzip(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	path := filepath.Join(dir, name+".gz")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractCompressedRatioLimit(t *testing.T) {
+	photo := bytes.Repeat([]byte("not really a photo "), 1000)
+	bomb := make([]byte, 8<<20) // Zeros compress about a thousand times
+
+	tests := []struct {
+		name  string
+		ratio int
+		data  []byte
+		ok    bool
+	}{
+		{"no limit", 0, photo, true},
+		{"no limit with a bomb", 0, bomb, true}, // --archive-max-ratio 0 disables the check
+		{"under the limit", 100, photo, true},
+		{"bomb past the limit", 100, bomb, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := *archiveMaxRatio
+			*archiveMaxRatio = tt.ratio
+			t.Cleanup(func() { *archiveMaxRatio = saved })
+
+			src, out := t.TempDir(), t.TempDir()
+			path := writeGzip(t, src, "IMG_0001.jpg", tt.data)
+			info, _ := os.Stat(path)
+			g := &archiveGuard{dir: out, size: info.Size(), budget: &extractionBudget{}, free: -1}
+
+			if got := extractCompressed(path, out, formatGz, g); got != tt.ok {
+				t.Fatalf("extractCompressed = %v, want %v", got, tt.ok)
+			}
+			got, err := os.ReadFile(filepath.Join(out, "IMG_0001.jpg"))
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("output of a refused file was left behind (%d bytes)", len(got))
+				}
+				return
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("decompressed %d bytes, want %d", len(got), len(tt.data))
+			}
+		})
+	}
+}
+
+func TestParseExtractorLists(t *testing.T) {
+	sevenZip := `
+7-Zip (z) 23.01 (x64) : Copyright (c) 1999-2023 Igor Pavlov : 2023-06-20
+
+Scanning the drive for archives:
+1 file, 22684 bytes (23 KiB)
+
+Listing archive: backup.7z
+
+--
+Path = backup.7z
+Type = 7z
+Physical Size = 22684
+Solid = +
+Blocks = 1
+
+----------
+Path = DCIM
+Size = 0
+Packed Size = 0
+Attributes = D_ drwxr-xr-x
+
+Path = DCIM/IMG 0001.jpg
+Size = 30000000
+Packed Size = 22100
+Attributes = A_ -rw-r--r--
+
+Path = DCIM/IMG_0002.jpg
+Size = 54191
+Packed Size = 
+Attributes = A_ -rw-r--r--
+
+`
+	unrar := `
+UNRAR 6.24 freeware      Copyright (c) 1993-2023 Alexander Roshal
+
+Archive: backup.rar
+Details: RAR 5
+
+        Name: DCIM/IMG 0001.jpg
+        Type: File
+        Size: 30000000
+ Packed size: 22100
+       Ratio: 0%
+       mtime: 2019-07-04 10:00:00,000000000
+  Attributes: -rw-r--r--
+
+        Name: DCIM
+        Type: Directory
+  Attributes: drwxr-xr-x
+
+        Name: DCIM/IMG_0002.jpg
+        Type: File
+        Size: 54191
+ Packed size: 54000
+       Ratio: 99%
+`
+	bsdtar := "-rw-r--r--  0 0      0    30000000 Oct 16 19:55 ./DCIM/IMG 0001.jpg\n" +
+		"drwxr-xr-x  0 0      0           0 Oct 16 19:55 ./DCIM/\n" +
+		"-rw-r--r--  0 user   staff    54191 Jul  4  2019 ./DCIM/IMG_0002.jpg\n"
+
+	tests := []struct {
+		name  string
+		parse func(string) []archiveEntry
+		out   string
+		want  []archiveEntry
+	}{
+		{"7z", parse7zList, sevenZip, []archiveEntry{{"DCIM/IMG 0001.jpg", 30000000, 22100}, {"DCIM/IMG_0002.jpg", 54191, 0}}},
+		{"7z on Windows", parse7zList, strings.ReplaceAll(sevenZip, "\n", "\r\n"), []archiveEntry{{"DCIM/IMG 0001.jpg", 30000000, 22100}, {"DCIM/IMG_0002.jpg", 54191, 0}}},
+		{"unrar", parseUnrarList, unrar, []archiveEntry{{"DCIM/IMG 0001.jpg", 30000000, 22100}, {"DCIM/IMG_0002.jpg", 54191, 54000}}},
+		{"bsdtar", parseBsdtarList, bsdtar, []archiveEntry{{"./DCIM/IMG 0001.jpg", 30000000, 0}, {"./DCIM/IMG_0002.jpg", 54191, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.parse(tt.out)
+			if len(got) != len(tt.want) {
+				t.Fatalf("listed %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("entry %d is %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExtractExternalRatioLimit(t *testing.T) {
+	if _, err := exec.LookPath("bsdtar"); err != nil {
+		t.Skip("bsdtar is not installed")
+	}
+	src := t.TempDir()
+	os.WriteFile(filepath.Join(src, "IMG_0001.jpg"), make([]byte, 8<<20), 0644)
+	archive := filepath.Join(t.TempDir(), "backup.7z")
+	if out, err := exec.Command("bsdtar", "--format", "7zip", "-cf", archive, "-C", src, ".").CombinedOutput(); err != nil {
+		t.Fatalf("creating the archive: %v: %s", err, out)
+	}
+	saved, savedTools := *archiveMaxRatio, extractorPaths
+	extractorPaths = map[string]string{format7z: "bsdtar"}
+	t.Cleanup(func() { *archiveMaxRatio, extractorPaths = saved, savedTools })
+
+	for _, ratio := range []int{0, 100} {
+		*archiveMaxRatio = ratio
+		out := t.TempDir()
+		info, _ := os.Stat(archive)
+		g := &archiveGuard{dir: out, size: info.Size(), budget: &extractionBudget{}, free: -1}
+		got := extractExternal(archive, out, format7z, g)
+		if want := ratio == 0; got != want {
+			t.Errorf("--archive-max-ratio %d: extractExternal = %v, want %v", ratio, got, want)
+		}
+		if _, err := os.Stat(filepath.Join(out, "IMG_0001.jpg")); (err == nil) != got {
+			t.Errorf("--archive-max-ratio %d: extracted file present: %v", ratio, err == nil)
+		}
+	}
+}
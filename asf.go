@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ASF object GUIDs, as stored in the file
+var (
+	asfHeaderObject         = []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11, 0xA6, 0xD9, 0x00, 0xAA, 0x00, 0x62, 0xCE, 0x6C}
+	asfFilePropertiesObject = []byte{0xA1, 0xDC, 0xAB, 0x8C, 0x47, 0xA9, 0xCF, 0x11, 0x8E, 0xE4, 0x00, 0xC0, 0x0C, 0x20, 0x53, 0x65}
+)
+
+// filetimeUnixEpoch is the Unix epoch as a Windows FILETIME: 100-nanosecond units since 1601, the
+// unit of the ASF creation date
+const filetimeUnixEpoch = 116444736000000000
+
+// extractASFCreationTime reads the creation date of the File Properties Object in a WMV/ASF's
+// header: when the recording was made
+func extractASFCreationTime(path string) (time.Time, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("Error opening WMV/ASF file for metadata reading: %s: %v", filepath.Base(path), err)
+		return time.Time{}, false
+	}
+	defer f.Close()
+
+	// Header Object: GUID, size, number of objects and two reserved bytes, then the objects
+	header := make([]byte, 30)
+	if _, err := f.ReadAt(header, 0); err != nil || !bytes.Equal(header[0:16], asfHeaderObject) {
+		return time.Time{}, false
+	}
+	headerEnd := int64(binary.LittleEndian.Uint64(header[16:24]))
+	obj := make([]byte, 92)
+	for offset := int64(30); offset+24 <= headerEnd; {
+		if _, err := f.ReadAt(obj[:24], offset); err != nil {
+			return time.Time{}, false
+		}
+		size := int64(binary.LittleEndian.Uint64(obj[16:24]))
+		if size < 24 {
+			return time.Time{}, false
+		}
+		if !bytes.Equal(obj[0:16], asfFilePropertiesObject) {
+			offset += size
+			continue
+		}
+		if size < int64(len(obj)) {
+			return time.Time{}, false
+		}
+		if _, err := f.ReadAt(obj, offset); err != nil {
+			return time.Time{}, false
+		}
+		created := binary.LittleEndian.Uint64(obj[48:56])
+		// Live broadcasts (flag bit 0) leave the creation date undefined
+		if created <= filetimeUnixEpoch || binary.LittleEndian.Uint32(obj[88:92])&1 != 0 {
+			log.Printf("No creation date in the File Properties of WMV/ASF file: %s", filepath.Base(path))
+			return time.Time{}, false
+		}
+		since := created - filetimeUnixEpoch
+		ct := time.Unix(int64(since/10_000_000), int64(since%10_000_000)*100).UTC()
+		log.Printf("Extracted creation time (File Properties) from %s: %s", filepath.Base(path), ct.Format(time.RFC3339))
+		return ct, true
+	}
+	log.Printf("No File Properties found in WMV/ASF file: %s", filepath.Base(path))
+	return time.Time{}, false
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// audioExts are the audio files sorted with --audio: voice memos and recordings from phones and
+// recorders. Without it they are handled like other unrecognized files.
+var audioExts = map[string]bool{".m4a": true, ".mp3": true, ".wav": true, ".amr": true, ".opus": true}
+
+// audioDir holds audio files by year, apart from the photos (--audio)
+var audioDir = filepath.Join(destDir, "audio")
+
+// audioTagLayouts are the forms recording dates take in audio tags, most precise first
+var audioTagLayouts = []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02", "2006-01", "2006"}
+
+// audioScanLen bounds how much of a file is read for its tags
+const audioScanLen = 1 << 20
+
+// audioFolder is the folder an audio file goes to: audio/<year>, or audio/no_date
+func audioFolder(date dateInfo) string {
+	if date.Year == "" || date.Year == "none" {
+		return filepath.Join(audioDir, "no_date")
+	}
+	return filepath.Join(audioDir, date.Year)
+}
+
+// getAudioDate reads the recording date from an audio file's tags: the MP4 metadata of M4A voice
+// memos, ID3 in MP3s, Broadcast WAV and INFO chunks in WAVs, and Vorbis comments in Opus files.
+// AMR has no tags; it is dated by its name like any file.
+func getAudioDate(path string) dateInfo {
+	filename := filepath.Base(path)
+	var t time.Time
+	var source string
+	var zoned, utc, found bool
+	switch mediaExt(path) {
+	case ".m4a":
+		t, source, zoned, utc, found = isoMediaDate(path)
+	case ".mp3":
+		t, source, found = id3Date(path)
+	case ".wav":
+		t, source, found = wavDate(path)
+	case ".opus":
+		t, source, found = opusDate(path)
+	default:
+		return dateInfo{}
+	}
+	if !found {
+		log.Printf("✗ No recording date found in the tags of %s", filename)
+		return dateInfo{}
+	}
+	if utc {
+		t, zoned = inVideoZone(t)
+	}
+	if year := t.Year(); year <= 1900 || year > time.Now().Year()+1 {
+		log.Printf("⚠ Invalid recording year (%d) for %s, treating as no date", year, filename)
+		return dateInfo{}
+	}
+	log.Printf("✓ Found recording date for %s: %d (%s)", filename, t.Year(), source)
+	return dateInfo{Year: strconv.Itoa(t.Year()), Source: source, Time: t, Zoned: zoned}
+}
+
+// parseAudioTagDate parses a tag's date as a wall-clock time
+func parseAudioTagDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(strings.TrimRight(value, "\x00"))
+	for _, layout := range audioTagLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// id3Date reads the recording date from an MP3's ID3v2 tag: TDRC (or TDOR) in ID3v2.4, and
+// TYER with TDAT and TIME in ID3v2.3 (TYE, TDA and TIM in ID3v2.2)
+func id3Date(path string) (time.Time, string, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	defer f.Close()
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(f, header); err != nil || string(header[0:3]) != "ID3" {
+		return time.Time{}, "", false
+	}
+	version, flags := header[3], header[5]
+	size := int(synchsafe(header[6:10]))
+	if size > audioScanLen {
+		size = audioScanLen
+	}
+	tag := make([]byte, size)
+	n, _ := io.ReadFull(f, tag)
+	tag = tag[:n]
+	if flags&0x40 != 0 && version >= 3 && len(tag) >= 4 { // Extended header
+		skip := int(binary.BigEndian.Uint32(tag[0:4])) + 4
+		if version == 4 {
+			skip = int(synchsafe(tag[0:4]))
+		}
+		if skip > len(tag) {
+			return time.Time{}, "", false
+		}
+		tag = tag[skip:]
+	}
+
+	frames := make(map[string]string)
+	idLen, hdrLen := 4, 10
+	if version == 2 {
+		idLen, hdrLen = 3, 6
+	}
+	for pos := 0; pos+hdrLen <= len(tag) && tag[pos] != 0; {
+		id := string(tag[pos : pos+idLen])
+		var frameSize int
+		switch version {
+		case 2:
+			frameSize = int(tag[pos+3])<<16 | int(tag[pos+4])<<8 | int(tag[pos+5])
+		case 4:
+			frameSize = int(synchsafe(tag[pos+4 : pos+8]))
+		default:
+			frameSize = int(binary.BigEndian.Uint32(tag[pos+4 : pos+8]))
+		}
+		start := pos + hdrLen
+		if frameSize <= 0 || start+frameSize > len(tag) {
+			break
+		}
+		if id[0] == 'T' {
+			frames[id] = id3Text(tag[start : start+frameSize])
+		}
+		pos = start + frameSize
+	}
+
+	for _, id := range []string{"TDRC", "TDOR"} {
+		if t, ok := parseAudioTagDate(frames[id]); ok {
+			return t, "ID3 " + id, true
+		}
+	}
+	year, date, clock := frames["TYER"], frames["TDAT"], frames["TIME"]
+	if version == 2 {
+		year, date, clock = frames["TYE"], frames["TDA"], frames["TIM"]
+	}
+	if len(year) != 4 {
+		return time.Time{}, "", false
+	}
+	value := year
+	if len(date) == 4 { // DDMM
+		value += "-" + date[2:4] + "-" + date[0:2]
+		if len(clock) == 4 { // HHMM
+			value += "T" + clock[0:2] + ":" + clock[2:4]
+		}
+	}
+	if t, ok := parseAudioTagDate(value); ok {
+		return t, "ID3 TYER", true
+	}
+	return time.Time{}, "", false
+}
+
+// synchsafe decodes an ID3 synchsafe integer: 7 bits per byte
+func synchsafe(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<7 | uint32(c&0x7F)
+	}
+	return v
+}
+
+// id3Text decodes an ID3 text frame: an encoding byte (ISO-8859-1, UTF-16 with a byte order
+// mark, UTF-16BE or UTF-8), then the text
+func id3Text(frame []byte) string {
+	if len(frame) < 1 {
+		return ""
+	}
+	text := frame[1:]
+	switch frame[0] {
+	case 1, 2:
+		order := binary.ByteOrder(binary.BigEndian)
+		if len(text) >= 2 && text[0] == 0xFF && text[1] == 0xFE {
+			order, text = binary.LittleEndian, text[2:]
+		} else if len(text) >= 2 && text[0] == 0xFE && text[1] == 0xFF {
+			text = text[2:]
+		}
+		units := make([]uint16, 0, len(text)/2)
+		for i := 0; i+1 < len(text); i += 2 {
+			units = append(units, order.Uint16(text[i:]))
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+	case 3:
+		return strings.TrimRight(string(text), "\x00")
+	}
+	runes := make([]rune, len(text))
+	for i, c := range text {
+		runes[i] = rune(c)
+	}
+	return strings.TrimRight(string(runes), "\x00")
+}
+
+// wavDate reads the recording date from a WAV's Broadcast WAV (bext) chunk, which field recorders
+// write, or its INFO list's ICRD
+func wavDate(path string) (time.Time, string, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	header := make([]byte, 12)
+	if _, err := f.ReadAt(header, 0); err != nil || string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return time.Time{}, "", false
+	}
+	var icrd string
+	chunk := make([]byte, 8)
+	for offset := int64(12); offset+8 <= info.Size(); {
+		if _, err := f.ReadAt(chunk, offset); err != nil {
+			break
+		}
+		id, size := string(chunk[0:4]), int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		data := offset + 8
+		switch {
+		case id == "bext" && size >= 338:
+			// Description (256), originator (32), its reference (32), then the date and time
+			stamp := make([]byte, 18)
+			if _, err := f.ReadAt(stamp, data+320); err == nil {
+				// The standard allows any separator in yyyy-mm-dd and hh:mm:ss
+				stamp[4], stamp[7], stamp[12], stamp[15] = '-', '-', ':', ':'
+				date, clock := string(stamp[0:10]), string(stamp[10:18])
+				if t, ok := parseAudioTagDate(date + " " + clock); ok {
+					return t, "BWF OriginationDate", true
+				}
+				if t, ok := parseAudioTagDate(date); ok {
+					return t, "BWF OriginationDate", true
+				}
+			}
+		case id == "LIST" && size >= 4 && size <= maxMetadataSize:
+			list := make([]byte, size)
+			if _, err := f.ReadAt(list, data); err == nil && string(list[0:4]) == "INFO" {
+				for pos := 4; pos+8 <= len(list); {
+					subSize := int(binary.LittleEndian.Uint32(list[pos+4 : pos+8]))
+					if pos+8+subSize > len(list) {
+						break
+					}
+					if string(list[pos:pos+4]) == "ICRD" {
+						icrd = string(list[pos+8 : pos+8+subSize])
+					}
+					pos += 8 + subSize + subSize&1
+				}
+			}
+		}
+		offset = data + size + size&1 // Chunks are padded to an even size
+	}
+	if t, ok := parseAudioTagDate(icrd); ok {
+		return t, "WAV INFO ICRD", true
+	}
+	return time.Time{}, "", false
+}
+
+// opusDate reads the DATE Vorbis comment of an Ogg Opus file's OpusTags header
+func opusDate(path string) (time.Time, string, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	defer f.Close()
+	head, _ := io.ReadAll(io.LimitReader(f, audioScanLen))
+	i := bytes.Index(head, []byte("OpusTags"))
+	if !bytes.HasPrefix(head, []byte("OggS")) || i < 0 {
+		return time.Time{}, "", false
+	}
+	// The vendor string, then a count of KEY=value comments, all with 32-bit little-endian lengths.
+	// A header spanning Ogg pages is cut by page headers; the date is usually among the first comments.
+	tags := head[i+8:]
+	next := func() ([]byte, bool) {
+		if len(tags) < 4 {
+			return nil, false
+		}
+		n := int(binary.LittleEndian.Uint32(tags))
+		if n > len(tags)-4 {
+			return nil, false
+		}
+		v := tags[4 : 4+n]
+		tags = tags[4+n:]
+		return v, true
+	}
+	if _, ok := next(); !ok || len(tags) < 4 {
+		return time.Time{}, "", false
+	}
+	count := binary.LittleEndian.Uint32(tags)
+	tags = tags[4:]
+	for ; count > 0; count-- {
+		comment, ok := next()
+		if !ok {
+			break
+		}
+		key, value, _ := strings.Cut(string(comment), "=")
+		if strings.EqualFold(key, "DATE") {
+			if t, ok := parseAudioTagDate(value); ok {
+				return t, "OpusTags DATE", true
+			}
+		}
+	}
+	return time.Time{}, "", false
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// mdpmUUID marks the H.264 SEI message in which AVCHD camcorders record the modified DV pack
+// metadata (MDPM), which holds the recording date
+var mdpmUUID = []byte{0x17, 0xEE, 0x8C, 0x60, 0xF8, 0x4D, 0x11, 0xD9, 0x8C, 0xD6, 0x08, 0x00, 0x20, 0x0C, 0x9A, 0x66}
+
+// avchdScanLen is how much of an AVCHD stream is searched for the MDPM. Camcorders repeat it with
+// every keyframe, so the first one is near the start.
+const avchdScanLen = 8 << 20
+
+// extractAVCHDCreationTime reads the recording date an AVCHD camcorder (.mts/.m2ts) writes into
+// the H.264 video of the MPEG transport stream. The date is the camera's wall clock.
+func extractAVCHDCreationTime(path string) (time.Time, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("Error opening AVCHD file for metadata reading: %s: %v", filepath.Base(path), err)
+		return time.Time{}, false
+	}
+	defer f.Close()
+
+	video := transportStreamVideo(io.LimitReader(f, avchdScanLen))
+	for len(video) > 0 {
+		i := bytes.Index(video, mdpmUUID)
+		if i < 0 {
+			break
+		}
+		video = video[i+len(mdpmUUID):]
+		if t, ok := mdpmDate(video); ok {
+			log.Printf("Extracted creation time (AVCHD MDPM) from %s: %s", filepath.Base(path), t.Format("2006-01-02 15:04:05"))
+			return t, true
+		}
+	}
+	log.Printf("No recording date (MDPM) found in AVCHD file: %s", filepath.Base(path))
+	return time.Time{}, false
+}
+
+// transportStreamVideo gathers the payload of the first video stream of an MPEG transport stream,
+// with 188-byte packets (.ts) or the 192-byte packets of AVCHD (.m2ts), which start with a
+// 4-byte timestamp. It returns nil for anything else.
+func transportStreamVideo(r io.Reader) []byte {
+	data, err := io.ReadAll(r)
+	if err != nil && len(data) == 0 {
+		return nil
+	}
+	packetSize, sync := 0, 0
+	for _, size := range []int{192, 188} {
+		sync = size - 188
+		if len(data) >= 3*size && data[sync] == 0x47 && data[sync+size] == 0x47 && data[sync+2*size] == 0x47 {
+			packetSize = size
+			break
+		}
+	}
+	if packetSize == 0 {
+		return nil
+	}
+	var video []byte
+	videoPID := -1
+	for offset := sync; offset+188 <= len(data); offset += packetSize {
+		packet := data[offset : offset+188]
+		if packet[0] != 0x47 {
+			break // Lost sync
+		}
+		start := packet[1]&0x40 != 0
+		pid := int(packet[1]&0x1F)<<8 | int(packet[2])
+		payload := packet[4:]
+		switch packet[3] & 0x30 {
+		case 0x10: // Payload only
+		case 0x30: // Adaptation field, then payload
+			if int(payload[0]) >= len(payload) {
+				continue
+			}
+			payload = payload[1+int(payload[0]):]
+		default:
+			continue
+		}
+		if videoPID < 0 && start && len(payload) >= 9 && bytes.HasPrefix(payload, []byte{0, 0, 1}) && payload[3]&0xF0 == 0xE0 {
+			videoPID = pid // The first PES packet of a video stream
+		}
+		if pid != videoPID {
+			continue
+		}
+		if start && len(payload) >= 9 {
+			// Skip the PES header to the elementary stream
+			if headerEnd := 9 + int(payload[8]); headerEnd <= len(payload) {
+				payload = payload[headerEnd:]
+			}
+		}
+		video = append(video, payload...)
+	}
+	return video
+}
+
+// mdpmDate reads the recording date from the MDPM following its UUID: "MDPM", a count, then
+// 5-byte entries of a tag and 4 bytes. Tag 0x18 holds the time zone, year and month, and tag 0x19
+// the day and time, all in BCD.
+func mdpmDate(sei []byte) (time.Time, bool) {
+	sei = unescapeNAL(sei, 4+1+255*5)
+	if len(sei) < 5 || string(sei[0:4]) != "MDPM" {
+		return time.Time{}, false
+	}
+	entries := sei[5:]
+	var date, clock []byte
+	for n := int(sei[4]); n > 0 && len(entries) >= 5; n-- {
+		switch entries[0] {
+		case 0x18:
+			date = entries[1:5]
+		case 0x19:
+			clock = entries[1:5]
+		}
+		entries = entries[5:]
+	}
+	if date == nil || clock == nil {
+		return time.Time{}, false
+	}
+	fields := []int{bcd(date[1])*100 + bcd(date[2]), bcd(date[3]), bcd(clock[0]), bcd(clock[1]), bcd(clock[2]), bcd(clock[3])}
+	year, month, day, hour, minute, second := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5]
+	for _, v := range fields {
+		if v < 0 {
+			return time.Time{}, false
+		}
+	}
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, false
+	}
+	return time.Date(year, time.Month(month), day, hour, minute, second, 0, time.Local), true
+}
+
+// unescapeNAL removes the emulation prevention bytes (0x03 after two zero bytes) from the start of
+// an H.264 NAL unit, returning at most max bytes
+func unescapeNAL(nal []byte, max int) []byte {
+	out := make([]byte, 0, max)
+	zeros := 0
+	for _, b := range nal {
+		if len(out) == max {
+			break
+		}
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// bcd decodes a binary-coded decimal byte, or returns -1 when it is not one
+func bcd(b byte) int {
+	hi, lo := int(b>>4), int(b&0x0F)
+	if hi > 9 || lo > 9 {
+		return -1
+	}
+	return hi*10 + lo
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// yearFolder is the destination folder of a file with date: the folder of its year, or a subfolder
+// of it for WhatsApp media (--whatsapp-subfolder), the event (--layout events), the place
+// (--place-folders) and the camera (--camera-folders), in that order:
+// 2022/2022-04-01_Event/Japan/Tokyo/Pixel 6
+func yearFolder(path string, date dateInfo) string {
+	if *whatsappSubfolder && isWhatsApp(path) {
+		return filepath.Join(destDir, date.Year, whatsappFolder)
+	}
+	folder := filepath.Join(destDir, date.Year)
+	if *layout == layoutEvents && !date.Time.IsZero() {
+		folder = filepath.Join(folder, eventFolder(date.Year, date.Time))
+	}
+	if !*placeFolders && !*cameraFolders {
+		return folder
+	}
+	x := photoExif(path)
+	if x == nil {
+		return folder
+	}
+	if *placeFolders {
+		if place := placeFolder(x); place != "" {
+			folder = filepath.Join(folder, place)
+		}
+	}
+	if *cameraFolders {
+		if camera := cameraFolderName(x); camera != "" {
+			folder = filepath.Join(folder, camera)
+		}
+	}
+	return folder
+}
+
+// inYearFolder reports whether a file was sorted into the folder of year or one of its subfolders.
+// It looks at the folder alone: once a file is moved its source can no longer be read for yearFolder.
+func inYearFolder(folder, year string) bool {
+	yearDir := filepath.Join(destDir, year)
+	return folder == yearDir || strings.HasPrefix(folder, yearDir+string(filepath.Separator))
+}
+
+// photoExif reads the EXIF of a photo, or nil for other files and photos without any
+func photoExif(path string) *exif.Exif {
+	ext := mediaExt(path)
+	if !imageExts[ext] {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	x, _, err := decodeExif(f, ext)
+	if err != nil {
+		return nil
+	}
+	return x
+}
+
+// cameraFolderName names the folder of the camera that took a photo after its EXIF Model
+// ("Pixel 6", "Canon EOS R5"), or "" when the file does not say
+func cameraFolderName(x *exif.Exif) string {
+	model := strings.Join(strings.Fields(exifString(x, exif.Model)), " ")
+	if model == "" {
+		return ""
+	}
+	return albumFolderName(model)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// canonicalExts maps equivalent extensions to the single form used in the library
+var canonicalExts = map[string]string{
+	".jpeg": ".jpg",
+	".jpe":  ".jpg",
+	".tif":  ".tiff",
+	".mpeg": ".mpg",
+}
+
+// canonicalName returns filename with its extension lower-cased and mapped to its canonical form
+// when --canonical-ext is set, and filename unchanged otherwise
+func canonicalName(filename string) string {
+	if !*canonicalExt {
+		return filename
+	}
+	ext := filepath.Ext(filename)
+	if ext == "" {
+		return filename
+	}
+	canon := strings.ToLower(ext)
+	if mapped, ok := canonicalExts[canon]; ok {
+		canon = mapped
+	}
+	return strings.TrimSuffix(filename, ext) + canon
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The checkpoint is a pair of append-only journals under .photo-sorter/checkpoint. They survive a
+// crash or Ctrl-C so that --resume can skip files that were already handled and restore the
+// destination hashes without re-hashing everything. A run that completes removes them.
+var (
+	checkpointDir        = filepath.Join(stateDir, "checkpoint")
+	processedJournalPath = filepath.Join(checkpointDir, "processed.log") // One source path per line
+	hashJournalPath      = filepath.Join(checkpointDir, "hashes.log")    // "<folder>\t<hash>\t<path>" per line
+
+	journalMu        sync.Mutex
+	processedJournal *os.File
+	hashJournal      *os.File
+
+	resumedProcessed = make(map[string]bool) // Source paths completed by the interrupted run
+
+	outcomeMu sync.Mutex
+	outcomes  = make(map[string]bool) // Source paths of this run: true once handled, false if any step failed
+)
+
+// openCheckpoint prepares the journals. With resume, the previous run's journals are loaded and
+// appended to; otherwise any leftovers are discarded and a fresh checkpoint is started.
+func openCheckpoint(resume bool) error {
+	if err := os.MkdirAll(checkpointDir, 0755); err != nil {
+		return err
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if resume {
+		if err := loadCheckpoint(); err != nil {
+			return err
+		}
+	} else {
+		if _, err := os.Stat(processedJournalPath); err == nil {
+			log.Println("⚠️  Found a checkpoint from an interrupted run; starting fresh (use --resume to continue it instead)")
+		}
+		flags |= os.O_TRUNC
+	}
+
+	var err error
+	if processedJournal, err = os.OpenFile(processedJournalPath, flags, 0644); err != nil {
+		return err
+	}
+	if hashJournal, err = os.OpenFile(hashJournalPath, flags, 0644); err != nil {
+		processedJournal.Close()
+		return err
+	}
+	return nil
+}
+
+// loadCheckpoint reads the journals of an interrupted run into memory
+func loadCheckpoint() error {
+	processed, err := readJournal(processedJournalPath)
+	if err != nil {
+		return err
+	}
+	for _, line := range processed {
+		resumedProcessed[line] = true
+	}
+
+	hashes, err := readJournal(hashJournalPath)
+	if err != nil {
+		return err
+	}
+	hashMu.Lock()
+	for _, line := range hashes {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 {
+			continue // Torn final line from a crash
+		}
+		path := ""
+		if len(fields) > 2 {
+			path = fields[2]
+		}
+		registerHashLocked(fields[0], fields[1], path)
+	}
+	hashMu.Unlock()
+
+	log.Printf("Resuming interrupted run: %d files already processed, %d destination hashes restored", len(resumedProcessed), len(hashes))
+	return nil
+}
+
+// readJournal returns the non-empty lines of a journal file; a missing file is an empty journal
+func readJournal(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// noteOutcome remembers the manifest action recorded for a source, for markProcessed. A failure
+// is final: the file is tried again on --resume even if another step for it succeeded.
+func noteOutcome(path, action string) {
+	if strings.HasPrefix(path, runTmpDir+string(filepath.Separator)) {
+		return // Extracted from an archive; only the archive itself is journaled
+	}
+	outcomeMu.Lock()
+	defer outcomeMu.Unlock()
+	if action == actionFailed {
+		outcomes[path] = false
+	} else if _, seen := outcomes[path]; !seen {
+		outcomes[path] = true
+	}
+}
+
+// markProcessed journals a source file as fully handled, if it was moved, copied, deduped or
+// deleted. Files that failed, or were left alone, are tried again on --resume.
+func markProcessed(path string) {
+	outcomeMu.Lock()
+	handled := outcomes[path]
+	delete(outcomes, path)
+	outcomeMu.Unlock()
+	if !handled {
+		return
+	}
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if processedJournal != nil {
+		processedJournal.WriteString(path + "\n")
+	}
+}
+
+// journalHash records a hash that now exists in a destination folder. Only call this once the file
+// is actually in place, otherwise a resumed run could delete a source as a duplicate of nothing.
+func journalHash(folder, hash, path string) {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if hashJournal != nil {
+		hashJournal.WriteString(folder + "\t" + hash + "\t" + path + "\n")
+	}
+}
+
+// closeCheckpoint flushes the journals. When the run completed they are removed, since there is
+// nothing left to resume.
+func closeCheckpoint(completed bool) {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	for _, f := range []*os.File{processedJournal, hashJournal} {
+		if f != nil {
+			f.Sync()
+			f.Close()
+		}
+	}
+	processedJournal, hashJournal = nil, nil
+
+	if completed {
+		os.RemoveAll(checkpointDir)
+	}
+}
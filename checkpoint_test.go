@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMarkProcessedOnlyHandled(t *testing.T) {
+	journal, err := os.Create(filepath.Join(t.TempDir(), "processed.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	processedJournal = journal
+	t.Cleanup(func() {
+		processedJournal = nil
+		journal.Close()
+	})
+
+	recordOp(manifestEntry{Source: "/src/moved.jpg", Action: actionMoved})
+	recordOp(manifestEntry{Source: "/src/dup.jpg", Action: actionDuplicate})
+	recordOp(manifestEntry{Source: "/src/failed.jpg", Action: actionFailed})
+	recordOp(manifestEntry{Source: "/src/partly.jpg", Action: actionMoved})
+	recordOp(manifestEntry{Source: "/src/partly.jpg", Action: actionFailed})
+	for _, p := range []string{"/src/moved.jpg", "/src/dup.jpg", "/src/failed.jpg", "/src/partly.jpg", "/src/untouched.jpg"} {
+		markProcessed(p)
+	}
+
+	data, _ := os.ReadFile(journal.Name())
+	got := strings.Fields(string(data))
+	want := []string{"/src/moved.jpg", "/src/dup.jpg"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("journaled %q, want %q", got, want)
+	}
+}
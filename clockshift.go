@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// clockShift corrects the clock of one camera model, or of every camera when model is ""
+type clockShift struct {
+	model               string // Normalized by cameraKey
+	years, months, days int
+	duration            time.Duration
+	text                string // As given, for logs
+}
+
+// clockShifts are the --shift-time corrections
+var clockShifts clockShiftList
+
+// clockShiftList is a repeatable flag of [MODEL=]±OFFSET, where OFFSET combines y (years), mo
+// (months), d (days), h, m and s, e.g. CanonEOS70D=+2h or -1y3d
+type clockShiftList []clockShift
+
+var clockShiftPart = regexp.MustCompile(`^(\d+)(y|mo|d|h|m|s)`)
+
+func (l *clockShiftList) String() string {
+	var out []string
+	for _, s := range *l {
+		out = append(out, s.text)
+	}
+	return strings.Join(out, ", ")
+}
+
+func (l *clockShiftList) Set(value string) error {
+	shift := clockShift{text: value}
+	offset := value
+	if i := strings.LastIndex(value, "="); i >= 0 {
+		shift.model, offset = cameraKey(value[:i]), strings.TrimSpace(value[i+1:])
+		if shift.model == "" {
+			return fmt.Errorf("%q names no camera model", value)
+		}
+	}
+	sign := 1
+	switch {
+	case strings.HasPrefix(offset, "+"):
+		offset = offset[1:]
+	case strings.HasPrefix(offset, "-"):
+		sign, offset = -1, offset[1:]
+	default:
+		return fmt.Errorf("offset %q must start with + or -", offset)
+	}
+	if offset == "" {
+		return fmt.Errorf("%q has no offset", value)
+	}
+	for offset != "" {
+		m := clockShiftPart.FindStringSubmatch(offset)
+		if m == nil {
+			return fmt.Errorf("invalid offset in %q (expected e.g. +2h, -1y or +1d12h)", value)
+		}
+		n, _ := strconv.Atoi(m[1])
+		n *= sign
+		switch m[2] {
+		case "y":
+			shift.years += n
+		case "mo":
+			shift.months += n
+		case "d":
+			shift.days += n
+		case "h":
+			shift.duration += time.Duration(n) * time.Hour
+		case "m":
+			shift.duration += time.Duration(n) * time.Minute
+		case "s":
+			shift.duration += time.Duration(n) * time.Second
+		}
+		offset = offset[len(m[0]):]
+	}
+	*l = append(*l, shift)
+	return nil
+}
+
+// cameraKey normalizes a camera name for matching: "Canon EOS 70D" and "CanonEOS70D" are the same
+func cameraKey(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// withClockShift corrects an EXIF date for a camera whose clock was known to be wrong
+// (--shift-time). A shift for the photo's model wins over a global one. Models match with or
+// without the make in front ("EOS70D", "CanonEOS70D").
+func withClockShift(x *exif.Exif, path string, d dateInfo) dateInfo {
+	if len(clockShifts) == 0 || d.Time.IsZero() {
+		return d
+	}
+	model, maker := cameraKey(exifString(x, exif.Model)), cameraKey(exifString(x, exif.Make))
+	var match *clockShift
+	for i, s := range clockShifts {
+		switch {
+		case s.model == "":
+			if match == nil {
+				match = &clockShifts[i]
+			}
+		case model != "" && (s.model == model || s.model == maker+model || s.model == strings.TrimPrefix(model, maker)):
+			match = &clockShifts[i]
+		}
+		if match != nil && match.model != "" {
+			break
+		}
+	}
+	if match == nil {
+		return d
+	}
+	t := d.Time.AddDate(match.years, match.months, match.days).Add(match.duration)
+	log.Printf("Shifted capture time of %s from %s to %s (--shift-time %s)", filepath.Base(path), d.Time.Format("2006-01-02 15:04:05"), t.Format("2006-01-02 15:04:05"), match.text)
+	return dateInfo{Year: t.Format("2006"), Source: d.Source + " (clock shifted)", Time: t, Zoned: d.Zoned, Inferred: true}
+}
+
+// cameraDate applies the clock corrections to a date read from a camera's EXIF: --shift-time,
+// then --gps-timezone
+func cameraDate(x *exif.Exif, path string, d dateInfo) dateInfo {
+	return withGPSZone(x, path, withClockShift(x, path, d))
+}
@@ -0,0 +1,28 @@
+package main
+
+import "os"
+
+// commands are the subcommands besides sorting. Without one (or with "sort"), photo-sorter sorts.
+var commands = map[string]func(args []string){
+	"tier":  runTier,
+	"plan":  runPlan,
+	"apply": runApply,
+}
+
+// runSubcommand runs the subcommand named on the command line and reports whether there was one.
+// An explicit "sort" is dropped so the sort flags parse as usual.
+func runSubcommand() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+	if os.Args[1] == "sort" {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+		return false
+	}
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		return false
+	}
+	run(os.Args[2:])
+	return true
+}
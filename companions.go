@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// rawExts are camera RAW formats. They are sorted as images; most are TIFF-based, so their EXIF
+// date is read like a TIFF's.
+var rawExts = map[string]bool{
+	".cr2": true, ".cr3": true, ".crw": true, ".nef": true, ".nrw": true, ".arw": true, ".srf": true, ".sr2": true,
+	".dng": true, ".orf": true, ".rw2": true, ".raf": true, ".pef": true, ".srw": true, ".x3f": true, ".3fr": true,
+	".iiq": true, ".rwl": true, ".erf": true, ".kdc": true, ".mrw": true,
+}
+
+// actionCompanion marks a file moved together with the photo it belongs to (the RAW of a RAW+JPEG
+// pair, the video of a Live Photo, an XMP sidecar); its destination sits next to that photo's
+const actionCompanion = "companion"
+
+func init() {
+	for ext := range rawExts {
+		imageExts[ext] = true
+	}
+}
+
+// pairCompanions attaches files that belong with another file to that file's job, so they are
+// moved together instead of sorted on their own. Companions share the image's folder and basename:
+// a RAW whose capture time agrees (RAW+JPEG), the .mov of a Live Photo, or an XMP sidecar of any
+// media file.
+func pairCompanions(jobs []fileJob) []fileJob {
+	byStem := make(map[string][]int) // Folder + lower-case basename -> job indexes
+	for i, job := range jobs {
+		byStem[companionKey(job.path)] = append(byStem[companionKey(job.path)], i)
+	}
+	hasOriginal := make(map[string]bool) // Keys with an unedited image, which Photos edits follow
+	for _, job := range jobs {
+		if ext := strings.ToLower(filepath.Ext(job.path)); imageExts[ext] && !rawExts[ext] && !isAppleEdit(job.path) {
+			hasOriginal[companionKey(job.path)] = true
+		}
+	}
+	absorbed := make([]bool, len(jobs))
+	for i := range jobs {
+		ext := strings.ToLower(filepath.Ext(jobs[i].path))
+		if !imageExts[ext] || rawExts[ext] || (isAppleEdit(jobs[i].path) && hasOriginal[companionKey(jobs[i].path)]) {
+			continue
+		}
+		for _, j := range byStem[companionKey(jobs[i].path)] {
+			cext := strings.ToLower(filepath.Ext(jobs[j].path))
+			if absorbed[j] || j == i {
+				continue
+			}
+			switch {
+			case isAppleEdit(jobs[j].path) && !isAppleEdit(jobs[i].path):
+				// Photos exports the edited version of a photo (or Live Photo video) next to it
+			case rawExts[cext]:
+				if !sameCapture(jobs[i].path, jobs[j].path) {
+					log.Printf("Not pairing '%s' with '%s': their capture times differ", filepath.Base(jobs[j].path), filepath.Base(jobs[i].path))
+					continue
+				}
+			case livePhotoVideoExts[cext] && livePhotoImageExts[ext]:
+				if !isLivePhotoPair(jobs[i].path, jobs[j].path) {
+					log.Printf("Not pairing '%s' with '%s': their Live Photo identifiers differ", filepath.Base(jobs[j].path), filepath.Base(jobs[i].path))
+					continue
+				}
+			default:
+				continue
+			}
+			jobs[i].companions = append(jobs[i].companions, jobs[j])
+			absorbed[j] = true
+		}
+	}
+
+	// Sidecars follow the file they describe, whether that is an image or its RAW companion
+	for i := range jobs {
+		if absorbed[i] || !isSidecar(jobs[i].path) {
+			continue
+		}
+		var owners []int // Top-level job holding each candidate
+		var files []string
+		for _, j := range byStem[companionKey(jobs[i].path)] {
+			if ext := strings.ToLower(filepath.Ext(jobs[j].path)); absorbed[j] || !(imageExts[ext] || videoExts[ext]) {
+				continue
+			}
+			files = append(files, jobs[j].path)
+			owners = append(owners, j)
+			for _, c := range jobs[j].companions {
+				if !isSidecar(c.path) {
+					files = append(files, c.path)
+					owners = append(owners, j)
+				}
+			}
+		}
+		if owner := sidecarOwner(jobs[i].path, files); owner != "" {
+			j := owners[indexOf(files, owner)]
+			jobs[i].sidecarFor = owner
+			jobs[j].companions = append(jobs[j].companions, jobs[i])
+			absorbed[i] = true
+		}
+	}
+
+	paired := jobs[:0:0]
+	for i, job := range jobs {
+		if !absorbed[i] {
+			paired = append(paired, job)
+		}
+	}
+	return paired
+}
+
+// companionKey groups files of the same folder and basename. Sidecars named after the full file
+// name (IMG_1.CR2.xmp) group with IMG_1 like those named after the basename (IMG_1.xmp).
+func companionKey(path string) string {
+	name := filepath.Base(path)
+	stem := appleVariantBase(strings.TrimSuffix(name, filepath.Ext(name)))
+	if isSidecar(path) {
+		stem = sidecarTarget(path)
+		if inner := strings.ToLower(filepath.Ext(stem)); imageExts[inner] || videoExts[inner] {
+			stem = strings.TrimSuffix(stem, filepath.Ext(stem))
+		}
+	}
+	return filepath.Join(filepath.Dir(path), strings.ToLower(stem))
+}
+
+// indexOf returns the position of s in list, or -1
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameCapture reports whether two files were taken at the same time. Files whose capture time
+// cannot be read (e.g. RAW formats goexif does not understand) are paired by basename alone.
+func sameCapture(a, b string) bool {
+	da, db := getExifDate(a), getExifDate(b)
+	ta, tb := da.Time, db.Time
+	if ta.IsZero() || tb.IsZero() {
+		return true
+	}
+	if da.Zoned != db.Zoned {
+		// Only one of them has an offset tag; compare the camera's clock
+		ta, tb = parseExifTime(ta.Format("2006:01:02 15:04:05")), parseExifTime(tb.Format("2006:01:02 15:04:05"))
+	}
+	d := ta.Sub(tb)
+	return d < time.Second && d > -time.Second
+}
+
+// jobPaths lists the paths of jobs and their companions
+func jobPaths(jobs []fileJob) []string {
+	var paths []string
+	for _, job := range jobs {
+		paths = append(paths, job.path)
+		for _, c := range job.companions {
+			paths = append(paths, c.path)
+		}
+	}
+	return paths
+}
+
+// jobBytes is the size of a job including its companions
+func jobBytes(job fileJob) int64 {
+	n := job.size
+	for _, c := range job.companions {
+		n += c.size
+	}
+	return n
+}
+
+// settleCompanions moves the companions of source next to where it was placed (dest), renamed in
+// lockstep with it. When source was not placed (a duplicate, an error), its companions are sorted
+// on their own instead; its sidecars still follow it to dest (e.g. the errors folder), or stay in
+// the source when there is none. The edited version of a duplicate photo (IMG_E1234.JPG) joins the
+// library copy it duplicates (keptCopy), as it would have joined the photo.
+func settleCompanions(source string, companions []fileJob, dest, keptCopy string, placed bool, date dateInfo) {
+	var rest []fileJob
+	for _, c := range companions {
+		if interrupted() {
+			leaveForResume(c.path)
+			continue
+		}
+		switch {
+		case placed || (dest != "" && c.sidecarFor == source):
+			placeCompanion(source, c, dest, date)
+		case keptCopy != "" && isAppleEdit(c.path) && !isAppleEdit(source):
+			log.Printf("Moving edited '%s' next to '%s', which its original duplicates", filepath.Base(c.path), filepath.Base(keptCopy))
+			placeCompanion(keptCopy, c, keptCopy, date)
+		case c.sidecarFor == source:
+			log.Printf("Leaving sidecar '%s' with '%s'", filepath.Base(c.path), filepath.Base(source))
+		default:
+			c.sidecarFor = ""
+			rest = append(rest, c)
+		}
+	}
+	for _, job := range pairCompanions(rest) {
+		processFile(job)
+	}
+}
+
+// companionName is the name of a companion of source once source has been placed at dest: dest's
+// basename with the companion's own extension(s), e.g. IMG_1_1.cr2 or IMG_1_1.cr2.xmp for IMG_1_1.jpg
+func companionName(source, dest, companion string) string {
+	if _, ok := takeoutMediaName(companion); ok {
+		return filepath.Base(dest) + ".json" // Takeout's own form, whatever form it arrived in
+	}
+	stem := strings.TrimSuffix(filepath.Base(dest), filepath.Ext(dest))
+	name := filepath.Base(companion)
+	srcStem := strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	suffix := filepath.Ext(name)
+	if isSidecar(companion) && len(name) > len(srcStem) && strings.EqualFold(name[:len(srcStem)], srcStem) {
+		suffix = name[len(srcStem):] // .xmp or .CR2.xmp
+	} else {
+		stem = withAppleVariant(stem, strings.TrimSuffix(name, suffix)) // IMG_E1234_1.JPG for IMG_1234_1.HEIC
+	}
+	// Extensions are canonicalized the way their files' are, so IMG_1.cr2.xmp still names IMG_1.cr2
+	out := ""
+	for _, part := range strings.SplitAfter(strings.TrimPrefix(suffix, "."), ".") {
+		out += filepath.Ext(canonicalName("x." + strings.TrimSuffix(part, ".")))
+	}
+	return stem + out
+}
+
+// placeCompanion moves one companion of source next to dest. RAW files, and sidecars of RAW files,
+// go to a raw/ subfolder with --raw-subfolder.
+func placeCompanion(source string, c fileJob, dest string, date dateInfo) {
+	filename := filepath.Base(c.path)
+	folder := filepath.Dir(dest)
+	if *rawSubfolder && (rawExts[strings.ToLower(filepath.Ext(c.path))] || rawExts[strings.ToLower(filepath.Ext(c.sidecarFor))]) {
+		folder = filepath.Join(folder, "raw")
+	}
+	fail := func(reason string) {
+		log.Printf("Could not move companion '%s': %s", filename, reason)
+		counterMu.Lock()
+		errorCount++
+		counterMu.Unlock()
+		recordError(c.path, "", errMoveFailed, reason)
+		recordOp(manifestEntry{Source: c.path, Year: date.Year, DateSource: date.Source, Taken: takenStamp(date), Action: actionFailed})
+	}
+	if err := ensureDir(folder); err != nil {
+		fail(fmt.Sprintf("could not create destination folder '%s': %v", folder, err))
+		return
+	}
+
+	hash, err := dedupKey(c.path)
+	if err != nil {
+		fail(fmt.Sprintf("hash calculation failed: %v", err))
+		return
+	}
+	name := companionName(source, dest, c.path)
+	target := filepath.Join(folder, name)
+	if _, err := os.Lstat(target); err == nil {
+		// The pair may already be in the library from an earlier run
+		if existing, err := dedupKey(target); err == nil && existing == hash && confirmDuplicate(c.path, target, hash) {
+			log.Printf("Duplicate detected (hash match): companion '%s' vs existing '%s'.", filename, name)
+			d, action := resolveDuplicate(c.path, target, folder, name, hash)
+			recordOp(manifestEntry{Source: c.path, Destination: d, Year: date.Year, DateSource: date.Source, Taken: takenStamp(date), Hash: hash, Action: action})
+			return
+		}
+		target = uniquePath(target)
+		log.Printf("Filename conflict: Renaming companion '%s' to '%s' in '%s'", filename, filepath.Base(target), filepath.Base(folder))
+	}
+	if err := placeFile(c.path, target); err != nil {
+		fail(fmt.Sprintf("move failed: %v", err))
+		return
+	}
+	registerHash(folder, hash, target)
+	journalHash(folder, hash, target)
+	log.Printf("Moved companion '%s' with its photo to '%s'", filename, target)
+	counterMu.Lock()
+	companionCount++
+	counterMu.Unlock()
+	recordAlbums(c.path, target)
+	recordOp(manifestEntry{Source: c.path, Destination: target, Year: date.Year, DateSource: date.Source, Taken: takenStamp(date), Hash: hash, Action: actionCompanion})
+}
+
+// placeFile moves a source file to dest, copying it when it cannot be renamed (other volume,
+// read-only source)
+func placeFile(src, dest string) error {
+	if err := renameSource(src, dest); err != nil {
+		if err := copyFile(src, dest); err != nil {
+			return err
+		}
+		removeSource(src)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	converterOnce sync.Once
+	converterPath string // heif-convert or ImageMagick; empty when none is installed
+)
+
+// heicConverter locates an external HEIC decoder, preferring libheif's heif-convert
+func heicConverter() string {
+	converterOnce.Do(func() {
+		candidates := []string{"heif-convert", "magick"}
+		if runtime.GOOS != "windows" {
+			// On Windows "convert" is the system's filesystem converter, not ImageMagick
+			candidates = append(candidates, "convert")
+		}
+		for _, name := range candidates {
+			if p, err := exec.LookPath(name); err == nil {
+				converterPath = p
+				log.Printf("HEIC conversion will use '%s'", p)
+				return
+			}
+		}
+		log.Println("⚠️  No HEIC converter found (install libheif's heif-convert or ImageMagick); HEIC files will be sorted unconverted")
+	})
+	return converterPath
+}
+
+// convertsToJPEG reports whether files with this extension are converted to JPEG: HEIC/HEIF unless
+// --heic-convert=false, AVIF with --avif-convert, and only when a converter is installed
+func convertsToJPEG(ext string) bool {
+	switch {
+	case heicExts[ext]:
+		return *heicConvert && heicConverter() != ""
+	case ext == ".avif":
+		return *avifConvert && heicConverter() != ""
+	}
+	return false
+}
+
+// convertToJPEG decodes src (HEIC/HEIF) into a JPEG at dst, keeping the source's ICC color profile
+// so Display P3 photos don't shift colors. The output is built in the run's temp namespace, checked
+// to be a decodable JPEG, and only renamed into place once complete.
+func convertToJPEG(src, dst string) error {
+	tool := heicConverter()
+	if tool == "" {
+		return errors.New("no HEIC converter installed")
+	}
+
+	tmp := newTempPath("convert", strings.TrimSuffix(filepath.Base(dst), filepath.Ext(dst))+".jpg")
+	if err := os.MkdirAll(filepath.Dir(tmp), 0755); err != nil {
+		return err
+	}
+	var args []string
+	if strings.HasPrefix(filepath.Base(tool), "heif-convert") {
+		args = []string{"-q", strconv.Itoa(*jpegQuality), src, tmp}
+	} else {
+		args = []string{src, "-quality", strconv.Itoa(*jpegQuality), tmp}
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(tool, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("%s: %v: %s", filepath.Base(tool), err, strings.TrimSpace(stderr.String()))
+	}
+
+	if err := checkJPEG(tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("%s produced an unusable JPEG: %v", filepath.Base(tool), err)
+	}
+	if err := preserveICCProfile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("could not preserve color profile: %v", err)
+	}
+	if info, err := os.Stat(src); err == nil {
+		os.Chtimes(tmp, info.ModTime(), info.ModTime())
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// checkJPEG makes sure a converter's output really is a JPEG with a readable header; some tools
+// exit successfully after writing an empty file or passing the HEIC bytes through
+func checkJPEG(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return err
+	}
+	if format != "jpeg" {
+		return fmt.Errorf("output is %s, not JPEG", format)
+	}
+	if cfg.Width == 0 || cfg.Height == 0 {
+		return errors.New("output has no pixels")
+	}
+	return nil
+}
+
+// preserveICCProfile makes sure the converted JPEG carries the same ICC profile as the source.
+// Converters differ in whether they copy it, so it is checked and re-embedded when missing.
+func preserveICCProfile(src, jpegPath string) error {
+	want, err := readICCProfile(src)
+	if err != nil {
+		log.Printf("Could not read color profile of '%s': %v", filepath.Base(src), err)
+		return nil // The conversion itself is fine; there is just nothing reliable to preserve
+	}
+	if want == nil {
+		return nil
+	}
+	data, err := os.ReadFile(jpegPath)
+	if err != nil {
+		return err
+	}
+	if got, err := jpegICCProfile(data); err == nil && bytes.Equal(got, want) {
+		return nil
+	}
+	log.Printf("Embedding the original color profile into converted '%s'", filepath.Base(src))
+	return embedJPEGICCProfile(jpegPath, want)
+}
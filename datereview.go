@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// dateReviewItem is a sorted file whose date is valid but suspicious (e.g. a camera whose clock was reset)
+type dateReviewItem struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Date        string `json:"date"`
+	DateSource  string `json:"date_source"`
+	Reason      string `json:"reason"`
+}
+
+var (
+	dateReviewMu    sync.Mutex
+	dateReviewItems []dateReviewItem
+)
+
+// checkDateForReview flags dates outside the soft thresholds. Unlike the hard validity window these
+// don't change where the file goes; they only list it in the reports so a human can double-check.
+func checkDateForReview(source, dest string, date dateInfo) {
+	year, err := strconv.Atoi(date.Year)
+	if err != nil {
+		return
+	}
+
+	var reason string
+	now := time.Now()
+	switch {
+	case *reviewBefore > 0 && year < *reviewBefore:
+		reason = fmt.Sprintf("older than %d", *reviewBefore)
+	case *reviewFuture && !date.Time.IsZero() && date.Time.After(now):
+		reason = "in the future"
+	case *reviewFuture && date.Time.IsZero() && year > now.Year():
+		reason = "in the future"
+	default:
+		return
+	}
+
+	shown := date.Year
+	if !date.Time.IsZero() {
+		shown = date.Time.Format("2006-01-02 15:04:05")
+	}
+
+	dateReviewMu.Lock()
+	dateReviewItems = append(dateReviewItems, dateReviewItem{Source: source, Destination: dest, Date: shown, DateSource: date.Source, Reason: reason})
+	dateReviewMu.Unlock()
+}
+
+// snapshotDateReview returns a copy of the files flagged for date review
+func snapshotDateReview() []dateReviewItem {
+	dateReviewMu.Lock()
+	defer dateReviewMu.Unlock()
+	return append(make([]dateReviewItem, 0, len(dateReviewItems)), dateReviewItems...)
+}
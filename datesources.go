@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Places a file's date can come from, as named in a --date-sources file
+const (
+	dateSourceLibrary  = "library"  // The Photos library the file is read from
+	dateSourceExif     = "exif"     // EXIF DateTimeOriginal, DateTimeDigitized or DateTime
+	dateSourceEmbedded = "embedded" // XMP, IPTC or PNG text inside the image
+	dateSourceMedia    = "media"    // A video's "Media Created" (mvhd, AVI INFO) or an audio file's tags
+	dateSourceSidecar  = "sidecar"  // XMP, THM and Google Takeout JSON sidecars
+	dateSourceCatalog  = "catalog"  // A Lightroom catalog
+	dateSourceFilename = "filename" // The file's name (WhatsApp, --filename-pattern, --filename-dates)
+	dateSourceFolder   = "folder"   // The name of the Photos export moment folder it is in
+	dateSourceMtime    = "mtime"    // The file's modification time
+	dateSourceNone     = "none"     // Ends the chain; files still without a date go to no_date
+)
+
+// dateSourceChain lists, per media type, where a date is looked for, in order. The default never
+// uses file system dates.
+var dateSourceChain = map[string][]string{
+	"image": {dateSourceLibrary, dateSourceExif, dateSourceEmbedded, dateSourceSidecar, dateSourceCatalog, dateSourceFilename, dateSourceFolder},
+	"video": {dateSourceLibrary, dateSourceMedia, dateSourceSidecar, dateSourceCatalog, dateSourceFilename, dateSourceFolder},
+	"audio": {dateSourceMedia, dateSourceSidecar, dateSourceFilename},
+}
+
+// loadDateSources replaces the date source chains with those of a --date-sources file, a JSON object
+// of media type ("image", "video", "audio") -> list of sources. Media types it leaves out keep the default.
+func loadDateSources(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var chains map[string][]string
+	if err := json.Unmarshal(data, &chains); err != nil {
+		return err
+	}
+	for mediaType, sources := range chains {
+		if _, ok := dateSourceChain[mediaType]; !ok {
+			return fmt.Errorf("unknown media type %q (expected image, video or audio)", mediaType)
+		}
+		var chain []string
+		for _, source := range sources {
+			source = strings.ToLower(strings.TrimSpace(source))
+			switch source {
+			case dateSourceLibrary, dateSourceSidecar, dateSourceCatalog, dateSourceFilename, dateSourceFolder, dateSourceMtime, dateSourceNone:
+			case dateSourceExif, dateSourceEmbedded:
+				if mediaType != "image" {
+					return fmt.Errorf("date source %q only applies to images", source)
+				}
+			case dateSourceMedia:
+				if mediaType != "video" && mediaType != "audio" {
+					return fmt.Errorf("date source %q only applies to videos and audio", source)
+				}
+			default:
+				return fmt.Errorf("unknown date source %q for %s", source, mediaType)
+			}
+			chain = append(chain, source)
+		}
+		dateSourceChain[mediaType] = chain
+	}
+	return nil
+}
+
+// applyFallbackMtime makes file modification times the last date source of every chain
+// (--fallback-mtime)
+func applyFallbackMtime() {
+	for mediaType, chain := range dateSourceChain {
+		if indexOf(chain, dateSourceMtime) >= 0 {
+			continue
+		}
+		if end := indexOf(chain, dateSourceNone); end >= 0 {
+			chain = append(chain[:end:end], dateSourceMtime)
+		} else {
+			chain = append(chain, dateSourceMtime)
+		}
+		dateSourceChain[mediaType] = chain
+	}
+}
+
+// usesFileDates reports whether any chain falls back to file system dates
+func usesFileDates() bool {
+	for _, chain := range dateSourceChain {
+		if indexOf(chain, dateSourceMtime) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// fileDate finds the date of an image, video or audio file by trying its media type's date sources in order.
+// external reports that the date came from outside the file's own metadata.
+func fileDate(job fileJob, mediaType string) (date dateInfo, external bool) {
+	if s, ok := prescannedDate(job.path); ok {
+		return s.date, s.external
+	}
+	chain := dateSourceChain[mediaType]
+	for i := 0; i < len(chain); i++ {
+		source := chain[i]
+		var d dateInfo
+		ok := false
+		switch source {
+		case dateSourceLibrary:
+			d, ok = dateOverride(job.path)
+		case dateSourceExif, dateSourceEmbedded:
+			exifTags, embedded := source == dateSourceExif, source == dateSourceEmbedded
+			if exifTags && i+1 < len(chain) && chain[i+1] == dateSourceEmbedded {
+				embedded = true // Read together, opening the file once
+				i++
+			}
+			d = readImageDate(job.path, exifTags, embedded)
+			ok = d.Year != ""
+		case dateSourceMedia:
+			if mediaType == "audio" {
+				d = getAudioDate(job.path)
+			} else {
+				d = getVideoDate(job.path)
+			}
+			ok = d.Year != ""
+		case dateSourceSidecar:
+			d, ok = sidecarDate(job)
+		case dateSourceCatalog:
+			d, ok = dateFallback(job.path)
+		case dateSourceFilename:
+			d, ok = filenameDate(job.path)
+		case dateSourceFolder:
+			d, ok = momentFolderDate(job.path)
+		case dateSourceMtime:
+			d, ok = modTimeDate(job.path)
+		case dateSourceNone:
+			return dateInfo{}, false
+		}
+		if d.Year == "error" {
+			return d, false
+		}
+		if ok {
+			external := source != dateSourceExif && source != dateSourceEmbedded && source != dateSourceMedia
+			d.Inferred = d.Inferred || external
+			return d, external
+		}
+	}
+	return dateInfo{}, false
+}
+
+// mtimeDateSource is the date source recorded for files dated by their modification time, which
+// is only an approximation of when they were taken
+const mtimeDateSource = "file modification time (approximate)"
+
+// modTimeDate dates a file by its modification time, e.g. for scans whose metadata has no date
+func modTimeDate(path string) (dateInfo, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return dateInfo{}, false
+	}
+	t := info.ModTime()
+	if t.Year() <= 1900 || t.Year() > time.Now().Year()+1 {
+		return dateInfo{}, false
+	}
+	return dateInfo{Year: t.Format("2006"), Source: mtimeDateSource, Time: t, Zoned: true}, true
+}
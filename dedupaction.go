@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Values accepted by --dedup-action
+const (
+	dedupDelete   = "delete"   // Delete the duplicate from the source
+	dedupKeep     = "keep"     // Leave the duplicate in the source untouched
+	dedupHardlink = "hardlink" // Replace it with a hardlink to the kept copy, under its own name
+	dedupReflink  = "reflink"  // Replace it with a copy-on-write clone of the kept copy (APFS, btrfs, XFS)
+)
+
+// errReflinkUnsupported is returned by cloneFile on platforms without copy-on-write clones
+var errReflinkUnsupported = errors.New("copy-on-write clones are not supported on this platform")
+
+// linkFallbackOnce limits the "falling back to copies" warning to one per run
+var linkFallbackOnce sync.Once
+
+// resolveDuplicate applies --dedup-action to a source file whose content the library already holds
+// at existing (the kept copy in folder). It returns where the duplicate is accounted for and the
+// manifest action; on failure the destination is "" and the action actionFailed.
+func resolveDuplicate(source, existing, folder, name, hash string) (string, string) {
+	// Under --no-hash the match is by name, size and date only: nothing proves the contents are the
+	// same, so the source is never deleted or replaced on that evidence
+	if isHeuristicKey(hash) {
+		log.Printf("Keeping probable duplicate '%s' in the source (matched by name, size and date; contents not compared)", source)
+		counterMu.Lock()
+		duplicateKeptCount++
+		counterMu.Unlock()
+		return existing, actionDuplicateKept
+	}
+
+	linking := *dedupAction == dedupHardlink || *dedupAction == dedupReflink
+	// A duplicate with the same name as the kept copy has nothing to preserve
+	if linking && filepath.Base(existing) != name {
+		return linkDuplicate(source, existing, folder, name, hash)
+	}
+
+	if *dedupAction == dedupKeep || !sourceRemovable(source) || !allowDeletion(source) {
+		log.Printf("Keeping duplicate '%s' in the source", source)
+		counterMu.Lock()
+		duplicateKeptCount++
+		counterMu.Unlock()
+		return existing, actionDuplicateKept
+	}
+
+	var size int64
+	if info, err := os.Stat(source); err == nil {
+		size = info.Size()
+	}
+	if err := removeSource(source); err != nil {
+		log.Printf("Could not delete duplicate source file '%s': %v", source, err)
+		counterMu.Lock()
+		errorCount++
+		counterMu.Unlock()
+		recordError(source, "", errDeleteFailed, fmt.Sprintf("could not delete duplicate: %v", err))
+		return "", actionFailed
+	}
+	log.Printf("Deleted duplicate source '%s'", filepath.Base(source))
+	counterMu.Lock()
+	duplicateDeletedCount++
+	counterMu.Unlock()
+	recordDeletedDuplicate(source, existing, hash, size)
+	return existing, actionDuplicate
+}
+
+// linkDuplicate places the duplicate's name in folder as a hardlink or clone of the kept copy and
+// removes the source. Where links are not possible (e.g. exFAT, or a kept copy known only from an
+// old journal) the duplicate is copied instead, so its name is still preserved.
+func linkDuplicate(source, existing, folder, name, hash string) (string, string) {
+	dest := uniquePath(filepath.Join(folder, name))
+	action := actionHardlinked
+	var err error
+	if info, statErr := os.Stat(existing); statErr != nil || !info.Mode().IsRegular() {
+		err = fmt.Errorf("the kept copy's path is unknown")
+	} else if *dedupAction == dedupReflink {
+		action = actionReflinked
+		err = cloneFile(existing, dest)
+	} else {
+		err = os.Link(existing, dest)
+	}
+
+	if err != nil {
+		linkFallbackOnce.Do(func() {
+			log.Printf("⚠️  Could not %s duplicates (%v); placing full copies instead", *dedupAction, err)
+		})
+		if err := copyFile(source, dest); err != nil {
+			log.Printf("Could not place duplicate '%s': %v", source, err)
+			counterMu.Lock()
+			errorCount++
+			counterMu.Unlock()
+			recordError(source, "", errMoveFailed, fmt.Sprintf("could not place duplicate: %v", err))
+			return "", actionFailed
+		}
+		action = actionCopied
+	}
+	log.Printf("Duplicate '%s' %s as '%s'", filepath.Base(source), action, dest)
+	indexHash(dest, hash)
+	if err := removeSource(source); err != nil && !errors.Is(err, errSourceKept) {
+		log.Printf("Could not delete duplicate source file '%s' after placing it: %v", source, err)
+	}
+
+	counterMu.Lock()
+	if action == actionCopied {
+		duplicateCopiedCount++
+	} else {
+		duplicateLinkedCount++
+	}
+	counterMu.Unlock()
+	return dest, action
+}
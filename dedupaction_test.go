@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveDuplicateKeepsHeuristicMatches(t *testing.T) {
+	dir := t.TempDir()
+	kept := filepath.Join(dir, "library", "IMG_1.jpg")
+	source := filepath.Join(dir, "source", "IMG_1.jpg")
+	os.MkdirAll(filepath.Dir(kept), 0755)
+	os.MkdirAll(filepath.Dir(source), 0755)
+	os.WriteFile(kept, []byte("one photo"), 0644)
+	os.WriteFile(source, []byte("another!!"), 0644) // Same name and size, different contents
+
+	*noHash = true
+	t.Cleanup(func() { *noHash, *dedupAction = false, dedupDelete })
+	key, err := dedupKey(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, action := range []string{dedupDelete, dedupHardlink} {
+		*dedupAction = action
+		dest, got := resolveDuplicate(source, kept, filepath.Dir(kept), "IMG_1.jpg", key)
+		if got != actionDuplicateKept || dest != kept {
+			t.Errorf("--dedup-action %s: got %q -> %q, want %q -> %q", action, got, dest, actionDuplicateKept, kept)
+		}
+		if _, err := os.Stat(source); err != nil {
+			t.Errorf("--dedup-action %s: source removed on a name+size+date match", action)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// indexJob is a library file to hash, and the destination folder it belongs to
+type indexJob struct {
+	folder string
+	path   string
+}
+
+// indexDestination hashes the files already in the destination so that a new batch is deduplicated
+// against the existing library, not just against files seen earlier in the same run. Every folder
+// is indexed under its own path, matching how processFile keys hashesInDestination. Unchanged files
+// are looked up in the persistent hash index instead of being re-hashed.
+func indexDestination() {
+	if !*scanDestination {
+		return
+	}
+	log.Println("Indexing files already in the destination...")
+	start := time.Now()
+
+	jobs := make(chan indexJob, 1000)
+	var wg sync.WaitGroup
+	var indexed, failed int64
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				hash, err := dedupKey(job.path)
+				if err != nil {
+					log.Printf("Could not index '%s': %v", job.path, err)
+					atomic.AddInt64(&failed, 1)
+					continue
+				}
+				registerHash(job.folder, hash, job.path)
+				atomic.AddInt64(&indexed, 1)
+			}
+		}()
+	}
+
+	seen := make(map[string]bool) // Index keys of every library file, for pruning the hash index
+	queue := func(folder, path string, size int64) {
+		seen[indexKey(path)] = true
+		// With the size prefilter, files whose size no source file shares are hashed only if needed
+		if prefilterEnabled() {
+			hashed := sourceSizeCounts[size] > 0
+			noteFolderFile(folder, path, size, hashed)
+			if !hashed {
+				return
+			}
+		}
+		jobs <- indexJob{folder: folder, path: path}
+	}
+	walkErr := filepath.Walk(destDir, func(path string, info os.FileInfo, err error) error {
+		if interrupted() {
+			return errInterrupted
+		}
+		if err != nil {
+			log.Printf("Error walking %s: %v", path, err)
+			return nil
+		}
+		if info.IsDir() {
+			// The tool's own state and manifests are not part of the library
+			if isStateDir(path) || path == manifestDir || path == albumsDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Files directly in the destination root are reports and summaries; symlinks point at
+		// tiered year folders, which are walked below
+		if filepath.Dir(path) == destDir || strings.HasSuffix(path, errorSidecarSuffix) || info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		queue(filepath.Dir(path), path, info.Size())
+		return nil
+	})
+
+	// Year folders on the archive volume are indexed under their destination folder, so new copies
+	// of archived photos are still recognized as duplicates
+	for _, year := range tieredYears() {
+		dir := tierLocations[year]
+		if _, err := os.Stat(dir); err != nil {
+			log.Printf("⚠️  Archive folder for %s is not available (%v); duplicates of its files will not be detected", year, err)
+			walkErr = err // Keep its hash index entries
+			continue
+		}
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || interrupted() {
+				return nil
+			}
+			rel, _ := filepath.Rel(dir, filepath.Dir(path))
+			queue(filepath.Join(destDir, year, rel), path, info.Size())
+			return nil
+		})
+	}
+	close(jobs)
+	wg.Wait()
+	if walkErr == nil {
+		pruneHashIndex(seen)
+	}
+
+	log.Printf("Indexed %d existing files in %s", indexed, time.Since(start).Round(time.Millisecond))
+	if failed > 0 {
+		log.Printf("⚠️  %d existing files could not be indexed; duplicates of them will not be detected", failed)
+	}
+}
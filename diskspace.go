@@ -0,0 +1,87 @@
+package main
+
+import (
+	"archive/zip"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// Values accepted by --space-check
+const (
+	spaceCheckAbort = "abort"
+	spaceCheckWarn  = "warn"
+	spaceCheckOff   = "off"
+)
+
+// checkDiskSpace estimates how much the run will write to the destination volume and compares it
+// with the free space there, so a run doesn't fill the disk halfway through and strand partial copies.
+func checkDiskSpace(jobs []fileJob) {
+	if *spaceCheck == spaceCheckOff {
+		return
+	}
+	needed := estimateSpaceNeeded(jobs, sameVolume(sourceDir, destDir) && !readOnlySource)
+	required := needed + int64(spaceMargin)
+
+	free, err := freeSpace(destDir)
+	if err != nil {
+		log.Printf("Warning: Could not determine free space on the destination volume: %v", err)
+		return
+	}
+	if required <= int64(free) {
+		log.Printf("Disk space check: about %s needed (+%s margin), %s free on the destination volume", formatBytes(needed), formatBytes(int64(spaceMargin)), formatBytes(int64(free)))
+		return
+	}
+
+	if *spaceCheck == spaceCheckWarn {
+		log.Printf("⚠️  WARNING: The destination volume has %s free but this run needs about %s (including a %s margin); it may run out of space", formatBytes(int64(free)), formatBytes(required), formatBytes(int64(spaceMargin)))
+		return
+	}
+	fatalf("Not enough free space on the destination volume: %s free, about %s needed (including a %s margin). Free up space, lower --space-margin, or use --space-check=warn to run anyway.",
+		formatBytes(int64(free)), formatBytes(required), formatBytes(int64(spaceMargin)))
+}
+
+// estimateSpaceNeeded returns the bytes the run will write to the destination volume. Moves within
+// one volume are renames and cost nothing; across volumes every file is copied. Archives are
+// extracted onto the destination volume and converted HEIC files get a new JPEG either way.
+func estimateSpaceNeeded(jobs []fileJob, onSameVolume bool) int64 {
+	var needed int64
+	for _, job := range jobs {
+		ext := strings.ToLower(filepath.Ext(job.path))
+		switch {
+		case archiveExts[ext] && *noExtract:
+			if !onSameVolume {
+				needed += job.size
+			}
+		case archiveExts[ext]:
+			needed += archiveExpandedSize(job.path, job.size)
+			if !onSameVolume {
+				needed += job.size // Unsupported archives are copied to the archives folder
+			}
+		case convertsToJPEG(ext), !onSameVolume:
+			needed += job.size
+		}
+		if !onSameVolume {
+			needed += jobBytes(job) - job.size
+		}
+	}
+	return needed
+}
+
+// archiveExpandedSize returns the uncompressed size of a ZIP archive's contents, falling back to
+// the archive's own size for other formats or unreadable archives
+func archiveExpandedSize(path string, size int64) int64 {
+	if strings.ToLower(filepath.Ext(path)) != ".zip" {
+		return size
+	}
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return size
+	}
+	defer reader.Close()
+	var total int64
+	for _, f := range reader.File {
+		total += int64(f.UncompressedSize64)
+	}
+	return total
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io"
+	"os"
+	"regexp"
+)
+
+// djiName matches the names newer DJI drones and gimbals give their photos and videos
+// (DJI_20230615143012_0001_D.JPG). Older models number them (DJI_0001.JPG), without a date.
+var djiName = regexp.MustCompile(`(?i)^DJI_(?P<year>\d{4})(?P<month>\d{2})(?P<day>\d{2})(?P<hour>\d{2})(?P<minute>\d{2})(?P<second>\d{2})_\d+`)
+
+// telemetryExts are the subtitle files DJI drones record their flight telemetry in next to each
+// video (DJI_0001.SRT). They are sidecars of the video and carry the camera's clock.
+var telemetryExts = map[string]bool{".srt": true}
+
+// srtTimestamp finds the first date in a DJI telemetry file: 2023-06-15 14:30:12.123 (Mini, Air),
+// 2017-09-03 12:58:36,389,882 (Mavic Pro) or 2017.08.05 14:11:51 (Phantom 4)
+var srtTimestamp = regexp.MustCompile(`(?P<year>(?:19|20)\d{2})[-.](?P<month>\d{2})[-.](?P<day>\d{2}) (?P<hour>\d{2}):(?P<minute>\d{2}):(?P<second>\d{2})`)
+
+// srtScanLen is how much of a telemetry file is searched for its first date
+const srtScanLen = 64 << 10
+
+// telemetryDate reads the recording date from a DJI telemetry sidecar: the camera's wall clock at
+// the first frame. Ordinary subtitles have no dates and are ignored.
+func telemetryDate(path string) (dateInfo, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return dateInfo{}, false
+	}
+	defer f.Close()
+	head, err := io.ReadAll(io.LimitReader(f, srtScanLen))
+	if err != nil {
+		return dateInfo{}, false
+	}
+	t, ok := matchFilenameDate(srtTimestamp, string(head))
+	if !ok {
+		return dateInfo{}, false
+	}
+	return dateInfo{Year: t.Format("2006"), Source: "sidecar DJI telemetry", Time: t}, true
+}
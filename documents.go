@@ -0,0 +1,31 @@
+package main
+
+import "path/filepath"
+
+// documentExts are the documents that end up in photo dumps: scanned PDFs, letters, spreadsheets and
+// notes. They are kept in the documents folder instead of being deleted as non-media.
+var documentExts = map[string]bool{
+	".pdf": true, ".txt": true, ".rtf": true, ".md": true,
+	".doc": true, ".docx": true, ".odt": true, ".pages": true,
+	".xls": true, ".xlsx": true, ".ods": true, ".csv": true, ".numbers": true,
+	".ppt": true, ".pptx": true, ".odp": true, ".epub": true,
+}
+
+// documentsDir keeps documents found among the photos
+var documentsDir = filepath.Join(destDir, "documents")
+
+// actionDocument marks a document kept in the documents folder
+const actionDocument = "document"
+
+// documentFolder is the folder a document goes to: documents, or with --document-years
+// documents/<year> by its modification time. Documents rarely carry a usable date of their own.
+func documentFolder(path string) (string, dateInfo) {
+	if !*documentYears {
+		return documentsDir, dateInfo{}
+	}
+	date, ok := modTimeDate(path)
+	if !ok {
+		return filepath.Join(documentsDir, "no_date"), dateInfo{}
+	}
+	return filepath.Join(documentsDir, date.Year), date
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/csv"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// duplicatesReportFileName lists every duplicate deleted in the last run and the copy it matched,
+// so the deduplication can be verified afterwards
+const duplicatesReportFileName = "duplicates_report.csv"
+
+var duplicatesReportHeader = []string{"time", "deleted", "kept", "hash", "size"}
+
+var (
+	duplicatesMu     sync.Mutex
+	duplicatesFile   *os.File
+	duplicatesCSV    *csv.Writer
+	duplicatesReport = filepath.Join(destDir, duplicatesReportFileName)
+)
+
+// openDuplicatesReport starts this run's duplicates report, replacing the previous run's
+func openDuplicatesReport() error {
+	f, err := os.Create(duplicatesReport)
+	if err != nil {
+		return err
+	}
+	duplicatesFile = f
+	duplicatesCSV = csv.NewWriter(f)
+	duplicatesCSV.Write(duplicatesReportHeader)
+	duplicatesCSV.Flush()
+	return nil
+}
+
+// recordDeletedDuplicate adds a deleted duplicate and the library file it matched. Rows are
+// flushed immediately, like the manifest.
+func recordDeletedDuplicate(deleted, kept, hash string, size int64) {
+	duplicatesMu.Lock()
+	defer duplicatesMu.Unlock()
+	if duplicatesFile == nil {
+		return
+	}
+	duplicatesCSV.Write([]string{time.Now().Format(time.RFC3339), deleted, kept, hash, strconv.FormatInt(size, 10)})
+	duplicatesCSV.Flush()
+	if err := duplicatesCSV.Error(); err != nil {
+		log.Printf("Warning: Could not write to '%s': %v", duplicatesReport, err)
+	}
+}
+
+// closeDuplicatesReport closes the duplicates report
+func closeDuplicatesReport() {
+	duplicatesMu.Lock()
+	defer duplicatesMu.Unlock()
+	if duplicatesFile == nil {
+		return
+	}
+	duplicatesFile.Close()
+	duplicatesFile = nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errorSidecarSuffix is appended to a file's name in the errors folder to hold its origin and failure reason
+const errorSidecarSuffix = ".error.json"
+
+// Failure reason codes. Files moved to the errors folder go to the subfolder of their code.
+const (
+	errHashFailed    = "hash_failed"     // The file could not be read to hash it
+	errExifRead      = "exif_read_error" // Its metadata could not be read
+	errConvertFailed = "convert_failed"  // HEIC/HEIF conversion failed
+	errCorrupt       = "corrupt"         // Truncated or damaged image or video (--corrupt-check)
+	errMoveFailed    = "move_failed"     // It could not be moved or placed; it stays in the source
+	errDeleteFailed  = "delete_failed"   // It could not be deleted; it stays in the source
+	errPlanMismatch  = "plan_mismatch"   // A planned operation no longer applies; it stays in the source
+)
+
+// errorsIndexName is the index of the errors folder, kept in the folder itself
+const errorsIndexName = "errors.json"
+
+// errorRecord describes a file that could not be processed: where it came from, where it is now and why
+type errorRecord struct {
+	Origin   string    `json:"origin"`             // Original source path
+	Location string    `json:"location,omitempty"` // Current path in the errors folder; empty if the file was left in place
+	Code     string    `json:"code"`               // Failure reason code (hash_failed, corrupt, ...)
+	Reason   string    `json:"reason"`
+	RunID    string    `json:"run_id"`
+	Time     time.Time `json:"time"`
+}
+
+var (
+	errorRecordsMu sync.Mutex
+	errorRecords   []errorRecord
+)
+
+// errorFolder is the subfolder of the errors folder for a failure reason code
+func errorFolder(code string) string {
+	return filepath.Join(errorsDir, code)
+}
+
+// inErrorsDir reports whether folder is in the errors folder
+func inErrorsDir(folder string) bool {
+	return folder == errorsDir || strings.HasPrefix(folder, errorsDir+string(filepath.Separator))
+}
+
+// recordError remembers a processing failure for the errors triage report. When the file was moved
+// into the errors folder (location != ""), a sidecar is written next to it so the origin and reason
+// survive after this run's report is gone.
+func recordError(origin, location, code, reason string) {
+	rec := errorRecord{Origin: origin, Location: location, Code: code, Reason: reason, RunID: runID, Time: time.Now()}
+
+	errorRecordsMu.Lock()
+	errorRecords = append(errorRecords, rec)
+	errorRecordsMu.Unlock()
+
+	if location == "" {
+		return
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(location+errorSidecarSuffix, append(data, '\n'), 0644); err != nil {
+		log.Printf("Could not write error sidecar for '%s': %v", location, err)
+	}
+}
+
+// snapshotErrorRecords returns a copy of the errors recorded so far
+func snapshotErrorRecords() []errorRecord {
+	errorRecordsMu.Lock()
+	defer errorRecordsMu.Unlock()
+	return append(make([]errorRecord, 0, len(errorRecords)), errorRecords...)
+}
+
+// errorsIndex is errors.json: every file waiting in the errors folder, and this run's failures
+// that left files in the source, grouped by reason code
+type errorsIndex struct {
+	Updated time.Time      `json:"updated"`
+	Counts  map[string]int `json:"counts"` // Code -> number of errors
+	Errors  []errorRecord  `json:"errors"`
+}
+
+// writeErrorsIndex updates errors.json in the errors folder. Entries of earlier runs are kept while
+// their file is still in the errors folder, so the index covers everything left to triage.
+func writeErrorsIndex(records []errorRecord) {
+	path := filepath.Join(errorsDir, errorsIndexName)
+	var index errorsIndex
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &index)
+	}
+	if len(index.Errors) == 0 && len(records) == 0 {
+		return
+	}
+	var kept []errorRecord
+	for _, rec := range index.Errors {
+		if rec.RunID != runID && rec.Location != "" && fileExists(rec.Location) {
+			kept = append(kept, rec)
+		}
+	}
+	index = errorsIndex{Updated: time.Now(), Counts: make(map[string]int), Errors: append(kept, records...)}
+	sort.SliceStable(index.Errors, func(i, j int) bool { return index.Errors[i].Code < index.Errors[j].Code })
+	for _, rec := range index.Errors {
+		index.Counts[rec.Code]++
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		log.Printf("Could not encode errors index: %v", err)
+		return
+	}
+	if err := os.MkdirAll(errorsDir, 0755); err != nil {
+		log.Printf("Could not write errors index: %v", err)
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		log.Printf("Could not write errors index '%s': %v", path, err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		log.Printf("Could not write errors index '%s': %v", path, err)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Destination layouts (--layout)
+const (
+	layoutYear   = "year"   // sorted_photos/2021/
+	layoutEvents = "events" // sorted_photos/2021/2021-06-12_Event/
+)
+
+// event is a run of photos and videos taken without a gap of --event-gap between them
+type event struct {
+	start, end time.Time
+	name       string
+}
+
+// scannedDate is a file's date as found by the events pre-pass
+type scannedDate struct {
+	date     dateInfo
+	external bool
+}
+
+var (
+	eventsMu     sync.Mutex
+	events       = make(map[string][]*event) // Year -> its events
+	scannedDates map[string]scannedDate      // Path -> date, so files are read once; nil without --layout events
+)
+
+// checkLayout validates --layout and --event-gap
+func checkLayout() error {
+	switch *layout {
+	case layoutYear:
+	case layoutEvents:
+		if *eventGap <= 0 {
+			return fmt.Errorf("--event-gap must be positive, got %v", *eventGap)
+		}
+	default:
+		return fmt.Errorf("%q (expected year or events)", *layout)
+	}
+	return nil
+}
+
+// groupEvents dates every photo and video of the run up front (--layout events) and splits each
+// year's into events wherever no photo was taken for --event-gap
+func groupEvents(jobs []fileJob) {
+	if *layout != layoutEvents {
+		return
+	}
+	log.Println("Reading capture dates to group photos into events...")
+	var mu sync.Mutex
+	scanned := make(map[string]scannedDate)
+	work := make(chan fileJob)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range work {
+				mediaType := "image"
+				if videoExts[mediaExt(job.path)] {
+					mediaType = "video"
+				}
+				d, external := fileDate(job, mediaType)
+				mu.Lock()
+				scanned[job.path] = scannedDate{d, external}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, job := range jobs {
+		if interrupted() {
+			break
+		}
+		if ext := mediaExt(job.path); imageExts[ext] || videoExts[ext] {
+			work <- job
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	byYear := make(map[string][]time.Time)
+	for _, s := range scanned {
+		if s.date.Year != "" && s.date.Year != "none" && s.date.Year != "error" && !s.date.Time.IsZero() {
+			byYear[s.date.Year] = append(byYear[s.date.Year], s.date.Time)
+		}
+	}
+	dated, count := 0, 0
+	for year, times := range byYear {
+		sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+		for _, t := range times {
+			eventFolder(year, t)
+		}
+		dated += len(times)
+		count += len(events[year])
+	}
+	scannedDates = scanned
+	log.Printf("Grouped %d dated files into %d events (a gap of %v starts a new one)", dated, count, *eventGap)
+}
+
+// eventFolder names the event of a file taken at t in year: the event it falls in or within
+// --event-gap of, or a new one named after its day. A second event on the same day gets a
+// numbered name (2021-06-12_Event_2).
+func eventFolder(year string, t time.Time) string {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	for _, e := range events[year] {
+		if !t.Before(e.start.Add(-*eventGap)) && !t.After(e.end.Add(*eventGap)) {
+			if t.Before(e.start) {
+				e.start = t
+			}
+			if t.After(e.end) {
+				e.end = t
+			}
+			return e.name
+		}
+	}
+	day := t.Format("2006-01-02")
+	name := day + "_Event"
+	for n := 2; ; n++ {
+		taken := false
+		for _, e := range events[year] {
+			taken = taken || e.name == name
+		}
+		if !taken {
+			break
+		}
+		name = fmt.Sprintf("%s_Event_%d", day, n)
+	}
+	events[year] = append(events[year], &event{start: t, end: t, name: name})
+	return name
+}
+
+// prescannedDate returns the date the events pre-pass found for a file
+func prescannedDate(path string) (scannedDate, bool) {
+	if scannedDates == nil {
+		return scannedDate{}, false
+	}
+	s, ok := scannedDates[path]
+	return s, ok
+}
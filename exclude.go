@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// excludePatterns are the globs of source files and folders to leave alone (--exclude)
+var excludePatterns excludeList
+
+// excludePattern is one --exclude glob. Patterns with a slash are matched against the path
+// relative to the source folder, others against the file or folder name at any depth.
+type excludePattern struct {
+	glob string
+	re   *regexp.Regexp
+	path bool // Matched against the relative path rather than the name
+}
+
+// excludeList implements flag.Value to collect repeated --exclude flags
+type excludeList []excludePattern
+
+func (l *excludeList) String() string {
+	var out []string
+	for _, p := range *l {
+		out = append(out, p.glob)
+	}
+	return strings.Join(out, ", ")
+}
+
+func (l *excludeList) Set(s string) error {
+	glob := filepath.ToSlash(strings.TrimSpace(s))
+	if glob == "" {
+		return fmt.Errorf("empty pattern")
+	}
+	re, err := globRegexp(strings.TrimPrefix(glob, "/"))
+	if err != nil {
+		return fmt.Errorf("pattern %q: %v", s, err)
+	}
+	*l = append(*l, excludePattern{glob: glob, re: re, path: strings.Contains(glob, "/")})
+	return nil
+}
+
+// globRegexp translates a glob into a regular expression: * and ? stop at slashes, ** crosses
+// them, and [...] is a character class ([!...] negated)
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?") // **/ also matches no folder at all
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// isExcluded reports whether a source file or folder matches an --exclude pattern. Folders also
+// match patterns for their contents, so "**/node_modules/**" skips the folder as a whole.
+func isExcluded(path string, dir bool) bool {
+	if len(excludePatterns) == 0 {
+		return false
+	}
+	name := filepath.Base(path)
+	rel, err := filepath.Rel(sourceDir, path)
+	inSource := err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+	rel = filepath.ToSlash(rel)
+	for _, p := range excludePatterns {
+		switch {
+		case !p.path:
+			if p.re.MatchString(name) {
+				return true
+			}
+		case inSource:
+			if p.re.MatchString(rel) || (dir && p.re.MatchString(rel+"/")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// beyondMaxDepth reports whether a source folder lies deeper than --max-depth: with 1 only the
+// files directly in the source are sorted, with 2 also those in its folders, and so on
+func beyondMaxDepth(dir string) bool {
+	if *maxDepth <= 0 {
+		return false
+	}
+	rel, err := filepath.Rel(sourceDir, dir)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	return len(strings.Split(rel, string(filepath.Separator))) >= *maxDepth
+}
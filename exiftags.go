@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// EXIF tags that goexif does not know about but we need
+const (
+	exifOffsetTime          exif.FieldName = "OffsetTime"
+	exifOffsetTimeOriginal  exif.FieldName = "OffsetTimeOriginal"
+	exifOffsetTimeDigitized exif.FieldName = "OffsetTimeDigitized"
+	exifBodySerialNumber    exif.FieldName = "BodySerialNumber"
+)
+
+// extraExifFields maps tag IDs in the Exif sub-IFD to the extra field names above
+var extraExifFields = map[uint16]exif.FieldName{
+	0x9010: exifOffsetTime,
+	0x9011: exifOffsetTimeOriginal,
+	0x9012: exifOffsetTimeDigitized,
+	0xA431: exifBodySerialNumber,
+}
+
+func init() {
+	exif.RegisterParsers(extraTagsParser{})
+}
+
+// extraTagsParser loads extraExifFields from the Exif sub-IFD after goexif's own parser has run
+type extraTagsParser struct{}
+
+func (extraTagsParser) Parse(x *exif.Exif) error {
+	ptr, err := x.Get(exif.ExifIFDPointer)
+	if err != nil {
+		return nil
+	}
+	offset, err := ptr.Int64(0)
+	if err != nil {
+		return nil
+	}
+	r := bytes.NewReader(x.Raw)
+	if _, err := r.Seek(offset, 0); err != nil {
+		return nil
+	}
+	dir, _, err := tiff.DecodeDir(r, x.Tiff.Order)
+	if err != nil {
+		return nil // Missing extras must never make the whole EXIF block unusable
+	}
+	x.LoadTags(dir, extraExifFields, false)
+	return nil
+}
+
+// exifString returns a trimmed string tag value, or "" when absent
+func exifString(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil {
+		return ""
+	}
+	val, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return trimExifString(val)
+}
+
+// exifInt returns the first integer value of a tag, or 0 when absent
+func exifInt(x *exif.Exif, name exif.FieldName) int {
+	tag, err := x.Get(name)
+	if err != nil {
+		return 0
+	}
+	v, err := tag.Int(0)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// trimExifString removes the NUL padding and whitespace cameras leave in ASCII tags
+func trimExifString(s string) string {
+	return string(bytes.TrimSpace(bytes.TrimRight([]byte(s), "\x00")))
+}
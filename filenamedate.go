@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// filenameDatePatterns find dates in the names phones, cameras and apps give files, most specific
+// first. Groups are named after the part of the date they capture; the time is optional. A name
+// may also be a Unix timestamp, in seconds (epoch) or milliseconds (epochms).
+var filenameDatePatterns = []*regexp.Regexp{
+	// IMG_20210615_123456, PXL_20230101_123456789, Screenshot_20220310-123456
+	regexp.MustCompile(`(?:^|[^0-9])(?P<year>(?:19|20)\d{2})(?P<month>\d{2})(?P<day>\d{2})[_-](?P<hour>\d{2})(?P<minute>\d{2})(?P<second>\d{2})`),
+	// 2019-07-04 13.22.01 (Dropbox camera uploads), 2019-07-04_13-22-01
+	regexp.MustCompile(`(?:^|[^0-9])(?P<year>(?:19|20)\d{2})-(?P<month>\d{2})-(?P<day>\d{2})[ _T](?P<hour>\d{2})[.:-](?P<minute>\d{2})[.:-](?P<second>\d{2})`),
+	// signal-2021-03-04-120000
+	regexp.MustCompile(`(?:^|[^0-9])(?P<year>(?:19|20)\d{2})-(?P<month>\d{2})-(?P<day>\d{2})-(?P<hour>\d{2})(?P<minute>\d{2})(?P<second>\d{2})(?:[^0-9]|$)`),
+	// 1592345678901: milliseconds since 1970, as chat and social apps name exports
+	regexp.MustCompile(`^(?P<epochms>1\d{12})$`),
+	// Dates alone: 20210615, 2021-06-15, 2021_06_15
+	regexp.MustCompile(`(?:^|[^0-9])(?P<year>(?:19|20)\d{2})(?P<month>\d{2})(?P<day>\d{2})(?:[^0-9]|$)`),
+	regexp.MustCompile(`(?:^|[^0-9])(?P<year>(?:19|20)\d{2})[-_](?P<month>\d{2})[-_](?P<day>\d{2})(?:[^0-9]|$)`),
+}
+
+// whatsappName matches the names WhatsApp gives the media it saves (IMG-20200131-WA0012.jpg,
+// VID-20200131-WA0003.mp4). WhatsApp strips their metadata, so the name holds the only date.
+var whatsappName = regexp.MustCompile(`(?i)^(?:IMG|VID|AUD|PTT|STK|DOC)-(?P<year>\d{4})(?P<month>\d{2})(?P<day>\d{2})-WA\d+`)
+
+// whatsappFolder is the subfolder of a year folder WhatsApp media go to with --whatsapp-subfolder
+const whatsappFolder = "whatsapp"
+
+// isWhatsApp reports whether a file is named like WhatsApp media
+func isWhatsApp(path string) bool {
+	return whatsappName.MatchString(filepath.Base(path))
+}
+
+// filenamePatterns are the user's own filename date patterns (--filename-pattern), tried before
+// the built-in ones
+var filenamePatterns filenamePatternList
+
+// filenamePatternList is a repeatable flag of regular expressions naming their date groups like
+// filenameDatePatterns do
+type filenamePatternList []*regexp.Regexp
+
+func (l *filenamePatternList) String() string {
+	var out []string
+	for _, re := range *l {
+		out = append(out, re.String())
+	}
+	return strings.Join(out, ", ")
+}
+
+func (l *filenamePatternList) Set(s string) error {
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return err
+	}
+	if re.SubexpIndex("year") < 0 && re.SubexpIndex("epoch") < 0 && re.SubexpIndex("epochms") < 0 {
+		return fmt.Errorf("pattern %q has no (?P<year>...), (?P<epoch>...) or (?P<epochms>...) group", s)
+	}
+	*l = append(*l, re)
+	return nil
+}
+
+// filenameDate parses a date from a file's name: WhatsApp and DJI media, legacy videos and the
+// user's own patterns always, other names with --filename-dates. Patterns see the name without its extension.
+func filenameDate(path string) (dateInfo, bool) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if t, ok := matchFilenameDate(whatsappName, name); ok {
+		return dateInfo{Year: t.Format("2006"), Source: "WhatsApp file name", Time: t}, true
+	}
+	if t, ok := matchFilenameDate(djiName, name); ok {
+		return dateInfo{Year: t.Format("2006"), Source: "DJI file name", Time: t}, true
+	}
+	for _, re := range filenamePatterns {
+		if t, ok := matchFilenameDate(re, name); ok {
+			return dateInfo{Year: t.Format("2006"), Source: "filename", Time: t}, true
+		}
+	}
+	// Legacy videos (MPEG, FLV) rarely hold a date of their own, so their names are always read
+	if !*filenameDates && !legacyVideoExts[mediaExt(path)] {
+		return dateInfo{}, false
+	}
+	for _, re := range filenameDatePatterns {
+		if t, ok := matchFilenameDate(re, name); ok {
+			return dateInfo{Year: t.Format("2006"), Source: "filename", Time: t}, true
+		}
+	}
+	return dateInfo{}, false
+}
+
+// matchFilenameDate builds a time from the named groups of a pattern's match, rejecting
+// impossible and future dates
+func matchFilenameDate(re *regexp.Regexp, name string) (time.Time, bool) {
+	m := re.FindStringSubmatch(name)
+	if m == nil {
+		return time.Time{}, false
+	}
+	parts := map[string]int64{"year": 0, "month": 1, "day": 1, "hour": 0, "minute": 0, "second": 0, "epoch": -1, "epochms": -1}
+	for i, group := range re.SubexpNames() {
+		if _, ok := parts[group]; ok && m[i] != "" {
+			n, err := strconv.ParseInt(m[i], 10, 64)
+			if err != nil {
+				return time.Time{}, false
+			}
+			parts[group] = n
+		}
+	}
+	var t time.Time
+	switch {
+	case parts["epochms"] >= 0:
+		t = time.UnixMilli(parts["epochms"])
+	case parts["epoch"] >= 0:
+		t = time.Unix(parts["epoch"], 0)
+	default:
+		t = time.Date(int(parts["year"]), time.Month(parts["month"]), int(parts["day"]), int(parts["hour"]), int(parts["minute"]), int(parts["second"]), 0, time.Local)
+		// time.Date normalizes overflow (month 13, hour 25); a normalized date was not a real one
+		if int64(t.Year()) != parts["year"] || int64(t.Month()) != parts["month"] || int64(t.Day()) != parts["day"] ||
+			int64(t.Hour()) != parts["hour"] || int64(t.Minute()) != parts["minute"] || int64(t.Second()) != parts["second"] {
+			return time.Time{}, false
+		}
+	}
+	if t.Year() <= 1900 || t.After(time.Now().AddDate(0, 0, 1)) {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// scanFileList returns the jobs for the files listed in name ("-" reads stdin), one path per line
+// or NUL-separated (find -print0). Relative paths are resolved against the working directory;
+// directories, missing files and repeated paths are skipped.
+func scanFileList(name string) ([]fileJob, error) {
+	var data []byte
+	var err error
+	if name == "-" {
+		log.Println("Reading the list of files to process from stdin...")
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read file list: %v", err)
+	}
+
+	sep := []byte("\n")
+	if bytes.IndexByte(data, 0) >= 0 {
+		sep = []byte{0}
+	}
+	var jobs []fileJob
+	seen := make(map[string]bool)
+	for _, line := range bytes.Split(data, sep) {
+		if interrupted() {
+			return jobs, errInterrupted
+		}
+		path := string(bytes.TrimRight(line, "\r"))
+		if path == "" {
+			continue
+		}
+		path, err := filepath.Abs(path)
+		if err != nil || seen[path] {
+			continue
+		}
+		seen[path] = true
+		if isSymlink(path) {
+			if _, ok := sourceLink(path); !ok {
+				continue
+			}
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Printf("Skipping listed file '%s': %v", path, err)
+			continue
+		}
+		if info.IsDir() {
+			continue // find lists directories too
+		}
+		if !info.Mode().IsRegular() {
+			log.Printf("Skipping listed path '%s': not a regular file", path)
+			continue
+		}
+		if job, ok := sourceJob(path, info); ok {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is how much of a file sniffExt reads
+const sniffLen = 64
+
+// ftypBrands maps the major brands of ISO base media files (the ftyp box) to their extension
+var ftypBrands = map[string]string{
+	"heic": ".heic", "heix": ".heic", "hevc": ".heic", "hevx": ".heic", "heim": ".heic", "heis": ".heic",
+	"hevm": ".heic", "hevs": ".heic", "mif1": ".heif", "msf1": ".heif",
+	"avif": ".avif", "avis": ".avif",
+	"qt  ": ".mov",
+	"isom": ".mp4", "iso2": ".mp4", "iso4": ".mp4", "iso5": ".mp4", "iso6": ".mp4", "mp41": ".mp4", "mp42": ".mp4",
+	"avc1": ".mp4", "dash": ".mp4", "MSNV": ".mp4", "XAVC": ".mp4",
+	"M4V ": ".m4v", "M4VH": ".m4v", "M4VP": ".m4v",
+	"3gp4": ".3gp", "3gp5": ".3gp", "3gp6": ".3gp", "3gp7": ".3gp", "3gg6": ".3gp", "3ge6": ".3gp",
+	"3g2a": ".3g2", "3g2b": ".3g2", "3g2c": ".3g2",
+}
+
+// formatGroups puts extensions of one format together: content sniffed as any of them confirms
+// an extension of the group
+var formatGroups = map[string]string{
+	".jpg": "jpeg", ".jpeg": "jpeg",
+	".tif": "tiff", ".tiff": "tiff",
+	".heic": "heif", ".heif": "heif", ".hif": "heif",
+	".mp4": "isobmff", ".m4v": "isobmff", ".mov": "isobmff", ".3gp": "isobmff", ".3g2": "isobmff",
+	".wmv": "asf", ".asf": "asf",
+}
+
+// sniffExt recognizes a media or archive file by its first bytes, returning its usual extension,
+// or "" when the content is not one the sorter handles
+func sniffExt(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	head := make([]byte, sniffLen)
+	n, _ := f.Read(head)
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return ".jpg"
+	case bytes.HasPrefix(head, pngSignature):
+		return ".png"
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return ".gif"
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return ".tif"
+	case bytes.HasPrefix(head, []byte("BM")) && len(head) >= 14 && bytes.Equal(head[6:10], []byte{0, 0, 0, 0}):
+		return ".bmp"
+	case len(head) >= 12 && bytes.HasPrefix(head, []byte("RIFF")) && string(head[8:12]) == "WEBP":
+		return ".webp"
+	case len(head) >= 12 && bytes.HasPrefix(head, []byte("RIFF")) && string(head[8:12]) == "AVI ":
+		return ".avi"
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		return ftypBrands[string(head[8:12])]
+	case bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return ".mkv"
+	case bytes.HasPrefix(head, []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11}):
+		return ".wmv"
+	case bytes.HasPrefix(head, []byte("FLV\x01")):
+		return ".flv"
+	case bytes.HasPrefix(head, []byte{0x00, 0x00, 0x01, 0xBA}), bytes.HasPrefix(head, []byte{0x00, 0x00, 0x01, 0xB3}):
+		return ".mpg"
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return ".zip"
+	case bytes.HasPrefix(head, []byte("Rar!\x1A\x07")):
+		return ".rar"
+	case bytes.HasPrefix(head, []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C}):
+		return ".7z"
+	}
+	return ""
+}
+
+// mediaExt is the lower-case extension a file is handled by. That is its own extension, unless
+// its content shows it is another kind of media (a HEIC named .jpg, a JPEG named .png), or it has
+// no recognized extension but is media (IMG_0001 without an extension). RAW files, which are TIFF
+// or ISO media inside, and sidecars keep their extension. Archive content never changes it: only
+// files named as archives are extracted (and deleted); a renamed .docx or .apk stays a plain file.
+func mediaExt(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if rawExts[ext] || isSidecar(path) || (*audioFiles && audioExts[ext]) {
+		return ext // An .m4a is MP4 inside
+	}
+	sniffed := sniffExt(path)
+	if sniffed == "" || sniffed == ext || (formatGroups[ext] != "" && formatGroups[ext] == formatGroups[sniffed]) {
+		return ext
+	}
+	if archiveExts[ext] || archiveExts[sniffed] {
+		return ext
+	}
+	return sniffed
+}
+
+// sortedName is the name a file is sorted under: canonicalName, and with --fix-extensions the
+// extension of its content (ext, from mediaExt) where its own is wrong or missing
+func sortedName(path, ext string) string {
+	name := filepath.Base(path)
+	own := strings.ToLower(filepath.Ext(name))
+	if *fixExtensions && ext != own && (formatGroups[ext] == "" || formatGroups[ext] != formatGroups[own]) {
+		name = strings.TrimSuffix(name, filepath.Ext(name)) + ext
+	}
+	return canonicalName(name)
+}
+
+// extensionNote describes, for the manifest, an extension that changed between a source and its
+// sorted file other than by canonicalization, or returns ""
+func extensionNote(source, dest string) string {
+	from, to := canonicalName("x"+strings.ToLower(filepath.Ext(source))), canonicalName("x"+strings.ToLower(filepath.Ext(dest)))
+	if strings.EqualFold(from, to) || dest == "" {
+		return ""
+	}
+	from, to = strings.TrimPrefix(from, "x"), strings.TrimPrefix(to, "x")
+	if from == "" {
+		from = "(none)"
+	}
+	return fmt.Sprintf("extension corrected from %s to %s", from, to)
+}
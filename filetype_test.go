@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestMediaExt(t *testing.T) {
+	jpeg := testJPEG()
+	zip := []byte("PK\x03\x04\x14\x00\x00\x00\x08\x00")
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"IMG_0001.jpg", jpeg, ".jpg"},
+		{"IMG_0001", jpeg, ".jpg"},
+		{"IMG_0001.png", jpeg, ".jpg"},
+		{"photos.zip", zip, ".zip"},
+		{"report.docx", zip, ".docx"},
+		{"IMG_0001.jpg", zip, ".jpg"},
+		{"report", zip, ""}, // A .docx or .apk that lost its extension is not extracted and deleted
+		{"app.bin", zip, ".bin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mediaExt(writeTestFile(t, tt.name, tt.data)); got != tt.want {
+				t.Errorf("mediaExt = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
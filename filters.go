@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// onlyExts are the extensions a run is limited to (--only-ext), with their dots; empty for all files
+var onlyExts map[string]bool
+
+// sinceDay and untilDay bound the dates of the files a run touches (--since, --until) as
+// yyyy-mm-dd, both inclusive; empty when unbounded
+var sinceDay, untilDay string
+
+// loadFilters parses --only-ext, --since and --until
+func loadFilters() error {
+	if *onlyExt != "" {
+		if onlyExts = parseExtList(*onlyExt); len(onlyExts) == 0 {
+			return fmt.Errorf("--only-ext lists no extensions")
+		}
+	}
+	var err error
+	if sinceDay, err = parseDateBound(*since, false); err != nil {
+		return fmt.Errorf("--since: %v", err)
+	}
+	if untilDay, err = parseDateBound(*until, true); err != nil {
+		return fmt.Errorf("--until: %v", err)
+	}
+	if sinceDay != "" && untilDay != "" && sinceDay > untilDay {
+		return fmt.Errorf("--since %s is after --until %s", *since, *until)
+	}
+	return nil
+}
+
+// parseExtList parses a comma-separated list of extensions, with or without their dots
+// ("jpg,.MP4"), into a set of lower-case extensions with dots
+func parseExtList(list string) map[string]bool {
+	exts := make(map[string]bool)
+	for _, ext := range strings.Split(list, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts[ext] = true
+	}
+	return exts
+}
+
+// parseDateBound turns a year, month or day (2015, 2015-06, 2015-06-01) into the first day of that
+// period, or the last one for an end bound
+func parseDateBound(value string, end bool) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006"} {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		if end {
+			switch layout {
+			case "2006":
+				t = t.AddDate(1, 0, -1)
+			case "2006-01":
+				t = t.AddDate(0, 1, -1)
+			}
+		}
+		return t.Format("2006-01-02"), nil
+	}
+	return "", fmt.Errorf("%q is not a year, month or day (2015, 2015-06 or 2015-06-01)", value)
+}
+
+// filterByExt drops the jobs whose extension is not listed in --only-ext. Companions follow the
+// file they belong to, so the sidecar of a listed photo goes with it and the RAW of an unlisted
+// one stays.
+func filterByExt(jobs []fileJob) []fileJob {
+	if len(onlyExts) == 0 {
+		return jobs
+	}
+	kept := jobs[:0]
+	for _, job := range jobs {
+		if onlyExts[strings.ToLower(filepath.Ext(job.path))] {
+			kept = append(kept, job)
+			continue
+		}
+		for _, j := range append([]fileJob{job}, job.companions...) {
+			atomic.AddInt64(&totalBytes, -j.size)
+			counterMu.Lock()
+			filteredCount++
+			counterMu.Unlock()
+		}
+	}
+	return kept
+}
+
+// dateRangeSet reports whether the run is limited to a date range
+func dateRangeSet() bool {
+	return sinceDay != "" || untilDay != ""
+}
+
+// noDateToFilter is why files without a date are left alone with --since or --until
+const noDateToFilter = "no date to match --since/--until"
+
+// outOfDateRange tells why a file's date keeps it out of the run (--since, --until), or returns ""
+// when it is in range. A date known only to the year is compared by its year.
+func outOfDateRange(date dateInfo) string {
+	if !dateRangeSet() {
+		return ""
+	}
+	if date.Year == "" || date.Year == "none" || date.Year == "error" {
+		return noDateToFilter
+	}
+	from, to := sinceDay, untilDay
+	day := date.Time.Format("2006-01-02")
+	if date.Time.IsZero() {
+		day = date.Year
+		if from != "" {
+			from = from[:4]
+		}
+		if to != "" {
+			to = to[:4]
+		}
+	}
+	if (from != "" && day < from) || (to != "" && day > to) {
+		return "dated outside --since/--until"
+	}
+	return ""
+}
+
+// leaveFiltered leaves a file in the source because the run's filters exclude it
+func leaveFiltered(path, reason string) {
+	log.Printf("Leaving '%s' in place (%s)", filepath.Base(path), reason)
+	counterMu.Lock()
+	filteredCount++
+	counterMu.Unlock()
+}
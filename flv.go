@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// legacyVideoExts are the video formats with no standard recording date. Their names are read
+// with the built-in file name patterns even without --filename-dates.
+var legacyVideoExts = map[string]bool{".flv": true, ".mpg": true, ".mpeg": true}
+
+// flvDateKeys are the onMetaData properties encoders record a creation date in, most reliable first
+var flvDateKeys = []string{"creationdate", "creationtime", "metadatadate"}
+
+// flvDateLayouts are the text forms of those dates: Flash Media Encoder writes the first
+var flvDateLayouts = []string{"Mon Jan _2 15:04:05 2006", time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006:01:02 15:04:05"}
+
+// flvScanTags is how many tags of an FLV are searched for the onMetaData script tag, which
+// encoders write first
+const flvScanTags = 16
+
+// extractFLVCreationTime reads the creation date from an FLV's onMetaData script tag
+func extractFLVCreationTime(path string) (time.Time, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("Error opening FLV file for metadata reading: %s: %v", filepath.Base(path), err)
+		return time.Time{}, false
+	}
+	defer f.Close()
+
+	header := make([]byte, 9)
+	if _, err := f.ReadAt(header, 0); err != nil || string(header[0:3]) != "FLV" {
+		return time.Time{}, false
+	}
+	// Tags follow the header and a 4-byte previous tag size: type, 24-bit data size, timestamp, stream ID
+	offset := int64(binary.BigEndian.Uint32(header[5:9])) + 4
+	tag := make([]byte, 11)
+	for i := 0; i < flvScanTags; i++ {
+		if _, err := f.ReadAt(tag, offset); err != nil {
+			break
+		}
+		size := int64(tag[1])<<16 | int64(tag[2])<<8 | int64(tag[3])
+		if tag[0] == 18 && size <= maxMetadataSize { // Script data
+			data := make([]byte, size)
+			if _, err := f.ReadAt(data, offset+11); err != nil {
+				break
+			}
+			if t, key, ok := flvMetadataDate(data); ok {
+				log.Printf("Extracted creation time (onMetaData %s) from %s: %s", key, filepath.Base(path), t.Format(time.RFC3339))
+				return t, true
+			}
+		}
+		offset += 11 + size + 4
+	}
+	log.Printf("No creation date in the onMetaData of FLV file: %s", filepath.Base(path))
+	return time.Time{}, false
+}
+
+// flvMetadataDate reads the creation date from an onMetaData script tag: the AMF0 string
+// "onMetaData" followed by an ECMA array or object of properties
+func flvMetadataDate(data []byte) (time.Time, string, bool) {
+	r := amfReader{data: data}
+	if name, ok := r.value(); !ok || name != "onMetaData" {
+		return time.Time{}, "", false
+	}
+	props, ok := r.value()
+	if !ok {
+		return time.Time{}, "", false
+	}
+	m, _ := props.(map[string]any)
+	for _, key := range flvDateKeys {
+		switch v := m[key].(type) {
+		case time.Time:
+			return v, key, true
+		case string:
+			v = strings.TrimSpace(v)
+			for _, layout := range flvDateLayouts {
+				if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+					return t, key, true
+				}
+			}
+		}
+	}
+	return time.Time{}, "", false
+}
+
+// amfReader decodes the AMF0 values of Flash script data: numbers, booleans, strings, dates and
+// nested objects. Other types end the decoding.
+type amfReader struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func (r *amfReader) take(n int) ([]byte, bool) {
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, false
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, true
+}
+
+func (r *amfReader) str(lenBytes int) (string, bool) {
+	b, ok := r.take(lenBytes)
+	if !ok {
+		return "", false
+	}
+	n := 0
+	for _, c := range b {
+		n = n<<8 | int(c)
+	}
+	s, ok := r.take(n)
+	return string(s), ok
+}
+
+func (r *amfReader) value() (any, bool) {
+	marker, ok := r.take(1)
+	if !ok {
+		return nil, false
+	}
+	switch marker[0] {
+	case 0x00: // Number
+		b, ok := r.take(8)
+		if !ok {
+			return nil, false
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), true
+	case 0x01: // Boolean
+		b, ok := r.take(1)
+		return ok && b[0] != 0, ok
+	case 0x02: // String
+		return r.str(2)
+	case 0x0C: // Long string
+		return r.str(4)
+	case 0x05, 0x06: // Null, undefined
+		return nil, true
+	case 0x0B: // Date: milliseconds since 1970 (UTC), then an unused time zone
+		b, ok := r.take(10)
+		if !ok {
+			return nil, false
+		}
+		ms := math.Float64frombits(binary.BigEndian.Uint64(b))
+		if math.IsNaN(ms) || math.IsInf(ms, 0) {
+			return nil, true
+		}
+		return time.UnixMilli(int64(ms)).UTC(), true
+	case 0x03, 0x08: // Object, ECMA array (with a count first): properties up to an empty name and 0x09
+		if marker[0] == 0x08 {
+			if _, ok := r.take(4); !ok {
+				return nil, false
+			}
+		}
+		if r.depth++; r.depth > 8 {
+			return nil, false
+		}
+		defer func() { r.depth-- }()
+		m := make(map[string]any)
+		for {
+			name, ok := r.str(2)
+			if !ok {
+				return m, true // Some encoders leave off the end marker
+			}
+			if name == "" {
+				r.take(1) // Object end
+				return m, true
+			}
+			v, ok := r.value()
+			if !ok {
+				return m, true
+			}
+			m[strings.ToLower(name)] = v
+		}
+	case 0x0A: // Strict array
+		b, ok := r.take(4)
+		if !ok {
+			return nil, false
+		}
+		if r.depth++; r.depth > 8 {
+			return nil, false
+		}
+		defer func() { r.depth-- }()
+		for n := binary.BigEndian.Uint32(b); n > 0; n-- {
+			if _, ok := r.value(); !ok {
+				return nil, false
+			}
+		}
+		return nil, true
+	}
+	return nil, false
+}
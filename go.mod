@@ -1,5 +1,14 @@
 module photo-sorter
 
-go 1.25.1
+go 1.26.0
 
-require github.com/rwcarlsen/goexif v0.0.0-20190401172101-9e8deecbddbd
+require (
+	github.com/cespare/xxhash/v2 v2.3.0
+	github.com/rwcarlsen/goexif v0.0.0-20190401172101-9e8deecbddbd
+	github.com/zeebo/blake3 v0.2.4
+	go.etcd.io/bbolt v1.5.0
+	golang.org/x/image v0.46.0
+	golang.org/x/sys v0.48.0
+)
+
+require github.com/klauspost/cpuid/v2 v2.0.12 // indirect
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+	_ "time/tzdata" // Zone rules for gpsZones on systems without a zoneinfo database (Windows)
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// gpsZone is a region whose photos are given the local time of an IANA time zone. The boxes are
+// coarse; where they overlap, the first listed wins, so smaller regions come first.
+type gpsZone struct {
+	minLat, maxLat, minLon, maxLon float64
+	name                           string
+}
+
+var gpsZones = []gpsZone{
+	{18.5, 22.5, -161, -154, "Pacific/Honolulu"},
+	{51, 72, -170, -129, "America/Anchorage"},
+	{24, 49, -125, -114.5, "America/Los_Angeles"},
+	{24, 49, -114.5, -102, "America/Denver"},
+	{24, 49, -102, -87, "America/Chicago"},
+	{24, 49, -87, -66, "America/New_York"},
+	{49, 70, -141, -120, "America/Vancouver"},
+	{49, 70, -120, -102, "America/Edmonton"},
+	{49, 70, -102, -89, "America/Winnipeg"},
+	{42, 63, -89, -67, "America/Toronto"},
+	{43, 60, -67, -52, "America/Halifax"},
+	{14, 24, -118, -86, "America/Mexico_City"},
+	{24, 32.7, -118, -103, "America/Mexico_City"},
+	{-55, -21.8, -74, -53.6, "America/Argentina/Buenos_Aires"},
+	{-34, 5.3, -74, -34, "America/Sao_Paulo"},
+	{-18.5, -0.5, -81.5, -68.5, "America/Lima"},
+	{63, 67, -25, -13, "Atlantic/Reykjavik"},
+	{36.8, 42.2, -9.6, -6.2, "Europe/Lisbon"},
+	{49.8, 61, -11, 2, "Europe/London"},
+	{59.5, 70.1, 20.5, 31.6, "Europe/Helsinki"},
+	{54.5, 71.5, 4.5, 20.5, "Europe/Stockholm"},
+	{35, 42, 19.5, 29.7, "Europe/Athens"},
+	{36, 42.1, 26, 45, "Europe/Istanbul"},
+	{43.5, 48.3, 20.2, 29.7, "Europe/Bucharest"},
+	{44.3, 56.2, 23, 40.2, "Europe/Kyiv"},
+	{41, 70, 27, 60, "Europe/Moscow"},
+	{35, 55, -9.5, 24, "Europe/Paris"},
+	{29.5, 33.4, 34.2, 35.9, "Asia/Jerusalem"},
+	{22, 31.7, 24.7, 35, "Africa/Cairo"},
+	{22.5, 26.5, 51, 56.5, "Asia/Dubai"},
+	{25, 38.5, 44, 63.5, "Asia/Tehran"},
+	{-35, -22, 16, 33, "Africa/Johannesburg"},
+	{-5, 5.5, 33.5, 42, "Africa/Nairobi"},
+	{27, 36.2, -13.2, -1, "Africa/Casablanca"},
+	{6, 36, 68, 97.5, "Asia/Kolkata"},
+	{26.3, 30.5, 80, 88.2, "Asia/Kathmandu"},
+	{5.5, 23.5, 97.5, 110, "Asia/Bangkok"},
+	{0.8, 7.5, 99.5, 119.5, "Asia/Singapore"},
+	{-11, 6, 95, 115, "Asia/Jakarta"},
+	{4.5, 21.5, 116, 127, "Asia/Manila"},
+	{21.8, 25.4, 119.3, 122.1, "Asia/Taipei"},
+	{33, 39, 124, 131, "Asia/Seoul"},
+	{24, 46, 122.9, 146, "Asia/Tokyo"},
+	{18, 54, 73.5, 135, "Asia/Shanghai"},
+	{-26, -10.5, 129, 138, "Australia/Darwin"},
+	{-35.5, -13.5, 112.9, 129, "Australia/Perth"},
+	{-38.1, -26, 129, 141, "Australia/Adelaide"},
+	{-29, -10, 138, 154, "Australia/Brisbane"},
+	{-44, -28.1, 141, 154, "Australia/Sydney"},
+	{-47.5, -34, 166, 179, "Pacific/Auckland"},
+}
+
+// gpsLocation returns the time zone of a position: the IANA zone of its region, or elsewhere the
+// zone its longitude falls in (15° per hour, as at sea)
+func gpsLocation(lat, lon float64) *time.Location {
+	for _, z := range gpsZones {
+		if lat >= z.minLat && lat <= z.maxLat && lon >= z.minLon && lon <= z.maxLon {
+			if loc, err := time.LoadLocation(z.name); err == nil {
+				return loc
+			}
+		}
+	}
+	hours := int(math.Round(lon / 15))
+	return time.FixedZone(fmt.Sprintf("UTC%+d", hours), hours*3600)
+}
+
+// gpsTime reads the UTC time the GPS receiver recorded (GPSDateStamp and GPSTimeStamp)
+func gpsTime(x *exif.Exif) (time.Time, bool) {
+	day, err := time.Parse("2006:01:02", exifString(x, exif.GPSDateStamp))
+	if err != nil {
+		return time.Time{}, false
+	}
+	tag, err := x.Get(exif.GPSTimeStamp)
+	if err != nil || tag.Count < 3 {
+		return time.Time{}, false
+	}
+	var seconds float64
+	for i, unit := range []float64{3600, 60, 1} {
+		num, den, err := tag.Rat2(i)
+		if err != nil || den == 0 {
+			return time.Time{}, false
+		}
+		seconds += float64(num) / float64(den) * unit
+	}
+	return day.Add(time.Duration(seconds * float64(time.Second))), true
+}
+
+// withGPSZone moves an EXIF date to the local time of where the photo was taken (--gps-timezone),
+// for cameras whose clock was left on another zone (e.g. home time while travelling). The instant
+// comes from the GPS time stamps, or from the date's own offset tag; without either the camera's
+// clock is trusted as it is.
+func withGPSZone(x *exif.Exif, path string, d dateInfo) dateInfo {
+	if !*gpsTimezone || d.Time.IsZero() {
+		return d
+	}
+	lat, lon, err := x.LatLong()
+	if err != nil || math.IsNaN(lat) || math.IsNaN(lon) || (lat == 0 && lon == 0) {
+		return d
+	}
+	instant, ok := gpsTime(x)
+	if ok {
+		// The receiver's time is only trusted when it agrees with the camera's clock to within a day
+		if diff := instant.Sub(d.Time); diff > 26*time.Hour || diff < -26*time.Hour {
+			ok = false
+		}
+	}
+	if !ok && d.Zoned {
+		instant, ok = d.Time, true
+	}
+	if !ok {
+		return d
+	}
+	loc := gpsLocation(lat, lon)
+	local := instant.In(loc)
+	wall := time.Date(d.Time.Year(), d.Time.Month(), d.Time.Day(), d.Time.Hour(), d.Time.Minute(), d.Time.Second(), d.Time.Nanosecond(), loc)
+	if shift := local.Sub(wall); shift < 15*time.Minute && shift > -15*time.Minute {
+		// The camera's clock was already on local time
+		d.Time, d.Zoned = wall, true
+		return d
+	}
+	log.Printf("Adjusted capture time of %s from %s to %s (%s, from GPS position)", filepath.Base(path), d.Time.Format("2006-01-02 15:04:05"), local.Format("2006-01-02 15:04:05"), local.Location())
+	return dateInfo{Year: local.Format("2006"), Source: strings.TrimSpace(d.Source + " (GPS time zone)"), Time: local, Zoned: true, Inferred: true}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sync"
+)
+
+// The deletion guard (--max-deletions, --max-deleted-bytes) is a backstop against runaway data loss
+// from bugs or misconfiguration: once a limit is reached, nothing else is deleted in the run.
+// Non-media files are quarantined instead, and duplicates, extracted archives and converted HEIC
+// originals are left in the source and reported.
+var (
+	guardMu          sync.Mutex
+	deletionsDone    int
+	deletedBytesDone int64
+	guardTripped     bool
+)
+
+// allowDeletion reports whether a source file may still be deleted, and if so counts it against
+// the limits
+func allowDeletion(path string) bool {
+	if *maxDeletions == 0 && maxDeletedBytes == 0 {
+		return true
+	}
+	var size int64
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+
+	guardMu.Lock()
+	defer guardMu.Unlock()
+	if !guardTripped {
+		overCount := *maxDeletions > 0 && deletionsDone+1 > *maxDeletions
+		overBytes := maxDeletedBytes > 0 && deletedBytesDone+size > int64(maxDeletedBytes)
+		if !overCount && !overBytes {
+			deletionsDone++
+			deletedBytesDone += size
+			return true
+		}
+		guardTripped = true
+		log.Printf("🛡️  Deletion limit reached after %d files (%s): nothing else will be deleted in this run", deletionsDone, formatBytes(deletedBytesDone))
+	}
+
+	counterMu.Lock()
+	deletionsBlockedCount++
+	counterMu.Unlock()
+	return false
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/zeebo/blake3"
+)
+
+// Values accepted by --hash-algo
+const (
+	hashSHA256 = "sha256"
+	hashXXH64  = "xxhash"
+	hashBLAKE3 = "blake3"
+)
+
+// newContentHasher returns a hasher for the selected algorithm
+func newContentHasher(algo string) (hash.Hash, error) {
+	switch algo {
+	case hashSHA256:
+		return sha256.New(), nil
+	case hashXXH64:
+		return xxhash.New(), nil
+	case hashBLAKE3:
+		return blake3.New(), nil
+	}
+	return nil, fmt.Errorf("unknown hash algorithm %q (expected %s, %s or %s)", algo, hashSHA256, hashXXH64, hashBLAKE3)
+}
+
+// hashPrefix tags non-SHA-256 hashes with their algorithm, so manifests and journals are
+// unambiguous and a hash from one algorithm never matches one from another. SHA-256 stays
+// unprefixed, as in earlier manifests.
+func hashPrefix(algo string) string {
+	if algo == hashSHA256 {
+		return ""
+	}
+	return algo + ":"
+}
+
+// hashAlgoLabel describes the active duplicate-detection hash for the summary
+func hashAlgoLabel() string {
+	switch *hashAlgo {
+	case hashXXH64:
+		return "xxHash64 content hash (fast, non-cryptographic)"
+	case hashBLAKE3:
+		return "BLAKE3 content hash"
+	}
+	return "SHA256 content hash"
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// hashIndexPath is the persistent hash index. It maps each library file (relative to the
+// destination) to its size, mtime and content hash, so later runs only re-hash files that changed.
+var hashIndexPath = filepath.Join(stateDir, "index.db")
+
+var hashIndexBucket = []byte("hashes")
+
+// hashIndex is nil when the index is disabled or could not be opened
+var hashIndex *bolt.DB
+
+// indexEntry is the stored value for one library file
+type indexEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"` // UnixNano
+	Algo    string `json:"algo"`
+	Hash    string `json:"hash"`
+}
+
+// openHashIndex opens (or creates) the persistent hash index. Failures are not fatal; the run
+// just hashes everything as before.
+func openHashIndex() {
+	if !*useHashIndex || *noHash {
+		return
+	}
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		log.Printf("Warning: Could not open hash index: %v", err)
+		return
+	}
+	db, err := bolt.Open(hashIndexPath, 0644, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		log.Printf("Warning: Could not open hash index '%s' (is another run using this library?): %v", hashIndexPath, err)
+		return
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(hashIndexBucket)
+		return err
+	}); err != nil {
+		log.Printf("Warning: Could not open hash index '%s': %v", hashIndexPath, err)
+		db.Close()
+		return
+	}
+	hashIndex = db
+}
+
+// closeHashIndex flushes and closes the index
+func closeHashIndex() {
+	if hashIndex != nil {
+		hashIndex.Close()
+		hashIndex = nil
+	}
+}
+
+// indexKey returns a file's key in the index, or "" for files outside the destination. Files in
+// year folders moved to the archive volume keep the key they had in the destination.
+func indexKey(path string) string {
+	rel, err := filepath.Rel(destDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return tieredIndexKey(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// cachedFileHash returns a library file's content hash from the index when its size and mtime are
+// unchanged, and hashes (and indexes) it otherwise
+func cachedFileHash(path string) (string, error) {
+	key := indexKey(path)
+	if hashIndex == nil || key == "" {
+		return fileHash(path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	var entry indexEntry
+	hashIndex.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(hashIndexBucket).Get([]byte(key)); data != nil {
+			json.Unmarshal(data, &entry)
+		}
+		return nil
+	})
+	if entry.Hash != "" && entry.Algo == *hashAlgo && entry.Size == info.Size() && entry.ModTime == info.ModTime().UnixNano() {
+		return entry.Hash, nil
+	}
+
+	hash, err := fileHash(path)
+	if err != nil {
+		return "", err
+	}
+	storeIndexEntry(key, info, hash)
+	return hash, nil
+}
+
+// indexHash records the hash of a file that was just placed in the library
+func indexHash(path, hash string) {
+	key := indexKey(path)
+	if hashIndex == nil || key == "" || *noHash || isPartialKey(hash) {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	storeIndexEntry(key, info, hash)
+}
+
+// storeIndexEntry writes one entry; concurrent writers are batched into shared transactions
+func storeIndexEntry(key string, info os.FileInfo, hash string) {
+	data, err := json.Marshal(indexEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Algo: *hashAlgo, Hash: hash})
+	if err != nil {
+		return
+	}
+	if err := hashIndex.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(hashIndexBucket).Put([]byte(key), data)
+	}); err != nil {
+		log.Printf("Warning: Could not update hash index for '%s': %v", key, err)
+	}
+}
+
+// pruneHashIndex drops entries for files that are no longer in the library. seen holds the keys of
+// every file found by a complete scan of the destination.
+func pruneHashIndex(seen map[string]bool) {
+	if hashIndex == nil {
+		return
+	}
+	pruned := 0
+	err := hashIndex.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(hashIndexBucket).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			if !seen[string(k)] {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				pruned++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Warning: Could not prune hash index: %v", err)
+	} else if pruned > 0 {
+		log.Printf("Removed %d stale entries from the hash index", pruned)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// heifContainerExts are the formats stored as HEIF (ISO BMFF) images, whose Exif and XMP are
+// items of the 'meta' box rather than JPEG segments. Canon and Fujifilm cameras name HEIF .hif.
+var heifContainerExts = map[string]bool{".heic": true, ".heif": true, ".hif": true, ".avif": true}
+
+// maxMetadataSize bounds the metadata items and chunks read into memory
+const maxMetadataSize = 16 << 20
+
+// heifMeta returns the payload of the file's top-level 'meta' box (after its version and flags),
+// or nil when there is none
+func heifMeta(f *os.File) ([]byte, error) {
+	meta, err := readTopLevelBox(f, "meta")
+	if err != nil || len(meta) < 4 {
+		return nil, err
+	}
+	return meta[4:], nil // Skip the full-box version/flags
+}
+
+// readTopLevelBox returns the payload of the first top-level ISO BMFF / QuickTime box of the given
+// type, or nil when there is none. Boxes above maxMetadataSize are refused.
+func readTopLevelBox(f *os.File, want string) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var offset int64
+	for offset+8 <= info.Size() {
+		header := make([]byte, 16)
+		n, _ := f.ReadAt(header, offset)
+		if n < 8 {
+			break
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		typ := string(header[4:8])
+		hdrLen := int64(8)
+		if size == 1 && n >= 16 {
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			hdrLen = 16
+		} else if size == 0 {
+			size = info.Size() - offset
+		}
+		if size < hdrLen || size > info.Size()-offset {
+			break
+		}
+		if typ == want {
+			if size > maxMetadataSize {
+				return nil, errors.New("'" + want + "' box unreasonably large")
+			}
+			payload := make([]byte, size-hdrLen)
+			if _, err := f.ReadAt(payload, offset+hdrLen); err != nil && err != io.EOF {
+				return nil, err
+			}
+			return payload, nil
+		}
+		offset += size
+	}
+	return nil, nil
+}
+
+// heifItem returns the data of the item whose type (and, for 'mime' items, content type) matches,
+// or nil when there is none. When several match (e.g. Exif of thumbnails or burst frames), the one
+// describing the primary image is used.
+func heifItem(f *os.File, meta []byte, match func(itemType, contentType string) bool) ([]byte, error) {
+	ids := heifItemIDs(isoChildBox(meta, "iinf"), match)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	id := ids[0]
+	if len(ids) > 1 {
+		if primary, ok := heifPrimaryItem(meta); ok {
+			described := heifDescribes(isoChildBox(meta, "iref"), primary)
+			for _, candidate := range ids {
+				if described[candidate] {
+					id = candidate
+					break
+				}
+			}
+		}
+	}
+	return heifItemData(f, meta, id)
+}
+
+// heifPrimaryItem reads the ID of the primary image from the 'pitm' box
+func heifPrimaryItem(meta []byte) (uint32, bool) {
+	pitm := isoChildBox(meta, "pitm")
+	switch {
+	case len(pitm) >= 6 && pitm[0] == 0:
+		return uint32(binary.BigEndian.Uint16(pitm[4:])), true
+	case len(pitm) >= 8:
+		return binary.BigEndian.Uint32(pitm[4:]), true
+	}
+	return 0, false
+}
+
+// heifDescribes returns the items whose 'cdsc' (content describes) reference in the 'iref' box
+// points at item
+func heifDescribes(iref []byte, item uint32) map[uint32]bool {
+	out := make(map[uint32]bool)
+	if len(iref) < 4 {
+		return out
+	}
+	idSize := 2
+	if iref[0] != 0 {
+		idSize = 4
+	}
+	forEachISOBox(iref[4:], func(typ string, ref []byte) {
+		if typ != "cdsc" {
+			return
+		}
+		r := &isoReader{data: ref}
+		from := uint32(r.uint(idSize))
+		count := r.uint(2)
+		for i := uint64(0); i < count && r.err == nil; i++ {
+			if uint32(r.uint(idSize)) == item && r.err == nil {
+				out[from] = true
+			}
+		}
+	})
+	return out
+}
+
+// heifItemIDs looks items up in the 'iinf' box, in the order they are listed
+func heifItemIDs(iinf []byte, match func(itemType, contentType string) bool) []uint32 {
+	if len(iinf) < 6 {
+		return nil
+	}
+	entries := iinf[6:] // version/flags and a 16-bit entry count
+	if iinf[0] != 0 {
+		if len(iinf) < 8 {
+			return nil
+		}
+		entries = iinf[8:]
+	}
+	var ids []uint32
+	forEachISOBox(entries, func(typ string, infe []byte) {
+		// Only version 2 and 3 entries carry an item type
+		if typ != "infe" || len(infe) < 4 || infe[0] < 2 {
+			return
+		}
+		pos := 4
+		var itemID uint32
+		if infe[0] == 2 {
+			if len(infe) < pos+2 {
+				return
+			}
+			itemID = uint32(binary.BigEndian.Uint16(infe[pos:]))
+			pos += 2
+		} else {
+			if len(infe) < pos+4 {
+				return
+			}
+			itemID = binary.BigEndian.Uint32(infe[pos:])
+			pos += 4
+		}
+		pos += 2 // item_protection_index
+		if len(infe) < pos+4 {
+			return
+		}
+		itemType := string(infe[pos : pos+4])
+		rest := infe[pos+4:]
+		contentType := ""
+		if i := bytes.IndexByte(rest, 0); i >= 0 && itemType == "mime" {
+			rest = rest[i+1:] // Skip item_name
+			if j := bytes.IndexByte(rest, 0); j >= 0 {
+				contentType = string(rest[:j])
+			} else {
+				contentType = string(rest)
+			}
+		}
+		if match(itemType, contentType) {
+			ids = append(ids, itemID)
+		}
+	})
+	return ids
+}
+
+// heifItemData reads an item's extents as located by the 'iloc' box, either from the file or from
+// the 'idat' box
+func heifItemData(f *os.File, meta []byte, id uint32) ([]byte, error) {
+	iloc := isoChildBox(meta, "iloc")
+	if len(iloc) < 8 {
+		return nil, errors.New("HEIF file has no item locations")
+	}
+	version := iloc[0]
+	offsetSize, lengthSize := int(iloc[4]>>4), int(iloc[4]&0x0f)
+	baseOffsetSize, indexSize := int(iloc[5]>>4), 0
+	if version == 1 || version == 2 {
+		indexSize = int(iloc[5] & 0x0f)
+	}
+	r := &isoReader{data: iloc, pos: 6}
+	var count uint64
+	if version < 2 {
+		count = r.uint(2)
+	} else {
+		count = r.uint(4)
+	}
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		var itemID uint64
+		if version < 2 {
+			itemID = r.uint(2)
+		} else {
+			itemID = r.uint(4)
+		}
+		method := uint64(0)
+		if version == 1 || version == 2 {
+			method = r.uint(2) & 0x0f
+		}
+		r.uint(2) // data_reference_index
+		base := r.uint(baseOffsetSize)
+		extents := r.uint(2)
+		var data []byte
+		for e := uint64(0); e < extents && r.err == nil; e++ {
+			if indexSize > 0 {
+				r.uint(indexSize)
+			}
+			off, length := base+r.uint(offsetSize), r.uint(lengthSize)
+			if uint32(itemID) != id {
+				continue
+			}
+			if length > maxMetadataSize || uint64(len(data))+length > maxMetadataSize {
+				return nil, errors.New("HEIF item unreasonably large")
+			}
+			switch method {
+			case 0: // File offsets
+				chunk := make([]byte, length)
+				if _, err := f.ReadAt(chunk, int64(off)); err != nil {
+					return nil, err
+				}
+				data = append(data, chunk...)
+			case 1: // Offsets into the 'idat' box
+				idat := isoChildBox(meta, "idat")
+				if off+length > uint64(len(idat)) {
+					return nil, errors.New("HEIF item outside its idat box")
+				}
+				data = append(data, idat[off:off+length]...)
+			default:
+				return nil, errors.New("unsupported HEIF item construction method")
+			}
+		}
+		if uint32(itemID) == id && r.err == nil {
+			return data, nil
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return nil, errors.New("HEIF item has no location")
+}
+
+// isoReader reads big-endian fields of 0, 2, 4 or 8 bytes, remembering the first overrun
+type isoReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *isoReader) uint(size int) uint64 {
+	if r.err != nil || size == 0 {
+		return 0
+	}
+	if r.pos+size > len(r.data) {
+		r.err = errors.New("truncated ISO BMFF box")
+		return 0
+	}
+	b := r.data[r.pos : r.pos+size]
+	r.pos += size
+	switch size {
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b))
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b))
+	case 8:
+		return binary.BigEndian.Uint64(b)
+	}
+	r.err = errors.New("unsupported ISO BMFF field size")
+	return 0
+}
+
+// heifExif decodes the Exif item of a HEIC/HEIF/AVIF file
+func heifExif(f *os.File) (*exif.Exif, error) {
+	meta, err := heifMeta(f)
+	if err != nil || meta == nil {
+		return nil, errors.New("no HEIF meta box")
+	}
+	data, err := heifItem(f, meta, func(itemType, _ string) bool { return itemType == "Exif" })
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 4 {
+		return nil, errors.New("no Exif item")
+	}
+	// The item starts with the offset of the TIFF header, which usually follows "Exif\0\0"
+	start := 4 + int(binary.BigEndian.Uint32(data))
+	if start >= len(data) {
+		start = 4
+	}
+	return exif.Decode(bytes.NewReader(data[start:]))
+}
+
+// heifXMP returns the XMP packet of a HEIC/HEIF/AVIF file, or nil
+func heifXMP(f *os.File) []byte {
+	meta, err := heifMeta(f)
+	if err != nil || meta == nil {
+		return nil
+	}
+	data, _ := heifItem(f, meta, func(itemType, contentType string) bool {
+		return itemType == "mime" && contentType == "application/rdf+xml"
+	})
+	return data
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// iccMarker prefixes the payload of every JPEG APP2 segment carrying a piece of an ICC profile
+var iccMarker = []byte("ICC_PROFILE\x00")
+
+// iccChunkSize is the largest profile piece that fits in one APP2 segment
+// (65535 - 2 length bytes - 12 marker bytes - 2 sequence bytes)
+const iccChunkSize = 65519
+
+// readICCProfile returns the embedded ICC profile of a JPEG or HEIC/HEIF file, or nil if it has none
+func readICCProfile(path string) ([]byte, error) {
+	switch mediaExt(path) {
+	case ".jpg", ".jpeg":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return jpegICCProfile(data)
+	case ".heic", ".heif", ".hif", ".avif":
+		return heifICCProfile(path)
+	}
+	return nil, nil
+}
+
+// jpegICCProfile reassembles the ICC profile from a JPEG's APP2 segments, which may be split
+// across several segments numbered 1..N
+func jpegICCProfile(data []byte) ([]byte, error) {
+	chunks := make(map[int][]byte)
+	total := 0
+	err := walkJPEGSegments(data, func(marker byte, payload []byte, _ int) bool {
+		if marker != 0xE2 || !bytes.HasPrefix(payload, iccMarker) || len(payload) < len(iccMarker)+2 {
+			return true
+		}
+		seq, count := int(payload[len(iccMarker)]), int(payload[len(iccMarker)+1])
+		chunks[seq] = payload[len(iccMarker)+2:]
+		total = count
+		return true
+	})
+	if err != nil || len(chunks) == 0 {
+		return nil, err
+	}
+	if len(chunks) != total {
+		return nil, fmt.Errorf("ICC profile incomplete: %d of %d segments", len(chunks), total)
+	}
+	var profile []byte
+	for i := 1; i <= total; i++ {
+		chunk, ok := chunks[i]
+		if !ok {
+			return nil, fmt.Errorf("ICC profile segment %d missing", i)
+		}
+		profile = append(profile, chunk...)
+	}
+	return profile, nil
+}
+
+// walkJPEGSegments calls fn for each marker segment before the image data (SOS). fn receives the
+// marker, the segment payload and the segment's offset; returning false stops the walk.
+func walkJPEGSegments(data []byte, fn func(marker byte, payload []byte, offset int) bool) error {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return errors.New("not a JPEG file")
+	}
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return fmt.Errorf("corrupt JPEG marker at offset %d", pos)
+		}
+		marker := data[pos+1]
+		if marker == 0xFF { // Fill byte
+			pos++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 { // Start of scan / end of image
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		if length < 2 || pos+2+length > len(data) {
+			return fmt.Errorf("corrupt JPEG segment at offset %d", pos)
+		}
+		if !fn(marker, data[pos+4:pos+2+length], pos) {
+			return nil
+		}
+		pos += 2 + length
+	}
+	return nil
+}
+
+// embedJPEGICCProfile replaces any ICC profile in a JPEG file with the given one. The new APP2
+// segments go right after the JFIF/EXIF headers, where decoders expect them.
+func embedJPEGICCProfile(path string, profile []byte) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// Keep every segment except old ICC pieces, and remember where the APP0/APP1 headers end
+	var kept bytes.Buffer
+	kept.Write(data[:2])
+	insertAt := 2
+	end := 2
+	err = walkJPEGSegments(data, func(marker byte, payload []byte, offset int) bool {
+		segEnd := offset + 4 + len(payload)
+		end = segEnd
+		if marker == 0xE2 && bytes.HasPrefix(payload, iccMarker) {
+			return true
+		}
+		kept.Write(data[offset:segEnd])
+		if marker == 0xE0 || marker == 0xE1 {
+			insertAt = kept.Len()
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	count := (len(profile) + iccChunkSize - 1) / iccChunkSize
+	if count > 255 {
+		return fmt.Errorf("ICC profile too large to embed (%d bytes)", len(profile))
+	}
+	var segments bytes.Buffer
+	for i := 0; i < count; i++ {
+		chunk := profile[i*iccChunkSize : min(len(profile), (i+1)*iccChunkSize)]
+		segments.Write([]byte{0xFF, 0xE2})
+		binary.Write(&segments, binary.BigEndian, uint16(2+len(iccMarker)+2+len(chunk)))
+		segments.Write(iccMarker)
+		segments.Write([]byte{byte(i + 1), byte(count)})
+		segments.Write(chunk)
+	}
+
+	head := kept.Bytes()
+	var out bytes.Buffer
+	out.Write(head[:insertAt])
+	out.Write(segments.Bytes())
+	out.Write(head[insertAt:])
+	out.Write(data[end:])
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".icc.tmp"
+	if err := os.WriteFile(tmp, out.Bytes(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	os.Chtimes(tmp, info.ModTime(), info.ModTime())
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// heifICCProfile returns the ICC profile stored in a HEIC/HEIF 'colr' property
+// (meta > iprp > ipco > colr of type 'prof' or 'rICC'). iPhones store Display P3 here.
+func heifICCProfile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	meta, err := heifMeta(f)
+	if err != nil || meta == nil {
+		return nil, err
+	}
+	return heifColrProfile(meta), nil
+}
+
+// heifColrProfile descends meta > iprp > ipco and returns the first embedded ICC profile. Image
+// items (primary, tiles, thumbnail) of a single photo share the same profile in practice.
+func heifColrProfile(meta []byte) []byte {
+	ipco := isoChildBox(isoChildBox(meta, "iprp"), "ipco")
+	var profile []byte
+	forEachISOBox(ipco, func(typ string, payload []byte) {
+		if profile != nil || typ != "colr" || len(payload) < 4 {
+			return
+		}
+		if kind := string(payload[:4]); kind == "prof" || kind == "rICC" {
+			profile = payload[4:]
+		}
+	})
+	return profile
+}
+
+// isoChildBox returns the payload of the first child box of the given type
+func isoChildBox(data []byte, want string) []byte {
+	var out []byte
+	forEachISOBox(data, func(typ string, payload []byte) {
+		if out == nil && typ == want {
+			out = payload
+		}
+	})
+	return out
+}
+
+// forEachISOBox calls fn for every box in an in-memory ISO BMFF container
+func forEachISOBox(data []byte, fn func(typ string, payload []byte)) {
+	for pos := 0; pos+8 <= len(data); {
+		size := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		typ := string(data[pos+4 : pos+8])
+		hdrLen := 8
+		if size == 1 {
+			if pos+16 > len(data) {
+				return
+			}
+			size = int(binary.BigEndian.Uint64(data[pos+8 : pos+16]))
+			hdrLen = 16
+		} else if size == 0 {
+			size = len(data) - pos
+		}
+		if size < hdrLen || size > len(data)-pos { // Not pos+size, which a huge 64-bit size overflows
+			return
+		}
+		fn(typ, data[pos+hdrLen:pos+size])
+		pos += size
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// isoBox builds an ISO BMFF box of the given type around the concatenated payloads
+func isoBox(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(box, typ...), body...)
+}
+
+// testHEIF is a minimal HEIF file whose meta box carries the given ICC profile in a 'colr' property,
+// after an 'nclx' one as iPhones write them
+func testHEIF(profile []byte) []byte {
+	ftyp := isoBox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+	ipco := isoBox("ipco",
+		isoBox("colr", []byte("nclx\x00\x01\x00\x0d\x00\x06\x80")),
+		isoBox("colr", []byte("prof"), profile))
+	meta := isoBox("meta", []byte{0, 0, 0, 0}, isoBox("iprp", ipco))
+	return append(ftyp, meta...)
+}
+
+// testJPEG is a minimal JPEG: a JFIF header, the given extra segments, and stand-in scan data
+func testJPEG(segments ...[]byte) []byte {
+	jfif := []byte{0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0, 1, 1, 0, 0, 1, 0, 1, 0, 0}
+	scan := []byte{0xFF, 0xDA, 0x00, 0x08, 1, 1, 0, 0, 0x3F, 0, 0x12, 0x34, 0x56, 0xFF, 0xD9}
+	out := append([]byte{0xFF, 0xD8}, jfif...)
+	for _, s := range segments {
+		out = append(out, s...)
+	}
+	return append(out, scan...)
+}
+
+// testProfile is a stand-in ICC profile of n bytes, varied so misordered pieces are noticed
+func testProfile(n int) []byte {
+	p := make([]byte, n)
+	for i := range p {
+		p[i] = byte(i * 7 / 5)
+	}
+	return p
+}
+
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestForEachISOBox(t *testing.T) {
+	// A 64-bit size near the int limit after another box once overflowed pos+size and panicked
+	// on slicing
+	huge := append(isoBox("ftyp"), 0, 0, 0, 1, 'f', 'r', 'e', 'e', 0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	huge = append(huge, make([]byte, 8)...)
+	large := []byte{0, 0, 0, 1, 'f', 'r', 'e', 'e', 0, 0, 0, 0, 0, 0, 0, 20, 1, 2, 3, 4}
+
+	tests := []struct {
+		name string
+		data []byte
+		want []string
+	}{
+		{"boxes", append(isoBox("ftyp", []byte("heic")), isoBox("meta")...), []string{"ftyp", "meta"}},
+		{"to the end", append(isoBox("ftyp"), 0, 0, 0, 0, 'm', 'd', 'a', 't', 9, 9), []string{"ftyp", "mdat"}},
+		{"64-bit size", large, []string{"free"}},
+		{"64-bit size past the end", huge, []string{"ftyp"}},
+		{"64-bit size with the sign bit", []byte{0, 0, 0, 1, 'f', 'r', 'e', 'e', 0xFF, 0, 0, 0, 0, 0, 0, 0}, nil},
+		{"truncated", isoBox("ftyp", []byte("heic"))[:10], nil},
+		{"size below the header", []byte{0, 0, 0, 4, 'f', 'r', 'e', 'e'}, nil},
+		{"empty", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			forEachISOBox(tt.data, func(typ string, _ []byte) { got = append(got, typ) })
+			if len(got) != len(tt.want) {
+				t.Fatalf("boxes %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("boxes %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func FuzzForEachISOBox(f *testing.F) {
+	f.Add(testHEIF(testProfile(64)))
+	f.Add(append(isoBox("ftyp"), 0, 0, 0, 1, 'f', 'r', 'e', 'e', 0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		forEachISOBox(data, func(_ string, payload []byte) {
+			forEachISOBox(payload, func(string, []byte) {})
+		})
+		heifColrProfile(data)
+	})
+}
+
+func TestHEIFColrProfile(t *testing.T) {
+	profile := testProfile(3000)
+	path := writeTestFile(t, "IMG_0001.heic", testHEIF(profile))
+	got, err := readICCProfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, profile) {
+		t.Errorf("read a %d byte profile, want the %d byte 'prof' one", len(got), len(profile))
+	}
+
+	ipco := isoBox("ipco", isoBox("colr", []byte("nclx\x00\x01\x00\x0d\x00\x06\x80")))
+	if got := heifColrProfile(isoBox("iprp", ipco)); got != nil {
+		t.Errorf("found a %d byte profile in an 'nclx'-only colr", len(got))
+	}
+}
+
+func TestEmbedJPEGICCProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		segments int
+	}{
+		{"one segment", 560, 1},
+		{"exactly one segment", iccChunkSize, 1},
+		{"split", 3*iccChunkSize + 100, 4},
+		{"segment limit", 255 * iccChunkSize, 255},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := testJPEG()
+			path := writeTestFile(t, "IMG_0001.jpg", old)
+			profile := testProfile(tt.size)
+			if err := embedJPEGICCProfile(path, profile); err != nil {
+				t.Fatal(err)
+			}
+			data, _ := os.ReadFile(path)
+			got, err := jpegICCProfile(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, profile) {
+				t.Fatalf("reassembled %d bytes, want %d", len(got), len(profile))
+			}
+			segments := 0
+			walkJPEGSegments(data, func(marker byte, payload []byte, _ int) bool {
+				if marker == 0xE2 && bytes.HasPrefix(payload, iccMarker) {
+					segments++
+				}
+				return true
+			})
+			if segments != tt.segments {
+				t.Errorf("%d APP2 segments, want %d", segments, tt.segments)
+			}
+			if !bytes.HasPrefix(data, old[:20]) || !bytes.HasSuffix(data, old[20:]) {
+				t.Error("JFIF header or image data changed")
+			}
+		})
+	}
+
+	t.Run("too large", func(t *testing.T) {
+		old := testJPEG()
+		path := writeTestFile(t, "IMG_0001.jpg", old)
+		if err := embedJPEGICCProfile(path, testProfile(255*iccChunkSize+1)); err == nil {
+			t.Fatal("embedded a profile needing 256 segments")
+		}
+		if data, _ := os.ReadFile(path); !bytes.Equal(data, old) {
+			t.Error("file changed although the profile was refused")
+		}
+	})
+}
+
+func TestJPEGICCProfileIncomplete(t *testing.T) {
+	piece := append(append([]byte{}, iccMarker...), 1, 2) // Segment 1 of 2
+	piece = append(piece, testProfile(10)...)
+	segment := append([]byte{0xFF, 0xE2, 0, byte(2 + len(piece))}, piece...)
+	if _, err := jpegICCProfile(testJPEG(segment)); err == nil {
+		t.Error("reassembled a profile with a segment missing")
+	}
+	if got, err := jpegICCProfile(testJPEG()); got != nil || err != nil {
+		t.Errorf("JPEG without a profile: got %d bytes, %v", len(got), err)
+	}
+}
+
+// TestPreserveICCProfile checks the profile of a converted JPEG before and after preserveICCProfile:
+// missing or different from the HEIC's, it is replaced by the HEIC's own
+func TestPreserveICCProfile(t *testing.T) {
+	displayP3, sRGB := testProfile(4000), testProfile(900)
+	heic := writeTestFile(t, "IMG_0001.heic", testHEIF(displayP3))
+
+	tests := []struct {
+		name   string
+		before []byte // The converter's profile, nil for none
+	}{
+		{"dropped by the converter", nil},
+		{"replaced by the converter", sRGB},
+		{"kept by the converter", displayP3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jpeg := writeTestFile(t, "IMG_0001.jpg", testJPEG())
+			if tt.before != nil {
+				if err := embedJPEGICCProfile(jpeg, tt.before); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := preserveICCProfile(heic, jpeg); err != nil {
+				t.Fatal(err)
+			}
+			data, _ := os.ReadFile(jpeg)
+			if got, _ := jpegICCProfile(data); !bytes.Equal(got, displayP3) {
+				t.Errorf("JPEG has a %d byte profile after conversion, want the HEIC's %d bytes", len(got), len(displayP3))
+			}
+		})
+	}
+
+	t.Run("source without a profile", func(t *testing.T) {
+		plain := testJPEG()
+		jpeg := writeTestFile(t, "IMG_0002.jpg", plain)
+		if err := preserveICCProfile(writeTestFile(t, "IMG_0002.heic", testHEIF(nil)[:24]), jpeg); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(jpeg); !bytes.Equal(data, plain) {
+			t.Error("JPEG changed although the source had no profile")
+		}
+	})
+}
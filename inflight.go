@@ -0,0 +1,67 @@
+package main
+
+// hashReservation marks a hash that a worker is currently moving into a folder
+type hashReservation struct {
+	done chan struct{} // Closed when the move finished, successfully or not
+}
+
+// inFlightHashes holds the reservations, keyed by folder and hash. Guarded by hashMu.
+var inFlightHashes = make(map[string]*hashReservation)
+
+// registerHash records that folder holds a file with the given hash at path
+func registerHash(folder, hash, path string) {
+	hashMu.Lock()
+	registerHashLocked(folder, hash, path)
+	hashMu.Unlock()
+}
+
+// registerHashLocked is registerHash for callers already holding hashMu. The first path recorded
+// for a hash is kept, since that is the copy duplicates are compared against.
+func registerHashLocked(folder, hash, path string) {
+	if hashesInDestination[folder] == nil {
+		hashesInDestination[folder] = make(map[string]string, 100)
+	}
+	if existing, ok := hashesInDestination[folder][hash]; !ok || existing == "" {
+		hashesInDestination[folder][hash] = path
+	}
+}
+
+// reserveHash claims a hash for a folder before its file is moved there. When the folder already
+// holds (or has just received) a file with that hash it returns that file's path (possibly "" for
+// hashes restored from an old journal) and true, i.e. the caller has a duplicate.
+// If another worker is moving an identical file, reserveHash waits for it: when that move succeeds
+// the caller gets a duplicate, when it fails the caller takes over the reservation. Every reservation
+// must be released with releaseHash.
+func reserveHash(folder, hash string) (string, bool) {
+	key := folder + "\x00" + hash
+	for {
+		hashMu.Lock()
+		if existing, ok := hashesInDestination[folder][hash]; ok {
+			hashMu.Unlock()
+			return existing, true
+		}
+		if r := inFlightHashes[key]; r != nil {
+			hashMu.Unlock()
+			<-r.done
+			continue
+		}
+		inFlightHashes[key] = &hashReservation{done: make(chan struct{})}
+		hashMu.Unlock()
+		return "", false
+	}
+}
+
+// releaseHash ends a reservation. placedAt is where the file now sits in the folder, or "" if it
+// did not get there; when set, the hash is registered so waiting workers treat their files as duplicates.
+func releaseHash(folder, hash, placedAt string) {
+	key := folder + "\x00" + hash
+	hashMu.Lock()
+	defer hashMu.Unlock()
+	if placedAt != "" {
+		registerHashLocked(folder, hash, placedAt)
+	}
+	if r := inFlightHashes[key]; r != nil {
+		delete(inFlightHashes, key)
+		close(r.done)
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+)
+
+// corruptDir keeps images and videos that are truncated or damaged, with the reason in an error sidecar
+var corruptDir = errorFolder(errCorrupt)
+
+// actionCorrupt marks an image or video moved to the corrupt folder
+const actionCorrupt = "corrupt"
+
+// mediaDamage checks an image or video with --corrupt-check, returning why it is damaged, or ""
+func mediaDamage(path, ext, mediaType string) string {
+	if !*corruptCheck {
+		return ""
+	}
+	switch mediaType {
+	case "image":
+		return imageDamage(path, ext)
+	case "video":
+		return videoDamage(path, ext)
+	}
+	return ""
+}
+
+// imageDamage checks that an image is whole without decoding its pixels: a JPEG's markers up to its
+// image data and an end marker after it, a PNG's chunks up to IEND, a WebP's RIFF size, or a GIF's
+// header. It returns what is wrong, or "" for a sound (or unchecked) image.
+func imageDamage(path, ext string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return ""
+	}
+	switch ext {
+	case ".jpg", ".jpeg":
+		err = jpegDamage(f)
+	case ".png":
+		err = pngDamage(f, info.Size())
+	case ".webp":
+		err = webpDamage(f, info.Size())
+	case ".gif":
+		if _, _, derr := image.DecodeConfig(f); derr != nil {
+			err = fmt.Errorf("unreadable header: %v", derr)
+		}
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// jpegDamage walks a JPEG's marker segments to its image data (SOS), requiring a frame header
+// (SOF) with a size on the way, then looks for the end-of-image marker after the image data.
+// Data after that marker (a Motion Photo's video, maker trailers) is allowed.
+func jpegDamage(f *os.File) error {
+	r := bufio.NewReaderSize(f, 64*1024)
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return errors.New("not a JPEG (no start-of-image marker)")
+	}
+	frame := false
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return errors.New("truncated before the image data")
+		}
+		if b != 0xFF {
+			return errors.New("damaged marker segments")
+		}
+		marker, err := r.ReadByte()
+		for err == nil && marker == 0xFF { // Fill bytes
+			marker, err = r.ReadByte()
+		}
+		if err != nil {
+			return errors.New("truncated before the image data")
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			continue // No length
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(r, length[:]); err != nil {
+			return errors.New("truncated before the image data")
+		}
+		size := int(binary.BigEndian.Uint16(length[:])) - 2
+		if size < 0 {
+			return errors.New("damaged marker segments")
+		}
+		segment := make([]byte, size)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return errors.New("truncated before the image data")
+		}
+		switch {
+		case marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC:
+			if len(segment) < 5 || binary.BigEndian.Uint16(segment[3:5]) == 0 {
+				return errors.New("frame header without a width")
+			}
+			frame = true
+		case marker == 0xDA:
+			if !frame {
+				return errors.New("image data without a frame header")
+			}
+			return findJPEGEnd(r)
+		case marker == 0xD9:
+			return errors.New("ends before the image data")
+		}
+	}
+}
+
+// findJPEGEnd scans entropy-coded data for the end-of-image marker
+func findJPEGEnd(r *bufio.Reader) error {
+	prev := byte(0)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buf)
+		chunk := buf[:n]
+		if prev == 0xFF && n > 0 && chunk[0] == 0xD9 {
+			return nil
+		}
+		if bytes.Contains(chunk, []byte{0xFF, 0xD9}) {
+			return nil
+		}
+		if n > 0 {
+			prev = chunk[n-1]
+		}
+		if err != nil {
+			return errors.New("truncated image data (no end-of-image marker)")
+		}
+	}
+}
+
+// pngDamage walks a PNG's chunks, which must start with a sized IHDR and reach IEND
+func pngDamage(f *os.File, size int64) error {
+	header := make([]byte, 8)
+	if _, err := f.ReadAt(header, 0); err != nil || !bytes.Equal(header, pngSignature) {
+		return errors.New("not a PNG (bad signature)")
+	}
+	offset := int64(8)
+	for first := true; ; first = false {
+		if offset+12 > size {
+			return errors.New("truncated (no IEND chunk)")
+		}
+		if _, err := f.ReadAt(header, offset); err != nil {
+			return errors.New("truncated (no IEND chunk)")
+		}
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		typ := string(header[4:8])
+		if first {
+			ihdr := make([]byte, 8)
+			if typ != "IHDR" || length < 13 {
+				return errors.New("missing IHDR chunk")
+			}
+			if _, err := f.ReadAt(ihdr, offset+8); err != nil || binary.BigEndian.Uint32(ihdr[0:4]) == 0 || binary.BigEndian.Uint32(ihdr[4:8]) == 0 {
+				return errors.New("IHDR chunk without a size")
+			}
+		}
+		if offset+12+length > size {
+			return fmt.Errorf("truncated %s chunk", typ)
+		}
+		if typ == "IEND" {
+			return nil
+		}
+		offset += 12 + length
+	}
+}
+
+// webpDamage compares a WebP's RIFF size with the file's
+func webpDamage(f *os.File, size int64) error {
+	header := make([]byte, 12)
+	if _, err := f.ReadAt(header, 0); err != nil || string(header[0:4]) != "RIFF" || string(header[8:12]) != "WEBP" {
+		return errors.New("not a WebP (bad RIFF header)")
+	}
+	if declared := int64(binary.LittleEndian.Uint32(header[4:8])) + 8; declared > size {
+		return fmt.Errorf("truncated (%d of %d bytes)", size, declared)
+	}
+	return nil
+}
+
+// videoDamage checks that a video's container is whole: an MP4/MOV/3GP's top-level boxes fit the file
+// and include both 'moov' and 'mdat', an MKV's EBML header and Segment are complete, and an AVI's
+// RIFF size and header list fit the file. It returns what is wrong, or "" for a sound (or
+// unchecked) video.
+func videoDamage(path, ext string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return ""
+	}
+	switch ext {
+	case ".mp4", ".m4v", ".mov", ".3gp", ".3g2":
+		err = mp4Damage(f, info.Size())
+	case ".mkv":
+		err = mkvDamage(f, info.Size())
+	case ".avi":
+		err = aviDamage(f, info.Size())
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// mp4Damage walks an MP4/MOV's top-level boxes. A recording cut short (a half-finished download
+// or copy) ends inside a box, or before the movie header (moov) that cameras write last. An 'mdat'
+// sized to or past the end of the file is whole if a movie header follows it anyway (scanForMoov),
+// as the dates are read from it too.
+func mp4Damage(f *os.File, size int64) error {
+	var offset int64
+	seen := make(map[string]bool)
+	for offset+8 <= size {
+		header := make([]byte, 16)
+		n, _ := f.ReadAt(header, offset)
+		if n < 8 {
+			break
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header[0:4]))
+		typ := string(header[4:8])
+		hdrLen := int64(8)
+		if boxSize == 1 {
+			if n < 16 {
+				return fmt.Errorf("truncated '%s' box header", typ)
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			hdrLen = 16
+		} else if boxSize == 0 {
+			boxSize = size - offset // Extends to the end of the file
+		}
+		if boxSize < hdrLen {
+			return errors.New("damaged box structure")
+		}
+		if offset+boxSize > size {
+			if typ == "mdat" && !seen["moov"] && moovPastMdat(f) {
+				seen["mdat"], seen["moov"] = true, true
+				break
+			}
+			return fmt.Errorf("truncated '%s' box (%d of %d bytes)", typ, size-offset, boxSize)
+		}
+		seen[typ] = true
+		offset += boxSize
+	}
+	if seen["mdat"] && !seen["moov"] && moovPastMdat(f) {
+		seen["moov"] = true
+	}
+	switch {
+	case !seen["moov"] && !seen["mdat"]:
+		return errors.New("no movie header ('moov') or media data ('mdat')")
+	case !seen["moov"]:
+		return errors.New("no movie header ('moov'); the recording or copy was cut short")
+	case !seen["mdat"]:
+		return errors.New("no media data ('mdat')")
+	}
+	return nil
+}
+
+// moovPastMdat reports whether a movie header was written after an 'mdat' whose size swallowed it
+func moovPastMdat(f *os.File) bool {
+	moov, err := scanForMoov(f)
+	return err == nil && moov != nil
+}
+
+// ebmlVint reads an EBML variable-length integer at offset, returning its value (with the length
+// marker removed when value is true), its length, and whether all its bits are set (unknown size)
+func ebmlVint(f *os.File, offset int64, value bool) (uint64, int64, bool, error) {
+	var first [1]byte
+	if _, err := f.ReadAt(first[:], offset); err != nil {
+		return 0, 0, false, err
+	}
+	length := int64(1)
+	for mask := byte(0x80); first[0]&mask == 0; mask >>= 1 {
+		if length++; length > 8 {
+			return 0, 0, false, errors.New("invalid EBML number")
+		}
+	}
+	buf := make([]byte, length)
+	if _, err := f.ReadAt(buf, offset); err != nil {
+		return 0, 0, false, err
+	}
+	if value {
+		buf[0] &= 0xFF >> length
+	}
+	var v uint64
+	for _, b := range buf {
+		v = v<<8 | uint64(b)
+	}
+	return v, length, v == 1<<(7*uint(length))-1, nil
+}
+
+// mkvDamage checks an MKV's EBML header and that its Segment, which holds everything else,
+// is not cut short. Segments of live recordings have an unknown size and are taken as whole.
+func mkvDamage(f *os.File, size int64) error {
+	var offset int64
+	for _, want := range []uint64{mkvEBMLHeader, mkvSegment} {
+		id, idLen, _, err := ebmlVint(f, offset, false)
+		if err != nil {
+			return errors.New("truncated before the Segment")
+		}
+		if id != want {
+			if want == mkvEBMLHeader {
+				return errors.New("not an MKV (no EBML header)")
+			}
+			return errors.New("no Segment after the EBML header")
+		}
+		dataSize, sizeLen, unknown, err := ebmlVint(f, offset+idLen, true)
+		if err != nil {
+			return errors.New("truncated before the Segment")
+		}
+		start := offset + idLen + sizeLen
+		if want == mkvSegment {
+			if !unknown && start+int64(dataSize) > size {
+				return fmt.Errorf("truncated Segment (%d of %d bytes)", size-start, dataSize)
+			}
+			return nil
+		}
+		if unknown || start+int64(dataSize) > size {
+			return errors.New("truncated EBML header")
+		}
+		offset = start + int64(dataSize)
+	}
+	return nil
+}
+
+// aviDamage compares an AVI's RIFF size with the file's and checks that its header list (hdrl),
+// which describes the streams, is complete
+func aviDamage(f *os.File, size int64) error {
+	header := make([]byte, 24)
+	if n, _ := f.ReadAt(header, 0); n < 12 || string(header[0:4]) != "RIFF" || string(header[8:12]) != "AVI " {
+		return errors.New("not an AVI (bad RIFF header)")
+	}
+	if string(header[12:16]) != "LIST" || string(header[20:24]) != "hdrl" {
+		return errors.New("no header list ('hdrl')")
+	}
+	if hdrlEnd := 20 + int64(binary.LittleEndian.Uint32(header[16:20])); hdrlEnd > size {
+		return errors.New("truncated header list ('hdrl')")
+	}
+	if declared := int64(binary.LittleEndian.Uint32(header[4:8])) + 8; declared > size {
+		return fmt.Errorf("truncated (%d of %d bytes)", size, declared)
+	}
+	return nil
+}
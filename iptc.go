@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"time"
+)
+
+// jpegPhotoshopHeader starts the APP13 segment holding Photoshop image resources, among them IPTC
+var jpegPhotoshopHeader = []byte("Photoshop 3.0\x00")
+
+// photoshopIPTCResource is the image resource holding IPTC-IIM records
+const photoshopIPTCResource = 0x0404
+
+// IPTC-IIM application records (record 2) holding the date and time the content was created
+const (
+	iptcDateCreated = 55 // CCYYMMDD
+	iptcTimeCreated = 60 // HHMMSS±HHMM
+)
+
+// jpegIPTCDate reads the IPTC DateCreated (2:55) of a JPEG file, with TimeCreated (2:60) when present
+func jpegIPTCDate(f *os.File) (dateInfo, bool) {
+	records := iptcRecords(photoshopResource(jpegSegment(f, 0xED, jpegPhotoshopHeader), photoshopIPTCResource))
+	date := string(records[iptcDateCreated])
+	if date == "" {
+		return dateInfo{}, false
+	}
+	t, err := time.Parse("20060102150405-0700", date+string(records[iptcTimeCreated]))
+	if err != nil {
+		t, err = time.Parse("20060102", date)
+	}
+	if err != nil || t.Year() <= 1900 || t.Year() > time.Now().Year()+1 {
+		return dateInfo{}, false
+	}
+	return dateInfo{Year: t.Format("2006"), Source: "IPTC DateCreated", Time: t}, true
+}
+
+// photoshopResource returns the data of an image resource from Photoshop's 8BIM blocks, or nil
+func photoshopResource(data []byte, id uint16) []byte {
+	// "8BIM", a 16-bit ID, an even-padded Pascal name, a 32-bit size and the even-padded data
+	for pos := 0; pos+12 <= len(data) && bytes.Equal(data[pos:pos+4], []byte("8BIM")); {
+		rid := binary.BigEndian.Uint16(data[pos+4:])
+		nameLen := int(data[pos+6]) + 1
+		nameLen += nameLen % 2
+		at := pos + 6 + nameLen
+		if at+4 > len(data) {
+			return nil
+		}
+		size := int(binary.BigEndian.Uint32(data[at:]))
+		at += 4
+		if size < 0 || at+size > len(data) {
+			return nil
+		}
+		if rid == id {
+			return data[at : at+size]
+		}
+		pos = at + size + size%2
+	}
+	return nil
+}
+
+// iptcRecords returns the first value of each dataset of IPTC-IIM application record 2
+func iptcRecords(data []byte) map[byte][]byte {
+	out := make(map[byte][]byte)
+	// A tag marker (0x1C), record and dataset numbers and a 16-bit size
+	for pos := 0; pos+5 <= len(data) && data[pos] == 0x1C; {
+		record, dataset := data[pos+1], data[pos+2]
+		size := int(binary.BigEndian.Uint16(data[pos+3:]))
+		if size&0x8000 != 0 {
+			return out // Extended sizes are only used for large binary data
+		}
+		pos += 5
+		if pos+size > len(data) {
+			return out
+		}
+		if _, seen := out[dataset]; record == 2 && !seen {
+			out[dataset] = data[pos : pos+size]
+		}
+		pos += size
+	}
+	return out
+}
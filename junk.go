@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// junkNames are the files operating systems leave among photos: Finder's folder settings
+// (.DS_Store), and Windows' thumbnail caches and folder settings. Names are compared lower-case.
+var junkNames = map[string]bool{".ds_store": true, "thumbs.db": true, "ehthumbs.db": true, "desktop.ini": true}
+
+// junkDirName is the folder Synology NAS keep the thumbnails and metadata of each photo folder
+// in. Its thumbnails are JPEGs, which would otherwise be sorted as photos.
+const junkDirName = "@eaDir"
+
+// isJunk reports whether a file is system junk: a known junk name, a macOS AppleDouble file
+// (._IMG_1.jpg, the resource fork of IMG_1.jpg copied to a non-Mac disk), or anything in an @eaDir folder
+func isJunk(path string) bool {
+	name := filepath.Base(path)
+	if junkNames[strings.ToLower(name)] || strings.HasPrefix(name, "._") {
+		return true
+	}
+	for _, part := range strings.Split(filepath.Dir(path), string(filepath.Separator)) {
+		if part == junkDirName {
+			return true
+		}
+	}
+	return false
+}
+
+// handleJunk deletes a system junk file. It is counted apart from other non-media files, and past
+// the deletion limit it is left in place rather than quarantined.
+func handleJunk(path string) {
+	filename := filepath.Base(path)
+	if !sourceRemovable(path) {
+		log.Printf("Leaving junk file '%s' in place (%v)", filename, errSourceKept)
+		return
+	}
+	if !allowDeletion(path) {
+		log.Printf("Leaving junk file '%s' in place (deletion limit reached)", filename)
+		recordOp(manifestEntry{Source: path, Action: actionFailed})
+		return
+	}
+	if err := removeSource(path); err != nil {
+		log.Printf("Could not delete junk file '%s': %v", path, err)
+		counterMu.Lock()
+		errorCount++
+		counterMu.Unlock()
+		recordError(path, "", errDeleteFailed, fmt.Sprintf("could not delete junk file: %v", err))
+		recordOp(manifestEntry{Source: path, Action: actionFailed})
+		return
+	}
+	log.Printf("Deleted '%s' (system junk)", filename)
+	counterMu.Lock()
+	junkCount++
+	counterMu.Unlock()
+	recordOp(manifestEntry{Source: path, Action: actionDeleted, Note: "system junk"})
+}
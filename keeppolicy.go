@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// Values accepted by --duplicate-policy
+const (
+	keepFirst = "first" // The copy that reached the library first stays
+	keepBest  = "best"  // The higher quality copy stays; the other one goes to review
+)
+
+// imageQuality is what --duplicate-policy best compares, in order of importance
+type imageQuality struct {
+	Pixels  int64
+	HasEXIF bool // Has a DateTimeOriginal, i.e. was not stripped by a messenger or editor
+	Size    int64
+}
+
+// measureQuality reads an image's resolution, EXIF presence and size. Dimensions come from the
+// decoder, or from EXIF for formats Go can't decode (HEIC, raw).
+func measureQuality(path string) imageQuality {
+	var q imageQuality
+	if info, err := os.Stat(path); err == nil {
+		q.Size = info.Size()
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return q
+	}
+	defer f.Close()
+	if cfg, _, err := image.DecodeConfig(f); err == nil {
+		q.Pixels = int64(cfg.Width) * int64(cfg.Height)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return q
+	}
+	if x, err := exif.Decode(f); x != nil && (err == nil || !exif.IsCriticalError(err)) {
+		q.HasEXIF = exifString(x, exif.DateTimeOriginal) != ""
+		if q.Pixels == 0 {
+			q.Pixels = int64(exifInt(x, exif.PixelXDimension)) * int64(exifInt(x, exif.PixelYDimension))
+		}
+	}
+	return q
+}
+
+// betterThan reports whether q should be kept over other: higher resolution first, then having
+// EXIF, then the larger file (less compression)
+func (q imageQuality) betterThan(other imageQuality) bool {
+	if q.Pixels != other.Pixels {
+		return q.Pixels > other.Pixels
+	}
+	if q.HasEXIF != other.HasEXIF {
+		return q.HasEXIF
+	}
+	return q.Size > other.Size
+}
+
+// policyQuality measures an image when --duplicate-policy best needs it
+func policyQuality(path string) imageQuality {
+	if *duplicatePolicy != keepBest {
+		return imageQuality{}
+	}
+	return measureQuality(path)
+}
+
+// inLibrary reports whether path is a sorted file (not a source, and not already in review), i.e.
+// a kept copy that can be swapped out
+func inLibrary(path string) bool {
+	return strings.HasPrefix(path, destDir+string(filepath.Separator)) && !strings.HasPrefix(path, reviewDir)
+}
+
+// demoteKept moves a kept image that a better copy replaced into review, and counts it as a logical
+// duplicate, or as a near-duplicate of the entry that now holds the better copy
+func demoteKept(path, reviewFolder string, near *nearEntry, distance int) {
+	dest, err := demoteToReview(path, reviewFolder)
+	if err != nil {
+		log.Printf("Could not move '%s' to review: %v", path, err)
+		return
+	}
+	if near != nil {
+		recordNearDuplicate(nearDuplicateItem{Source: path, Destination: dest, Distance: distance, kept: near})
+	} else {
+		counterMu.Lock()
+		logicalDuplicateCount++
+		counterMu.Unlock()
+	}
+}
+
+// demoteToReview moves a kept library file into a review folder, making room for a better copy.
+// Its hash registration and counts are withdrawn so it no longer stands for its folder.
+func demoteToReview(path, reviewFolder string) (string, error) {
+	if err := ensureDir(reviewFolder); err != nil {
+		return "", err
+	}
+	name := filepath.Base(path)
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	dest := filepath.Join(reviewFolder, name)
+	for counter := 1; ; counter++ {
+		if _, err := os.Stat(dest); os.IsNotExist(err) {
+			break
+		}
+		dest = filepath.Join(reviewFolder, fmt.Sprintf("%s_%d%s", stem, counter, ext))
+	}
+	if err := os.Rename(path, dest); err != nil {
+		return "", err
+	}
+
+	folder := filepath.Dir(path)
+	forgetHashPath(folder, path)
+	counterMu.Lock()
+	if strings.Contains(folder, "no_date") {
+		noDateCount--
+	} else {
+		movedCount--
+	}
+	counterMu.Unlock()
+	if year := filepath.Base(folder); isYearFolder(year) && filepath.Dir(folder) == destDir {
+		unrecordYear(year, "image")
+	}
+	log.Printf("Moved '%s' to '%s' to keep a higher quality copy", name, dest)
+	recordOp(manifestEntry{Source: path, Destination: dest, Action: actionReview})
+	return dest, nil
+}
+
+// forgetHashPath drops the hash registration pointing at path, after the file left its folder
+func forgetHashPath(folder, path string) {
+	hashMu.Lock()
+	defer hashMu.Unlock()
+	for hash, p := range hashesInDestination[folder] {
+		if p == path {
+			delete(hashesInDestination[folder], hash)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// libraryStatsFileName is a small machine-readable description of the whole library for dashboards
+const libraryStatsFileName = "library-stats.json"
+
+// libraryStats describes the whole library, not just the last run
+type libraryStats struct {
+	GeneratedAt   time.Time `json:"generated_at"`
+	Photos        int       `json:"photos"`      // Photos in year folders
+	Videos        int       `json:"videos"`      // Videos in year folders
+	NoDate        int       `json:"no_date"`     // Media without a usable date
+	TotalFiles    int       `json:"total_files"` // Every file in the library folders
+	TotalBytes    int64     `json:"total_bytes"`
+	TotalSize     string    `json:"total_size"`            // TotalBytes, human readable
+	OldestYear    string    `json:"oldest_year,omitempty"` // Date range of the year folders
+	NewestYear    string    `json:"newest_year,omitempty"`
+	LastRunID     string    `json:"last_run_id"`
+	LastRunStatus string    `json:"last_run_status"`
+}
+
+// writeLibraryStats tallies the library from the directory tree (file sizes only, nothing is read)
+// and writes library-stats.json to the destination root
+func writeLibraryStats(summary runSummary) {
+	stats := libraryStats{GeneratedAt: time.Now(), LastRunID: summary.RunID, LastRunStatus: summary.Status}
+
+	tally := func(top, path string, size int64) {
+		stats.TotalFiles++
+		stats.TotalBytes += size
+
+		ext := strings.ToLower(filepath.Ext(path))
+		switch {
+		case top == filepath.Base(noDateDir):
+			stats.NoDate++
+		case isYearFolder(top):
+			if videoExts[ext] {
+				stats.Videos++
+			} else {
+				stats.Photos++
+			}
+			if stats.OldestYear == "" || top < stats.OldestYear {
+				stats.OldestYear = top
+			}
+			if top > stats.NewestYear {
+				stats.NewestYear = top
+			}
+		}
+	}
+	filepath.Walk(destDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if isStateDir(path) || path == manifestDir || path == albumsDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(destDir, path)
+		if err != nil || !strings.ContainsRune(rel, filepath.Separator) || strings.HasSuffix(path, errorSidecarSuffix) || path == filepath.Join(errorsDir, errorsIndexName) {
+			return nil // Reports and summaries in the destination root, error sidecars and their index
+		}
+		tally(strings.SplitN(rel, string(filepath.Separator), 2)[0], path, info.Size())
+		return nil
+	})
+	// Year folders moved to the archive volume still belong to the library
+	for _, year := range tieredYears() {
+		filepath.Walk(tierLocations[year], func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				tally(year, path, info.Size())
+			}
+			return nil
+		})
+	}
+	stats.TotalSize = formatBytes(stats.TotalBytes)
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		log.Printf("Could not encode library stats: %v", err)
+		return
+	}
+	path := filepath.Join(destDir, libraryStatsFileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		log.Printf("Could not write library stats '%s': %v", path, err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		log.Printf("Could not write library stats '%s': %v", path, err)
+	}
+}
+
+// isYearFolder reports whether a top-level destination folder name is a year
+func isYearFolder(name string) bool {
+	if len(name) != 4 {
+		return false
+	}
+	_, err := strconv.Atoi(name)
+	return err == nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// lightroomEditedAlbum lists the files that have Lightroom develop adjustments. The edits live only
+// in the catalog, so this tells the user which sorted files have an edited version in Lightroom.
+const lightroomEditedAlbum = "Edited in Lightroom"
+
+// lightroomTimeLayouts are the forms Lightroom stores captureTime in
+var lightroomTimeLayouts = []string{
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// readLightroomCatalog loads capture dates, collections and edit state from a Lightroom Classic
+// catalog. Dates are only used for files whose own metadata has none.
+func readLightroomCatalog(catalog string) error {
+	db, err := copySQLiteDatabase(catalog, "lrcat")
+	if err != nil {
+		return err
+	}
+	log.Printf("Reading Lightroom catalog '%s'", catalog)
+
+	rows, err := querySQLite(db, `SELECT i.id_local, r.absolutePath, r.name, f.pathFromRoot, lf.idx_filename, COALESCE(i.captureTime, '')
+		FROM Adobe_images i
+		JOIN AgLibraryFile lf ON lf.id_local = i.rootFile
+		JOIN AgLibraryFolder f ON f.id_local = lf.folder
+		JOIN AgLibraryRootFolder r ON r.id_local = f.rootFolder`)
+	if err != nil {
+		return err
+	}
+
+	imagePaths := make(map[string][]string, len(rows)) // Adobe_images id -> candidate source paths
+	dates := 0
+	for _, row := range rows {
+		if len(row) < 6 {
+			continue
+		}
+		candidates := lightroomSourcePaths(row[1], row[2], row[3], row[4])
+		imagePaths[row[0]] = candidates
+		if t, ok := parseLightroomTime(row[5]); ok {
+			dates++
+			for _, path := range candidates {
+				dateFallbacks[path] = dateInfo{Year: t.Format("2006"), Source: "Lightroom catalog", Time: t}
+			}
+		}
+	}
+
+	collections := loadLightroomCollections(db, imagePaths)
+	edited := loadLightroomEdits(db, imagePaths)
+	log.Printf("Lightroom catalog: %d images (%d with a capture date), %d collection memberships, %d edited", len(imagePaths), dates, collections, edited)
+	log.Println("⚠️  Files moved out of Lightroom-managed folders will show as missing in Lightroom until it is pointed at the sorted library")
+	return nil
+}
+
+// lightroomSourcePaths returns where a catalog file may be on this machine: at its absolute path, or,
+// for catalogs made on another machine, inside the source folder (with or without the root folder)
+func lightroomSourcePaths(rootPath, rootName, pathFromRoot, name string) []string {
+	rel := filepath.FromSlash(pathFromRoot)
+	paths := []string{
+		filepath.Clean(filepath.Join(filepath.FromSlash(rootPath), rel, name)),
+		filepath.Join(sourceDir, rel, name),
+	}
+	if rootName != "" {
+		paths = append(paths, filepath.Join(sourceDir, rootName, rel, name))
+	}
+	return paths
+}
+
+// parseLightroomTime parses a captureTime value (local time, sometimes with fractional seconds or a zone)
+func parseLightroomTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range lightroomTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// loadLightroomCollections adds regular (non-smart) collection memberships to sourceAlbums and
+// returns how many it found
+func loadLightroomCollections(db string, imagePaths map[string][]string) int {
+	rows, err := querySQLite(db, `SELECT c.name, ci.image
+		FROM AgLibraryCollection c
+		JOIN AgLibraryCollectionImage ci ON ci.collection = c.id_local
+		WHERE c.creationId = 'com.adobe.ag.library.collection' AND c.name IS NOT NULL`)
+	if err != nil {
+		log.Printf("Could not read Lightroom collections: %v", err)
+		return 0
+	}
+	count := 0
+	for _, row := range rows {
+		if len(row) < 2 {
+			continue
+		}
+		if paths, ok := imagePaths[row[1]]; ok {
+			addSourceAlbum(paths, row[0])
+			count++
+		}
+	}
+	return count
+}
+
+// loadLightroomEdits lists the images with develop adjustments under lightroomEditedAlbum and returns
+// how many there are. The column name differs between Lightroom versions.
+func loadLightroomEdits(db string, imagePaths map[string][]string) int {
+	cols, err := querySQLite(db, "SELECT name FROM pragma_table_info('Adobe_imageDevelopSettings')")
+	if err != nil {
+		return 0
+	}
+	column := ""
+	for _, c := range cols {
+		if c[0] == "hasDevelopAdjustmentsEx" || (c[0] == "hasDevelopAdjustments" && column == "") {
+			column = c[0]
+		}
+	}
+	if column == "" {
+		return 0
+	}
+	rows, err := querySQLite(db, fmt.Sprintf("SELECT DISTINCT image FROM Adobe_imageDevelopSettings WHERE %s > 0", column))
+	if err != nil {
+		log.Printf("Could not read Lightroom edits: %v", err)
+		return 0
+	}
+	count := 0
+	for _, row := range rows {
+		if paths, ok := imagePaths[row[0]]; ok {
+			addSourceAlbum(paths, lightroomEditedAlbum)
+			count++
+		}
+	}
+	return count
+}
+
+// addSourceAlbum records album membership for each candidate path of a file
+func addSourceAlbum(paths []string, album string) {
+	for _, path := range paths {
+		sourceAlbums[path] = append(sourceAlbums[path], album)
+	}
+}
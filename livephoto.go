@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// Live Photos are a still image plus a short QuickTime video with the same basename
+var (
+	livePhotoImageExts = map[string]bool{".heic": true, ".heif": true, ".jpg": true, ".jpeg": true}
+	livePhotoVideoExts = map[string]bool{".mov": true}
+)
+
+// contentIdentifierKey is the QuickTime metadata key holding a Live Photo's pairing identifier
+const contentIdentifierKey = "com.apple.quicktime.content.identifier"
+
+// appleContentIdentifierTag is the Apple MakerNote tag holding the same identifier in the image
+const appleContentIdentifierTag = 0x0011
+
+// isLivePhotoPair reports whether image and video (same folder and basename) form a Live Photo.
+// When both carry Apple's content identifier it must match; otherwise the basename decides.
+func isLivePhotoPair(image, video string) bool {
+	imageID, videoID := imageContentIdentifier(image), movContentIdentifier(video)
+	return imageID == "" || videoID == "" || imageID == videoID
+}
+
+// imageContentIdentifier returns the Live Photo identifier from an image's Apple MakerNote, or ""
+func imageContentIdentifier(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	x, _, err := decodeExif(f, mediaExt(path))
+	if err != nil {
+		return ""
+	}
+	tag, err := x.Get(exif.MakerNote)
+	if err != nil {
+		return ""
+	}
+	return appleMakerNoteString(tag.Val, appleContentIdentifierTag)
+}
+
+// appleMakerNoteString reads an ASCII entry from an Apple MakerNote: an "Apple iOS" header
+// followed by a big-endian IFD whose offsets are relative to the start of the note
+func appleMakerNoteString(note []byte, want uint16) string {
+	if len(note) < 16 || !bytes.HasPrefix(note, []byte("Apple iOS\x00")) || string(note[12:14]) != "MM" {
+		return ""
+	}
+	count := int(binary.BigEndian.Uint16(note[14:16]))
+	for i := 0; i < count; i++ {
+		entry := 16 + 12*i
+		if entry+12 > len(note) {
+			return ""
+		}
+		if binary.BigEndian.Uint16(note[entry:]) != want || binary.BigEndian.Uint16(note[entry+2:]) != 2 {
+			continue
+		}
+		n := int(binary.BigEndian.Uint32(note[entry+4:]))
+		value := note[entry+8 : entry+12]
+		if n > 4 {
+			off := int(binary.BigEndian.Uint32(note[entry+8:]))
+			if off < 0 || off+n > len(note) {
+				return ""
+			}
+			value = note[off : off+n]
+		} else {
+			value = value[:n]
+		}
+		return strings.TrimRight(string(value), "\x00 ")
+	}
+	return ""
+}
+
+// movContentIdentifier returns the Live Photo identifier from a QuickTime file's metadata, or ""
+func movContentIdentifier(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	moov, err := readMoov(f)
+	if err != nil || moov == nil {
+		return ""
+	}
+	return quickTimeMetadata(moov, contentIdentifierKey)
+}
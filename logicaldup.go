@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// reviewDir collects files that need a human decision; logical duplicates go in a subfolder
+var (
+	reviewDir                = filepath.Join(destDir, "review")
+	logicalDuplicatesDir     = filepath.Join(reviewDir, "logical_duplicates")
+	logicalKeysMu            sync.Mutex
+	logicalKeysInDestination = make(map[string]*logicalCopy) // logical key -> kept file
+)
+
+// logicalCopy is the file kept for a capture
+type logicalCopy struct {
+	path    string       // Source path, replaced by the destination once the file is sorted
+	quality imageQuality // Only measured with --duplicate-policy best
+}
+
+// logicalDuplicateKey builds a key identifying the same capture independent of encoding:
+// DateTimeOriginal + SubSecTimeOriginal + camera (serial, or make/model) + pixel dimensions.
+// Returns "" when the file lacks the metadata needed for a trustworthy key.
+func logicalDuplicateKey(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	x, err := exif.Decode(f)
+	if x == nil || err != nil && exif.IsCriticalError(err) {
+		return ""
+	}
+
+	taken := exifString(x, exif.DateTimeOriginal)
+	if taken == "" {
+		return ""
+	}
+	width, height := exifInt(x, exif.PixelXDimension), exifInt(x, exif.PixelYDimension)
+	if width == 0 || height == 0 {
+		return ""
+	}
+	camera := exifString(x, exifBodySerialNumber)
+	if camera == "" {
+		camera = strings.TrimSpace(exifString(x, exif.Make) + " " + exifString(x, exif.Model))
+	}
+
+	return fmt.Sprintf("%s.%s|%s|%dx%d", taken, exifString(x, exif.SubSecTimeOriginal), camera, width, height)
+}
+
+// claimLogicalKey registers key for path. If another file already holds the key, it returns that
+// file and false, unless --duplicate-policy best prefers path: then path takes the key over and the
+// previously kept file is returned as superseded.
+func claimLogicalKey(key, path string, quality imageQuality) (first string, ok bool, superseded string) {
+	logicalKeysMu.Lock()
+	defer logicalKeysMu.Unlock()
+	kept := logicalKeysInDestination[key]
+	if kept == nil {
+		logicalKeysInDestination[key] = &logicalCopy{path: path, quality: quality}
+		return "", true, ""
+	}
+	if *duplicatePolicy == keepBest && quality.betterThan(kept.quality) {
+		superseded = kept.path
+		kept.path, kept.quality = path, quality
+		return "", true, superseded
+	}
+	return kept.path, false, ""
+}
+
+// settleLogicalKey records where the kept file of key was sorted. It returns false if a better copy
+// took the key over while the file was being sorted; the file then belongs in review.
+func settleLogicalKey(key, path, dest string) bool {
+	logicalKeysMu.Lock()
+	defer logicalKeysMu.Unlock()
+	kept := logicalKeysInDestination[key]
+	if kept == nil || kept.path != path {
+		return false
+	}
+	kept.path = dest
+	return true
+}
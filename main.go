@@ -3,9 +3,10 @@ package main
 import (
 	"archive/zip"
 	"bytes"
-	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -22,10 +23,10 @@ import (
 )
 
 var (
-	imageExts   = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".tiff": true, ".bmp": true, ".heic": true, ".heif": true}
-	videoExts   = map[string]bool{".mp4": true, ".avi": true, ".mov": true, ".wmv": true, ".mkv": true, ".flv": true, ".mpeg": true, ".mpg": true, ".m4v": true}
-	heicExts    = map[string]bool{".heic": true, ".heif": true}
-	archiveExts = map[string]bool{".zip": true, ".rar": true, ".7z": true, ".tar": true, ".gz": true, ".bz2": true, ".xz": true, ".tar.gz": true, ".tar.bz2": true, ".tar.xz": true}
+	imageExts   = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".tif": true, ".tiff": true, ".bmp": true, ".heic": true, ".heif": true, ".hif": true, ".avif": true, ".webp": true}
+	videoExts   = map[string]bool{".mp4": true, ".avi": true, ".mov": true, ".wmv": true, ".asf": true, ".mkv": true, ".flv": true, ".mpeg": true, ".mpg": true, ".m4v": true, ".3gp": true, ".3g2": true, ".mts": true, ".m2ts": true}
+	heicExts    = map[string]bool{".heic": true, ".heif": true, ".hif": true}
+	archiveExts = map[string]bool{".zip": true, ".rar": true, ".7z": true, ".tar": true, ".gz": true, ".bz2": true, ".xz": true, ".tar.gz": true, ".tar.bz2": true, ".tar.xz": true, ".tgz": true, ".tbz2": true, ".tbz": true}
 )
 
 var (
@@ -39,7 +40,7 @@ var (
 
 var (
 	hashMu              sync.Mutex
-	hashesInDestination = make(map[string]map[string]bool, 20) // Pre-allocate with estimated year folders
+	hashesInDestination = make(map[string]map[string]string, 20) // Folder -> hash -> path of the file holding it
 
 	// Cache for directories that have been created to avoid repeated MkdirAll calls
 	createdDirsMu sync.RWMutex
@@ -55,37 +56,157 @@ var (
 	noDateCount           int
 	archiveMovedCount     int
 	archiveExtractedCount int // New counter for extracted archives
+	archiveEncryptedCount int // Encrypted archives no password opened, among archiveMovedCount
 	deletedNonMediaCount  int
+	junkCount             int // System junk deleted, or left alone with --keep-junk
 	errorCount            int
 	skippedCount          int
 	duplicateDeletedCount int
+	duplicateLinkedCount  int   // Duplicates replaced by hardlinks or clones (--dedup-action)
+	duplicateCopiedCount  int   // Duplicates placed as full copies because linking failed
+	duplicateKeptCount    int   // Duplicates left in the source (--dedup-action keep)
+	sourceKeptCount       int   // Files copied into the library with their source kept (read-only source, linked folder)
+	deletionsBlockedCount int   // Deletions skipped because the deletion guard tripped
+	logicalDuplicateCount int   // Same capture in a different encoding, routed to review
+	quarantinedCount      int   // Unrecognized files kept with --keep-unknown
+	otherFilesCount       int   // Unrecognized files kept in the other_files folder
+	sidecarKeptCount      int   // Sidecars without their photo, kept in the sidecars folder
+	documentCount         int   // Documents kept in the documents folder
+	mtimeDatedCount       int   // Files sorted by their modification time for lack of a metadata date
+	datesWrittenCount     int   // Inferred dates written into sorted files or their sidecars (--write-dates)
+	screenshotCount       int   // Screenshots sorted into the screenshots folder (--screenshots)
+	audioCount            int   // Audio files sorted into the audio folder (--audio)
+	filteredCount         int   // Files left in the source by --only-ext, --since or --until
+	corruptCount          int   // Truncated or damaged images and videos moved to the corrupt folder
+	recoveredCount        int   // Thumbnails saved from damaged photos (--recover-thumbnails)
+	zeroByteCount         int   // Empty files moved to the zero_byte folder or deleted (--delete-zero-byte)
+	nearDuplicateCount    int   // Visually identical photos found by --near-duplicates
+	companionCount        int   // Files moved together with their photo (RAW+JPEG pairs, Live Photo videos, sidecars)
 	totalFiles            int64 // Track total files for progress
 	processedFiles        int64 // Track processed files for progress
+	totalBytes            int64 // Track total bytes for progress and ETA
+	processedBytes        int64 // Track processed bytes for progress and ETA
 )
 
+// fileJob is a unit of work handed to the worker goroutines
+type fileJob struct {
+	path       string
+	size       int64
+	companions []fileJob // Files moved together with this one: the RAW of a RAW+JPEG pair, a Live Photo's video, sidecars
+	sidecarFor string    // For a sidecar companion: the file it describes
+}
+
 func main() {
+	if runSubcommand() {
+		return
+	}
+	flag.Parse()
 	log.SetFlags(log.LstdFlags)
+	checkSortFlags()
 	log.Printf("Starting media sort from '%s' to '%s'...", sourceDir, destDir)
-	log.Println("HEIC/HEIF files will be converted to JPEG.")
-	log.Println("IMPORTANT: Sorting by 'Date Taken' metadata for photos and 'Media Created' metadata for videos - ignoring file system dates")
+	if !*heicConvert {
+		log.Println("HEIC/HEIF conversion is disabled; HEIC files will be sorted unconverted")
+	} else if heicConverter() != "" {
+		if *heicKeepOriginal {
+			log.Printf("HEIC/HEIF files will be converted to JPEG (quality %d), keeping the originals next to them.", *jpegQuality)
+		} else {
+			log.Printf("HEIC/HEIF files will be converted to JPEG (quality %d).", *jpegQuality)
+		}
+	}
+	if *avifConvert && heicConverter() != "" {
+		log.Println("AVIF files will be converted to JPEG too.")
+	}
+	if *dateSources != "" || *fallbackMtime {
+		log.Printf("Date sources: images %s; videos %s", strings.Join(dateSourceChain["image"], " → "), strings.Join(dateSourceChain["video"], " → "))
+		if *audioFiles {
+			log.Printf("Date sources: audio %s", strings.Join(dateSourceChain["audio"], " → "))
+		}
+	}
+	if usesFileDates() {
+		log.Println("IMPORTANT: Sorting by 'Date Taken' metadata for photos and 'Media Created' metadata for videos - falling back to file modification dates as configured")
+	} else {
+		log.Println("IMPORTANT: Sorting by 'Date Taken' metadata for photos and 'Media Created' metadata for videos - ignoring file system dates")
+	}
 	log.Println("Files without metadata will be sorted by extension in 'no_date' folder")
-	log.Println("ZIP archives will be extracted and contents processed automatically")
+	if *noExtract {
+		log.Println("Archives will be moved to the 'archives' folder unextracted (--no-extract)")
+	} else {
+		log.Println("ZIP, TAR (.tar, .tar.gz, .tgz, .tar.bz2, .tar.xz), 7z and RAR archives will be extracted, and .gz, .bz2 and .xz files decompressed, and contents processed automatically")
+	}
+	if *noHash {
+		log.Println("⚠️  WARNING: Content hashing is DISABLED (--no-hash). Duplicates are detected by name+size+date only;")
+		log.Println("⚠️  byte-identical files with different names or dates will NOT be deduplicated in this run,")
+		log.Println("⚠️  and probable duplicates are kept in the source rather than deleted.")
+	}
+
+	if *photosLibrary != "" {
+		if err := openPhotosLibrary(*photosLibrary); err != nil {
+			fatalf("Cannot read Photos library: %v", err)
+		}
+	}
 
 	// Check if source directory exists
-	if _, err := os.Stat(sourceDir); os.IsNotExist(err) {
-		log.Fatalf("Source directory '%s' not found. Exiting.", sourceDir)
+	if _, err := os.Stat(sourceDir); os.IsNotExist(err) && *filesFrom == "" {
+		fatalf("Source directory '%s' not found. Exiting.", sourceDir)
 	}
 
 	// Ensure destination directories exist
 	dirs := []string{destDir, noDateDir, archivesDir, errorsDir}
 	for _, d := range dirs {
 		if err := os.MkdirAll(d, 0755); err != nil {
-			log.Fatalf("Failed to create directory %s: %v", d, err)
+			fatalf("Failed to create directory %s: %v", d, err)
 		}
 	}
 
+	// All temporary artifacts for this run live under a single namespace in the destination
+	if err := initRunTemp(); err != nil {
+		fatalf("Failed to create temporary directory %s: %v", runTmpDir, err)
+	}
+	cleanupStalePartials()
+	if *photosLibrary != "" {
+		readPhotosDatabase(*photosLibrary)
+	}
+	if *lightroomCatalog != "" {
+		if err := readLightroomCatalog(*lightroomCatalog); err != nil {
+			log.Printf("⚠️  Could not read the Lightroom catalog: %v", err)
+		}
+	}
+
+	if err := openManifest(*manifestFormat); err != nil {
+		fatalf("Failed to create manifest: %v", err)
+	}
+	if err := openDuplicatesReport(); err != nil {
+		fatalf("Failed to create duplicates report: %v", err)
+	}
+	if err := openCheckpoint(*resume); err != nil {
+		fatalf("Failed to open checkpoint: %v", err)
+	}
+	handleSignals()
+	loadTiers()
+	openHashIndex()
+
+	// Walk the whole source first, so totals are known up front and free space can be checked
+	log.Println("Scanning files...")
+	jobs, err := scanSource()
+	atomic.StoreInt64(&totalFiles, int64(len(jobs)))
+	scanComplete.Store(true)
+	log.Printf("Found %d files to process (%s)", len(jobs), formatBytes(atomic.LoadInt64(&totalBytes)))
+	if err != nil && !errors.Is(err, errInterrupted) {
+		fatalf("Failed to walk source directory: %v", err)
+	}
+	if n := loadTakeoutAlbums(jobPaths(jobs)); n > 0 {
+		log.Printf("Google Takeout: %d album memberships", n)
+	}
+	countSourceSizes(jobs)
+	indexDestination()
+	groupEvents(jobs)
+	checkDiskSpace(jobs)
+	if jobs, err = scheduleJobs(jobs, *schedule); err != nil {
+		fatalf("Invalid --schedule: %v", err)
+	}
+
 	var wg sync.WaitGroup
-	fileChan := make(chan string, 1000) // Increased buffer size for better throughput
+	fileChan := make(chan fileJob, 1000) // Increased buffer size for better throughput
 
 	// Use more workers based on CPU cores for better performance
 	numWorkers := runtime.NumCPU() * 2 // Use 2x CPU cores for I/O bound operations
@@ -93,56 +214,196 @@ func main() {
 		numWorkers = 4 // Minimum 4 workers
 	}
 	log.Printf("Using %d worker goroutines for processing", numWorkers)
+	workerSlots = make(chan struct{}, numWorkers)
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for path := range fileChan {
-				processFile(path)
+			for job := range fileChan {
+				// Once a shutdown is requested, queued files are left untouched for --resume
+				if interrupted() {
+					continue
+				}
+				paths := jobPaths([]fileJob{job})
+				trackCopies(paths)
+				workerSlots <- struct{}{}
+				processFile(job)
+				<-workerSlots
+				for _, p := range append([]fileJob{job}, job.companions...) {
+					if !isLeftForResume(p.path) {
+						markProcessed(p.path)
+					}
+				}
+				// Bytes copied were counted as they went; a retried copy may have counted more
+				atomic.AddInt64(&processedBytes, jobBytes(job)-settleCopies(paths))
+				atomic.AddInt64(&processedFiles, 1)
 			}
 		}()
 	}
 
-	// Walk the source directory and send files to workers
-	log.Println("Scanning files...")
-	var fileCount int64
-	err := filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			log.Printf("Error walking %s: %v", path, err)
-			return nil
-		}
-		if info.IsDir() {
-			return nil
-		}
+	// Report progress by bytes so a few huge videos don't make the ETA meaningless
+	stopProgress := startProgressReporter(2 * time.Second)
 
-		// Skip files that might already be in a destination structure
-		if strings.Contains(path, destDir) {
-			log.Printf("Skipping file already in destination structure: %s", path)
-			counterMu.Lock()
-			skippedCount++
-			counterMu.Unlock()
-			return nil
+	for _, job := range jobs {
+		if interrupted() {
+			break
 		}
-
-		fileCount++
-		fileChan <- path
-		return nil
-	})
-
-	// Set total files for progress tracking
-	atomic.StoreInt64(&totalFiles, fileCount)
-	log.Printf("Found %d files to process", fileCount)
-	if err != nil {
-		log.Fatalf("Failed to walk source directory: %v", err)
+		fileChan <- job
 	}
 	close(fileChan)
 	wg.Wait()
+	stopProgress()
+	cleanupRunTemp()
+	closeManifest()
+	closeDuplicatesReport()
+	// An interrupted run keeps its checkpoint so --resume can pick up the remaining files
+	closeCheckpoint(!interrupted())
+	closeHashIndex()
+
+	// Clean up empty directories in source; skipped after an interruption, since the source
+	// still holds files this run never got to
+	if !interrupted() && !readOnlySource && *filesFrom == "" {
+		cleanupEmptyDirectories(sourceDir)
+	}
 
-	// Clean up empty directories in source
-	cleanupEmptyDirectories(sourceDir)
+	finishRun()
+}
 
-	// Print summary
+// finishRun prints and writes the run's summary and reports, then exits with the summary's code
+func finishRun() {
 	printSummary()
+	summary := buildSummary(nil)
+	writeSummaryFile(summary)
+	writeErrorsIndex(summary.Errors)
+	writeHTMLReport(summary)
+	writeLibraryStats(summary)
+	writeAlbumCatalog()
+	writeAlbumFolders()
+	sendNotification(summary)
+	os.Exit(summary.exitCode())
+}
+
+// scanSource walks the source directory and returns every file to process, in walk order, with
+// companions attached to the file they belong with. With --files-from, the listed files are used instead.
+func scanSource() ([]fileJob, error) {
+	jobs, err := scanSourceFiles()
+	return filterByExt(pairCompanions(jobs)), err
+}
+
+// scanSourceFiles lists the source files to process
+func scanSourceFiles() ([]fileJob, error) {
+	if *filesFrom != "" {
+		return scanFileList(*filesFrom)
+	}
+	var jobs []fileJob
+	visited := make(map[string]bool) // Real paths of the folders walked (--follow-symlinks)
+	var walk func(root string) error
+	walk = func(root string) error {
+		return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if interrupted() {
+				return errInterrupted
+			}
+			if err != nil {
+				log.Printf("Error walking %s: %v", path, err)
+				return nil
+			}
+			if info.Mode()&os.ModeSymlink != 0 {
+				target, ok := sourceLink(path)
+				if !ok {
+					return nil
+				}
+				if target.IsDir() {
+					// Walked from the link itself, so the files keep their paths in the source
+					return walk(path + string(filepath.Separator))
+				}
+				info = target
+			}
+			if info.IsDir() {
+				// Never walk into the tool's own state/temporary folder
+				if isStateDir(path) {
+					return filepath.SkipDir
+				}
+				if path != sourceDir && isExcluded(path, true) {
+					log.Printf("Skipping excluded folder: %s", path)
+					return filepath.SkipDir
+				}
+				if beyondMaxDepth(path) {
+					log.Printf("Skipping folder below --max-depth %d: %s", *maxDepth, path)
+					return filepath.SkipDir
+				}
+				if !firstVisit(visited, path) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if job, ok := sourceJob(path, info); ok {
+				jobs = append(jobs, job)
+			}
+			return nil
+		})
+	}
+	err := walk(sourceDir)
+	return jobs, err
+}
+
+// sourceJob turns a source file into a job, or counts it as skipped
+func sourceJob(path string, info os.FileInfo) (fileJob, bool) {
+	// Skip files an interrupted run already handled (--resume)
+	if resumedProcessed[path] {
+		counterMu.Lock()
+		skippedCount++
+		counterMu.Unlock()
+		return fileJob{}, false
+	}
+
+	// Skip files that might already be in a destination structure
+	if strings.Contains(path, destDir) {
+		log.Printf("Skipping file already in destination structure: %s", path)
+		counterMu.Lock()
+		skippedCount++
+		counterMu.Unlock()
+		return fileJob{}, false
+	}
+
+	// Skip files the user excluded (--exclude)
+	if isExcluded(path, false) {
+		log.Printf("Skipping excluded file: %s", path)
+		counterMu.Lock()
+		skippedCount++
+		counterMu.Unlock()
+		return fileJob{}, false
+	}
+
+	// Leave system junk alone without counting it as skipped (--keep-junk)
+	if *keepJunk && isJunk(path) {
+		counterMu.Lock()
+		junkCount++
+		counterMu.Unlock()
+		return fileJob{}, false
+	}
+
+	// Skip originals the Photos library has in its trash
+	if trashedAssets[path] {
+		counterMu.Lock()
+		skippedCount++
+		counterMu.Unlock()
+		return fileJob{}, false
+	}
+
+	atomic.AddInt64(&totalBytes, info.Size())
+	return fileJob{path: path, size: info.Size()}, true
+}
+
+// failFolder handles a destination folder that could not be created: the file stays in the
+// source, counted and recorded as an error
+func failFolder(path, folder string, date dateInfo, err error) {
+	log.Printf("Failed to create directory %s: %v", folder, err)
+	counterMu.Lock()
+	errorCount++
+	counterMu.Unlock()
+	recordError(path, "", errMoveFailed, fmt.Sprintf("could not create destination folder '%s': %v", folder, err))
+	recordOp(manifestEntry{Source: path, Year: date.Year, DateSource: date.Source, Taken: takenStamp(date), Action: actionFailed})
 }
 
 // ensureDir creates a directory if it doesn't exist, using a cache to avoid repeated checks
@@ -172,96 +433,134 @@ func ensureDir(dir string) error {
 	return nil
 }
 
-func processFile(path string) {
-	defer func() {
-		// Update progress counter
-		processed := atomic.AddInt64(&processedFiles, 1)
-		total := atomic.LoadInt64(&totalFiles)
-		if processed%100 == 0 || processed == total {
-			log.Printf("Progress: %d/%d files processed (%.1f%%)", processed, total, float64(processed)/float64(total)*100)
-		}
-	}()
-
-	ext := strings.ToLower(filepath.Ext(path))
+func processFile(job fileJob) {
+	path := job.path
+	r := routeFile(job)
+	ext, mediaType, date := r.ext, r.mediaType, r.date
 	filename := filepath.Base(path)
-	var targetFolder string
-	var mediaType string
-	var yearOrStatus string
-
-	if imageExts[ext] {
-		mediaType = "image"
-		// Extract year from EXIF "Date Taken" metadata ONLY (ignoring file system dates)
-		yearOrStatus = getExifYear(path)
-	} else if videoExts[ext] {
-		mediaType = "video"
-		// Extract year from video "Media Created" metadata (ignoring file system dates)
-		yearOrStatus = getVideoDateYear(path)
-	} else if archiveExts[ext] {
-		mediaType = "archive"
+	if own := strings.ToLower(filepath.Ext(path)); ext != own {
+		log.Printf("'%s' holds %s content; handling it as %s", filename, strings.ToUpper(ext[1:]), ext)
+	}
+	yearOrStatus := date.Year
+	targetFolder := r.folder
+	errorReason := r.reason  // Why the file is being routed to the errors folder
+	errorCode := r.errCode   // The reason's code, the errors subfolder the file goes to
+	var placedAt string      // Set once the file sits in the folder its hash was reserved for
+	var companionDest string // Where the file ended up (or its kept copy), for its companions
+	var keptCopy string      // The library file this one duplicates, which its edited version joins
+	var placed bool          // The file itself was sorted, so all companions follow it
+
+	if len(job.companions) > 0 {
+		defer func() { settleCompanions(path, job.companions, companionDest, keptCopy, placed, date) }()
+	}
+
+	switch r.op {
+	case opSkip:
+		leaveFiltered(path, r.reason)
+		return
+	case opJunk:
+		if !*keepJunk {
+			handleJunk(path)
+		}
+		return
+	case opZeroByte:
+		handleZeroByte(path, *deleteZeroByte)
+		return
+	case opArchive:
+		log.Printf("Moving archive '%s' to '%s' unextracted (--no-extract)", filename, "archives")
+	case opExtract:
 		// Try to extract archive contents and process them
-		if extractArchive(path) {
+		extracted, encrypted := extractArchive(path)
+		if !extracted && interrupted() {
+			// Some entries may not have been processed yet; keep the archive for the resumed run
+			log.Printf("Leaving archive '%s' in place because the run was interrupted", filename)
+			leaveForResume(path)
+			return
+		}
+		if extracted {
 			log.Printf("Successfully extracted and processed contents of '%s'", filename)
 			counterMu.Lock()
 			archiveExtractedCount++
 			counterMu.Unlock()
 			// Delete the original archive after successful extraction
-			if err := os.Remove(path); err != nil {
+			if !sourceRemovable(path) {
+				// Stays in the read-only or linked source
+			} else if !allowDeletion(path) {
+				log.Printf("Leaving extracted archive '%s' in place (deletion limit reached)", filename)
+			} else if err := removeSource(path); err != nil {
 				log.Printf("Warning: Could not delete original archive '%s' after extraction: %v", path, err)
 			}
+			recordOp(manifestEntry{Source: path, Action: actionExtracted})
 			return
+		} else if encrypted {
+			// Kept apart so they can be found and opened once the password turns up
+			targetFolder = encryptedArchivesDir
+			log.Printf("Could not decrypt '%s', moving to '%s' (encrypted archive)", filename, "archives/encrypted")
 		} else {
 			// Extraction failed, move to archives folder as before
 			targetFolder = archivesDir
 			log.Printf("Could not extract '%s', moving to '%s' (archive file)", filename, "archives")
-			counterMu.Lock()
-			archiveMovedCount++
-			counterMu.Unlock()
 		}
-	} else {
-		mediaType = "other"
-		// Delete non-media files
-		if err := os.Remove(path); err != nil {
-			log.Printf("Could not delete non-media file '%s': %v", path, err)
-			counterMu.Lock()
-			errorCount++
-			counterMu.Unlock()
-		} else {
-			log.Printf("Deleted '%s' (not a recognized media file)", filename)
-			counterMu.Lock()
-			deletedNonMediaCount++
-			counterMu.Unlock()
+	case opSidecar:
+		log.Printf("Keeping sidecar '%s' without its photo in '%s'", filename, "sidecars")
+	case opDocument:
+		rel, _ := filepath.Rel(destDir, targetFolder)
+		log.Printf("Keeping document '%s' in '%s'", filename, rel)
+	case opQuarantine, opDelete, opOther:
+		recordUnknownFormat(path)
+		// Past the deletion limit, files to delete are quarantined as if --keep-unknown was set
+		if r.op == opDelete && !sourceRemovable(path) {
+			log.Printf("Leaving '%s' in place (%v)", filename, errSourceKept)
+			return
 		}
-		return
-	}
-
-	// Determine target folder based on metadata (Date Taken for images, Media Created for videos)
-	if mediaType == "image" || mediaType == "video" {
-		if yearOrStatus == "error" {
-			targetFolder = errorsDir
-			log.Printf("Moving '%s' to '%s' due to processing error.", filename, "errors")
-			counterMu.Lock()
-			errorCount++
-			counterMu.Unlock()
-		} else if yearOrStatus != "" && yearOrStatus != "none" {
-			// Year was successfully extracted from metadata
-			targetFolder = filepath.Join(destDir, yearOrStatus)
-			if mediaType == "image" {
-				log.Printf("Processing '%s' (%s) for year '%s' (from Date Taken metadata)", filename, mediaType, yearOrStatus)
+		if r.op == opDelete && !allowDeletion(path) {
+			targetFolder = filepath.Join(quarantineDir, getFileExtensionCategory(path))
+		}
+		if r.op == opOther {
+			log.Printf("Keeping unrecognized file '%s' in 'other_files'", filename)
+		} else if targetFolder == "" {
+			if err := removeSource(path); err != nil {
+				log.Printf("Could not delete non-media file '%s': %v", path, err)
+				counterMu.Lock()
+				errorCount++
+				counterMu.Unlock()
+				recordError(path, "", errDeleteFailed, fmt.Sprintf("could not delete non-media file: %v", err))
+				recordOp(manifestEntry{Source: path, Action: actionFailed})
 			} else {
-				log.Printf("Processing '%s' (%s) for year '%s' (from Media Created metadata)", filename, mediaType, yearOrStatus)
+				log.Printf("Deleted '%s' (not a recognized media file)", filename)
+				counterMu.Lock()
+				deletedNonMediaCount++
+				counterMu.Unlock()
+				recordOp(manifestEntry{Source: path, Action: actionDeleted})
 			}
-		} else {
-			// No metadata found - sort by file extension (ignoring file system dates)
-			extCat := getFileExtensionCategory(path)
-			targetFolder = filepath.Join(noDateDir, extCat)
+			return
+		}
+	case opError:
+		log.Printf("Moving '%s' to '%s' due to processing error.", filename, "errors/"+errorCode)
+		counterMu.Lock()
+		errorCount++
+		counterMu.Unlock()
+	case opCorrupt:
+		log.Printf("⚠️  '%s' is damaged (%s); moving it to 'errors/corrupt'", filename, strings.TrimPrefix(errorReason, "corrupt "+mediaType+": "))
+	case opMove, opConvert:
+		rel, _ := filepath.Rel(destDir, targetFolder)
+		switch {
+		case mediaType == "audio":
+			log.Printf("Processing '%s' (audio) for '%s'", filename, rel)
+		case strings.HasPrefix(targetFolder, screenshotsDir):
+			log.Printf("Processing '%s' (screenshot) for '%s'", filename, rel)
+		case date.Source == "none":
+			metadata := "Media Created"
 			if mediaType == "image" {
-				log.Printf("Processing '%s' (%s) for '%s' (no Date Taken metadata found, ignoring file dates, sorting by extension: %s)", filename, mediaType, filepath.Join("no_date", extCat), extCat)
-			} else {
-				log.Printf("Processing '%s' (%s) for '%s' (no Media Created metadata found, ignoring file dates, sorting by extension: %s)", filename, mediaType, filepath.Join("no_date", extCat), extCat)
+				metadata = "Date Taken"
 			}
-			counterMu.Lock()
-			noDateCount++
-			counterMu.Unlock()
+			log.Printf("Processing '%s' (%s) for '%s' (no %s metadata found, ignoring file dates, sorting by extension: %s)", filename, mediaType, rel, metadata, filepath.Base(targetFolder))
+		case r.external:
+			log.Printf("Processing '%s' (%s) for year '%s' (from %s)", filename, mediaType, yearOrStatus, date.Source)
+		case mediaType == "image":
+			log.Printf("Processing '%s' (%s) for year '%s' (from Date Taken metadata)", filename, mediaType, yearOrStatus)
+		default:
+			log.Printf("Processing '%s' (%s) for year '%s' (from Media Created metadata)", filename, mediaType, yearOrStatus)
 		}
 	}
 
@@ -271,55 +570,243 @@ func processFile(path string) {
 
 	// Create target folder efficiently with caching
 	if err := ensureDir(targetFolder); err != nil {
-		log.Printf("Failed to create directory %s: %v", targetFolder, err)
+		failFolder(path, targetFolder, date, err)
 		return
 	}
 
-	// Calculate hash for deduplication
-	hash, err := fileHash(path)
+	// Calculate hash (or degraded-mode key) for deduplication, unless the size prefilter shows
+	// nothing could be a duplicate of it
+	var hash string
+	var err error
+	if needsHash(path, targetFolder) {
+		hash, err = dedupKey(path)
+	}
 	if err != nil {
 		log.Printf("Could not calculate hash for %s. Moving to errors folder.", filename)
-		targetFolder = errorsDir
-		ensureDir(targetFolder) // Use optimized directory creation
+		errorCode, errorReason = errHashFailed, fmt.Sprintf("hash calculation failed: %v", err)
+		targetFolder = errorFolder(errorCode)
+		if err := ensureDir(targetFolder); err != nil {
+			failFolder(path, targetFolder, date, err)
+			return
+		}
 		counterMu.Lock()
 		errorCount++
 		counterMu.Unlock()
-	} else {
-		// Check for duplicates in the target folder
-		hashMu.Lock()
-		if hashesInDestination[targetFolder] == nil {
-			hashesInDestination[targetFolder] = make(map[string]bool, 100) // Pre-allocate for typical folder size
-		}
-		if hashesInDestination[targetFolder][hash] {
-			hashMu.Unlock()
-			log.Printf("Duplicate detected (hash match in run): '%s' for '%s'. Deleting source.", filename, filepath.Base(targetFolder))
-			if err := os.Remove(path); err != nil {
-				log.Printf("Could not delete duplicate source file '%s': %v", path, err)
-				counterMu.Lock()
-				errorCount++
-				counterMu.Unlock()
+	} else if hash != "" {
+		// Check for duplicates in the target folder. An identical file another worker is still
+		// moving holds a reservation; we wait for its outcome rather than racing it.
+		existing, dup := reserveHash(targetFolder, hash)
+		if dup && !confirmDuplicate(path, existing, hash) {
+			// Only the partial fingerprints matched; continue with the full hash, which no longer collides
+			if hash, err = fileHash(path); err == nil {
+				existing, dup = reserveHash(targetFolder, hash)
 			} else {
-				counterMu.Lock()
-				duplicateDeletedCount++
-				counterMu.Unlock()
+				log.Printf("Could not calculate full hash for %s: %v", filename, err)
+				hash, dup = "", false
+			}
+		}
+		if dup {
+			if existing == "" {
+				existing = targetFolder // Hash restored from a journal without paths
+			}
+			log.Printf("Duplicate detected (hash match in destination): '%s' for '%s'.", filename, filepath.Base(targetFolder))
+			dest, action := resolveDuplicate(path, existing, targetFolder, sortedName(path, ext), hash)
+			recordOp(manifestEntry{Source: path, Destination: dest, Year: date.Year, DateSource: date.Source, Taken: takenStamp(date), Hash: hash, Action: action})
+			if action != actionFailed && dest != targetFolder {
+				recordAlbums(path, dest)
+				keptCopy = dest
+				if action == actionHardlinked || action == actionReflinked {
+					companionDest = dest // Sidecars follow the duplicate's own name
+				}
 			}
 			return
 		}
-		hashesInDestination[targetFolder][hash] = true
-		hashMu.Unlock()
+		if hash != "" {
+			reservedFolder, reservedHash := targetFolder, hash
+			defer func() { releaseHash(reservedFolder, reservedHash, placedAt) }()
+		}
 	}
 
-	// Handle HEIC conversion or regular file move
-	if mediaType == "image" && heicExts[ext] {
-		convertHEIC(path, targetFolder, hash)
+	// Opt-in: a different encoding of an already-seen capture goes to review rather than being deleted
+	routedToReview := false
+	var logicalKey string // Set when this file is the kept copy of its capture
+	if *logicalDedup && mediaType == "image" && !inErrorsDir(targetFolder) {
+		if key := logicalDuplicateKey(path); key != "" {
+			first, ok, superseded := claimLogicalKey(key, path, policyQuality(path))
+			if ok {
+				logicalKey = key
+				if superseded != "" {
+					log.Printf("Logical duplicate detected: '%s' is a better copy of '%s'. Keeping it.", filename, filepath.Base(superseded))
+					if inLibrary(superseded) {
+						demoteKept(superseded, logicalDuplicatesDir, nil, 0)
+					}
+				}
+			} else {
+				log.Printf("Logical duplicate detected: '%s' matches '%s' (same capture time, camera and dimensions). Moving to review.", filename, first)
+				targetFolder = logicalDuplicatesDir
+				if err := ensureDir(targetFolder); err != nil {
+					failFolder(path, targetFolder, date, err)
+					return
+				}
+				routedToReview = true
+			}
+		}
+	}
+
+	// Opt-in: visually identical photos (re-encoded, resized, stripped) are reported or routed to review
+	var nearKept, nearMatch *nearEntry
+	var nearDistance int
+	if *nearDupMode != nearOff && mediaType == "image" && !inErrorsDir(targetFolder) && !routedToReview {
+		if h, ok := dHash(path); ok {
+			var superseded string
+			nearKept, nearMatch, nearDistance, superseded = claimNearHash(h, path, policyQuality(path))
+			if superseded != "" {
+				log.Printf("Near-duplicate detected: '%s' is a better copy of '%s' (distance %d). Keeping it.", filename, filepath.Base(superseded), nearDistance)
+				if inLibrary(superseded) {
+					demoteKept(superseded, nearDuplicatesDir, nearKept, nearDistance)
+				}
+			} else if nearMatch != nil {
+				log.Printf("Near-duplicate detected: '%s' looks identical to '%s' (distance %d)", filename, filepath.Base(nearEntryPath(nearMatch)), nearDistance)
+				if *nearDupMode == nearMove {
+					targetFolder = nearDuplicatesDir
+					if err := ensureDir(targetFolder); err != nil {
+						failFolder(path, targetFolder, date, err)
+						return
+					}
+					routedToReview = true
+				}
+			}
+		}
+	}
+
+	// Handle HEIC conversion or regular file move (files headed for errors are moved untouched)
+	var dest, action string
+	if mediaType == "image" && convertsToJPEG(ext) && !inErrorsDir(targetFolder) && !routedToReview {
+		dest, action = convertHEIC(path, targetFolder, hash)
 	} else {
-		moveFile(path, targetFolder, filename, hash, mediaType)
+		// With --canonical-ext the new name shows up as the destination in the manifest
+		dest, action = moveFile(path, targetFolder, sortedName(path, ext), hash, mediaType)
+		if action == actionMoved {
+			switch {
+			case targetFolder == corruptDir:
+				action = actionCorrupt
+				recordError(path, dest, errorCode, errorReason)
+				if *recoverThumbnails && mediaType == "image" {
+					recoverThumbnail(path, dest, date)
+				}
+			case inErrorsDir(targetFolder):
+				action = actionError
+				recordError(path, dest, errorCode, errorReason)
+			case targetFolder == archivesDir, targetFolder == encryptedArchivesDir:
+				action = actionArchived
+			case routedToReview:
+				action = actionReview
+			case mediaType == "sidecar":
+				action = actionSidecar
+			case mediaType == "document":
+				action = actionDocument
+			case mediaType == "other" && targetFolder == otherFilesDir:
+				action = actionOtherFile
+			case mediaType == "other":
+				action = actionQuarantined
+			}
+		}
+	}
+	countSorted(action, targetFolder, mediaType, date)
+	// With --duplicate-policy best, a better copy may have taken over as the kept one meanwhile
+	supersededIn := ""
+	if nearKept != nil && dest != "" {
+		if d, ok := settleNearEntry(nearKept, path, dest); !ok {
+			supersededIn, nearDistance = nearDuplicatesDir, d
+		}
+	}
+	if logicalKey != "" && dest != "" && !settleLogicalKey(logicalKey, path, dest) {
+		supersededIn = logicalDuplicatesDir
+	}
+	if action != actionMoved && action != actionConverted {
+		supersededIn = ""
+	}
+	if nearMatch != nil && dest != "" {
+		recordNearDuplicate(nearDuplicateItem{Source: path, Destination: dest, Distance: nearDistance, kept: nearMatch})
+	}
+	if hash == "" && prefilterEnabled() && (action == actionMoved || action == actionConverted) {
+		notePlacedUnhashed(dest)
+	}
+	if action == actionMoved || action == actionConverted || action == actionDuplicate {
+		recordAlbums(path, dest)
+	}
+	// Only a file that now sits in the reserved folder counts as that folder's copy
+	if !routedToReview && supersededIn == "" && (action == actionMoved || action == actionConverted || action == actionDuplicate) {
+		placedAt = dest
+	}
+	if (action == actionMoved || action == actionConverted) && yearOrStatus != "" && inYearFolder(targetFolder, yearOrStatus) {
+		checkDateForReview(path, dest, date)
+		writeInferredDate(dest, date, jobPaths(job.companions))
+	}
+	var note string
+	if action != actionConverted {
+		note = extensionNote(path, dest)
+	}
+	recordOp(manifestEntry{Source: path, Destination: dest, Year: date.Year, DateSource: date.Source, Taken: takenStamp(date), Hash: hash, Action: action, Note: note})
+	companionDest = dest
+	placed = action == actionMoved || action == actionConverted || action == actionReview
+	if supersededIn != "" {
+		if supersededIn == nearDuplicatesDir {
+			demoteKept(dest, supersededIn, nearKept, nearDistance)
+		} else {
+			demoteKept(dest, supersededIn, nil, 0)
+		}
+	}
+}
+
+// countSorted updates the summary counters for a file sorted into folder with action: what kind
+// of file it was, and for sorted media, its year, screenshot or audio folder and how it was dated
+// (none, for files sorted by extension). Sorts and applied plans both count through it.
+func countSorted(action, folder, mediaType string, date dateInfo) {
+	sorted := action == actionMoved || action == actionConverted
+	if sorted && date.Year != "" && inYearFolder(folder, date.Year) {
+		recordYear(date.Year, mediaType)
+	}
+	counterMu.Lock()
+	defer counterMu.Unlock()
+	switch action {
+	case actionCorrupt:
+		corruptCount++
+	case actionArchived:
+		archiveMovedCount++
+		if folder == encryptedArchivesDir {
+			archiveEncryptedCount++
+		}
+	case actionReview:
+		if folder == logicalDuplicatesDir {
+			logicalDuplicateCount++ // Near-duplicates are counted as they are reported
+		}
+	case actionSidecar:
+		sidecarKeptCount++
+	case actionDocument:
+		documentCount++
+	case actionOtherFile:
+		otherFilesCount++
+	case actionQuarantined:
+		quarantinedCount++
+	}
+	if sorted && date.Source == "none" {
+		noDateCount++
+	}
+	if sorted && date.Year != "" && inYearFolder(folder, date.Year) && date.Source == mtimeDateSource {
+		mtimeDatedCount++
+	}
+	if sorted && strings.HasPrefix(folder, screenshotsDir) {
+		screenshotCount++
+	}
+	if sorted && strings.HasPrefix(folder, audioDir) {
+		audioCount++
 	}
 }
 
 // getFileExtensionCategory categorizes files by extension for no_date sorting
 func getFileExtensionCategory(path string) string {
-	ext := strings.ToLower(filepath.Ext(path))
+	ext := strings.ToLower(filepath.Ext(canonicalName(path)))
 	if ext == "" {
 		return "no_extension"
 	}
@@ -327,31 +814,57 @@ func getFileExtensionCategory(path string) string {
 	return ext[1:]
 }
 
-// getExifYear tries to extract the year from EXIF "Date Taken" metadata ONLY
+// dateInfo describes a file's capture date and which metadata it came from
+type dateInfo struct {
+	Year   string    // "YYYY"; "" when no date was found; "error" when the file could not be read
+	Source string    // Metadata the date came from, e.g. "EXIF DateTimeOriginal" or "mvhd"
+	Time   time.Time // Full timestamp when known
+	Zoned  bool      // Time is a known instant; otherwise it is a wall-clock time in an unknown zone
+	// Inferred dates were not read unchanged from the file's own metadata (a name, a sidecar, a
+	// catalog, a clock correction)
+	Inferred bool
+}
+
+// getExifDate tries to extract the date from EXIF "Date Taken" metadata ONLY
 // This function explicitly ignores file system dates (modified/created) and only uses camera metadata
-func getExifYear(path string) string {
-	ext := strings.ToLower(filepath.Ext(path))
+func getExifDate(path string) dateInfo {
+	return readImageDate(path, true, true)
+}
+
+// readImageDate reads an image's date from its EXIF tags, the other metadata embedded in it (XMP,
+// IPTC, PNG text), or both, EXIF first
+func readImageDate(path string, exifTags, embedded bool) dateInfo {
+	ext := mediaExt(path)
 
-	// Only try EXIF for formats that commonly have it (skip PNG, GIF, BMP for performance)
-	if ext != ".jpg" && ext != ".jpeg" && ext != ".tiff" && ext != ".heic" && ext != ".heif" {
-		return ""
+	// Only try EXIF for formats that commonly have it (skip GIF, BMP for performance)
+	if ext != ".jpg" && ext != ".jpeg" && ext != ".tif" && ext != ".tiff" && ext != ".webp" && ext != ".png" && !heifContainerExts[ext] && !rawExts[ext] && !thumbnailExts[ext] {
+		return dateInfo{}
 	}
 
 	f, err := os.Open(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			log.Printf("File not found during EXIF read: %s", path)
-			return "error"
+			return dateInfo{Year: "error"}
 		}
 		log.Printf("Error opening file for EXIF: %s: %v", path, err)
-		return ""
+		return dateInfo{}
 	}
 	defer f.Close()
 
-	x, err := exif.Decode(f)
-	if err != nil {
-		// This is normal for many image types that don't have EXIF
-		return ""
+	x, fallback, err := decodeExif(f, ext)
+	if !embedded {
+		fallback = nil
+	}
+	if err != nil || !exifTags {
+		// No EXIF is normal for many image types
+		if fallback != nil {
+			if d, ok := fallback(); ok {
+				log.Printf("Found %s for %s: %s", d.Source, filepath.Base(path), d.Year)
+				return d
+			}
+		}
+		return dateInfo{}
 	}
 
 	// Priority order for EXIF date tags (most reliable first):
@@ -364,7 +877,7 @@ func getExifYear(path string) string {
 		if dateStr, err := tag.StringVal(); err == nil && len(dateStr) >= 4 {
 			if year := extractYearFromDateString(dateStr); year != "" {
 				log.Printf("Found DateTimeOriginal for %s: %s", filepath.Base(path), year)
-				return year
+				return cameraDate(x, path, exifDate(year, "EXIF DateTimeOriginal", dateStr, exifZone(x, exifOffsetTimeOriginal)))
 			}
 		}
 	}
@@ -374,7 +887,7 @@ func getExifYear(path string) string {
 		if dateStr, err := tag.StringVal(); err == nil && len(dateStr) >= 4 {
 			if year := extractYearFromDateString(dateStr); year != "" {
 				log.Printf("Found DateTimeDigitized for %s: %s", filepath.Base(path), year)
-				return year
+				return cameraDate(x, path, exifDate(year, "EXIF DateTimeDigitized", dateStr, exifZone(x, exifOffsetTimeDigitized)))
 			}
 		}
 	}
@@ -384,7 +897,12 @@ func getExifYear(path string) string {
 		year := dt.Year()
 		if year > 1900 && year <= time.Now().Year()+1 {
 			log.Printf("Found DateTime method for %s: %d", filepath.Base(path), year)
-			return strconv.Itoa(year)
+			d := dateInfo{Year: strconv.Itoa(year), Source: "EXIF DateTime", Time: dt}
+			if zone := exifZone(x, exifOffsetTime); zone != nil {
+				// goexif reads the clock in the local zone; the photo's offset is the real one
+				d.Time, d.Zoned = time.Date(dt.Year(), dt.Month(), dt.Day(), dt.Hour(), dt.Minute(), dt.Second(), 0, zone), true
+			}
+			return cameraDate(x, path, d)
 		}
 	}
 
@@ -393,14 +911,88 @@ func getExifYear(path string) string {
 		if dateStr, err := tag.StringVal(); err == nil && len(dateStr) >= 4 {
 			if year := extractYearFromDateString(dateStr); year != "" {
 				log.Printf("Found DateTime tag for %s: %s", filepath.Base(path), year)
-				return year
+				return cameraDate(x, path, exifDate(year, "EXIF DateTime", dateStr, exifZone(x, exifOffsetTime)))
 			}
 		}
 	}
 
+	if fallback != nil {
+		if d, ok := fallback(); ok {
+			log.Printf("Found %s for %s: %s", d.Source, filepath.Base(path), d.Year)
+			return d
+		}
+	}
+
 	// Explicitly log that we found no EXIF date (ignoring file system dates)
 	log.Printf("No EXIF date metadata found for %s (ignoring file system dates)", filepath.Base(path))
-	return ""
+	return dateInfo{}
+}
+
+// decodeExif reads a file's EXIF, wherever its format keeps it. HEIC/HEIF/AVIF keep Exif as an item
+// of the container, WebP as a RIFF chunk and PNG as an eXIf chunk. Their other metadata (XMP, PNG
+// text) is returned as the fallback for dates; JPEG and TIFF files may carry XMP too, and JPEGs IPTC.
+func decodeExif(f *os.File, ext string) (*exif.Exif, func() (dateInfo, bool), error) {
+	switch {
+	case heifContainerExts[ext]:
+		x, err := heifExif(f)
+		return x, func() (dateInfo, bool) { return xmpDate(heifXMP(f)) }, err
+	case ext == ".webp":
+		x, err := webpExif(f)
+		return x, func() (dateInfo, bool) { return xmpDate(webpXMP(f)) }, err
+	case ext == ".png":
+		x, err := pngExif(f)
+		return x, func() (dateInfo, bool) { return pngTextDate(f) }, err
+	case ext == ".jpg" || ext == ".jpeg" || thumbnailExts[ext]:
+		x, err := exif.Decode(f)
+		return x, func() (dateInfo, bool) {
+			if d, ok := xmpDate(jpegXMP(f)); ok {
+				return d, true
+			}
+			return jpegIPTCDate(f)
+		}, err
+	case ext == ".tif" || ext == ".tiff":
+		x, err := exif.Decode(f)
+		return x, func() (dateInfo, bool) { return xmpDate(tiffXMP(f)) }, err
+	}
+	x, err := exif.Decode(f)
+	return x, nil, err
+}
+
+// parseExifTime parses an EXIF "YYYY:MM:DD HH:MM:SS" string, returning the zero time if it is malformed
+func parseExifTime(dateStr string) time.Time {
+	return parseExifTimeIn(dateStr, time.UTC)
+}
+
+// parseExifTimeIn parses an EXIF date string as a clock time in the given zone
+func parseExifTimeIn(dateStr string, zone *time.Location) time.Time {
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", strings.TrimRight(strings.TrimSpace(dateStr), "\x00"), zone)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// exifDate builds the date of an EXIF date tag. The year is the one on the camera's clock; with the
+// tag's offset the time is also a known instant, so photos from other time zones compare correctly.
+func exifDate(year, source, dateStr string, zone *time.Location) dateInfo {
+	if zone == nil {
+		return dateInfo{Year: year, Source: source, Time: parseExifTime(dateStr)}
+	}
+	t := parseExifTimeIn(dateStr, zone)
+	return dateInfo{Year: year, Source: source, Time: t, Zoned: !t.IsZero()}
+}
+
+// exifZone reads the time zone of an EXIF date from its offset tag (e.g. OffsetTimeOriginal,
+// "+02:00"), falling back to OffsetTime; nil when neither is set
+func exifZone(x *exif.Exif, tag exif.FieldName) *time.Location {
+	for _, name := range []exif.FieldName{tag, exifOffsetTime} {
+		offset := exifString(x, name)
+		if t, err := time.Parse("-07:00", offset); err == nil {
+			_, seconds := t.Zone()
+			return time.FixedZone(offset, seconds)
+		}
+	}
+	return nil
 }
 
 // extractYearFromDateString efficiently extracts year from EXIF date string
@@ -420,45 +1012,95 @@ func extractYearFromDateString(dateStr string) string {
 	return ""
 }
 
-// getVideoDateYear attempts to extract the media creation date from video metadata
+// getVideoDate attempts to extract the media creation date from video metadata
 // This reads the "media created" timestamp from video file metadata, NOT file system dates
-func getVideoDateYear(path string) string {
-	ext := strings.ToLower(filepath.Ext(path))
+func getVideoDate(path string) dateInfo {
+	ext := mediaExt(path)
 	filename := filepath.Base(path)
 
 	log.Printf("Attempting to extract video metadata for: %s (extension: %s)", filename, ext)
 
 	var creationTime time.Time
-	var found bool
+	var found, zoned, utc bool // utc: stored as UTC, converted to --video-tz
+	var source string
 
 	switch ext {
-	case ".mp4", ".m4v", ".mov":
-		// Try to read QuickTime/MP4 creation time from metadata
+	case ".mp4", ".m4v", ".mov", ".3gp", ".3g2":
+		// Try to read QuickTime/MP4 creation time from metadata (3GP is the same ISO media format)
 		log.Printf("Processing MP4/MOV file: %s", filename)
-		creationTime, found = extractMP4CreationTime(path)
+		creationTime, source, zoned, utc, found = isoMediaDate(path)
 	case ".avi":
 		// Try to read AVI creation time from metadata
 		log.Printf("Processing AVI file: %s", filename)
 		creationTime, found = extractAVICreationTime(path)
+		source = "AVI INFO"
+	case ".mkv":
+		// Try to read the Matroska DateUTC from the Segment Info
+		log.Printf("Processing MKV file: %s", filename)
+		creationTime, found = extractMKVCreationTime(path)
+		source, utc = "MKV DateUTC", true
+	case ".wmv", ".asf":
+		// Try to read the creation date from the ASF File Properties
+		log.Printf("Processing WMV/ASF file: %s", filename)
+		creationTime, found = extractASFCreationTime(path)
+		source, utc = "ASF File Properties", true
+	case ".mts", ".m2ts":
+		// Try to read the recording date AVCHD camcorders write into the video stream
+		log.Printf("Processing AVCHD file: %s", filename)
+		creationTime, found = extractAVCHDCreationTime(path)
+		source = "AVCHD MDPM"
+	case ".flv":
+		// Try to read the creation date Flash encoders write into onMetaData
+		log.Printf("Processing FLV file: %s", filename)
+		creationTime, found = extractFLVCreationTime(path)
+		source = "FLV onMetaData"
+	case ".mpg", ".mpeg":
+		// MPEG program streams carry no recording date; only the name can tell (see filenameDate)
+		log.Printf("MPEG files carry no recording date: %s", filename)
 	default:
 		// For other video formats, we currently can't extract metadata
 		log.Printf("Video metadata extraction not supported for format '%s': %s", ext, filename)
-		return ""
+		return dateInfo{}
+	}
+
+	if found && utc {
+		creationTime, zoned = inVideoZone(creationTime)
 	}
 
 	if found {
 		year := creationTime.Year()
 		if year > 1900 && year <= time.Now().Year()+1 {
 			log.Printf("✓ Found media creation date for %s: %d", filename, year)
-			return strconv.Itoa(year)
+			return dateInfo{Year: strconv.Itoa(year), Source: source, Time: creationTime, Zoned: zoned}
 		} else {
 			log.Printf("⚠ Invalid media creation year (%d) for %s, treating as no date", year, filename)
-			return ""
+			return dateInfo{}
 		}
 	}
 
 	log.Printf("✗ No media creation date found in metadata for %s", filename)
-	return ""
+	return dateInfo{}
+}
+
+// isoMediaDate reads the creation date of an MP4/MOV (or M4A) file from its richest metadata,
+// reporting where it came from, whether it is a known instant, and whether it was stored as UTC
+func isoMediaDate(path string) (creationTime time.Time, source string, zoned, utc, found bool) {
+	// Apple's creation date keeps the local time and zone, so it comes before mvhd
+	if creationTime, found = extractQuickTimeCreationDate(path); found {
+		return creationTime, creationDateKey, true, false, true
+	}
+	if creationTime, found = extractMP4CreationTime(path); found {
+		return creationTime, "mvhd", false, true, true
+	}
+	// Re-muxing often zeroes mvhd but keeps the track headers
+	if t, box, ok := extractTrackCreationTime(path); ok {
+		return t, box, false, true, true
+	}
+	// Drones and action cameras (DJI) that leave mvhd empty write XMP
+	if d, ok := extractMP4XMPDate(path); ok {
+		return d.Time, d.Source, d.Zoned, false, true
+	}
+	return time.Time{}, "", false, false, false
 }
 
 // extractMP4CreationTime extracts creation time from MP4/MOV/M4V metadata
@@ -505,7 +1147,7 @@ func extractMP4CreationTime(path string) (time.Time, bool) {
 			size = fileSize - at
 		}
 		// Basic sanity
-		if size < hdrLen || at+size > fileSize {
+		if size < hdrLen || size > fileSize-at {
 			return "", 0, 0, false
 		}
 		return typ, size, hdrLen, true
@@ -530,8 +1172,17 @@ func extractMP4CreationTime(path string) (time.Time, bool) {
 	}
 
 	if moovPayloadOffset == 0 || moovPayloadSize <= 0 {
-		log.Printf("No 'moov' atom found in video file: %s", filepath.Base(path))
-		return time.Time{}, false
+		// An 'mdat' sized 0 or wrongly hides a 'moov' after it from the walk
+		moov, _ := scanForMoov(file)
+		if moov == nil {
+			log.Printf("No 'moov' atom found in video file: %s", filepath.Base(path))
+			return time.Time{}, false
+		}
+		ct, ok := isoCreationTime(isoChildBox(moov, "mvhd"))
+		if ok {
+			log.Printf("Extracted creation time (mvhd, 'moov' found past 'mdat') from %s: %s", filepath.Base(path), ct.Format(time.RFC3339))
+		}
+		return ct, ok
 	}
 
 	// Walk atoms inside moov to find mvhd
@@ -742,46 +1393,88 @@ func extractAVICreationTime(path string) (time.Time, bool) {
 }
 
 // extractArchive attempts to extract an archive and process its contents
-// Returns true if extraction was successful, false otherwise
-func extractArchive(archivePath string) bool {
+// Returns true if extraction was successful, false otherwise, and whether it failed because the
+// archive is encrypted
+func extractArchive(archivePath string) (bool, bool) {
 	ext := strings.ToLower(filepath.Ext(archivePath))
 	filename := filepath.Base(archivePath)
 
-	// Create temporary extraction directory
-	tempDir := filepath.Join(filepath.Dir(archivePath), "temp_extract_"+strings.TrimSuffix(filename, ext))
-
-	var extractSuccess bool
+	// Create temporary extraction directory inside this run's temp namespace (never inside the source tree)
+	tempDir := newTempPath("extract", strings.TrimSuffix(filename, ext))
 
-	switch ext {
-	case ".zip":
-		extractSuccess = extractZip(archivePath, tempDir)
+	// Archives inside archives are extracted in turn, down to --archive-depth
+	e, err := beginExtraction(archivePath, tempDir)
+	if err != nil {
+		log.Printf("⚠️  Not extracting '%s': %v", filename, err)
+		return false, false
+	}
+	defer endExtraction(e)
+	if e.depth > 1 {
+		log.Printf("Extracting nested archive %s (depth %d)", e.chain, e.depth)
+	}
+
+	var extractSuccess, encrypted bool
+
+	switch format := archiveFormat(archivePath); format {
+	case formatZip:
+		g := newArchiveGuard(archivePath, tempDir, e)
+		if streamableZip(archivePath) {
+			// Sorted as it is read, so there is nothing left to process afterwards
+			log.Printf("Streaming '%s' folder by folder (contents over --zip-stream-threshold %s)", filename, zipStreamThreshold.String())
+			streamed := streamZip(archivePath, tempDir, g)
+			e.budget.spend(g.total)
+			os.RemoveAll(tempDir)
+			return streamed, false
+		}
+		extractSuccess, encrypted = extractZip(archivePath, tempDir, g)
+	case formatTar, formatTarGz, formatTarBz2:
+		extractSuccess = extractTar(archivePath, tempDir, format, newArchiveGuard(archivePath, tempDir, e))
+	case format7z, formatRar:
+		extractSuccess = extractExternal(archivePath, tempDir, format, newArchiveGuard(archivePath, tempDir, e))
+	case formatGz, formatBz2, formatXz:
+		extractSuccess = extractCompressed(archivePath, tempDir, format, newArchiveGuard(archivePath, tempDir, e))
 	default:
-		// For other archive types (.rar, .7z, .tar, etc.), we currently can't extract
+		// For other archive types, we currently can't extract
 		log.Printf("Archive type '%s' not supported for extraction: %s", ext, filename)
-		return false
+		return false, false
 	}
 
 	if !extractSuccess {
 		// Clean up temp directory if extraction failed
 		os.RemoveAll(tempDir)
-		return false
+		return false, encrypted
 	}
 
-	// Process extracted files
+	// Process extracted files, keeping pairs (RAW+JPEG) together as in the source
 	log.Printf("Processing extracted files from '%s'...", filename)
-	err := filepath.Walk(tempDir, func(path string, info os.FileInfo, err error) error {
+	var extracted []fileJob
+	var extractedBytes int64
+	err = filepath.Walk(tempDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			log.Printf("Error walking extracted files: %v", err)
 			return nil
 		}
-		if info.IsDir() {
-			return nil
+		if interrupted() {
+			return errInterrupted
+		}
+		if !info.Mode().IsRegular() {
+			return nil // Directories, and links an external extractor may have created
 		}
 
-		// Process each extracted file as if it was in the original source
-		processFile(path)
+		extracted = append(extracted, fileJob{path: path, size: info.Size()})
+		extractedBytes += info.Size()
 		return nil
 	})
+	if err == nil && !e.budget.spend(extractedBytes) {
+		root := strings.SplitN(e.chain, " > ", 2)[0]
+		log.Printf("⚠️  Not sorting the contents of '%s' (%s): what was extracted from '%s' is past --archive-budget %s", filename, formatBytes(extractedBytes), root, archiveBudget.String())
+		os.RemoveAll(tempDir)
+		return false, false
+	}
+	if err == nil {
+		// Process each extracted file as if it was in the original source, on idle workers too
+		err = processExtracted(pairCompanions(extracted))
+	}
 
 	// Clean up temporary extraction directory
 	if err := os.RemoveAll(tempDir); err != nil {
@@ -790,79 +1483,150 @@ func extractArchive(archivePath string) bool {
 
 	if err != nil {
 		log.Printf("Error processing extracted files from '%s': %v", filename, err)
-		return false
+		return false, false
 	}
 
-	return true
+	return true, false
 }
 
-// extractZip extracts a ZIP file to the specified directory
-func extractZip(zipPath, destDir string) bool {
-	reader, err := zip.OpenReader(zipPath)
-	if err != nil {
-		log.Printf("Error opening ZIP file '%s': %v", filepath.Base(zipPath), err)
-		return false
+// extractZip extracts a ZIP file to the specified directory. Encrypted entries are decrypted with
+// the --zip-passwords; when none opens one, nothing is used and the second result is true. The
+// guard sees every entry before anything is written, so a zip bomb is not extracted at all.
+func extractZip(zipPath, destDir string, g *archiveGuard) (bool, bool) {
+	reader, filePaths, ok := openZip(zipPath, destDir, g)
+	if !ok {
+		return false, false
 	}
 	defer reader.Close()
 
-	// Create destination directory
-	if err := os.MkdirAll(destDir, 0755); err != nil {
-		log.Printf("Error creating extraction directory '%s': %v", destDir, err)
-		return false
+	if !extractZipFiles(reader.File, filePaths, zipPath, false) {
+		return false, true
 	}
+	return true, false
+}
 
-	// Extract each file
+// openZip opens a ZIP archive and has the guard admit its entries, returning where each file
+// entry is extracted to. The ZIP reader stops entries at the size declared there.
+func openZip(zipPath, destDir string, g *archiveGuard) (*zip.ReadCloser, map[*zip.File]string, bool) {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		log.Printf("Error opening ZIP file '%s': %v", filepath.Base(zipPath), err)
+		return nil, nil, false
+	}
+
+	filePaths := make(map[*zip.File]string)
 	for _, file := range reader.File {
-		// Skip directories
 		if file.FileInfo().IsDir() {
 			continue
 		}
+		filePath, err := g.admit(file.Name, int64(file.UncompressedSize64), int64(file.CompressedSize64))
+		if err != nil {
+			log.Printf("⚠️  Not extracting ZIP file '%s': %v", filepath.Base(zipPath), err)
+			reader.Close()
+			return nil, nil, false
+		}
+		filePaths[file] = filePath
+	}
 
-		// Create the file path
-		filePath := filepath.Join(destDir, file.Name)
+	// Create destination directory
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		log.Printf("Error creating extraction directory '%s': %v", destDir, err)
+		reader.Close()
+		return nil, nil, false
+	}
+	return reader, filePaths, true
+}
 
-		// Create directory structure if needed
-		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
-			log.Printf("Error creating directory structure for '%s': %v", file.Name, err)
+// extractZipFiles extracts the file entries among files a few at a time, as the ZIP reader reads
+// entries independently. With hashed, each is hashed as it is written (see streamZip). It reports
+// false when an encrypted entry turned out to be locked.
+func extractZipFiles(files []*zip.File, filePaths map[*zip.File]string, zipPath string, hashed bool) bool {
+	var wg sync.WaitGroup
+	var locked atomic.Bool
+	slots := make(chan struct{}, runtime.NumCPU())
+	for _, file := range files {
+		// Skip directories, and stop once an entry turned out to be locked
+		filePath, ok := filePaths[file]
+		if !ok {
 			continue
 		}
-
-		// Open the file in the ZIP
-		rc, err := file.Open()
-		if err != nil {
-			log.Printf("Error opening file '%s' in ZIP: %v", file.Name, err)
-			continue
+		if locked.Load() || interrupted() {
+			break
 		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(file *zip.File) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if !extractZipEntry(file, filePath, zipPath, hashed) {
+				locked.Store(true)
+			}
+		}(file)
+	}
+	wg.Wait()
+	return !locked.Load()
+}
 
-		// Create the destination file
-		outFile, err := os.Create(filePath)
-		if err != nil {
-			log.Printf("Error creating extracted file '%s': %v", filePath, err)
-			rc.Close()
-			continue
+// extractZipEntry extracts one file of a ZIP archive. Entries that cannot be read are skipped
+// with an error; it returns false only for an encrypted entry that no password opens.
+func extractZipEntry(file *zip.File, filePath, zipPath string, hashed bool) bool {
+	// Create directory structure if needed
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		log.Printf("Error creating directory structure for '%s': %v", file.Name, err)
+		return true
+	}
+
+	// Encrypted entries need a password, without which the archive is kept whole
+	if file.Flags&0x1 != 0 {
+		if !extractEncryptedEntry(file, filePath, zipPath) {
+			log.Printf("🔒 '%s' is encrypted and none of the %d ZIP passwords opened '%s'", filepath.Base(zipPath), len(zipPasswordCandidates()), file.Name)
+			return false
 		}
+		log.Printf("Extracted: %s (decrypted)", file.Name)
+		return true
+	}
 
-		// Copy the file contents
-		_, err = io.Copy(outFile, rc)
-		outFile.Close()
-		rc.Close()
+	// Open the file in the ZIP
+	rc, err := file.Open()
+	if err != nil {
+		log.Printf("Error opening file '%s' in ZIP: %v", file.Name, err)
+		return true
+	}
+	defer rc.Close()
 
-		if err != nil {
-			log.Printf("Error extracting file '%s': %v", file.Name, err)
-			os.Remove(filePath) // Clean up partially extracted file
-			continue
-		}
+	// Create the destination file
+	outFile, err := os.Create(filePath)
+	if err != nil {
+		log.Printf("Error creating extracted file '%s': %v", filePath, err)
+		return true
+	}
 
-		log.Printf("Extracted: %s", file.Name)
+	// Copy the file contents, hashing them on the way when streaming
+	var w io.Writer = outFile
+	h, _ := newContentHasher(*hashAlgo)
+	hashed = hashed && h != nil && !*noHash && !usePartialHash(int64(file.UncompressedSize64))
+	if hashed {
+		w = io.MultiWriter(outFile, h)
 	}
+	_, err = io.Copy(w, rc)
+	outFile.Close()
 
+	if err != nil {
+		log.Printf("Error extracting file '%s': %v", file.Name, err)
+		os.Remove(filePath) // Clean up partially extracted file
+		return true
+	}
+	if hashed {
+		streamedHashes.Store(filePath, hashPrefix(*hashAlgo)+hex.EncodeToString(h.Sum(nil)))
+	}
+
+	log.Printf("Extracted: %s", file.Name)
 	return true
 }
 
-// convertHEIC handles HEIC to JPEG conversion (stub - requires external tool)
-func convertHEIC(sourcePath, targetFolder, hash string) {
-	// For now, just log that HEIC conversion would happen
-	// In a real implementation, you'd use ImageMagick or similar
+// convertHEIC converts a HEIC/HEIF file to JPEG in the target folder (see convertToJPEG)
+// Returns the resulting path and the manifest action taken
+func convertHEIC(sourcePath, targetFolder, hash string) (string, string) {
 	filename := filepath.Base(sourcePath)
 	stem := strings.TrimSuffix(filename, filepath.Ext(filename))
 	outputFilename := stem + ".jpg"
@@ -875,20 +1639,10 @@ func convertHEIC(sourcePath, targetFolder, hash string) {
 		}
 
 		// Check if existing file has same hash
-		existingHash, err := fileHash(destPath)
-		if err == nil && existingHash == hash {
-			log.Printf("Duplicate detected (HEIC hash matches existing JPG): '%s' vs '%s'. Deleting source HEIC.", filename, filepath.Base(destPath))
-			if err := os.Remove(sourcePath); err != nil {
-				log.Printf("Could not delete source HEIC duplicate '%s': %v", sourcePath, err)
-				counterMu.Lock()
-				errorCount++
-				counterMu.Unlock()
-			} else {
-				counterMu.Lock()
-				duplicateDeletedCount++
-				counterMu.Unlock()
-			}
-			return
+		existingHash, err := dedupKey(destPath)
+		if err == nil && existingHash == hash && confirmDuplicate(sourcePath, destPath, hash) {
+			log.Printf("Duplicate detected (HEIC hash matches existing JPG): '%s' vs '%s'.", filename, filepath.Base(destPath))
+			return resolveDuplicate(sourcePath, destPath, targetFolder, filename, hash)
 		}
 
 		// Rename the output
@@ -900,54 +1654,83 @@ func convertHEIC(sourcePath, targetFolder, hash string) {
 
 	log.Printf("Converting '%s' to '%s'...", filename, filepath.Base(destPath))
 
-	// TODO: Implement actual HEIC to JPEG conversion using ImageMagick or similar
-	// For now, just copy the file as-is (this is a placeholder)
-	if err := copyFile(sourcePath, destPath); err != nil {
+	if err := convertToJPEG(sourcePath, destPath); err != nil {
 		log.Printf("Failed to convert HEIC file '%s': %v", filename, err)
 		counterMu.Lock()
 		errorCount++
 		counterMu.Unlock()
 
 		// Move to error folder
-		errorDest := filepath.Join(errorsDir, filename)
+		errorDest := uniquePath(filepath.Join(errorFolder(errConvertFailed), filename))
+		reason := fmt.Sprintf("HEIC conversion failed: %v", err)
+		if err := ensureDir(filepath.Dir(errorDest)); err != nil {
+			log.Printf("Could not move failed HEIC '%s' to error directory: %v", sourcePath, err)
+			recordError(sourcePath, "", errConvertFailed, reason)
+			return "", actionFailed
+		}
 		if err := copyFile(sourcePath, errorDest); err != nil {
 			log.Printf("Could not move failed HEIC '%s' to error directory: %v", sourcePath, err)
-		} else {
-			log.Printf("Moved failed HEIC '%s' to '%s'", filename, "errors")
-			os.Remove(sourcePath)
+			recordError(sourcePath, "", errConvertFailed, reason)
+			return "", actionFailed
 		}
-		return
+		log.Printf("Moved failed HEIC '%s' to '%s'", filename, "errors/"+errConvertFailed)
+		removeSource(sourcePath)
+		recordError(sourcePath, errorDest, errConvertFailed, reason)
+		return errorDest, actionError
 	}
 
 	counterMu.Lock()
 	heicConvertedCount++
 	counterMu.Unlock()
 
-	// Delete original HEIC after successful conversion
-	if err := os.Remove(sourcePath); err != nil {
+	// Keep or delete the original HEIC after successful conversion. A kept original holds the
+	// hashed content, so later copies of it are matched against it rather than the JPEG.
+	hashPath := destPath
+	if *heicKeepOriginal {
+		if kept, err := keepHEICOriginal(sourcePath, targetFolder); err != nil {
+			log.Printf("Could not keep original HEIC '%s' next to its JPEG: %v", filename, err)
+		} else {
+			hashPath = kept
+			recordOp(manifestEntry{Source: sourcePath, Destination: kept, Hash: hash, Action: actionOriginal})
+		}
+	} else if !sourceRemovable(sourcePath) {
+		// Stays in the read-only or linked source
+	} else if !allowDeletion(sourcePath) {
+		log.Printf("Leaving original HEIC '%s' in place (deletion limit reached)", filename)
+	} else if err := removeSource(sourcePath); err != nil {
 		log.Printf("Could not delete original HEIC '%s' after conversion: %v", sourcePath, err)
 	}
 
 	// Record hash in destination set
-	hashMu.Lock()
-	if hashesInDestination[targetFolder] == nil {
-		hashesInDestination[targetFolder] = make(map[string]bool)
-	}
-	hashesInDestination[targetFolder][hash] = true
-	hashMu.Unlock()
+	registerHash(targetFolder, hash, hashPath)
+	journalHash(targetFolder, hash, hashPath)
 
 	// Increment appropriate counter
 	if strings.Contains(targetFolder, "no_date") {
-		// no_date_count already incremented
-	} else if targetFolder != errorsDir {
+		// Counted as no_date by countSorted
+	} else if !inErrorsDir(targetFolder) {
 		counterMu.Lock()
 		movedCount++
 		counterMu.Unlock()
 	}
+	return destPath, actionConverted
+}
+
+// keepHEICOriginal moves a converted HEIC next to its JPEG (copying it from a read-only source)
+// and returns where it went
+func keepHEICOriginal(sourcePath, targetFolder string) (string, error) {
+	dest := uniquePath(filepath.Join(targetFolder, filepath.Base(sourcePath)))
+	if err := placeFile(sourcePath, dest); err != nil {
+		return "", err
+	}
+	log.Printf("Kept original '%s' as '%s'", filepath.Base(sourcePath), dest)
+	return dest, nil
 }
 
 // moveFile handles moving regular files
-func moveFile(sourcePath, targetFolder, filename, hash, mediaType string) {
+// Returns the resulting path and the manifest action taken: actionMoved, actionDuplicate
+// (path is the existing copy that was kept) or actionFailed
+func moveFile(sourcePath, targetFolder, filename, hash, mediaType string) (string, string) {
 	destPath := filepath.Join(targetFolder, filename)
 	counter := 1
 
@@ -957,20 +1740,10 @@ func moveFile(sourcePath, targetFolder, filename, hash, mediaType string) {
 		}
 
 		// Check if existing file has same hash
-		existingHash, err := fileHash(destPath)
-		if err == nil && existingHash == hash {
-			log.Printf("Duplicate detected (hash match): '%s' vs existing '%s'. Deleting source.", filename, filepath.Base(destPath))
-			if err := os.Remove(sourcePath); err != nil {
-				log.Printf("Could not delete source duplicate file '%s': %v", sourcePath, err)
-				counterMu.Lock()
-				errorCount++
-				counterMu.Unlock()
-			} else {
-				counterMu.Lock()
-				duplicateDeletedCount++
-				counterMu.Unlock()
-			}
-			return
+		existingHash, err := dedupKey(destPath)
+		if err == nil && existingHash == hash && confirmDuplicate(sourcePath, destPath, hash) {
+			log.Printf("Duplicate detected (hash match): '%s' vs existing '%s'.", filename, filepath.Base(destPath))
+			return resolveDuplicate(sourcePath, destPath, targetFolder, filename, hash)
 		}
 
 		// Rename file being moved
@@ -983,34 +1756,50 @@ func moveFile(sourcePath, targetFolder, filename, hash, mediaType string) {
 	}
 
 	// Perform the move
-	if err := os.Rename(sourcePath, destPath); err != nil {
+	kept := false
+	if err := renameSource(sourcePath, destPath); err != nil {
 		// If rename fails, try copy and delete
 		if err := copyFile(sourcePath, destPath); err != nil {
 			log.Printf("Failed to move '%s': %v", sourcePath, err)
 			counterMu.Lock()
 			errorCount++
 			counterMu.Unlock()
-			return
+			recordError(sourcePath, "", errMoveFailed, fmt.Sprintf("move failed: %v", err))
+			return "", actionFailed
+		}
+		if err := removeSource(sourcePath); errors.Is(err, errSourceKept) {
+			kept = true
+		} else if err != nil {
+			log.Printf("Could not delete '%s' after copying it: %v", sourcePath, err)
 		}
-		os.Remove(sourcePath)
 	}
 
-	log.Printf("Successfully moved '%s' to '%s'", filename, destPath)
+	if kept {
+		log.Printf("Copied '%s' to '%s' (source kept)", filename, destPath)
+	} else {
+		log.Printf("Successfully moved '%s' to '%s'", filename, destPath)
+	}
 
 	// Increment appropriate counter
-	switch mediaType {
-	case "video":
+	switch {
+	case kept:
+		counterMu.Lock()
+		sourceKeptCount++
+		counterMu.Unlock()
+	case mediaType == "video":
 		if strings.Contains(targetFolder, "no_date") {
-			// no_date_count already incremented
-		} else if targetFolder != errorsDir {
+			// Counted as no_date by countSorted
+		} else if !inErrorsDir(targetFolder) {
 			counterMu.Lock()
 			videoMovedCount++
 			counterMu.Unlock()
 		}
-	case "image":
+	case mediaType == "image":
 		if strings.Contains(targetFolder, "no_date") {
-			// no_date_count already incremented
-		} else if targetFolder != errorsDir {
+			// Counted as no_date by countSorted
+		} else if strings.HasPrefix(targetFolder, reviewDir) {
+			// Logical and near-duplicates are counted separately
+		} else if !inErrorsDir(targetFolder) {
 			counterMu.Lock()
 			movedCount++
 			counterMu.Unlock()
@@ -1019,16 +1808,16 @@ func moveFile(sourcePath, targetFolder, filename, hash, mediaType string) {
 
 	// Record hash in destination set
 	if hash != "" {
-		hashMu.Lock()
-		if hashesInDestination[targetFolder] == nil {
-			hashesInDestination[targetFolder] = make(map[string]bool)
-		}
-		hashesInDestination[targetFolder][hash] = true
-		hashMu.Unlock()
+		registerHash(targetFolder, hash, destPath)
+		journalHash(targetFolder, hash, destPath)
+		indexHash(destPath, hash)
 	}
+	return destPath, actionMoved
 }
 
-// copyFile copies a file from src to dst with optimized buffered I/O
+// copyFile copies a file from src to dst with optimized buffered I/O.
+// Data is written to a .part file in the run's temp namespace and renamed into place once complete,
+// so an interrupted copy never leaves a half-written file at dst. Large files use resumable copies.
 func copyFile(src, dst string) error {
 	srcFile, err := os.Open(src)
 	if err != nil {
@@ -1036,16 +1825,41 @@ func copyFile(src, dst string) error {
 	}
 	defer srcFile.Close()
 
-	dstFile, err := os.Create(dst)
+	if info, err := srcFile.Stat(); err == nil && resumableThreshold > 0 && info.Size() >= int64(resumableThreshold) {
+		srcFile.Close()
+		return copyFileResumable(src, dst, info)
+	}
+
+	partPath := newTempPath("parts", filepath.Base(dst)+".part")
+	if err := os.MkdirAll(filepath.Dir(partPath), 0755); err != nil {
+		return err
+	}
+	partFile, err := os.Create(partPath)
 	if err != nil {
 		return err
 	}
-	defer dstFile.Close()
 
 	// Use a larger buffer for better performance
 	buf := make([]byte, 64*1024) // 64KB buffer
-	_, err = io.CopyBuffer(dstFile, srcFile, buf)
-	return err
+	_, err = io.CopyBuffer(countCopy(src, partFile), srcFile, buf)
+	if closeErr := partFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return err
+	}
+
+	// Preserve the modification time so copies look the same as renamed files (the --no-hash heuristic relies on it)
+	if info, err := srcFile.Stat(); err == nil {
+		os.Chtimes(partPath, info.ModTime(), info.ModTime())
+	}
+
+	if err := os.Rename(partPath, dst); err != nil {
+		os.Remove(partPath)
+		return err
+	}
+	return nil
 }
 
 // printSummary prints a comprehensive final summary with statistics and performance metrics
@@ -1055,7 +1869,11 @@ func printSummary() {
 
 	log.Println("")
 	log.Println("═══════════════════════════════════════════════════════════════")
-	log.Println("                    📊 PHOTO SORTING COMPLETE 📊")
+	if interrupted() {
+		log.Println("             ⏸️  PHOTO SORTING INTERRUPTED (partial) ⏸️")
+	} else {
+		log.Println("                    📊 PHOTO SORTING COMPLETE 📊")
+	}
 	log.Println("═══════════════════════════════════════════════════════════════")
 	log.Println("")
 
@@ -1064,23 +1882,80 @@ func printSummary() {
 	log.Printf("   • Total files found: %d", totalFound)
 	log.Printf("   • Total files processed: %d", totalProcessed)
 	log.Printf("   • Processing completion: %.1f%%", float64(totalProcessed)/float64(totalFound)*100)
+	log.Printf("   • Data processed: %s of %s", formatBytes(atomic.LoadInt64(&processedBytes)), formatBytes(atomic.LoadInt64(&totalBytes)))
 	log.Println("")
 
 	// Successful Operations
 	log.Println("✅ SUCCESSFUL OPERATIONS:")
-	successfulOps := movedCount + videoMovedCount + heicConvertedCount + noDateCount + archiveExtractedCount + archiveMovedCount
+	successfulOps := movedCount + videoMovedCount + sourceKeptCount + heicConvertedCount + noDateCount + archiveExtractedCount + archiveMovedCount
 	log.Printf("   📷 Photos sorted by Date Taken: %d", movedCount)
 	log.Printf("   🎬 Videos sorted by Media Created: %d", videoMovedCount)
 	log.Printf("   🔄 HEIC/HEIF files converted to JPEG: %d", heicConvertedCount)
 	log.Printf("   📂 Files sorted by extension (no date): %d", noDateCount)
-	log.Printf("   📦 ZIP archives extracted & processed: %d", archiveExtractedCount)
-	log.Printf("   📥 Archives moved (non-ZIP): %d", archiveMovedCount)
+	if sourceKeptCount > 0 {
+		log.Printf("   📋 Files copied, source kept (read-only source or linked folder): %d", sourceKeptCount)
+	}
+	if mtimeDatedCount > 0 {
+		log.Printf("   🕰️  Files sorted by modification time (approximate year): %d", mtimeDatedCount)
+	}
+	if datesWrittenCount > 0 {
+		log.Printf("   ✍️  Inferred dates written to files (--write-dates %s): %d", *writeDates, datesWrittenCount)
+	}
+	if screenshotCount > 0 {
+		log.Printf("   📱 Screenshots sorted into screenshots/: %d", screenshotCount)
+	}
+	if audioCount > 0 {
+		log.Printf("   🎙️  Audio files sorted into audio/: %d", audioCount)
+	}
+	if filteredCount > 0 {
+		log.Printf("   🚧 Files left in place by --only-ext/--since/--until: %d", filteredCount)
+	}
+	if corruptCount > 0 {
+		log.Printf("   🩹 Damaged images and videos moved to errors/corrupt/: %d", corruptCount)
+	}
+	if recoveredCount > 0 {
+		log.Printf("   🩹 Thumbnails recovered from damaged photos to recovered/: %d", recoveredCount)
+	}
+	if zeroByteCount > 0 {
+		if *deleteZeroByte {
+			log.Printf("   🫙 Empty files deleted: %d", zeroByteCount)
+		} else {
+			log.Printf("   🫙 Empty files moved to zero_byte/: %d", zeroByteCount)
+		}
+	}
+	log.Printf("   📦 Archives extracted & processed: %d", archiveExtractedCount)
+	log.Printf("   📥 Archives moved (not extractable): %d", archiveMovedCount)
+	if archiveEncryptedCount > 0 {
+		log.Printf("   🔒 Encrypted archives moved to archives/encrypted/: %d", archiveEncryptedCount)
+	}
 	log.Printf("   🗑️  Non-media files deleted: %d", deletedNonMediaCount)
+	if junkCount > 0 {
+		if *keepJunk {
+			log.Printf("   🧹 System junk files left alone (--keep-junk): %d", junkCount)
+		} else {
+			log.Printf("   🧹 System junk files deleted: %d", junkCount)
+		}
+	}
+	if sidecarKeptCount > 0 {
+		log.Printf("   🗒️  Sidecars kept without their photo: %d", sidecarKeptCount)
+	}
+	if documentCount > 0 {
+		log.Printf("   📄 Documents kept in documents/: %d", documentCount)
+	}
+	if *keepUnknown || quarantinedCount > 0 {
+		log.Printf("   🧪 Unrecognized files quarantined: %d", quarantinedCount)
+	}
+	if otherFilesCount > 0 {
+		log.Printf("   📦 Unrecognized files kept in other_files/: %d", otherFilesCount)
+	}
+	if companionCount > 0 {
+		log.Printf("   🎞️  Companion files (RAW, Live Photo videos, sidecars) moved with their photo: %d", companionCount)
+	}
 	log.Printf("   ➡️  Total successful operations: %d", successfulOps)
 	log.Println("")
 
 	// Issues and Cleanup
-	issueCount := errorCount + duplicateDeletedCount + skippedCount
+	issueCount := errorCount + duplicateDeletedCount + duplicateLinkedCount + duplicateCopiedCount + duplicateKeptCount + deletionsBlockedCount + logicalDuplicateCount + nearDuplicateCount + skippedCount
 	if issueCount > 0 {
 		log.Println("⚠️  ISSUES HANDLED:")
 		if errorCount > 0 {
@@ -1089,6 +1964,28 @@ func printSummary() {
 		if duplicateDeletedCount > 0 {
 			log.Printf("   🔄 Duplicate files deleted: %d", duplicateDeletedCount)
 		}
+		if duplicateLinkedCount > 0 {
+			log.Printf("   🔗 Duplicates replaced by %ss: %d", *dedupAction, duplicateLinkedCount)
+		}
+		if duplicateCopiedCount > 0 {
+			log.Printf("   📄 Duplicates placed as full copies (linking not possible): %d", duplicateCopiedCount)
+		}
+		if duplicateKeptCount > 0 {
+			log.Printf("   📌 Duplicates left in the source: %d", duplicateKeptCount)
+		}
+		if deletionsBlockedCount > 0 {
+			log.Printf("   🛡️  Deletions blocked by the deletion limit: %d", deletionsBlockedCount)
+		}
+		if logicalDuplicateCount > 0 {
+			log.Printf("   🔍 Logical duplicates moved to review: %d", logicalDuplicateCount)
+		}
+		if nearDuplicateCount > 0 {
+			if *nearDupMode == nearMove {
+				log.Printf("   👯 Near-duplicates moved to review: %d", nearDuplicateCount)
+			} else {
+				log.Printf("   👯 Near-duplicates found (kept, see %s): %d", reportFileName, nearDuplicateCount)
+			}
+		}
 		if skippedCount > 0 {
 			log.Printf("   ⏭️  Files skipped (already processed): %d", skippedCount)
 		}
@@ -1096,13 +1993,72 @@ func printSummary() {
 		log.Println("")
 	}
 
+	if flagged := snapshotDateReview(); len(flagged) > 0 {
+		log.Printf("📅 DATES TO DOUBLE-CHECK: %d files were sorted with suspicious dates (see %s)", len(flagged), reportFileName)
+		log.Println("")
+	}
+
+	// Which unrecognized formats were kept, so they can be added to the config or requested
+	if formats := snapshotUnknownFormats(); (*keepUnknown || !*aggressiveDelete) && len(formats) > 0 {
+		const maxListed = 10
+		kept := "kept unless on the --delete-exts list"
+		if *keepUnknown {
+			kept = "quarantined"
+		}
+		log.Printf("🧪 UNRECOGNIZED FORMATS (%s, most common first):", kept)
+		for i, f := range formats {
+			if i == maxListed {
+				log.Printf("   ... and %d more extensions (see %s)", len(formats)-maxListed, reportFileName)
+				break
+			}
+			log.Printf("   %s: %d files, %s (e.g. %s)", f.Ext, f.Count, formatBytes(f.Bytes), strings.Join(f.Samples, ", "))
+		}
+		log.Println("")
+	}
+
+	// Errors triage: where each failed file came from and why
+	if records := snapshotErrorRecords(); len(records) > 0 {
+		const maxListed = 20
+		log.Println("🩺 ERRORS TRIAGE:")
+		for i, rec := range records {
+			if i == maxListed {
+				log.Printf("   ... and %d more (see %s)", len(records)-maxListed, filepath.Join(errorsDir, errorsIndexName))
+				break
+			}
+			where := "left in place"
+			if rec.Location != "" {
+				where = "now " + rec.Location
+			}
+			log.Printf("   ❌ [%s] %s (%s): %s", rec.Code, rec.Origin, where, rec.Reason)
+		}
+		log.Println("")
+	}
+
 	// Performance Stats
 	log.Println("⚡ PERFORMANCE & SETTINGS:")
 	log.Printf("   🔧 Worker goroutines used: %d", runtime.NumCPU()*2)
-	log.Printf("   📋 Sorting method: Date Taken (photos) & Media Created (videos)")
-	log.Printf("   🚫 File system dates: Ignored")
+	if *dateSources != "" {
+		log.Printf("   📋 Sorting method: date sources from %s (images: %s; videos: %s)", *dateSources,
+			strings.Join(dateSourceChain["image"], ", "), strings.Join(dateSourceChain["video"], ", "))
+	} else {
+		log.Printf("   📋 Sorting method: Date Taken (photos) & Media Created (videos)")
+	}
+	if usesFileDates() {
+		log.Printf("   🕰️  File system dates: Used when metadata has no date (modification time)")
+	} else {
+		log.Printf("   🚫 File system dates: Ignored")
+	}
 	log.Printf("   📁 Extension-based sorting: Enabled for no-date files")
-	log.Printf("   📦 ZIP auto-extraction: Enabled")
+	if *noHash {
+		log.Printf("   ⚠️  Duplicate detection: name+size+date heuristic (content hashing DISABLED)")
+	} else {
+		log.Printf("   🔐 Duplicate detection: %s", hashAlgoLabel())
+	}
+	if *noExtract {
+		log.Printf("   📦 Archive extraction: Disabled (--no-extract), archives moved to archives/")
+	} else {
+		log.Printf("   📦 ZIP, TAR, 7z and RAR auto-extraction: Enabled")
+	}
 	log.Println("")
 
 	// Directory Locations
@@ -1110,18 +2066,39 @@ func printSummary() {
 	log.Printf("   📂 Sorted photos: %s", destDir)
 	log.Printf("   📅 No-date files: %s", noDateDir)
 	log.Printf("   📦 Archives: %s", archivesDir)
+	if sidecarKeptCount > 0 {
+		log.Printf("   🗒️  Sidecars without their photo: %s", sidecarsDir)
+	}
+	if documentCount > 0 {
+		log.Printf("   📄 Documents: %s", documentsDir)
+	}
+	if quarantinedCount > 0 {
+		log.Printf("   🧪 Quarantined files: %s", quarantineDir)
+	}
+	if otherFilesCount > 0 {
+		log.Printf("   📦 Unrecognized files: %s", otherFilesDir)
+	}
+	if zeroByteCount > 0 && !*deleteZeroByte {
+		log.Printf("   🫙 Empty files: %s", zeroByteDir)
+	}
 	if errorCount > 0 {
 		log.Printf("   ❌ Error files: %s", errorsDir)
 	}
 	log.Println("")
 
 	// Final Status
-	if errorCount > 0 {
+	if interrupted() {
+		log.Println("⏸️  INTERRUPTED - Files not yet processed were left in the source; run again with --resume to continue")
+	} else if errorCount > 0 {
 		log.Println("⚠️  COMPLETED WITH ISSUES - Check the 'errors' folder for problematic files")
 	} else {
 		log.Println("🎉 COMPLETED SUCCESSFULLY - All files processed without errors!")
 	}
 
+	if *noHash {
+		log.Println("⚠️  CONTENT-LEVEL DEDUPLICATION WAS OFF FOR THIS RUN (--no-hash) - byte-identical copies with different names or dates may remain")
+	}
+
 	log.Println("═══════════════════════════════════════════════════════════════")
 	log.Printf("📋 IMPORTANT: Photos sorted by 'Date Taken' metadata, Videos by 'Media Created' metadata")
 	log.Printf("🔍 Review your sorted files in: %s", destDir)
@@ -1172,6 +2149,11 @@ func removeEmptyDirsPass(basePath string) int {
 			return nil
 		}
 
+		// Leave the tool's own state/temporary folder, and source folders the walk skipped, alone
+		if isStateDir(path) || (basePath == sourceDir && (isExcluded(path, true) || beyondMaxDepth(path))) {
+			return filepath.SkipDir
+		}
+
 		// Check if directory is empty
 		if isDirEmpty(path) {
 			if err := os.Remove(path); err != nil {
@@ -1202,15 +2184,38 @@ func isDirEmpty(dirPath string) bool {
 	return len(entries) == 0
 }
 
-// fileHash calculates the SHA256 hash of a file with optimized buffered I/O
+// dedupKey returns the key used for duplicate detection: the content hash normally, a partial
+// fingerprint for files above --partial-hash-threshold, or a name+size+modification-date heuristic
+// when hashing is disabled with --no-hash
+func dedupKey(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !*noHash {
+		if usePartialHash(info.Size()) {
+			return partialFingerprint(path, info.Size())
+		}
+		return cachedFileHash(path)
+	}
+	return fmt.Sprintf(heuristicKeyPrefix+"%s|%d|%d", strings.ToLower(filepath.Base(path)), info.Size(), info.ModTime().Unix()), nil
+}
+
+// fileHash calculates the content hash of a file (--hash-algo, SHA256 by default) with optimized buffered I/O
 func fileHash(path string) (string, error) {
+	if hash, ok := streamedHashes.Load(path); ok {
+		return hash.(string), nil // Hashed as it was extracted
+	}
 	f, err := os.Open(path)
 	if err != nil {
 		return "", err
 	}
 	defer f.Close()
 
-	h := sha256.New()
+	h, err := newContentHasher(*hashAlgo)
+	if err != nil {
+		return "", err
+	}
 	// Use a larger buffer for better performance on large files
 	buf := make([]byte, 64*1024) // 64KB buffer
 	for {
@@ -1225,5 +2230,5 @@ func fileHash(path string) (string, error) {
 			return "", err
 		}
 	}
-	return hex.EncodeToString(h.Sum(nil)), nil
+	return hashPrefix(*hashAlgo) + hex.EncodeToString(h.Sum(nil)), nil
 }
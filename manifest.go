@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Actions recorded in the manifest
+const (
+	actionMoved       = "moved"       // Sorted into a year or no_date folder
+	actionConverted   = "converted"   // HEIC/HEIF converted to JPEG
+	actionDeleted     = "deleted"     // Non-media file deleted
+	actionDuplicate   = "duplicate"   // Duplicate source deleted; destination is the copy that was kept
+	actionError       = "error"       // Moved to the errors folder
+	actionArchived    = "archived"    // Archive moved to the archives folder
+	actionExtracted   = "extracted"   // Archive extracted and deleted
+	actionFailed      = "failed"      // Could not be handled; left in place
+	actionReview      = "review"      // Moved to a review folder for a human decision
+	actionQuarantined = "quarantined" // Unrecognized file kept in the quarantine folder
+	actionOriginal    = "original"    // HEIC/HEIF kept next to its converted JPEG (--heic-keep-original)
+
+	// Duplicates handled by --dedup-action other than delete
+	actionDuplicateKept = "duplicate_kept" // Left in the source; destination is the copy in the library
+	actionHardlinked    = "hardlinked"     // Replaced by a hardlink to the kept copy
+	actionReflinked     = "reflinked"      // Replaced by a copy-on-write clone of the kept copy
+	actionCopied        = "copied"         // Linking was not possible, so the duplicate was placed as a full copy
+)
+
+// manifestDir holds one manifest per run
+var manifestDir = filepath.Join(destDir, "manifests")
+
+// manifestEntry records a single file operation, for auditing and undo tooling
+type manifestEntry struct {
+	Time        time.Time `json:"time"`
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Year        string    `json:"year"`
+	DateSource  string    `json:"date_source"`
+	Hash        string    `json:"hash"`
+	Action      string    `json:"action"`
+	Taken       string    `json:"taken,omitempty"`        // Capture time: UTC when its zone is known, else the camera's clock
+	Note        string    `json:"note,omitempty"`         // E.g. an extension corrected on the way (--fix-extensions)
+	Archive     string    `json:"archive,omitempty"`      // For a file extracted from an archive: the archives it was in, outermost first
+	ArchivePath string    `json:"archive_path,omitempty"` // And where it was inside the innermost one
+}
+
+var manifestCSVHeader = []string{"time", "source", "destination", "year", "date_source", "hash", "action", "taken", "note", "archive", "archive_path"}
+
+// takenStamp formats a capture date for the manifest: normalized to UTC when it is a known
+// instant, otherwise as the clock time without a zone
+func takenStamp(d dateInfo) string {
+	switch {
+	case d.Time.IsZero():
+		return ""
+	case d.Zoned:
+		return d.Time.UTC().Format(time.RFC3339)
+	}
+	return d.Time.Format("2006-01-02T15:04:05")
+}
+
+var (
+	manifestMu   sync.Mutex
+	manifestFile *os.File
+	manifestBuf  *bufio.Writer
+	manifestCSV  *csv.Writer // Set for the csv format; nil means JSON Lines
+	manifestPath string
+)
+
+// manifestExt returns the file extension of a manifest format (csv or json)
+func manifestExt(format string) (string, error) {
+	switch format {
+	case "csv":
+		return ".csv", nil
+	case "json":
+		return ".jsonl", nil
+	}
+	return "", fmt.Errorf("unknown manifest format %q (expected csv or json)", format)
+}
+
+// openManifest creates this run's manifest file in the requested format (csv or json)
+func openManifest(format string) error {
+	ext, err := manifestExt(format)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(manifestDir, 0755); err != nil {
+		return err
+	}
+	manifestPath = filepath.Join(manifestDir, "manifest-"+runID+ext)
+	f, err := os.Create(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	manifestFile = f
+	manifestBuf = bufio.NewWriter(f)
+	if format == "csv" {
+		manifestCSV = csv.NewWriter(manifestBuf)
+		manifestCSV.Write(manifestCSVHeader)
+		manifestCSV.Flush()
+	}
+	log.Printf("Writing operation manifest to '%s'", manifestPath)
+	return nil
+}
+
+// recordOp appends an operation to the manifest. Each record is flushed immediately so the
+// manifest stays useful even if the run is interrupted.
+func recordOp(entry manifestEntry) {
+	noteOutcome(entry.Source, entry.Action)
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+	if manifestFile == nil {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if e := extractionOf(entry.Source); e != nil && entry.Archive == "" {
+		entry.Archive, entry.ArchivePath = e.chain, e.innerPath(entry.Source)
+	}
+
+	if manifestCSV != nil {
+		manifestCSV.Write([]string{entry.Time.Format(time.RFC3339), entry.Source, entry.Destination, entry.Year, entry.DateSource, entry.Hash, entry.Action, entry.Taken, entry.Note, entry.Archive, entry.ArchivePath})
+		manifestCSV.Flush()
+	} else {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		manifestBuf.Write(append(data, '\n'))
+	}
+	if err := manifestBuf.Flush(); err != nil {
+		log.Printf("Warning: Could not write to manifest '%s': %v", manifestPath, err)
+	}
+}
+
+// closeManifest flushes and closes the manifest file
+func closeManifest() {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+	if manifestFile == nil {
+		return
+	}
+	manifestBuf.Flush()
+	manifestFile.Close()
+	manifestFile = nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Matroska element IDs read for the recording date
+const (
+	mkvEBMLHeader = 0x1A45DFA3
+	mkvSegment    = 0x18538067
+	mkvInfo       = 0x1549A966
+	mkvDateUTC    = 0x4461
+	mkvCluster    = 0x1F43B675
+)
+
+// mkvEpoch is the origin of Matroska's DateUTC, which counts nanoseconds from the start of 2001
+var mkvEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// extractMKVCreationTime reads the DateUTC of an MKV's Segment Info: when the camera or muxer
+// wrote the file
+func extractMKVCreationTime(path string) (time.Time, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("Error opening MKV file for metadata reading: %s: %v", filepath.Base(path), err)
+		return time.Time{}, false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	// The EBML header, then the Segment holding everything else
+	header, headerSize, ok := ebmlChild(f, 0, info.Size(), mkvEBMLHeader, 0)
+	if !ok {
+		return time.Time{}, false
+	}
+	segment, segmentSize, ok := ebmlChild(f, header+headerSize, info.Size(), mkvSegment, 0)
+	if !ok {
+		return time.Time{}, false
+	}
+	// Info comes before the first Cluster of media data
+	infoStart, infoSize, ok := ebmlChild(f, segment, segment+segmentSize, mkvInfo, mkvCluster)
+	if !ok {
+		log.Printf("No Segment Info found in MKV file: %s", filepath.Base(path))
+		return time.Time{}, false
+	}
+	dateStart, dateSize, ok := ebmlChild(f, infoStart, infoStart+infoSize, mkvDateUTC, 0)
+	if !ok || dateSize != 8 {
+		log.Printf("No DateUTC in the Segment Info of MKV file: %s", filepath.Base(path))
+		return time.Time{}, false
+	}
+	buf := make([]byte, 8)
+	if _, err := f.ReadAt(buf, dateStart); err != nil {
+		return time.Time{}, false
+	}
+	nanos := int64(binary.BigEndian.Uint64(buf))
+	if nanos == 0 {
+		return time.Time{}, false // Muxers without a clock write the epoch itself
+	}
+	ct := mkvEpoch.Add(time.Duration(nanos))
+	log.Printf("Extracted creation time (DateUTC) from %s: %s", filepath.Base(path), ct.Format(time.RFC3339))
+	return ct, true
+}
+
+// ebmlChild looks for the element want among the elements from start to end, returning where its
+// data starts and its size. Elements of unknown size (a live recording's Segment) run to end. It
+// gives up at the element stop (0 for none) and at other elements of unknown size, which cannot be
+// skipped.
+func ebmlChild(f *os.File, start, end int64, want, stop uint64) (int64, int64, bool) {
+	for offset := start; offset < end; {
+		id, idLen, _, err := ebmlVint(f, offset, false)
+		if err != nil {
+			return 0, 0, false
+		}
+		size, sizeLen, unknown, err := ebmlVint(f, offset+idLen, true)
+		if err != nil {
+			return 0, 0, false
+		}
+		data := offset + idLen + sizeLen
+		switch {
+		case id == want && unknown:
+			return data, end - data, end > data
+		case id == want:
+			return data, int64(size), true
+		case id == stop || unknown:
+			return 0, 0, false
+		}
+		offset = data + int64(size)
+	}
+	return 0, 0, false
+}
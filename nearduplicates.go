@@ -0,0 +1,171 @@
+package main
+
+import (
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sync"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+)
+
+// Values accepted by --near-duplicates
+const (
+	nearOff    = "off"
+	nearReport = "report" // List near-duplicates in the reports; files are sorted normally
+	nearMove   = "move"   // Move near-duplicates to review/near_duplicates
+)
+
+// nearDuplicatesDir receives visually identical copies in move mode
+var nearDuplicatesDir = filepath.Join(reviewDir, "near_duplicates")
+
+// nearHashBands is the number of 8-bit bands a 64-bit dHash is split into for lookup. Two hashes
+// within Hamming distance < nearHashBands share at least one band exactly (pigeonhole), so only
+// files sharing a band need comparing.
+const nearHashBands = 8
+
+// nearEntry is an image kept by the near-duplicate pass
+type nearEntry struct {
+	hash     uint64
+	path     string       // Source path, replaced by the destination once the file is sorted
+	quality  imageQuality // Only measured with --duplicate-policy best
+	distance int          // Set when a better copy took the entry over: how far it was from the old one
+}
+
+// nearDuplicateItem is one near-duplicate found in this run, for the reports
+type nearDuplicateItem struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Matches     string `json:"matches"`  // The visually identical image that was kept
+	Distance    int    `json:"distance"` // Hamming distance between the dHashes (0 = identical)
+
+	kept *nearEntry // Matches is filled from this at snapshot time, once the kept image is sorted
+}
+
+var (
+	nearMu         sync.Mutex
+	nearBands      [nearHashBands]map[uint8][]*nearEntry
+	nearDuplicates []nearDuplicateItem
+)
+
+// dHash computes a 64-bit difference hash: the image is reduced to 9x8 grayscale cells and each bit
+// records whether a cell is brighter than its right-hand neighbour. Re-encoding, resizing and
+// stripping metadata barely change it.
+func dHash(path string) (uint64, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return 0, false
+	}
+	b := img.Bounds()
+	if b.Dx() < 9 || b.Dy() < 8 {
+		return 0, false
+	}
+
+	// Average the luminance of each of the 9x8 cells
+	var cells [8][9]float64
+	var counts [8][9]int
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		cy := (y - b.Min.Y) * 8 / b.Dy()
+		for x := b.Min.X; x < b.Max.X; x++ {
+			cx := (x - b.Min.X) * 9 / b.Dx()
+			r, g, bl, _ := img.At(x, y).RGBA()
+			cells[cy][cx] += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)
+			counts[cy][cx]++
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if cells[y][x]/float64(counts[y][x]) > cells[y][x+1]/float64(counts[y][x+1]) {
+				hash |= 1
+			}
+		}
+	}
+	return hash, true
+}
+
+// claimNearHash looks for a kept image whose dHash is within --near-threshold of hash and returns
+// it as match. Without a match the image is kept, and its entry returned so its path can be
+// updated once it is sorted. In move mode with --duplicate-policy best, a better image takes the
+// matching entry over instead: it is returned as kept, and the image it replaces as superseded.
+func claimNearHash(hash uint64, path string, quality imageQuality) (kept, match *nearEntry, distance int, superseded string) {
+	nearMu.Lock()
+	defer nearMu.Unlock()
+	for band := 0; band < nearHashBands; band++ {
+		for _, e := range nearBands[band][uint8(hash>>(8*band))] {
+			d := bits.OnesCount64(e.hash ^ hash)
+			if d > *nearThreshold {
+				continue
+			}
+			if *nearDupMode == nearMove && *duplicatePolicy == keepBest && quality.betterThan(e.quality) {
+				superseded = e.path
+				e.path, e.quality, e.distance = path, quality, d
+				return e, nil, d, superseded
+			}
+			return nil, e, d, ""
+		}
+	}
+
+	e := &nearEntry{hash: hash, path: path, quality: quality}
+	for band := 0; band < nearHashBands; band++ {
+		if nearBands[band] == nil {
+			nearBands[band] = make(map[uint8][]*nearEntry)
+		}
+		key := uint8(hash >> (8 * band))
+		nearBands[band][key] = append(nearBands[band][key], e)
+	}
+	return e, nil, 0, ""
+}
+
+// settleNearEntry records where a kept image was sorted. It returns false, with the distance to the
+// better copy, if one took the entry over while the image was being sorted.
+func settleNearEntry(e *nearEntry, path, dest string) (int, bool) {
+	nearMu.Lock()
+	defer nearMu.Unlock()
+	if e.path != path {
+		return e.distance, false
+	}
+	e.path = dest
+	return 0, true
+}
+
+// nearEntryPath returns where a kept image currently is
+func nearEntryPath(e *nearEntry) string {
+	nearMu.Lock()
+	defer nearMu.Unlock()
+	return e.path
+}
+
+// recordNearDuplicate counts a near-duplicate and adds it to the reports
+func recordNearDuplicate(item nearDuplicateItem) {
+	nearMu.Lock()
+	nearDuplicates = append(nearDuplicates, item)
+	nearMu.Unlock()
+	counterMu.Lock()
+	nearDuplicateCount++
+	counterMu.Unlock()
+}
+
+// snapshotNearDuplicates returns a copy of the near-duplicates found so far
+func snapshotNearDuplicates() []nearDuplicateItem {
+	nearMu.Lock()
+	defer nearMu.Unlock()
+	out := make([]nearDuplicateItem, len(nearDuplicates))
+	for i, item := range nearDuplicates {
+		item.Matches = item.kept.path
+		out[i] = item
+	}
+	return out
+}
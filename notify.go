@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// notifyTimeout bounds how long the completion webhook may delay exit
+const notifyTimeout = 15 * time.Second
+
+// sendNotification POSTs the run summary as JSON to the --notify-url webhook, if one was given
+func sendNotification(summary runSummary) {
+	if *notifyURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(summary)
+	if err != nil {
+		log.Printf("Could not encode notification payload: %v", err)
+		return
+	}
+
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Post(*notifyURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Failed to send completion notification: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Printf("Completion notification rejected by %s: %s", *notifyURL, resp.Status)
+		return
+	}
+	log.Printf("Sent completion notification (%s)", summary.Status)
+}
+
+// fatalf logs a fatal error, records and notifies that the run failed, and exits with exitFatal
+func fatalf(format string, args ...interface{}) {
+	err := fmt.Errorf(format, args...)
+	log.Print(err)
+	summary := buildSummary(err)
+	writeSummaryFile(summary)
+	writeHTMLReport(summary)
+	sendNotification(summary)
+	closeManifest()
+	closeDuplicatesReport()
+	closeCheckpoint(false)
+	closeHashIndex()
+	cleanupRunTemp()
+	os.Exit(summary.exitCode())
+}
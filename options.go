@@ -0,0 +1,212 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Command-line options
+var (
+	noHash               = flag.Bool("no-hash", false, "Skip content hashing for speed; duplicates are detected by name+size+date only (degraded mode)")
+	notifyURL            = flag.String("notify-url", "", "POST the final run summary as JSON to this URL when the run finishes or fails (e.g. ntfy or Slack webhook)")
+	logicalDedup         = flag.Bool("logical-dedup", false, "Detect the same capture saved at different compression levels (DateTimeOriginal+SubSec+camera+dimensions) and move matches to review/logical_duplicates")
+	manifestFormat       = flag.String("manifest-format", "csv", "Format of the per-run operation manifest in sorted_photos/manifests: csv or json (JSON Lines)")
+	resume               = flag.Bool("resume", false, "Continue an interrupted run from its checkpoint: skip files it already handled and restore its destination hashes")
+	reviewBefore         = flag.Int("review-before", 1990, "Flag files dated before this year for review in the reports (they are still sorted); 0 disables")
+	reviewFuture         = flag.Bool("review-future", true, "Flag files dated after the current time for review in the reports (they are still sorted)")
+	scanDestination      = flag.Bool("scan-destination", true, "Hash the files already in the destination before processing, so files already in the library are treated as duplicates")
+	schedule             = flag.String("schedule", "walk", "Processing order: walk (directory order), small-first, or size-classes (round-robin by file size so large videos don't hold up photos)")
+	fixExtensions        = flag.Bool("fix-extensions", false, "Give sorted files the extension of their content where theirs is wrong or missing (a JPEG named .png becomes .jpg, IMG_0001 becomes IMG_0001.jpg); the manifest notes each correction")
+	canonicalExt         = flag.Bool("canonical-ext", false, "Normalize equivalent extensions when moving (lower-case, .jpeg/.jpe->.jpg, .tif->.tiff, .mpeg->.mpg); the new names are recorded in the manifest")
+	hashAlgo             = flag.String("hash-algo", "sha256", "Content hash used for duplicate detection: sha256, blake3, or xxhash (fastest, non-cryptographic)")
+	documentYears        = flag.Bool("document-years", false, "Sort documents (PDFs, office files, text) into sorted_photos/documents/<year> by their modification time instead of one documents folder")
+	onlyExt              = flag.String("only-ext", "", "Only sort files with these extensions, e.g. \"jpg,mp4\"; everything else is left in place. Sidecars and RAW or Live Photo companions follow their file")
+	since                = flag.String("since", "", "Only sort files dated on or after this year, month or day (2015, 2015-06 or 2015-06-01); everything else, including files without a date, is left in place")
+	until                = flag.String("until", "", "Only sort files dated on or before this year, month or day (2020, 2020-12 or 2020-12-31); everything else, including files without a date, is left in place")
+	keepJunk             = flag.Bool("keep-junk", false, "Leave system junk (.DS_Store, Thumbs.db, desktop.ini, ._* AppleDouble files, Synology @eaDir folders) in place instead of deleting it")
+	keepUnknown          = flag.Bool("keep-unknown", false, "Move all unrecognized files to sorted_photos/quarantine/<ext>, even those on the --delete-exts list, and report which formats were found")
+	deleteExtList        = flag.String("delete-exts", "tmp,temp,crdownload,part,partial,lnk", "Comma-separated extensions of unrecognized files to delete, e.g. leftovers of downloads; other unrecognized files are kept in sorted_photos/other_files/. Empty deletes none")
+	aggressiveDelete     = flag.Bool("aggressive-delete", false, "Delete every unrecognized file, as earlier versions did, instead of keeping those not on the --delete-exts list in sorted_photos/other_files/ (--keep-unknown takes precedence)")
+	sizePrefilter        = flag.Bool("size-prefilter", false, "Only hash files whose size matches another file that could be a duplicate; unique sizes skip hashing (their manifest hash is left empty)")
+	nearDupMode          = flag.String("near-duplicates", "off", "Perceptual (dHash) detection of visually identical photos with different bytes: off, report (list them in the reports) or move (to review/near_duplicates)")
+	maxDeletions         = flag.Int("max-deletions", 0, "Stop deleting after this many files in the run; later unrecognized files that would be deleted are quarantined and duplicates, extracted archives and HEIC originals are left in place. 0 disables")
+	dedupAction          = flag.String("dedup-action", "delete", "What to do with exact duplicates: delete them from the source, keep them there, or replace them with a hardlink or reflink (copy-on-write clone) to the kept copy under their own name")
+	duplicatePolicy      = flag.String("duplicate-policy", "first", "Which copy of a logical duplicate (or near-duplicate in move mode) stays in the library: first (whichever arrived first) or best (highest resolution, then has EXIF, then largest); the other goes to review")
+	nearThreshold        = flag.Int("near-threshold", 4, "Maximum dHash bit difference (0-7) for two photos to count as near-duplicates")
+	useHashIndex         = flag.Bool("hash-index", true, "Keep a persistent hash index of the library in sorted_photos/.photo-sorter/index.db so unchanged files are not re-hashed on every run")
+	lightroomCatalog     = flag.String("lightroom-catalog", "", "Read this Lightroom Classic .lrcat catalog for capture dates of files without metadata, and record its collections (and which files have edits) in albums.json")
+	filesFrom            = flag.String("files-from", "", "Process only the files listed in this file (\"-\" for stdin), one path per line or NUL-separated, instead of walking the source folder")
+	photosLibrary        = flag.String("photos-library", "", "Sort the originals of an Apple Photos .photoslibrary bundle (read-only: files are copied, dates and albums come from its database when present) instead of the source folder")
+	heicConvert          = flag.Bool("heic-convert", true, "Convert HEIC/HEIF files to JPEG; with --heic-convert=false they are sorted by date unconverted")
+	avifConvert          = flag.Bool("avif-convert", false, "Also convert AVIF files to JPEG (like HEIC); by default they are sorted unconverted")
+	jpegQuality          = flag.Int("jpeg-quality", 92, "JPEG quality (1-100) for converted HEIC/HEIF files")
+	heicKeepOriginal     = flag.Bool("heic-keep-original", false, "Keep the original HEIC/HEIF next to its converted JPEG instead of deleting it")
+	rawSubfolder         = flag.Bool("raw-subfolder", false, "Put the RAW file of a RAW+JPEG pair (and its XMP sidecar) in a raw/ subfolder of the JPEG's folder instead of next to it")
+	filenameDates        = flag.Bool("filename-dates", false, "For files without date metadata, use a date in the file name (IMG_20210615_123456.jpg, PXL_20230101_*.jpg, 2019-07-04 13.22.01.jpg, Screenshot_20220310-*.png) before sorting them into no_date")
+	whatsappSubfolder    = flag.Bool("whatsapp-subfolder", false, "Put WhatsApp media (IMG-20200131-WA0012.jpg, VID-20200131-WA0003.mp4) in a whatsapp/ subfolder of their year folder")
+	fallbackMtime        = flag.Bool("fallback-mtime", false, "Date files without any metadata date by their modification time instead of sorting them into no_date; the manifest marks these dates as approximate")
+	gpsTimezone          = flag.Bool("gps-timezone", false, "For photos with GPS coordinates, use the local time of where they were taken (from the GPS time or the EXIF offset) when the camera's clock was set to another time zone")
+	writeDates           = flag.String("write-dates", "", "Write dates the sorter inferred (from file names, sidecars, catalogs, clock corrections) back so other tools agree: xmp (an XMP sidecar next to the sorted file) or exif (into the sorted file, with exiftool)")
+	dateSources          = flag.String("date-sources", "", "JSON file ordering the date sources per media type, e.g. {\"image\": [\"exif\", \"embedded\", \"sidecar\", \"filename\", \"mtime\"]}. Sources: library, exif, embedded, media, sidecar, catalog, filename, folder, mtime, none")
+	cameraFolders        = flag.Bool("camera-folders", false, "Sort photos into a subfolder of their year named after the camera model in their EXIF (e.g. 2021/Pixel 6/); photos without one stay in the year folder")
+	corruptCheck         = flag.Bool("corrupt-check", true, "Check that JPEG, PNG, WebP and GIF images (markers, chunks and sizes, without decoding pixels) and MP4, MOV, 3GP, MKV and AVI videos (container structure) are whole, and move truncated or damaged ones to sorted_photos/errors/corrupt/ with the reason in an error sidecar")
+	recoverThumbnails    = flag.Bool("recover-thumbnails", false, "For images moved to errors/corrupt/, save their EXIF thumbnail, when it is intact, to sorted_photos/recovered/<name>_thumbnail.jpg so at least a small version of the photo survives")
+	noExtract            = flag.Bool("no-extract", false, "Move archives to sorted_photos/archives/ untouched instead of extracting them and sorting their contents (the archives are not deleted)")
+	archiveAlbumHints    = flag.Bool("archive-albums", false, "Record files extracted from archives in albums named after the archives (Summer Trip 2019.zip) and the folders they were in inside (Holiday/), in albums.json and --album-folders; generic names like Takeout chunks and DCIM are skipped")
+	followSymlinks       = flag.Bool("follow-symlinks", false, "Sort what symlinks in the source point to: linked files are copied and the link removed, linked folders are walked once each. Off by default, when symlinks are left alone")
+	maxDepth             = flag.Int("max-depth", 0, "Only sort files this many folder levels deep in the source: 1 sorts just the files directly in it, leaving its subfolders alone. 0 (default) has no limit")
+	archiveDepth         = flag.Int("archive-depth", 3, "Extract archives found inside archives down to this depth (1 extracts only archives in the source); deeper ones are moved to the archives folder")
+	archiveMaxEntries    = flag.Int("archive-max-entries", 100000, "Do not extract ZIP, TAR, 7z or RAR archives with more entries than this (zip bomb protection); they are moved to the archives folder. 0 disables")
+	archiveMaxRatio      = flag.Int("archive-max-ratio", 100, "Do not extract ZIP, TAR, 7z or RAR archives whose contents, or any ZIP, 7z or RAR entry over 1MB, expand more than this many times their compressed size (zip bomb protection); they are moved to the archives folder. 0 disables")
+	zipPasswords         = flag.String("zip-passwords", "", "File of passwords to try on encrypted ZIP archives, one per line (also read from $PHOTO_SORTER_ZIP_PASSWORDS); ZIPs none of them open are moved to sorted_photos/archives/encrypted/")
+	zipPasswordPrompt    = flag.Bool("zip-password-prompt", false, "Ask on the terminal for the password of encrypted ZIP archives the --zip-passwords list does not open (the password is echoed)")
+	deleteZeroByte       = flag.Bool("delete-zero-byte", false, "Delete empty (zero-byte) photos, videos, archives and sidecars instead of moving them to sorted_photos/zero_byte/ for review")
+	audioFiles           = flag.Bool("audio", false, "Sort audio files (.m4a, .mp3, .wav, .amr, .opus voice memos and recordings) by the recording date in their tags into sorted_photos/audio/<year>/ (or audio/no_date/) instead of handling them as unrecognized files")
+	screenshots          = flag.Bool("screenshots", false, "Sort screenshots (named Screenshot_*/Screen Shot *, marked by iOS, or PNGs at a screen resolution without a camera) into sorted_photos/screenshots/<year>/ instead of the year folders")
+	layout               = flag.String("layout", layoutYear, "Folder layout inside each year: year (sorted_photos/2021/) or events (sorted_photos/2021/2021-06-12_Event/, a new event starting wherever no photo was taken for --event-gap)")
+	eventGap             = flag.Duration("event-gap", 6*time.Hour, "Time without photos that starts a new event in --layout events (e.g. 3h, 24h)")
+	placeFolders         = flag.Bool("place-folders", false, "Sort photos with GPS coordinates into Country/City subfolders of their year (e.g. 2022/Japan/Tokyo/) by the nearest city within 50 km, found offline; photos elsewhere or without GPS stay in the year folder")
+	placesFile           = flag.String("places-file", "", "GeoNames dump (e.g. cities1000.txt from download.geonames.org) to find the cities of --place-folders in, instead of the built-in list of major cities")
+	albumFolders         = flag.String("album-folders", "", "Also build sorted_photos/albums/<Album> folders of symlinks or hardlinks to the sorted files of each album (Google Takeout, Photos library, Lightroom collections): symlink or hardlink")
+	videoTZ              = flag.String("video-tz", videoTZUTC, "Time zone video creation times stored as UTC (MP4/MOV mvhd, MKV, WMV) are read in when taking their year: utc (as stored, right for cameras that write their local clock), local (this computer's zone), an offset like +02:00, or a zone name like Europe/Berlin")
+	spaceCheck           = flag.String("space-check", "abort", "What to do when the destination volume lacks room for the run before it starts: abort, warn or off")
+	resumableThreshold   = byteSize(1 << 30)
+	partialHashThreshold = byteSize(0)
+	zipStreamThreshold   = byteSize(4 << 30)
+	spaceMargin          = byteSize(1 << 30)
+	maxDeletedBytes      = byteSize(0)
+	archiveBudget        = byteSize(0)
+)
+
+func init() {
+	flag.Var(&resumableThreshold, "resumable-threshold", "Copies of files at least this large (e.g. 500MB, 2GB) are resumable after a failure or interruption; 0 disables")
+	flag.Var(&partialHashThreshold, "partial-hash-threshold", "Fingerprint files at least this large (e.g. 2GB) by size + first 4MB + last 4MB instead of hashing them fully; matches are fully hashed before deleting a duplicate. 0 disables")
+	flag.Var(&maxDeletedBytes, "max-deleted-bytes", "Stop deleting once this much data (e.g. 20GB) was deleted in the run; later deletions become quarantine or are left in place. 0 disables")
+	flag.Var(&filenamePatterns, "filename-pattern", "A regular expression dating files without date metadata by their name (without extension), with named groups year, month, day and optionally hour, minute, second, or a Unix timestamp as epoch (seconds) or epochms. Repeatable; tried before the --filename-dates patterns")
+	flag.Var(&excludePatterns, "exclude", "A glob of source files or folders to leave alone, e.g. \"**/node_modules/**\" or \"*.tmp\". Patterns with a slash match the path within the source folder, others the name at any depth; ** spans folders. Repeatable")
+	flag.Var(&clockShifts, "shift-time", "Correct a wrong camera clock before dating photos: MODEL=OFFSET for one camera model (e.g. \"CanonEOS70D=+2h\") or OFFSET for all cameras. Offsets combine y, mo, d, h, m and s (e.g. -1y, +1d12h). Repeatable")
+	flag.Var(&zipStreamThreshold, "zip-stream-threshold", "Sort ZIP archives whose contents total at least this much (e.g. 2GB) a folder at a time as they are read, hashing files as they are written, instead of extracting them whole first; ZIPs with encrypted entries are extracted whole. 0 disables")
+	flag.Var(&archiveBudget, "archive-budget", "Stop extracting archives nested in one archive in the source once their contents total this much (e.g. 50GB); archives past it are moved to the archives folder. 0 disables")
+	flag.Var(&spaceMargin, "space-margin", "Free space to keep on the destination volume on top of the run's estimated needs (e.g. 5GB)")
+}
+
+// byteSize is a flag value accepting plain byte counts or sizes with a unit suffix (KB, MB, GB, TB)
+type byteSize int64
+
+func (b *byteSize) String() string { return formatBytes(int64(*b)) }
+
+func (b *byteSize) Set(s string) error {
+	n, err := parseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = byteSize(n)
+	return nil
+}
+
+// parseByteSize parses sizes like "4096", "500MB" or "1.5GB" (binary units)
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multipliers := []struct {
+		suffix string
+		mult   float64
+	}{
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	}
+	mult := 1.0
+	for _, m := range multipliers {
+		if strings.HasSuffix(s, m.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, m.suffix))
+			mult = m.mult
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(v * mult), nil
+}
+
+// checkSortFlags validates the sort options, shared by a sort, plan and apply, and loads the files
+// they name. An invalid one ends the run.
+func checkSortFlags() {
+	if _, err := newContentHasher(*hashAlgo); err != nil {
+		fatalf("Invalid --hash-algo: %v", err)
+	}
+	if *dateSources != "" {
+		if err := loadDateSources(*dateSources); err != nil {
+			fatalf("Invalid --date-sources: %v", err)
+		}
+	}
+	if *fallbackMtime {
+		applyFallbackMtime()
+	}
+	if *placeFolders {
+		if err := loadPlaces(*placesFile); err != nil {
+			fatalf("Invalid --places-file: %v", err)
+		}
+	}
+	if *nearDupMode != nearOff && *nearDupMode != nearReport && *nearDupMode != nearMove {
+		fatalf("Invalid --near-duplicates %q (expected off, report or move)", *nearDupMode)
+	}
+	if *duplicatePolicy != keepFirst && *duplicatePolicy != keepBest {
+		fatalf("Invalid --duplicate-policy %q (expected first or best)", *duplicatePolicy)
+	}
+	if *dedupAction != dedupDelete && *dedupAction != dedupKeep && *dedupAction != dedupHardlink && *dedupAction != dedupReflink {
+		fatalf("Invalid --dedup-action %q (expected delete, keep, hardlink or reflink)", *dedupAction)
+	}
+	if *maxDeletions < 0 {
+		fatalf("Invalid --max-deletions %d (expected 0 or more)", *maxDeletions)
+	}
+	if *jpegQuality < 1 || *jpegQuality > 100 {
+		fatalf("Invalid --jpeg-quality %d (expected 1-100)", *jpegQuality)
+	}
+	if *albumFolders != "" && *albumFolders != albumLinkSymlink && *albumFolders != albumLinkHardlink {
+		fatalf("Invalid --album-folders %q (expected symlink or hardlink)", *albumFolders)
+	}
+	if err := checkWriteDates(); err != nil {
+		fatalf("Invalid --write-dates: %v", err)
+	}
+	if err := checkLayout(); err != nil {
+		fatalf("Invalid --layout: %v", err)
+	}
+	if err := loadVideoTZ(); err != nil {
+		fatalf("Invalid --video-tz: %v", err)
+	}
+	if err := loadFilters(); err != nil {
+		fatalf("Invalid filters: %v", err)
+	}
+	loadDeleteExts()
+	if *nearThreshold < 0 || *nearThreshold >= nearHashBands {
+		fatalf("Invalid --near-threshold %d (expected 0-%d)", *nearThreshold, nearHashBands-1)
+	}
+	if *archiveDepth < 1 {
+		fatalf("Invalid --archive-depth %d (expected 1 or more)", *archiveDepth)
+	}
+	if *maxDepth < 0 {
+		fatalf("Invalid --max-depth %d (expected 0 for no limit, or more)", *maxDepth)
+	}
+	if *archiveMaxEntries < 0 {
+		fatalf("Invalid --archive-max-entries %d (expected 0 or more)", *archiveMaxEntries)
+	}
+	if *archiveMaxRatio < 0 {
+		fatalf("Invalid --archive-max-ratio %d (expected 0 or more)", *archiveMaxRatio)
+	}
+	if err := loadZipPasswords(*zipPasswords); err != nil {
+		fatalf("Invalid --zip-passwords: %v", err)
+	}
+	if _, err := manifestExt(*manifestFormat); err != nil {
+		fatalf("Invalid --manifest-format: %v", err)
+	}
+	if *spaceCheck != spaceCheckAbort && *spaceCheck != spaceCheckWarn && *spaceCheck != spaceCheckOff {
+		fatalf("Unknown --space-check value %q (expected abort, warn or off)", *spaceCheck)
+	}
+	if _, err := scheduleJobs(nil, *schedule); err != nil {
+		fatalf("Invalid --schedule: %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// otherFilesDir keeps the unrecognized files that are not known junk, so nothing is deleted on a guess
+var otherFilesDir = filepath.Join(destDir, "other_files")
+
+// actionOtherFile marks an unrecognized file kept in the other_files folder
+const actionOtherFile = "other_file"
+
+// deleteExts are the extensions of unrecognized files that are deleted (--delete-exts): leftovers
+// of downloads and temporary files, never anything a user may have made
+var deleteExts map[string]bool
+
+// loadDeleteExts parses --delete-exts
+func loadDeleteExts() {
+	deleteExts = parseExtList(*deleteExtList)
+}
+
+// deletesUnknown reports whether an unrecognized file is deleted: its extension is on the
+// --delete-exts list, or with --aggressive-delete any unrecognized file is
+func deletesUnknown(path string) bool {
+	return *aggressiveDelete || deleteExts[strings.ToLower(filepath.Ext(path))]
+}
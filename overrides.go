@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// External metadata about source files, e.g. from a Photos library database. It is loaded before
+// processing starts and only read afterwards, so it needs no lock.
+var (
+	dateOverrides = make(map[string]dateInfo) // Source path -> date that takes precedence over file metadata
+	dateFallbacks = make(map[string]dateInfo) // Source path -> date used when the file's own metadata has none
+	sourceAlbums  = make(map[string][]string) // Source path -> album titles it belongs to
+)
+
+// readOnlySource is set when the source must not be modified (a Photos library): files are copied
+// instead of moved and nothing in the source is deleted
+var readOnlySource bool
+
+// errReadOnlySource is returned by renameSource when the source must be left untouched
+var errReadOnlySource = errors.New("source is read-only")
+
+// errSourceKept is returned by removeSource when it leaves the file in place: the file was
+// copied rather than moved, and is counted as such
+var errSourceKept = errors.New("source kept: read-only, or in a folder reached through a symlink")
+
+// albumsFileName is the album catalog written to the destination root
+const albumsFileName = "albums.json"
+
+var (
+	albumsMu      sync.Mutex
+	albumContents = make(map[string][]string) // Album title -> sorted files in it, this run
+)
+
+// dateOverride returns the externally supplied date for a source file, if any
+func dateOverride(path string) (dateInfo, bool) {
+	d, ok := dateOverrides[path]
+	return d, ok
+}
+
+// dateFallback returns the externally supplied date for a source file without a metadata date
+func dateFallback(path string) (dateInfo, bool) {
+	d, ok := dateFallbacks[path]
+	return d, ok
+}
+
+// recordAlbums adds a sorted file to the catalog of every album its source belonged to, including
+// those its archive suggests (--archive-albums)
+func recordAlbums(source, dest string) {
+	albums := append(archiveAlbums(source), sourceAlbums[source]...)
+	if len(albums) == 0 {
+		return
+	}
+	if rel, err := filepath.Rel(destDir, dest); err == nil {
+		dest = filepath.ToSlash(rel) // Paths are relative to the library so it can be moved
+	}
+	albumsMu.Lock()
+	defer albumsMu.Unlock()
+	for _, album := range albums {
+		albumContents[album] = append(albumContents[album], dest)
+	}
+}
+
+// removeSource deletes a source file, or returns errSourceKept when sourceRemovable says no
+func removeSource(path string) error {
+	if !sourceRemovable(path) {
+		return errSourceKept
+	}
+	return os.Remove(path)
+}
+
+// sourceRemovable reports whether a source file may be deleted: not in a read-only source, where
+// only files extracted into the run's temp namespace are, nor in a folder reached through a
+// symlink. A symlink itself may be, never what it points to.
+func sourceRemovable(path string) bool {
+	return !(readOnlySource && !isRunTemp(path)) && !inLinkedFolder(path)
+}
+
+// renameSource moves a source file by renaming it. A read-only source and a symlink refuse, so the
+// caller falls back to copying.
+func renameSource(src, dst string) error {
+	if readOnlySource && !isRunTemp(src) {
+		return errReadOnlySource
+	}
+	if isSymlink(src) || inLinkedFolder(src) {
+		return errSymlinkSource
+	}
+	return os.Rename(src, dst)
+}
+
+// writeAlbumCatalog merges this run's album memberships into albums.json (album -> files relative
+// to the destination)
+func writeAlbumCatalog() {
+	albumsMu.Lock()
+	defer albumsMu.Unlock()
+	if len(albumContents) == 0 {
+		return
+	}
+
+	path := filepath.Join(destDir, albumsFileName)
+	catalog := make(map[string][]string)
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			log.Printf("Warning: Could not read existing album catalog '%s', rewriting it: %v", path, err)
+			catalog = make(map[string][]string)
+		}
+	}
+	for album, files := range albumContents {
+		seen := make(map[string]bool, len(catalog[album]))
+		for _, f := range catalog[album] {
+			seen[f] = true
+		}
+		for _, f := range files {
+			if !seen[f] {
+				catalog[album] = append(catalog[album], f)
+				seen[f] = true
+			}
+		}
+		sort.Strings(catalog[album])
+	}
+
+	data, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		log.Printf("Could not encode album catalog: %v", err)
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		log.Printf("Could not write album catalog '%s': %v", path, err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		log.Printf("Could not write album catalog '%s': %v", path, err)
+		return
+	}
+	log.Printf("Album catalog written to '%s' (%d albums)", path, len(catalog))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	partialHashChunk   = 4 << 20      // Bytes fingerprinted at each end of a large file
+	partialKeyPrefix   = "partial:"   // Marks dedup keys that are fingerprints rather than full hashes
+	heuristicKeyPrefix = "heuristic:" // Marks --no-hash keys: name, size and date, not the contents
+)
+
+// partialFingerprint hashes a file's size plus its first and last 4MB. It is cheap for huge videos
+// but not proof of identity, so matches are confirmed with a full hash before anything is deleted.
+func partialFingerprint(path string, size int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h, err := newContentHasher(*hashAlgo)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "%d\n", size)
+	if _, err := io.CopyN(h, f, partialHashChunk); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(-partialHashChunk, io.SeekEnd); err != nil {
+		return "", err
+	}
+	if _, err := io.CopyN(h, f, partialHashChunk); err != nil {
+		return "", err
+	}
+	return partialKeyPrefix + hashPrefix(*hashAlgo) + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// usePartialHash reports whether a file of this size is fingerprinted instead of fully hashed
+func usePartialHash(size int64) bool {
+	return partialHashThreshold > 0 && size >= int64(partialHashThreshold) && size >= 2*partialHashChunk
+}
+
+// isPartialKey reports whether a dedup key is a partial fingerprint
+func isPartialKey(key string) bool {
+	return strings.HasPrefix(key, partialKeyPrefix)
+}
+
+// isHeuristicKey reports whether a dedup key is a --no-hash name+size+date key
+func isHeuristicKey(key string) bool {
+	return strings.HasPrefix(key, heuristicKeyPrefix)
+}
+
+// confirmDuplicate makes sure a source really is identical to the existing file its dedup key
+// matched. Full hashes and heuristic keys are taken as they are (resolveDuplicate never deletes a
+// heuristic match); partial fingerprints are confirmed by hashing both files completely. Without a
+// known existing file nothing is confirmed.
+func confirmDuplicate(source, existing, key string) bool {
+	if !isPartialKey(key) {
+		return true
+	}
+	if existing == "" {
+		return false
+	}
+	srcHash, err := fileHash(source)
+	if err != nil {
+		log.Printf("Could not confirm duplicate '%s': %v", filepath.Base(source), err)
+		return false
+	}
+	existingHash, err := cachedFileHash(existing)
+	if err != nil {
+		log.Printf("Could not confirm duplicate '%s' against '%s': %v", filepath.Base(source), existing, err)
+		return false
+	}
+	if srcHash != existingHash {
+		log.Printf("Partial fingerprint of '%s' matches '%s' but the full contents differ; keeping both", filepath.Base(source), existing)
+		return false
+	}
+	return true
+}
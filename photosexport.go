@@ -0,0 +1,62 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// appleVariantName matches the names Photos gives the versions of a photo when exporting
+// unmodified originals: IMG_E1234 is the edited render of IMG_1234, and IMG_O1234.AAE holds the
+// adjustments of its original
+var appleVariantName = regexp.MustCompile(`(?i)^(IMG_)([EO])(\d+)$`)
+
+// appleVariantBase returns the name of the photo a Photos variant belongs to (IMG_1234 for
+// IMG_E1234), or stem itself
+func appleVariantBase(stem string) string {
+	return appleVariantName.ReplaceAllString(stem, "$1$3")
+}
+
+// isAppleEdit reports whether path is the edited render of a photo (IMG_E1234.JPG, IMG_E1234.MOV)
+func isAppleEdit(path string) bool {
+	m := appleVariantName.FindStringSubmatch(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	return m != nil && strings.EqualFold(m[2], "E") && !isSidecar(path)
+}
+
+// withAppleVariant gives stem (e.g. IMG_1234_1) the variant letter of name (e.g. IMG_E1234), so a
+// renamed photo's versions keep Photos' naming
+func withAppleVariant(stem, name string) string {
+	m := appleVariantName.FindStringSubmatch(name)
+	if m == nil || len(stem) <= 4 || !strings.EqualFold(stem[:4], "IMG_") || appleVariantName.MatchString(stem) {
+		return stem
+	}
+	return stem[:4] + m[2] + stem[4:]
+}
+
+// momentFolderLayouts are the dates Photos puts at the end of moment folder names when exporting
+// with "Subfolder Format: Moment Name" ("Paris, June 12, 2019" or "12 June 2019")
+var momentFolderLayouts = []struct {
+	pattern *regexp.Regexp
+	layout  string
+}{
+	{regexp.MustCompile(`(?:^|[ ,-])([A-Z][a-z]+ \d{1,2}, \d{4})$`), "January 2, 2006"},
+	{regexp.MustCompile(`(?:^|[ ,-])(\d{1,2} [A-Z][a-z]+ \d{4})$`), "2 January 2006"},
+}
+
+// momentFolderDate reads the date from the name of the Photos moment folder a file was exported to
+func momentFolderDate(path string) (dateInfo, bool) {
+	folder := filepath.Base(filepath.Dir(path))
+	for _, m := range momentFolderLayouts {
+		match := m.pattern.FindStringSubmatch(folder)
+		if match == nil {
+			continue
+		}
+		t, err := time.ParseInLocation(m.layout, match[1], time.Local)
+		if err != nil || t.Year() <= 1900 || t.Year() > time.Now().Year()+1 {
+			continue
+		}
+		return dateInfo{Year: t.Format("2006"), Source: "Photos export folder", Time: t}, true
+	}
+	return dateInfo{}, false
+}
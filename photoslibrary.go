@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// coreDataEpoch is the reference date of the timestamps in the Photos database
+var coreDataEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// trashedAssets holds originals that are in the Photos trash; they are skipped
+var trashedAssets = make(map[string]bool)
+
+// openPhotosLibrary makes a .photoslibrary bundle the source: its originals folder is walked
+// read-only (files are copied, never deleted)
+func openPhotosLibrary(library string) error {
+	info, err := os.Stat(library)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a Photos library bundle", library)
+	}
+
+	// Photos 5 and later keep originals in "originals"; older libraries in "Masters"
+	originals := ""
+	for _, name := range []string{"originals", "Masters"} {
+		if dir := filepath.Join(library, name); isDir(dir) {
+			originals = dir
+			break
+		}
+	}
+	if originals == "" {
+		return fmt.Errorf("no originals or Masters folder in %s", library)
+	}
+	sourceDir = originals
+	readOnlySource = true
+	log.Printf("Reading Photos library '%s' (originals are copied; the library is not modified)", library)
+	return nil
+}
+
+// readPhotosDatabase loads the library's capture dates, albums and trash state when its database
+// can be read. It needs the run's temp namespace, so it runs after initRunTemp.
+func readPhotosDatabase(library string) {
+	originals := sourceDir
+	dbPath := filepath.Join(library, "database", "Photos.sqlite")
+	if _, err := os.Stat(dbPath); err != nil {
+		log.Println("⚠️  No Photos.sqlite database found (libraries older than Photos 5 are not read); dates come from file metadata")
+		return
+	}
+	if err := loadPhotosDatabase(dbPath, originals); err != nil {
+		log.Printf("⚠️  Could not read the Photos database, dates come from file metadata: %v", err)
+	}
+}
+
+// isDir reports whether path is an existing directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// loadPhotosDatabase reads capture dates, trash state and album memberships from Photos.sqlite.
+// The database is copied first (with its WAL) so a running Photos app can't interfere.
+func loadPhotosDatabase(dbPath, originals string) error {
+	db, err := copySQLiteDatabase(dbPath, "photosdb")
+	if err != nil {
+		return err
+	}
+
+	// Photos 5 named the asset table ZGENERICASSET; later versions ZASSET
+	assetTable := "ZASSET"
+	if tables, err := querySQLite(db, "SELECT name FROM sqlite_master WHERE type='table' AND name='ZGENERICASSET'"); err == nil && len(tables) > 0 {
+		assetTable = "ZGENERICASSET"
+	}
+	rows, err := querySQLite(db, "SELECT Z_PK, ZDIRECTORY, ZFILENAME, ZDATECREATED, ZTRASHEDSTATE FROM "+assetTable+" WHERE ZFILENAME IS NOT NULL")
+	if err != nil {
+		return err
+	}
+
+	assetPaths := make(map[string]string, len(rows)) // Z_PK -> original path
+	for _, row := range rows {
+		if len(row) < 5 {
+			continue
+		}
+		path := filepath.Join(originals, filepath.FromSlash(row[1]), row[2])
+		assetPaths[row[0]] = path
+		if row[4] == "1" {
+			trashedAssets[path] = true
+			continue
+		}
+		if secs, err := strconv.ParseFloat(row[3], 64); err == nil {
+			t := coreDataEpoch.Add(time.Duration(secs * float64(time.Second))).Local()
+			dateOverrides[path] = dateInfo{Year: t.Format("2006"), Source: "Photos library", Time: t, Zoned: true}
+		}
+	}
+
+	albums := loadPhotosAlbums(db, assetPaths)
+	log.Printf("Photos database: %d assets (%d in trash, skipped), %d album memberships", len(assetPaths), len(trashedAssets), albums)
+	return nil
+}
+
+// loadPhotosAlbums reads user album memberships into sourceAlbums and returns how many it found.
+// The asset/album join table is named after Core Data entity numbers that differ between Photos
+// versions (Z_26ASSETS, Z_28ASSETS, ...), so it is looked up by its column names.
+func loadPhotosAlbums(db string, assetPaths map[string]string) int {
+	tables, err := querySQLite(db, "SELECT name FROM sqlite_master WHERE type='table' AND name LIKE 'Z\\_%ASSETS' ESCAPE '\\'")
+	if err != nil {
+		return 0
+	}
+	for _, t := range tables {
+		table := t[0]
+		cols, err := querySQLite(db, "SELECT name FROM pragma_table_info('"+table+"')")
+		if err != nil {
+			continue
+		}
+		var albumCol, assetCol string
+		for _, c := range cols {
+			switch {
+			case strings.HasSuffix(c[0], "ALBUMS"):
+				albumCol = c[0]
+			case strings.HasSuffix(c[0], "ASSETS"):
+				assetCol = c[0]
+			}
+		}
+		if albumCol == "" || assetCol == "" {
+			continue
+		}
+
+		// ZKIND 2 is a regular user album
+		rows, err := querySQLite(db, fmt.Sprintf("SELECT a.ZTITLE, j.%s FROM ZGENERICALBUM a JOIN %s j ON j.%s = a.Z_PK WHERE a.ZKIND = 2 AND a.ZTITLE IS NOT NULL AND COALESCE(a.ZTRASHEDSTATE, 0) = 0", assetCol, table, albumCol))
+		if err != nil {
+			continue
+		}
+		count := 0
+		for _, row := range rows {
+			if len(row) < 2 {
+				continue
+			}
+			if path, ok := assetPaths[row[1]]; ok {
+				sourceAlbums[path] = append(sourceAlbums[path], row[0])
+				count++
+			}
+		}
+		return count
+	}
+	return 0
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// place is a city photos can be sorted under
+type place struct {
+	name     string
+	country  string // ISO 3166 code
+	lat, lon float64
+}
+
+// maxPlaceDistance is how far (km) from a city a photo may be taken and still be filed under it
+const maxPlaceDistance = 50
+
+// builtinPlaces are the cities known without --places-file: capitals and large or much-visited
+// cities. A GeoNames dump covers every town.
+var builtinPlaces = []place{
+	{"New York", "US", 40.71, -74.01}, {"Los Angeles", "US", 34.05, -118.24}, {"Chicago", "US", 41.88, -87.63},
+	{"San Francisco", "US", 37.77, -122.42}, {"Seattle", "US", 47.61, -122.33}, {"Boston", "US", 42.36, -71.06},
+	{"Washington", "US", 38.91, -77.04}, {"Miami", "US", 25.76, -80.19}, {"Orlando", "US", 28.54, -81.38},
+	{"Las Vegas", "US", 36.17, -115.14}, {"San Diego", "US", 32.72, -117.16}, {"Denver", "US", 39.74, -104.99},
+	{"Houston", "US", 29.76, -95.37}, {"Dallas", "US", 32.78, -96.80}, {"Austin", "US", 30.27, -97.74},
+	{"Atlanta", "US", 33.75, -84.39}, {"Philadelphia", "US", 39.95, -75.17}, {"Phoenix", "US", 33.45, -112.07},
+	{"New Orleans", "US", 29.95, -90.07}, {"Nashville", "US", 36.16, -86.78}, {"Portland", "US", 45.52, -122.68},
+	{"Salt Lake City", "US", 40.76, -111.89}, {"Minneapolis", "US", 44.98, -93.27}, {"Detroit", "US", 42.33, -83.05},
+	{"Honolulu", "US", 21.31, -157.86}, {"Anchorage", "US", 61.22, -149.90},
+	{"Toronto", "CA", 43.65, -79.38}, {"Montreal", "CA", 45.50, -73.57}, {"Vancouver", "CA", 49.28, -123.12},
+	{"Calgary", "CA", 51.05, -114.07}, {"Ottawa", "CA", 45.42, -75.70}, {"Quebec City", "CA", 46.81, -71.21},
+	{"Mexico City", "MX", 19.43, -99.13}, {"Cancún", "MX", 21.16, -86.85}, {"Guadalajara", "MX", 20.67, -103.35},
+	{"Havana", "CU", 23.11, -82.37}, {"San José", "CR", 9.93, -84.08}, {"Panama City", "PA", 8.98, -79.52},
+	{"Bogotá", "CO", 4.71, -74.07}, {"Cartagena", "CO", 10.39, -75.51}, {"Lima", "PE", -12.05, -77.04},
+	{"Cusco", "PE", -13.53, -71.97}, {"Quito", "EC", -0.18, -78.47}, {"Santiago", "CL", -33.45, -70.67},
+	{"Buenos Aires", "AR", -34.60, -58.38}, {"Montevideo", "UY", -34.90, -56.16}, {"La Paz", "BO", -16.50, -68.15},
+	{"Rio de Janeiro", "BR", -22.91, -43.17}, {"São Paulo", "BR", -23.55, -46.63}, {"Brasília", "BR", -15.79, -47.88},
+	{"Salvador", "BR", -12.97, -38.50}, {"Caracas", "VE", 10.48, -66.90},
+	{"London", "GB", 51.51, -0.13}, {"Edinburgh", "GB", 55.95, -3.19}, {"Manchester", "GB", 53.48, -2.24},
+	{"Birmingham", "GB", 52.49, -1.89}, {"Liverpool", "GB", 53.41, -2.98}, {"Glasgow", "GB", 55.86, -4.25},
+	{"Bristol", "GB", 51.45, -2.59}, {"Cardiff", "GB", 51.48, -3.18}, {"Belfast", "GB", 54.60, -5.93},
+	{"Dublin", "IE", 53.35, -6.26}, {"Cork", "IE", 51.90, -8.47}, {"Reykjavík", "IS", 64.15, -21.94},
+	{"Paris", "FR", 48.86, 2.35}, {"Lyon", "FR", 45.76, 4.84}, {"Marseille", "FR", 43.30, 5.37},
+	{"Nice", "FR", 43.70, 7.27}, {"Bordeaux", "FR", 44.84, -0.58}, {"Toulouse", "FR", 43.60, 1.44},
+	{"Strasbourg", "FR", 48.57, 7.75}, {"Monaco", "MC", 43.74, 7.42},
+	{"Madrid", "ES", 40.42, -3.70}, {"Barcelona", "ES", 41.39, 2.17}, {"Seville", "ES", 37.39, -5.98},
+	{"Valencia", "ES", 39.47, -0.38}, {"Málaga", "ES", 36.72, -4.42}, {"Palma", "ES", 39.57, 2.65},
+	{"Las Palmas", "ES", 28.12, -15.44}, {"Santa Cruz de Tenerife", "ES", 28.46, -16.25}, {"Bilbao", "ES", 43.26, -2.93},
+	{"Granada", "ES", 37.18, -3.60}, {"Lisbon", "PT", 38.72, -9.14}, {"Porto", "PT", 41.15, -8.61},
+	{"Faro", "PT", 37.02, -7.93}, {"Funchal", "PT", 32.65, -16.91},
+	{"Rome", "IT", 41.90, 12.50}, {"Milan", "IT", 45.46, 9.19}, {"Venice", "IT", 45.44, 12.32},
+	{"Florence", "IT", 43.77, 11.26}, {"Naples", "IT", 40.85, 14.27}, {"Turin", "IT", 45.07, 7.69},
+	{"Bologna", "IT", 44.49, 11.34}, {"Palermo", "IT", 38.12, 13.36}, {"Catania", "IT", 37.50, 15.09},
+	{"Berlin", "DE", 52.52, 13.40}, {"Munich", "DE", 48.14, 11.58}, {"Hamburg", "DE", 53.55, 9.99},
+	{"Frankfurt", "DE", 50.11, 8.68}, {"Cologne", "DE", 50.94, 6.96}, {"Stuttgart", "DE", 48.78, 9.18},
+	{"Düsseldorf", "DE", 51.23, 6.77}, {"Dresden", "DE", 51.05, 13.74}, {"Leipzig", "DE", 51.34, 12.37},
+	{"Nuremberg", "DE", 49.45, 11.08}, {"Hanover", "DE", 52.38, 9.73}, {"Bremen", "DE", 53.08, 8.80},
+	{"Amsterdam", "NL", 52.37, 4.90}, {"Rotterdam", "NL", 51.92, 4.48}, {"The Hague", "NL", 52.08, 4.30},
+	{"Utrecht", "NL", 52.09, 5.12}, {"Brussels", "BE", 50.85, 4.35}, {"Antwerp", "BE", 51.22, 4.40},
+	{"Bruges", "BE", 51.21, 3.22}, {"Luxembourg", "LU", 49.61, 6.13},
+	{"Zurich", "CH", 47.38, 8.54}, {"Geneva", "CH", 46.20, 6.14}, {"Bern", "CH", 46.95, 7.45},
+	{"Basel", "CH", 47.56, 7.59}, {"Lucerne", "CH", 47.05, 8.31}, {"Interlaken", "CH", 46.69, 7.86},
+	{"Vienna", "AT", 48.21, 16.37}, {"Salzburg", "AT", 47.81, 13.04}, {"Innsbruck", "AT", 47.27, 11.40},
+	{"Graz", "AT", 47.07, 15.44},
+	{"Copenhagen", "DK", 55.68, 12.57}, {"Aarhus", "DK", 56.16, 10.20}, {"Oslo", "NO", 59.91, 10.75},
+	{"Bergen", "NO", 60.39, 5.32}, {"Tromsø", "NO", 69.65, 18.96}, {"Stockholm", "SE", 59.33, 18.07},
+	{"Gothenburg", "SE", 57.71, 11.97}, {"Malmö", "SE", 55.60, 13.00}, {"Helsinki", "FI", 60.17, 24.94},
+	{"Rovaniemi", "FI", 66.50, 25.73}, {"Tallinn", "EE", 59.44, 24.75}, {"Riga", "LV", 56.95, 24.11},
+	{"Vilnius", "LT", 54.69, 25.28},
+	{"Warsaw", "PL", 52.23, 21.01}, {"Kraków", "PL", 50.06, 19.94}, {"Gdańsk", "PL", 54.35, 18.65},
+	{"Wrocław", "PL", 51.11, 17.04}, {"Prague", "CZ", 50.08, 14.44}, {"Brno", "CZ", 49.20, 16.61},
+	{"Bratislava", "SK", 48.15, 17.11}, {"Budapest", "HU", 47.50, 19.04}, {"Ljubljana", "SI", 46.06, 14.51},
+	{"Zagreb", "HR", 45.81, 15.98}, {"Split", "HR", 43.51, 16.44}, {"Dubrovnik", "HR", 42.65, 18.09},
+	{"Belgrade", "RS", 44.79, 20.45}, {"Sarajevo", "BA", 43.86, 18.41}, {"Kotor", "ME", 42.42, 18.77},
+	{"Tirana", "AL", 41.33, 19.82}, {"Skopje", "MK", 42.00, 21.43}, {"Sofia", "BG", 42.70, 23.32},
+	{"Varna", "BG", 43.21, 27.91}, {"Bucharest", "RO", 44.43, 26.10}, {"Cluj-Napoca", "RO", 46.77, 23.60},
+	{"Chișinău", "MD", 47.01, 28.86}, {"Kyiv", "UA", 50.45, 30.52}, {"Lviv", "UA", 49.84, 24.03},
+	{"Odesa", "UA", 46.48, 30.72}, {"Minsk", "BY", 53.90, 27.56}, {"Moscow", "RU", 55.76, 37.62},
+	{"Saint Petersburg", "RU", 59.93, 30.34},
+	{"Athens", "GR", 37.98, 23.73}, {"Thessaloniki", "GR", 40.64, 22.94}, {"Heraklion", "GR", 35.34, 25.13},
+	{"Santorini", "GR", 36.42, 25.43}, {"Mykonos", "GR", 37.45, 25.33}, {"Rhodes", "GR", 36.43, 28.22},
+	{"Corfu", "GR", 39.62, 19.92}, {"Valletta", "MT", 35.90, 14.51}, {"Nicosia", "CY", 35.19, 33.38},
+	{"Limassol", "CY", 34.68, 33.04}, {"Istanbul", "TR", 41.01, 28.98}, {"Ankara", "TR", 39.93, 32.86},
+	{"Antalya", "TR", 36.90, 30.70}, {"İzmir", "TR", 38.42, 27.14}, {"Göreme", "TR", 38.64, 34.83},
+	{"Tbilisi", "GE", 41.72, 44.79}, {"Yerevan", "AM", 40.18, 44.51}, {"Baku", "AZ", 40.41, 49.87},
+	{"Tel Aviv", "IL", 32.09, 34.78}, {"Jerusalem", "IL", 31.77, 35.21}, {"Amman", "JO", 31.95, 35.93},
+	{"Petra", "JO", 30.33, 35.44}, {"Beirut", "LB", 33.89, 35.50}, {"Dubai", "AE", 25.20, 55.27},
+	{"Abu Dhabi", "AE", 24.45, 54.38}, {"Doha", "QA", 25.29, 51.53}, {"Muscat", "OM", 23.59, 58.41},
+	{"Riyadh", "SA", 24.71, 46.68}, {"Tehran", "IR", 35.69, 51.39},
+	{"Cairo", "EG", 30.04, 31.24}, {"Luxor", "EG", 25.69, 32.64}, {"Hurghada", "EG", 27.26, 33.81},
+	{"Sharm El Sheikh", "EG", 27.92, 34.33}, {"Marrakesh", "MA", 31.63, -7.99}, {"Casablanca", "MA", 33.57, -7.59},
+	{"Fes", "MA", 34.03, -5.00}, {"Tunis", "TN", 36.81, 10.18}, {"Cape Town", "ZA", -33.92, 18.42},
+	{"Johannesburg", "ZA", -26.20, 28.05}, {"Durban", "ZA", -29.86, 31.02}, {"Nairobi", "KE", -1.29, 36.82},
+	{"Mombasa", "KE", -4.04, 39.67}, {"Zanzibar", "TZ", -6.16, 39.19}, {"Arusha", "TZ", -3.39, 36.68},
+	{"Addis Ababa", "ET", 9.03, 38.74}, {"Kigali", "RW", -1.95, 30.06}, {"Lagos", "NG", 6.52, 3.38},
+	{"Accra", "GH", 5.60, -0.19}, {"Dakar", "SN", 14.72, -17.47}, {"Victoria Falls", "ZW", -17.93, 25.84},
+	{"Windhoek", "NA", -22.56, 17.08}, {"Port Louis", "MU", -20.16, 57.50}, {"Antananarivo", "MG", -18.88, 47.51},
+	{"Mumbai", "IN", 19.08, 72.88}, {"Delhi", "IN", 28.61, 77.21}, {"Bengaluru", "IN", 12.97, 77.59},
+	{"Chennai", "IN", 13.08, 80.27}, {"Kolkata", "IN", 22.57, 88.36}, {"Jaipur", "IN", 26.91, 75.79},
+	{"Agra", "IN", 27.18, 78.01}, {"Goa", "IN", 15.50, 73.83}, {"Hyderabad", "IN", 17.39, 78.49},
+	{"Kathmandu", "NP", 27.72, 85.32}, {"Colombo", "LK", 6.93, 79.86}, {"Malé", "MV", 4.18, 73.51},
+	{"Dhaka", "BD", 23.81, 90.41}, {"Karachi", "PK", 24.86, 67.01}, {"Lahore", "PK", 31.55, 74.34},
+	{"Bangkok", "TH", 13.76, 100.50}, {"Chiang Mai", "TH", 18.79, 98.98}, {"Phuket", "TH", 7.88, 98.39},
+	{"Krabi", "TH", 8.09, 98.91}, {"Koh Samui", "TH", 9.51, 100.01}, {"Hanoi", "VN", 21.03, 105.85},
+	{"Ho Chi Minh City", "VN", 10.82, 106.63}, {"Da Nang", "VN", 16.05, 108.22}, {"Hoi An", "VN", 15.88, 108.34},
+	{"Phnom Penh", "KH", 11.56, 104.93}, {"Siem Reap", "KH", 13.36, 103.86}, {"Vientiane", "LA", 17.98, 102.63},
+	{"Luang Prabang", "LA", 19.89, 102.13}, {"Yangon", "MM", 16.87, 96.20}, {"Kuala Lumpur", "MY", 3.14, 101.69},
+	{"Penang", "MY", 5.41, 100.33}, {"Singapore", "SG", 1.35, 103.82}, {"Jakarta", "ID", -6.21, 106.85},
+	{"Denpasar", "ID", -8.65, 115.22}, {"Ubud", "ID", -8.51, 115.26}, {"Yogyakarta", "ID", -7.80, 110.36},
+	{"Manila", "PH", 14.60, 120.98}, {"Cebu", "PH", 10.32, 123.89}, {"El Nido", "PH", 11.20, 119.42},
+	{"Beijing", "CN", 39.90, 116.41}, {"Shanghai", "CN", 31.23, 121.47}, {"Guangzhou", "CN", 23.13, 113.26},
+	{"Shenzhen", "CN", 22.54, 114.06}, {"Chengdu", "CN", 30.57, 104.07}, {"Xi'an", "CN", 34.34, 108.94},
+	{"Hangzhou", "CN", 30.27, 120.16}, {"Guilin", "CN", 25.27, 110.29}, {"Hong Kong", "HK", 22.32, 114.17},
+	{"Macau", "MO", 22.20, 113.54}, {"Taipei", "TW", 25.03, 121.57}, {"Kaohsiung", "TW", 22.63, 120.30},
+	{"Seoul", "KR", 37.57, 126.98}, {"Busan", "KR", 35.18, 129.08}, {"Jeju", "KR", 33.50, 126.53},
+	{"Tokyo", "JP", 35.68, 139.69}, {"Yokohama", "JP", 35.44, 139.64}, {"Kyoto", "JP", 35.01, 135.77},
+	{"Osaka", "JP", 34.69, 135.50}, {"Nara", "JP", 34.69, 135.80}, {"Hiroshima", "JP", 34.39, 132.46},
+	{"Sapporo", "JP", 43.06, 141.35}, {"Fukuoka", "JP", 33.59, 130.40}, {"Nagoya", "JP", 35.18, 136.91},
+	{"Naha", "JP", 26.21, 127.68}, {"Hakone", "JP", 35.23, 139.11}, {"Ulaanbaatar", "MN", 47.89, 106.91},
+	{"Almaty", "KZ", 43.24, 76.89}, {"Tashkent", "UZ", 41.30, 69.24}, {"Samarkand", "UZ", 39.65, 66.96},
+	{"Sydney", "AU", -33.87, 151.21}, {"Melbourne", "AU", -37.81, 144.96}, {"Brisbane", "AU", -27.47, 153.03},
+	{"Perth", "AU", -31.95, 115.86}, {"Adelaide", "AU", -34.93, 138.60}, {"Cairns", "AU", -16.92, 145.77},
+	{"Gold Coast", "AU", -28.02, 153.40}, {"Hobart", "AU", -42.88, 147.33}, {"Darwin", "AU", -12.46, 130.84},
+	{"Canberra", "AU", -35.28, 149.13}, {"Auckland", "NZ", -36.85, 174.76}, {"Wellington", "NZ", -41.29, 174.78},
+	{"Christchurch", "NZ", -43.53, 172.64}, {"Queenstown", "NZ", -45.03, 168.66}, {"Rotorua", "NZ", -38.14, 176.25},
+	{"Nadi", "FJ", -17.78, 177.42}, {"Papeete", "PF", -17.54, -149.57}, {"Bora Bora", "PF", -16.50, -151.74},
+}
+
+// countryNames are the folder names of the countries of builtinPlaces (and of common GeoNames codes)
+var countryNames = map[string]string{
+	"AE": "United Arab Emirates", "AL": "Albania", "AM": "Armenia", "AR": "Argentina", "AT": "Austria", "AU": "Australia",
+	"AZ": "Azerbaijan", "BA": "Bosnia and Herzegovina", "BD": "Bangladesh", "BE": "Belgium", "BG": "Bulgaria", "BO": "Bolivia",
+	"BR": "Brazil", "BY": "Belarus", "CA": "Canada", "CH": "Switzerland", "CL": "Chile", "CN": "China", "CO": "Colombia",
+	"CR": "Costa Rica", "CU": "Cuba", "CY": "Cyprus", "CZ": "Czechia", "DE": "Germany", "DK": "Denmark", "EC": "Ecuador",
+	"EE": "Estonia", "EG": "Egypt", "ES": "Spain", "ET": "Ethiopia", "FI": "Finland", "FJ": "Fiji", "FR": "France",
+	"GB": "United Kingdom", "GE": "Georgia", "GH": "Ghana", "GR": "Greece", "HK": "Hong Kong", "HR": "Croatia", "HU": "Hungary",
+	"ID": "Indonesia", "IE": "Ireland", "IL": "Israel", "IN": "India", "IR": "Iran", "IS": "Iceland", "IT": "Italy",
+	"JO": "Jordan", "JP": "Japan", "KE": "Kenya", "KH": "Cambodia", "KR": "South Korea", "KZ": "Kazakhstan", "LA": "Laos",
+	"LB": "Lebanon", "LK": "Sri Lanka", "LT": "Lithuania", "LU": "Luxembourg", "LV": "Latvia", "MA": "Morocco", "MC": "Monaco",
+	"MD": "Moldova", "ME": "Montenegro", "MG": "Madagascar", "MK": "North Macedonia", "MM": "Myanmar", "MN": "Mongolia",
+	"MO": "Macau", "MT": "Malta", "MU": "Mauritius", "MV": "Maldives", "MX": "Mexico", "MY": "Malaysia", "NA": "Namibia",
+	"NG": "Nigeria", "NL": "Netherlands", "NO": "Norway", "NP": "Nepal", "NZ": "New Zealand", "OM": "Oman", "PA": "Panama",
+	"PE": "Peru", "PF": "French Polynesia", "PH": "Philippines", "PK": "Pakistan", "PL": "Poland", "PT": "Portugal",
+	"QA": "Qatar", "RO": "Romania", "RS": "Serbia", "RU": "Russia", "RW": "Rwanda", "SA": "Saudi Arabia", "SE": "Sweden",
+	"SG": "Singapore", "SI": "Slovenia", "SK": "Slovakia", "SN": "Senegal", "TH": "Thailand", "TN": "Tunisia", "TR": "Turkey",
+	"TW": "Taiwan", "TZ": "Tanzania", "UA": "Ukraine", "US": "United States", "UY": "Uruguay", "UZ": "Uzbekistan",
+	"VE": "Venezuela", "VN": "Vietnam", "ZA": "South Africa", "ZW": "Zimbabwe",
+}
+
+// placeGrid indexes the known places by whole degrees of latitude and longitude
+var placeGrid map[[2]int][]place
+
+// loadPlaces indexes the places photos are filed under: those of a GeoNames dump (--places-file,
+// e.g. cities1000.txt), or the built-in ones
+func loadPlaces(path string) error {
+	places := builtinPlaces
+	if path != "" {
+		var err error
+		if places, err = readGeoNames(path); err != nil {
+			return err
+		}
+	}
+	placeGrid = make(map[[2]int][]place)
+	for _, p := range places {
+		cell := [2]int{int(math.Floor(p.lat)), int(math.Floor(p.lon))}
+		placeGrid[cell] = append(placeGrid[cell], p)
+	}
+	return nil
+}
+
+// readGeoNames reads the populated places of a GeoNames dump: tab-separated, with the name in
+// column 2, latitude and longitude in 5 and 6, the feature class in 7 and the country code in 9
+func readGeoNames(path string) ([]place, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var places []place
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		cols := strings.Split(scanner.Text(), "\t")
+		if len(cols) < 9 || cols[6] != "P" {
+			continue
+		}
+		lat, errLat := strconv.ParseFloat(cols[4], 64)
+		lon, errLon := strconv.ParseFloat(cols[5], 64)
+		if errLat != nil || errLon != nil {
+			continue
+		}
+		places = append(places, place{name: cols[1], country: cols[8], lat: lat, lon: lon})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(places) == 0 {
+		return nil, fmt.Errorf("no places found in '%s' (expected a GeoNames dump such as cities1000.txt)", filepath.Base(path))
+	}
+	return places, nil
+}
+
+// nearestPlace finds the known place closest to a position, within maxPlaceDistance
+func nearestPlace(lat, lon float64) (place, bool) {
+	var best place
+	bestDist := math.Inf(1)
+	cellLat, cellLon := int(math.Floor(lat)), int(math.Floor(lon))
+	for dLat := -1; dLat <= 1; dLat++ {
+		for dLon := -1; dLon <= 1; dLon++ {
+			for _, p := range placeGrid[[2]int{cellLat + dLat, cellLon + dLon}] {
+				if d := haversineKm(lat, lon, p.lat, p.lon); d < bestDist {
+					best, bestDist = p, d
+				}
+			}
+		}
+	}
+	return best, bestDist <= maxPlaceDistance
+}
+
+// haversineKm is the great-circle distance between two positions
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371
+	rad := math.Pi / 180
+	dLat, dLon := (lat2-lat1)*rad, (lon2-lon1)*rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// placeFolder is the Country/City folder of where a photo was taken, or "" when it has no GPS
+// position or was not taken near a known place
+func placeFolder(x *exif.Exif) string {
+	lat, lon, err := x.LatLong()
+	if err != nil || math.IsNaN(lat) || math.IsNaN(lon) || (lat == 0 && lon == 0) {
+		return ""
+	}
+	p, ok := nearestPlace(lat, lon)
+	if !ok {
+		return ""
+	}
+	country := countryNames[p.country]
+	if country == "" {
+		country = p.country
+	}
+	return filepath.Join(albumFolderName(country), albumFolderName(p.name))
+}
@@ -0,0 +1,690 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// planVersion is bumped whenever the plan format changes incompatibly
+const planVersion = 1
+
+// Operations a plan can contain. External tools may change an operation to opSkip (or drop it)
+// before the plan is applied.
+const (
+	opMove       = "move"              // Sort into a year or no_date folder
+	opConvert    = "convert"           // Convert HEIC/HEIF to JPEG in the destination folder
+	opDuplicate  = "duplicate"         // Exact duplicate of existing; handled per --dedup-action
+	opDelete     = "delete"            // Non-media file to delete
+	opQuarantine = "quarantine"        // Non-media file kept in the quarantine folder
+	opOther      = "other"             // Unrecognized file kept in the other_files folder
+	opSidecar    = "sidecar"           // Sidecar without its photo, kept in the sidecars folder
+	opDocument   = "document"          // Document kept in the documents folder
+	opExtract    = "extract"           // Archive; its contents are sorted by the usual rules when applied
+	opArchive    = "archive"           // Archive moved to the archives folder unextracted (--no-extract)
+	opError      = "error"             // Unreadable file, moved to the errors folder
+	opCorrupt    = "corrupt"           // Truncated or damaged image or video, moved to the corrupt folder
+	opLogicalDup = "logical_duplicate" // Same capture as a kept image (--logical-dedup), moved to review
+	opNearDup    = "near_duplicate"    // Looks identical to a kept image (--near-duplicates move), moved to review
+	opJunk       = "junk"              // System junk (.DS_Store, Thumbs.db, AppleDouble files) to delete
+	opZeroByte   = "zero_byte"         // Empty file, moved to the zero_byte folder, or deleted when it has no destination
+	opSkip       = "skip"              // Leave the file alone
+)
+
+// SortPlan is the full set of operations a sort would perform. Plan returns it and Apply performs
+// it; in between, orchestration code can filter or change its operations. Its JSON is the same plan
+// for other programs, written by the plan subcommand and read by apply.
+type SortPlan struct {
+	Version     int         `json:"version"`
+	Created     time.Time   `json:"created"`
+	Source      string      `json:"source"` // Every source is in this folder; with --files-from, the one holding all listed files
+	Destination string      `json:"destination"`
+	Ops         []PlannedOp `json:"ops"`
+}
+
+// PlannedOp is one intended operation on a source file
+type PlannedOp struct {
+	Op          string   `json:"op"`
+	Source      string   `json:"source"`
+	Size        int64    `json:"size"`
+	MediaType   string   `json:"media_type"`
+	Destination string   `json:"destination,omitempty"` // Intended path; apply resolves name conflicts that appeared since
+	Existing    string   `json:"existing,omitempty"`    // For duplicates: the copy that is kept
+	Year        string   `json:"year,omitempty"`
+	DateSource  string   `json:"date_source,omitempty"`
+	Taken       string   `json:"taken,omitempty"`         // Capture time, as in the manifest
+	Inferred    bool     `json:"inferred_date,omitempty"` // The date did not come from the file's own metadata (--write-dates)
+	Hash        string   `json:"hash,omitempty"`
+	Reason      string   `json:"reason,omitempty"`
+	Companions  []string `json:"companions,omitempty"` // Files that follow this one, renamed in lockstep (e.g. its RAW)
+	Matches     string   `json:"matches,omitempty"`    // For logical and near-duplicates: the planned destination of the kept image
+	Distance    int      `json:"distance,omitempty"`   // For near-duplicates: how far their dHashes are apart
+}
+
+// runPlan implements the plan subcommand: it takes the sort flags, decides what a sort would do
+// without touching any file, and writes the plan as JSON to stdout
+func runPlan(args []string) {
+	flag.CommandLine.Parse(args)
+	log.SetFlags(log.LstdFlags)
+	checkSortFlags()
+	handleSignals()
+
+	p, err := Plan()
+	if err != nil {
+		fatalf("Cannot plan: %v", err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(p); err != nil {
+		fatalf("Could not write plan: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, op := range p.Ops {
+		counts[op.Op]++
+	}
+	log.Printf("Planned %d operations: %d move, %d convert, %d duplicate, %d logical duplicate, %d near-duplicate, %d delete, %d quarantine, %d other, %d sidecar, %d document, %d extract, %d archive, %d error, %d corrupt, %d zero-byte, %d junk, %d skip",
+		len(p.Ops), counts[opMove], counts[opConvert], counts[opDuplicate], counts[opLogicalDup], counts[opNearDup], counts[opDelete], counts[opQuarantine], counts[opOther], counts[opSidecar], counts[opDocument], counts[opExtract], counts[opArchive], counts[opError], counts[opCorrupt], counts[opZeroByte], counts[opJunk], counts[opSkip])
+}
+
+// Plan decides what a sort of the source with the current options would do, without moving,
+// converting or deleting anything. The plan can be filtered or changed before it is passed to Apply.
+func Plan() (SortPlan, error) {
+	// Planning only reads: no hash index updates, and every file is hashed
+	savedIndex, savedPrefilter := *useHashIndex, *sizePrefilter
+	*useHashIndex, *sizePrefilter = false, false
+	defer func() { *useHashIndex, *sizePrefilter = savedIndex, savedPrefilter }()
+
+	if *photosLibrary != "" {
+		if err := openPhotosLibrary(*photosLibrary); err != nil {
+			return SortPlan{}, fmt.Errorf("cannot read Photos library: %v", err)
+		}
+	}
+	if _, err := os.Stat(sourceDir); os.IsNotExist(err) && *filesFrom == "" {
+		return SortPlan{}, fmt.Errorf("source directory '%s' not found", sourceDir)
+	}
+	// Catalogs are copied into the temp namespace before they are read
+	if *photosLibrary != "" || *lightroomCatalog != "" {
+		if err := initRunTemp(); err != nil {
+			return SortPlan{}, fmt.Errorf("failed to create temporary directory %s: %v", runTmpDir, err)
+		}
+		defer cleanupRunTemp()
+	}
+	if *photosLibrary != "" {
+		readPhotosDatabase(*photosLibrary)
+	}
+	if *lightroomCatalog != "" {
+		if err := readLightroomCatalog(*lightroomCatalog); err != nil {
+			log.Printf("⚠️  Could not read the Lightroom catalog: %v", err)
+		}
+	}
+	loadTiers()
+
+	jobs, err := scanSource()
+	if err != nil {
+		return SortPlan{}, fmt.Errorf("failed to walk source directory: %v", err)
+	}
+	if _, err := os.Stat(destDir); err == nil {
+		indexDestination()
+	}
+	groupEvents(jobs)
+	p := buildPlan(jobs)
+	if interrupted() {
+		return SortPlan{}, errors.New("planning was interrupted")
+	}
+	return p, nil
+}
+
+// planner is what buildPlan has decided so far
+type planner struct {
+	ops     []PlannedOp
+	planned map[string]string  // Folder + hash -> planned destination, for duplicates within the source
+	taken   map[string]bool    // Destinations already claimed by the plan
+	at      map[string]int     // Planned destination -> its operation, for kept images a better copy replaces
+	near    map[int]*nearEntry // Near-duplicate operations -> the kept image they match, wherever it ends up
+}
+
+// buildPlan decides what sorting jobs would do. The destination must already be indexed so
+// duplicates of library files are found; files are not moved, converted or deleted.
+func buildPlan(jobs []fileJob) SortPlan {
+	p := SortPlan{Version: planVersion, Created: time.Now(), Source: sourceDir, Destination: destDir}
+	if *filesFrom != "" {
+		p.Source = commonDir(jobPaths(jobs))
+	}
+	pl := &planner{planned: make(map[string]string), taken: make(map[string]bool), at: make(map[string]int), near: make(map[int]*nearEntry)}
+	for _, job := range jobs {
+		if interrupted() {
+			break
+		}
+		op := pl.planFile(job)
+		if op.Destination != "" {
+			pl.at[op.Destination] = len(pl.ops)
+		}
+		pl.ops = append(pl.ops, op)
+	}
+	for i, kept := range pl.near {
+		pl.ops[i].Matches = nearEntryPath(kept)
+	}
+	p.Ops = pl.ops
+	return p
+}
+
+// planFile decides a single file's operation with routeFile, as processFile does, and looks for
+// duplicates in the library and earlier in the plan
+func (pl *planner) planFile(job fileJob) PlannedOp {
+	path := job.path
+	r := routeFile(job)
+	op := PlannedOp{Op: r.op, Source: path, Size: job.size, MediaType: r.mediaType, Reason: r.reason}
+	for _, c := range job.companions {
+		op.Companions = append(op.Companions, c.path)
+	}
+	if date := r.date; date.Year != "" && date.Year != "none" && date.Year != "error" {
+		op.Year, op.DateSource, op.Taken, op.Inferred = date.Year, date.Source, takenStamp(date), date.Inferred
+	} else if r.op == opMove || r.op == opConvert {
+		op.DateSource = "none"
+	}
+
+	switch r.op {
+	case opJunk:
+		if *keepJunk {
+			op.Op, op.Reason = opSkip, "system junk (--keep-junk)"
+		}
+		return op
+	case opSkip, opExtract, opDelete:
+		return op
+	case opZeroByte, opArchive, opSidecar, opDocument, opQuarantine, opOther:
+		if r.folder != "" {
+			op.Destination = planDestination(r.folder, canonicalName(filepath.Base(path)), pl.taken)
+		}
+		return op
+	}
+
+	folder := r.folder
+	hash, err := dedupKey(path)
+	if err != nil {
+		op.Op, op.Reason = opError, fmt.Sprintf("hash calculation failed: %v", err)
+		folder = errorFolder(errHashFailed)
+	} else {
+		op.Hash = hash
+		hashMu.Lock()
+		existing, inLibrary := hashesInDestination[folder][hash]
+		hashMu.Unlock()
+		if !inLibrary {
+			existing, inLibrary = pl.planned[folder+"\x00"+hash]
+		}
+		if inLibrary {
+			if existing == "" {
+				existing = folder // Known only by hash
+			}
+			op.Op, op.Existing = opDuplicate, existing
+			op.Destination = filepath.Join(folder, sortedName(path, r.ext))
+			return op
+		}
+	}
+
+	name := sortedName(path, r.ext)
+	if op.Op == opConvert {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ".jpg"
+	}
+	var settle []func(dest string)
+	if (op.Op == opMove || op.Op == opConvert) && r.mediaType == "image" {
+		var review string
+		if review, settle = pl.planReview(&op); review != "" {
+			folder, name = review, sortedName(path, r.ext) // Moved to review unconverted
+		}
+	}
+	op.Destination = planDestination(folder, name, pl.taken)
+	for _, f := range settle {
+		f(op.Destination)
+	}
+	if op.Hash != "" && op.Op != opLogicalDup && op.Op != opNearDup {
+		pl.planned[folder+"\x00"+op.Hash] = op.Destination
+	}
+	return op
+}
+
+// planReview looks an image up among the kept ones as processFile does with --logical-dedup and
+// --near-duplicates. It returns the review folder the image goes to instead, or "", and what to do
+// once its destination is known: record it as the kept copy, and with --duplicate-policy best,
+// send the image it replaces to review.
+func (pl *planner) planReview(op *PlannedOp) (string, []func(dest string)) {
+	path := op.Source
+	var settle []func(dest string)
+	if *logicalDedup {
+		if key := logicalDuplicateKey(path); key != "" {
+			first, ok, superseded := claimLogicalKey(key, path, policyQuality(path))
+			if !ok {
+				op.Op, op.Matches = opLogicalDup, first
+				return logicalDuplicatesDir, nil
+			}
+			settle = append(settle, func(dest string) {
+				settleLogicalKey(key, path, dest)
+				pl.demote(superseded, dest, nil, 0)
+			})
+		}
+	}
+	if *nearDupMode != nearOff {
+		if h, ok := dHash(path); ok {
+			kept, match, distance, superseded := claimNearHash(h, path, policyQuality(path))
+			switch {
+			case match != nil:
+				// Reported against the kept image; in move mode, moved to review as well
+				pl.near[len(pl.ops)], op.Distance = match, distance
+				if *nearDupMode == nearMove {
+					op.Op = opNearDup
+					return nearDuplicatesDir, settle
+				}
+			case kept != nil:
+				settle = append(settle, func(dest string) {
+					settleNearEntry(kept, path, dest)
+					pl.demote(superseded, dest, kept, distance)
+				})
+			}
+		}
+	}
+	return "", settle
+}
+
+// demote sends the image planned for dest to review, as demoteKept does during a sort: a better
+// copy planned for better replaced it as the kept one (--duplicate-policy best). It is a logical
+// duplicate, or a near-duplicate of the entry that now holds the better copy.
+func (pl *planner) demote(dest, better string, near *nearEntry, distance int) {
+	i, ok := pl.at[dest]
+	if dest == "" || !ok || (pl.ops[i].Op != opMove && pl.ops[i].Op != opConvert) {
+		return
+	}
+	o := &pl.ops[i]
+	delete(pl.planned, filepath.Dir(o.Destination)+"\x00"+o.Hash)
+	delete(pl.at, dest)
+	o.Op, o.Matches, o.Distance = opLogicalDup, better, 0
+	folder := logicalDuplicatesDir
+	if near != nil {
+		o.Op, o.Distance, folder = opNearDup, distance, nearDuplicatesDir
+		pl.near[i] = near
+	}
+	o.Destination = planDestination(folder, sortedName(o.Source, mediaExt(o.Source)), pl.taken)
+	pl.at[o.Destination] = i
+}
+
+// planDestination picks the name a file would get in folder, avoiding files already there and
+// destinations claimed earlier in the plan the same way moveFile renames on conflict
+func planDestination(folder, name string, taken map[string]bool) string {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	dest := filepath.Join(folder, name)
+	for n := 1; ; n++ {
+		if _, err := os.Lstat(dest); os.IsNotExist(err) && !taken[dest] {
+			break
+		}
+		dest = filepath.Join(folder, fmt.Sprintf("%s_%d%s", stem, n, ext))
+	}
+	taken[dest] = true
+	return dest
+}
+
+// loadPlan reads a plan written by the plan subcommand ("-" reads stdin)
+func loadPlan(name string) (SortPlan, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return SortPlan{}, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var p SortPlan
+	if err := json.NewDecoder(r).Decode(&p); err != nil {
+		return SortPlan{}, fmt.Errorf("invalid plan: %v", err)
+	}
+	if err := checkPlan(p); err != nil {
+		return SortPlan{}, err
+	}
+	return p, nil
+}
+
+// checkPlan makes sure a plan is in a format this version understands and was made for this destination
+func checkPlan(p SortPlan) error {
+	if p.Version != planVersion {
+		return fmt.Errorf("plan version %d is not supported (expected %d)", p.Version, planVersion)
+	}
+	if p.Destination != destDir {
+		return fmt.Errorf("plan was made for destination '%s', not '%s'", p.Destination, destDir)
+	}
+	return nil
+}
+
+// runApply implements the apply subcommand: it performs the operations of a (possibly edited)
+// plan file, with the same manifest, reports and summary as a sort
+func runApply(args []string) {
+	flag.CommandLine.Parse(args)
+	log.SetFlags(log.LstdFlags)
+	if flag.NArg() != 1 {
+		log.Print("apply: expected one plan file (or - for stdin)")
+		os.Exit(exitFatal)
+	}
+	p, err := loadPlan(flag.Arg(0))
+	if err != nil {
+		fatalf("Cannot apply plan: %v", err)
+	}
+	checkSortFlags()
+	handleSignals()
+	log.Printf("Applying %d planned operations from '%s' to '%s'...", len(p.Ops), flag.Arg(0), destDir)
+
+	if err := Apply(p); err != nil {
+		fatalf("Cannot apply plan: %v", err)
+	}
+	finishRun()
+}
+
+// Apply performs the operations of a plan from Plan, as filtered or changed since, with the same
+// manifest, reports and counters as a sort. The run summary is left to the caller (finishRun).
+func Apply(p SortPlan) error {
+	if err := checkPlan(p); err != nil {
+		return err
+	}
+	for _, d := range []string{destDir, noDateDir, archivesDir, errorsDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %v", d, err)
+		}
+	}
+	if err := initRunTemp(); err != nil {
+		return fmt.Errorf("failed to create temporary directory %s: %v", runTmpDir, err)
+	}
+	defer cleanupRunTemp()
+	cleanupStalePartials()
+	if err := openManifest(*manifestFormat); err != nil {
+		return fmt.Errorf("failed to create manifest: %v", err)
+	}
+	defer closeManifest()
+	if err := openDuplicatesReport(); err != nil {
+		return fmt.Errorf("failed to create duplicates report: %v", err)
+	}
+	defer closeDuplicatesReport()
+	loadTiers()
+	openHashIndex()
+	defer closeHashIndex()
+	var sources []string
+	for _, op := range p.Ops {
+		sources = append(sources, op.Source)
+	}
+	if n := loadTakeoutAlbums(sources); n > 0 {
+		log.Printf("Google Takeout: %d album memberships", n)
+	}
+
+	applyPlan(p)
+	return nil
+}
+
+// applyPlan performs a plan's operations in order. A file that changed since planning is
+// reported as an error and left alone.
+func applyPlan(p SortPlan) {
+	atomic.StoreInt64(&totalFiles, int64(len(p.Ops)))
+	for _, op := range p.Ops {
+		if interrupted() {
+			break
+		}
+		trackCopies([]string{op.Source})
+		applyOp(op, p.Source)
+		atomic.AddInt64(&processedFiles, 1)
+		atomic.AddInt64(&processedBytes, op.Size-settleCopies([]string{op.Source}))
+	}
+}
+
+// applyOp performs a single planned operation. Only files under the plan's source folder and the
+// destination are touched.
+func applyOp(op PlannedOp, source string) {
+	if op.Op == opSkip {
+		counterMu.Lock()
+		skippedCount++
+		counterMu.Unlock()
+		return
+	}
+	if err := checkPlannedPaths(op, source); err != nil {
+		log.Printf("Skipping '%s': %v", op.Source, err)
+		counterMu.Lock()
+		errorCount++
+		counterMu.Unlock()
+		recordError(op.Source, "", errPlanMismatch, err.Error())
+		return
+	}
+	if err := checkPlannedSource(op); err != nil {
+		log.Printf("Skipping '%s': %v", op.Source, err)
+		counterMu.Lock()
+		errorCount++
+		counterMu.Unlock()
+		recordError(op.Source, "", errPlanMismatch, err.Error())
+		recordOp(manifestEntry{Source: op.Source, Year: op.Year, DateSource: op.DateSource, Taken: op.Taken, Action: actionFailed})
+		return
+	}
+	filename := filepath.Base(op.Source)
+
+	switch op.Op {
+	case opExtract:
+		processFile(fileJob{path: op.Source, size: op.Size})
+		return
+	case opZeroByte:
+		handleZeroByte(op.Source, op.Destination == "")
+		return
+	case opJunk:
+		handleJunk(op.Source)
+		return
+	case opDelete:
+		if !sourceRemovable(op.Source) {
+			log.Printf("Leaving '%s' in place (%v)", filename, errSourceKept)
+			return
+		}
+		if !allowDeletion(op.Source) {
+			log.Printf("Leaving '%s' in place (deletion limit reached)", filename)
+			recordOp(manifestEntry{Source: op.Source, Action: actionFailed})
+			return
+		}
+		if err := removeSource(op.Source); err != nil {
+			log.Printf("Could not delete non-media file '%s': %v", op.Source, err)
+			counterMu.Lock()
+			errorCount++
+			counterMu.Unlock()
+			recordError(op.Source, "", errDeleteFailed, fmt.Sprintf("could not delete non-media file: %v", err))
+			recordOp(manifestEntry{Source: op.Source, Action: actionFailed})
+			return
+		}
+		log.Printf("Deleted '%s' (not a recognized media file)", filename)
+		counterMu.Lock()
+		deletedNonMediaCount++
+		counterMu.Unlock()
+		recordOp(manifestEntry{Source: op.Source, Action: actionDeleted})
+		return
+	case opMove, opConvert, opDuplicate, opLogicalDup, opNearDup, opQuarantine, opOther, opSidecar, opDocument, opArchive, opError, opCorrupt:
+	default:
+		log.Printf("Skipping '%s': unknown planned operation %q", op.Source, op.Op)
+		counterMu.Lock()
+		errorCount++
+		counterMu.Unlock()
+		recordError(op.Source, "", errPlanMismatch, fmt.Sprintf("unknown planned operation %q", op.Op))
+		return
+	}
+
+	folder := filepath.Dir(op.Destination)
+	if op.Destination == "" {
+		log.Printf("Skipping '%s': no planned destination for %q", op.Source, op.Op)
+		counterMu.Lock()
+		errorCount++
+		counterMu.Unlock()
+		recordError(op.Source, "", errPlanMismatch, fmt.Sprintf("no planned destination for %q", op.Op))
+		return
+	}
+	if err := ensureDir(folder); err != nil {
+		log.Printf("Failed to create directory %s: %v", folder, err)
+		counterMu.Lock()
+		errorCount++
+		counterMu.Unlock()
+		recordError(op.Source, "", errMoveFailed, fmt.Sprintf("could not create destination folder '%s': %v", folder, err))
+		recordOp(manifestEntry{Source: op.Source, Year: op.Year, DateSource: op.DateSource, Taken: op.Taken, Action: actionFailed})
+		return
+	}
+	if op.Op == opError {
+		counterMu.Lock()
+		errorCount++ // Counted once routed, as processFile does
+		counterMu.Unlock()
+	}
+
+	taken, zoned := parseTaken(op.Taken)
+	date := dateInfo{Year: op.Year, Source: op.DateSource, Time: taken, Zoned: zoned, Inferred: op.Inferred}
+	var dest, action string
+	switch {
+	case op.Op == opDuplicate && fileExists(op.Existing):
+		log.Printf("Duplicate (planned): '%s' matches '%s'.", filename, filepath.Base(op.Existing))
+		dest, action = resolveDuplicate(op.Source, op.Existing, folder, filepath.Base(op.Destination), op.Hash)
+	case op.Op == opConvert && convertsToJPEG(mediaExt(op.Source)):
+		dest, action = convertHEIC(op.Source, folder, op.Hash)
+	default:
+		// Also duplicates whose kept copy is gone since planning: the file is sorted instead
+		dest, action = moveFile(op.Source, folder, filepath.Base(op.Destination), op.Hash, op.MediaType)
+		if action == actionMoved {
+			switch op.Op {
+			case opError:
+				action = actionError
+				recordError(op.Source, dest, filepath.Base(folder), op.Reason) // The subfolder is the reason code
+			case opCorrupt:
+				action = actionCorrupt
+				recordError(op.Source, dest, errCorrupt, op.Reason)
+				if *recoverThumbnails && op.MediaType == "image" {
+					recoverThumbnail(op.Source, dest, date)
+				}
+			case opQuarantine:
+				action = actionQuarantined
+			case opOther:
+				action = actionOtherFile
+			case opSidecar:
+				action = actionSidecar
+			case opDocument:
+				action = actionDocument
+			case opArchive:
+				action = actionArchived
+			case opLogicalDup, opNearDup:
+				action = actionReview
+			}
+		}
+	}
+	countSorted(action, folder, op.MediaType, date)
+	if op.Op != opLogicalDup && op.Matches != "" && dest != "" {
+		recordNearDuplicate(nearDuplicateItem{Source: op.Source, Destination: dest, Distance: op.Distance, kept: &nearEntry{path: op.Matches}})
+	}
+	if action == actionMoved || action == actionConverted || action == actionDuplicate {
+		recordAlbums(op.Source, dest)
+	}
+	if len(op.Companions) > 0 {
+		files := []string{op.Source} // What sidecars may describe
+		for _, c := range op.Companions {
+			if !isSidecar(c) {
+				files = append(files, c)
+			}
+		}
+		var companions []fileJob
+		for _, c := range op.Companions {
+			info, err := os.Stat(c)
+			if err != nil {
+				log.Printf("Skipping companion '%s': %v", c, err)
+				continue
+			}
+			job := fileJob{path: c, size: info.Size()}
+			if isSidecar(c) {
+				job.sidecarFor = sidecarOwner(c, files)
+			}
+			companions = append(companions, job)
+		}
+		placed := action == actionMoved || action == actionConverted || action == actionReview
+		companionDest := dest
+		if op.Op == opDuplicate && action != actionHardlinked && action != actionReflinked {
+			companionDest = "" // Sidecars of a deleted or kept duplicate stay in the source
+		}
+		keptCopy := ""
+		if op.Op == opDuplicate && action != actionFailed && fileExists(dest) {
+			keptCopy = dest
+		}
+		defer settleCompanions(op.Source, companions, companionDest, keptCopy, placed, date)
+	}
+	if (action == actionMoved || action == actionConverted) && op.Year != "" && inYearFolder(folder, op.Year) {
+		writeInferredDate(dest, date, op.Companions)
+	}
+	var note string
+	if action != actionConverted {
+		note = extensionNote(op.Source, dest)
+	}
+	recordOp(manifestEntry{Source: op.Source, Destination: dest, Year: op.Year, DateSource: op.DateSource, Taken: op.Taken, Hash: op.Hash, Action: action, Note: note})
+}
+
+// checkPlannedPaths makes sure a planned operation stays within the plan's folders: its source and
+// companions in source, its destination and the kept copy of a duplicate in the destination. An
+// edited plan cannot delete or move anything else.
+func checkPlannedPaths(op PlannedOp, source string) error {
+	if source == "" || !filepath.IsAbs(source) {
+		return fmt.Errorf("plan has no absolute source folder (%q)", source)
+	}
+	if !inFolder(op.Source, source) {
+		return fmt.Errorf("source is outside the planned source folder '%s'", source)
+	}
+	for _, c := range op.Companions {
+		if !inFolder(c, source) {
+			return fmt.Errorf("companion '%s' is outside the planned source folder '%s'", c, source)
+		}
+	}
+	if op.Destination != "" && !inFolder(op.Destination, destDir) {
+		return fmt.Errorf("planned destination '%s' is outside '%s'", op.Destination, destDir)
+	}
+	if op.Existing != "" && !inFolder(op.Existing, destDir) {
+		return fmt.Errorf("kept copy '%s' is outside '%s'", op.Existing, destDir)
+	}
+	return nil
+}
+
+// inFolder reports whether path, once cleaned, is inside dir
+func inFolder(path, dir string) bool {
+	prefix := filepath.Clean(dir)
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator) // Not for a root like / or C:\
+	}
+	return filepath.IsAbs(path) && strings.HasPrefix(filepath.Clean(path), prefix)
+}
+
+// commonDir returns the deepest folder holding all of paths
+func commonDir(paths []string) string {
+	if len(paths) == 0 {
+		return sourceDir
+	}
+	dir := filepath.Dir(paths[0])
+	for _, p := range paths[1:] {
+		for !inFolder(p, dir) && filepath.Dir(dir) != dir {
+			dir = filepath.Dir(dir)
+		}
+	}
+	return dir
+}
+
+// checkPlannedSource makes sure a planned file is still the file that was planned
+func checkPlannedSource(op PlannedOp) error {
+	info, err := os.Stat(op.Source)
+	if err != nil {
+		return fmt.Errorf("source changed since planning: %v", err)
+	}
+	if info.IsDir() {
+		return errors.New("source is a directory")
+	}
+	if info.Size() != op.Size {
+		return fmt.Errorf("source changed since planning (size %d, planned %d)", info.Size(), op.Size)
+	}
+	return nil
+}
+
+// fileExists reports whether path exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
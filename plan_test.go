@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckPlannedPaths(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "unsorted_photos")
+	saved := destDir
+	destDir = filepath.Join(root, "sorted_photos")
+	t.Cleanup(func() { destDir = saved })
+
+	tests := []struct {
+		name string
+		op   PlannedOp
+		ok   bool
+	}{
+		{"move", PlannedOp{Op: opMove, Source: filepath.Join(source, "IMG_1.jpg"), Destination: filepath.Join(destDir, "2019", "IMG_1.jpg")}, true},
+		{"delete", PlannedOp{Op: opDelete, Source: filepath.Join(source, "sub", "x.tmp")}, true},
+		{"duplicate", PlannedOp{Op: opDuplicate, Source: filepath.Join(source, "IMG_1.jpg"), Existing: filepath.Join(destDir, "2019", "IMG_1.jpg"), Destination: filepath.Join(destDir, "2019", "IMG_1.jpg")}, true},
+		{"delete outside the source", PlannedOp{Op: opDelete, Source: filepath.Join(root, "important.doc")}, false},
+		{"delete climbing out", PlannedOp{Op: opDelete, Source: filepath.Join(source, "..", "important.doc")}, false},
+		{"relative source", PlannedOp{Op: opJunk, Source: "unsorted_photos/.DS_Store"}, false},
+		{"source folder itself", PlannedOp{Op: opDelete, Source: source}, false},
+		{"companion outside the source", PlannedOp{Op: opMove, Source: filepath.Join(source, "IMG_1.jpg"), Destination: filepath.Join(destDir, "2019", "IMG_1.jpg"), Companions: []string{filepath.Join(root, "IMG_1.xmp")}}, false},
+		{"destination climbing out", PlannedOp{Op: opMove, Source: filepath.Join(source, "IMG_1.jpg"), Destination: filepath.Join(destDir, "..", "IMG_1.jpg")}, false},
+		{"kept copy outside the destination", PlannedOp{Op: opDuplicate, Source: filepath.Join(source, "IMG_1.jpg"), Existing: filepath.Join(root, "IMG_1.jpg"), Destination: filepath.Join(destDir, "2019", "IMG_1.jpg")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkPlannedPaths(tt.op, source); (err == nil) != tt.ok {
+				t.Errorf("checkPlannedPaths = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCommonDir(t *testing.T) {
+	root := t.TempDir()
+	tests := []struct {
+		paths []string
+		want  string
+	}{
+		{[]string{filepath.Join(root, "a", "IMG_1.jpg")}, filepath.Join(root, "a")},
+		{[]string{filepath.Join(root, "a", "b", "IMG_1.jpg"), filepath.Join(root, "a", "IMG_2.jpg")}, filepath.Join(root, "a")},
+		{[]string{filepath.Join(root, "ab", "IMG_1.jpg"), filepath.Join(root, "a", "IMG_2.jpg")}, root},
+	}
+	for _, tt := range tests {
+		if got := commonDir(tt.paths); got != tt.want {
+			t.Errorf("commonDir(%s) = %q, want %q", strings.Join(tt.paths, ", "), got, tt.want)
+		}
+	}
+}
+
+func TestBuildPlanNearDuplicates(t *testing.T) {
+	savedMode, savedPolicy := *nearDupMode, *duplicatePolicy
+	*nearDupMode, *duplicatePolicy = nearMove, keepBest
+	t.Cleanup(func() {
+		*nearDupMode, *duplicatePolicy = savedMode, savedPolicy
+		nearBands = [nearHashBands]map[uint8][]*nearEntry{}
+	})
+
+	// The same gradient twice; the larger copy comes second and takes over as the kept one
+	gradient := func(size int) []byte {
+		img := image.NewGray(image.Rect(0, 0, size, size))
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				img.SetGray(x, y, color.Gray{uint8(x * 255 / size)})
+			}
+		}
+		var buf bytes.Buffer
+		png.Encode(&buf, img)
+		return buf.Bytes()
+	}
+	dir := t.TempDir()
+	var jobs []fileJob
+	for _, f := range []struct {
+		name string
+		size int
+	}{{"a_small.png", 32}, {"b_large.png", 64}, {"c_small.png", 16}} {
+		data := gradient(f.size)
+		path := filepath.Join(dir, f.name)
+		os.WriteFile(path, data, 0644)
+		jobs = append(jobs, fileJob{path: path, size: int64(len(data))})
+	}
+
+	ops := buildPlan(jobs).Ops
+	kept := ops[1].Destination
+	if ops[1].Op != opMove || !strings.HasPrefix(kept, noDateDir) {
+		t.Fatalf("larger copy planned as %s to %s, want a move to no_date", ops[1].Op, kept)
+	}
+	for _, i := range []int{0, 2} {
+		if ops[i].Op != opNearDup || filepath.Dir(ops[i].Destination) != nearDuplicatesDir || ops[i].Matches != kept {
+			t.Errorf("%s planned as %s to %s matching %q, want a near-duplicate of %s", filepath.Base(ops[i].Source), ops[i].Op, ops[i].Destination, ops[i].Matches, kept)
+		}
+	}
+}
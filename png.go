@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngTextDateKeys are the text keywords holding a creation date, most reliable first: the PNG
+// specification's "Creation Time", then ImageMagick's "date:create"
+var pngTextDateKeys = []string{"Creation Time", "date:create"}
+
+// pngTimeLayouts are the forms "Creation Time" is written in; the specification suggests RFC 1123
+// but writers vary
+var pngTimeLayouts = []string{
+	time.RFC1123Z, time.RFC1123, time.RFC3339Nano, time.ANSIC,
+	"2006:01:02 15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2 Jan 2006 15:04:05 -0700", "2006-01-02",
+}
+
+// pngChunks calls fn with the type and data of each chunk of a PNG file whose type is in want,
+// until fn returns true. Image data is skipped without being read.
+func pngChunks(f *os.File, want map[string]bool, fn func(typ string, data []byte) bool) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header := make([]byte, 8)
+	if _, err := f.ReadAt(header, 0); err != nil || !bytes.Equal(header, pngSignature) {
+		return errors.New("not a PNG file")
+	}
+	// Chunks are a big-endian length, a type, the data and a CRC
+	offset := int64(8)
+	for offset+12 <= info.Size() {
+		if _, err := f.ReadAt(header, offset); err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		typ := string(header[4:8])
+		if offset+12+size > info.Size() {
+			return errors.New("truncated PNG chunk")
+		}
+		if typ == "IEND" {
+			return nil
+		}
+		if want[typ] {
+			if size > maxMetadataSize {
+				return errors.New("PNG metadata chunk unreasonably large")
+			}
+			data := make([]byte, size)
+			if _, err := f.ReadAt(data, offset+8); err != nil && err != io.EOF {
+				return err
+			}
+			if fn(typ, data) {
+				return nil
+			}
+		}
+		offset += 12 + size
+	}
+	return nil
+}
+
+// pngExif decodes the eXIf chunk of a PNG file
+func pngExif(f *os.File) (*exif.Exif, error) {
+	var data []byte
+	err := pngChunks(f, map[string]bool{"eXIf": true}, func(_ string, d []byte) bool {
+		data = d
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, errors.New("no eXIf chunk")
+	}
+	return exif.Decode(bytes.NewReader(data))
+}
+
+// pngTextDate reads a date from a PNG's text chunks: embedded XMP first, then the keywords in
+// pngTextDateKeys
+func pngTextDate(f *os.File) (dateInfo, bool) {
+	texts := make(map[string]string) // Keyword -> text, first occurrence
+	pngChunks(f, map[string]bool{"tEXt": true, "zTXt": true, "iTXt": true}, func(typ string, data []byte) bool {
+		if key, text, ok := pngText(typ, data); ok {
+			if _, seen := texts[key]; !seen {
+				texts[key] = text
+			}
+		}
+		return false
+	})
+	if xmp, ok := texts["XML:com.adobe.xmp"]; ok {
+		if d, ok := xmpDate([]byte(xmp)); ok {
+			return d, true
+		}
+	}
+	for _, key := range pngTextDateKeys {
+		value := strings.TrimSpace(texts[key])
+		if value == "" {
+			continue
+		}
+		for _, layout := range pngTimeLayouts {
+			t, err := time.Parse(layout, value)
+			if err != nil {
+				continue
+			}
+			if t.Year() <= 1900 || t.Year() > time.Now().Year()+1 {
+				break
+			}
+			return dateInfo{Year: t.Format("2006"), Source: "PNG " + key, Time: t}, true
+		}
+	}
+	return dateInfo{}, false
+}
+
+// pngText decodes a tEXt, zTXt or iTXt chunk into its keyword and text
+func pngText(typ string, data []byte) (string, string, bool) {
+	i := bytes.IndexByte(data, 0)
+	if i < 0 {
+		return "", "", false
+	}
+	key, rest := string(data[:i]), data[i+1:]
+	switch typ {
+	case "tEXt":
+		return key, string(rest), true
+	case "zTXt":
+		// Compression method, then zlib data
+		if len(rest) < 1 {
+			return "", "", false
+		}
+		text, err := inflatePNGText(rest[1:])
+		return key, text, err == nil
+	case "iTXt":
+		// Compression flag and method, language tag, translated keyword, then the (maybe zlib) text
+		if len(rest) < 2 {
+			return "", "", false
+		}
+		compressed := rest[0] == 1
+		rest = rest[2:]
+		for n := 0; n < 2; n++ {
+			j := bytes.IndexByte(rest, 0)
+			if j < 0 {
+				return "", "", false
+			}
+			rest = rest[j+1:]
+		}
+		if !compressed {
+			return key, string(rest), true
+		}
+		text, err := inflatePNGText(rest)
+		return key, text, err == nil
+	}
+	return "", "", false
+}
+
+// inflatePNGText decompresses a zlib-compressed text, up to maxMetadataSize
+func inflatePNGText(data []byte) (string, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	text, err := io.ReadAll(io.LimitReader(r, maxMetadataSize))
+	return string(text), err
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressBarWidth is the number of cells in the rendered progress bar
+const progressBarWidth = 30
+
+// scanComplete is set once the source walk has finished and the totals are final
+var scanComplete atomic.Bool
+
+// liveRedrawInterval is how often the bar is redrawn in place on a terminal
+const liveRedrawInterval = 250 * time.Millisecond
+
+// startProgressReporter shows a progress bar until the returned stop function is called. On a
+// terminal the bar is redrawn in place below the log; otherwise a line is logged every interval.
+// Progress is measured in bytes rather than files, since a handful of large videos dominate runtime
+// far more than thousands of small photos.
+func startProgressReporter(interval time.Duration) func() {
+	start := time.Now()
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	var live *liveProgress
+	if info, err := os.Stderr.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		live = &liveProgress{out: os.Stderr}
+		log.SetOutput(live)
+		interval = liveRedrawInterval
+	}
+
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var lastBytes, lastFiles int64 = -1, -1
+		for {
+			select {
+			case <-ticker.C:
+				bytesDone := atomic.LoadInt64(&processedBytes)
+				filesDone := atomic.LoadInt64(&processedFiles)
+				// Don't repeat identical lines while a single large file is stalled
+				if bytesDone == lastBytes && filesDone == lastFiles {
+					continue
+				}
+				lastBytes, lastFiles = bytesDone, filesDone
+				if live != nil {
+					live.draw(renderProgress(time.Since(start)))
+				} else {
+					log.Println(renderProgress(time.Since(start)))
+				}
+			case <-done:
+				if live != nil {
+					live.finish(renderProgress(time.Since(start)))
+					log.SetOutput(os.Stderr)
+				} else {
+					log.Println(renderProgress(time.Since(start)))
+				}
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// liveProgress keeps the progress bar on the last line of a terminal. It is the log's output while
+// the bar is shown: each log line clears the bar, and the bar is drawn again below it.
+type liveProgress struct {
+	mu  sync.Mutex
+	out io.Writer
+	bar string
+}
+
+func (l *liveProgress) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprint(l.out, "\r\x1b[K")
+	n, err := l.out.Write(p)
+	if l.bar != "" {
+		fmt.Fprint(l.out, l.bar)
+	}
+	return n, err
+}
+
+// draw replaces the bar with a new one
+func (l *liveProgress) draw(bar string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bar = bar
+	fmt.Fprint(l.out, "\r\x1b[K"+bar)
+}
+
+// finish draws the final bar and leaves it in the log
+func (l *liveProgress) finish(bar string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bar = ""
+	fmt.Fprintln(l.out, "\r\x1b[K"+bar)
+}
+
+// copyProgress holds the bytes copied so far from each source being sorted. Copies add to
+// processedBytes as they go, so the bar and ETA move during a long copy rather than jumping
+// when the file is done.
+var (
+	copyProgressMu sync.Mutex
+	copyProgress   = make(map[string]*int64)
+)
+
+// trackCopies starts counting the bytes copied from the given sources
+func trackCopies(paths []string) {
+	copyProgressMu.Lock()
+	defer copyProgressMu.Unlock()
+	for _, p := range paths {
+		copyProgress[p] = new(int64)
+	}
+}
+
+// settleCopies stops counting copies from the sources and returns how many bytes were already
+// added to processedBytes for them
+func settleCopies(paths []string) int64 {
+	copyProgressMu.Lock()
+	defer copyProgressMu.Unlock()
+	var n int64
+	for _, p := range paths {
+		if c := copyProgress[p]; c != nil {
+			n += atomic.LoadInt64(c)
+			delete(copyProgress, p)
+		}
+	}
+	return n
+}
+
+// countCopy wraps the writer a copy of src goes to, so its bytes count toward progress while it
+// runs. Copies of files that are not tracked (e.g. extracted from an archive) are not counted.
+func countCopy(src string, w io.Writer) io.Writer {
+	copyProgressMu.Lock()
+	c := copyProgress[src]
+	copyProgressMu.Unlock()
+	if c == nil {
+		return w
+	}
+	return progressWriter{w: w, n: c}
+}
+
+// progressWriter adds the bytes written to a tracked copy and to processedBytes
+type progressWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (p progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	atomic.AddInt64(p.n, int64(n))
+	atomic.AddInt64(&processedBytes, int64(n))
+	return n, err
+}
+
+// renderProgress builds a single progress line: bar, percentage, bytes, files, throughput and ETA
+func renderProgress(elapsed time.Duration) string {
+	bytesDone := atomic.LoadInt64(&processedBytes)
+	bytesTotal := atomic.LoadInt64(&totalBytes)
+	filesDone := atomic.LoadInt64(&processedFiles)
+	filesTotal := atomic.LoadInt64(&totalFiles)
+	scanned := scanComplete.Load()
+
+	// Fall back to file counts when every file is empty (nothing to measure in bytes)
+	var fraction float64
+	if bytesTotal > 0 {
+		fraction = float64(bytesDone) / float64(bytesTotal)
+	} else if filesTotal > 0 {
+		fraction = float64(filesDone) / float64(filesTotal)
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+
+	filled := int(fraction * progressBarWidth)
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", progressBarWidth-filled)
+
+	var rate float64
+	if secs := elapsed.Seconds(); secs > 0 {
+		rate = float64(bytesDone) / secs
+	}
+
+	eta := "calculating..."
+	switch {
+	case !scanned:
+		eta = "scanning..."
+	case bytesDone >= bytesTotal:
+		eta = "0s"
+	case rate > 0:
+		remaining := time.Duration(float64(bytesTotal-bytesDone) / rate * float64(time.Second))
+		eta = remaining.Round(time.Second).String()
+	}
+
+	filesLabel := fmt.Sprintf("%d/%d files", filesDone, filesTotal)
+	if !scanned {
+		filesLabel = fmt.Sprintf("%d files (scan in progress)", filesDone)
+	}
+
+	return fmt.Sprintf("Progress: [%s] %5.1f%% | %s / %s | %s | %s/s | ETA %s",
+		bar, fraction*100, formatBytes(bytesDone), formatBytes(bytesTotal), filesLabel, formatBytes(int64(rate)), eta)
+}
+
+// formatBytes renders a byte count using binary units (KB, MB, GB, ...)
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// quarantineDir keeps unrecognized files (grouped by extension) when --keep-unknown is set
+var quarantineDir = filepath.Join(destDir, "quarantine")
+
+// maxFormatSamples is how many example paths are kept per unrecognized extension
+const maxFormatSamples = 3
+
+// unknownFormatStat summarizes the unrecognized files of one extension
+type unknownFormatStat struct {
+	Ext     string   `json:"ext"`
+	Count   int      `json:"count"`
+	Bytes   int64    `json:"bytes"`
+	Samples []string `json:"samples"` // First few source paths seen
+}
+
+// unknownFormats is guarded by statsMu
+var unknownFormats = make(map[string]*unknownFormatStat)
+
+// recordUnknownFormat counts a file whose extension is not a recognized media or archive type
+func recordUnknownFormat(path string) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		ext = "(no extension)"
+	}
+	var size int64
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stat := unknownFormats[ext]
+	if stat == nil {
+		stat = &unknownFormatStat{Ext: ext}
+		unknownFormats[ext] = stat
+	}
+	stat.Count++
+	stat.Bytes += size
+	if len(stat.Samples) < maxFormatSamples {
+		stat.Samples = append(stat.Samples, path)
+	}
+}
+
+// snapshotUnknownFormats returns the unrecognized extensions ranked by file count, then total size
+func snapshotUnknownFormats() []unknownFormatStat {
+	statsMu.Lock()
+	out := make([]unknownFormatStat, 0, len(unknownFormats))
+	for _, stat := range unknownFormats {
+		s := *stat
+		s.Samples = append([]string(nil), stat.Samples...)
+		out = append(out, s)
+	}
+	statsMu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		if out[i].Bytes != out[j].Bytes {
+			return out[i].Bytes > out[j].Bytes
+		}
+		return out[i].Ext < out[j].Ext
+	})
+	return out
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// creationDateKey is the QuickTime metadata key in which iPhones (and other Apple devices) record
+// when a video was taken, in local time with its offset
+const creationDateKey = "com.apple.quicktime.creationdate"
+
+// quickTimeDateLayouts are the forms of the creation date value; Apple writes the first
+var quickTimeDateLayouts = []string{"2006-01-02T15:04:05-0700", time.RFC3339, "2006-01-02T15:04-0700"}
+
+// readMoov returns the payload of a MOV/MP4's 'moov' box, or nil when it has none. When the walk
+// over the top-level boxes cannot reach it, because an 'mdat' before it is sized 0 ("to the end of
+// the file") or wrongly, as interrupted recordings and some re-muxers leave it, the end of the file
+// is scanned for it.
+func readMoov(f *os.File) ([]byte, error) {
+	moov, err := readTopLevelBox(f, "moov")
+	if moov != nil || err != nil {
+		return moov, err
+	}
+	return scanForMoov(f)
+}
+
+// scanForMoov searches the last maxMetadataSize bytes of a file for a 'moov' box, the last one
+// first, and returns the payload of the first whose size fits in the file and that holds a movie
+// header (mvhd)
+func scanForMoov(f *os.File) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	start := max(info.Size()-maxMetadataSize, 0)
+	tail := make([]byte, info.Size()-start)
+	n, err := f.ReadAt(tail, start)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	tail = tail[:n]
+	for i := bytes.LastIndex(tail, []byte("moov")); i >= 4; i = bytes.LastIndex(tail[:i], []byte("moov")) {
+		size := int(binary.BigEndian.Uint32(tail[i-4:]))
+		if size < 8 || size > len(tail)-(i-4) {
+			continue
+		}
+		if moov := tail[i+4 : i-4+size]; isoChildBox(moov, "mvhd") != nil {
+			return moov, nil
+		}
+	}
+	return nil, nil
+}
+
+// extractQuickTimeCreationDate reads the creation date from a MOV/MP4's keys/ilst metadata. Unlike
+// mvhd, which many devices leave at zero or write in UTC, it keeps the local time and time zone.
+func extractQuickTimeCreationDate(path string) (time.Time, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+	moov, err := readMoov(f)
+	if err != nil || moov == nil {
+		return time.Time{}, false
+	}
+	value := quickTimeMetadata(moov, creationDateKey)
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range quickTimeDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			log.Printf("Extracted creation time (%s) from %s: %s", creationDateKey, filepath.Base(path), t.Format(time.RFC3339))
+			return t, true
+		}
+	}
+	log.Printf("Unreadable %s '%s' in %s", creationDateKey, value, filepath.Base(path))
+	return time.Time{}, false
+}
+
+// quickTimeMetadata returns the text value of key in a QuickTime moov's meta > keys/ilst metadata, or ""
+func quickTimeMetadata(moov []byte, key string) string {
+	meta := isoChildBox(moov, "meta")
+	if len(meta) >= 12 && string(meta[4:8]) != "hdlr" && string(meta[8:12]) == "hdlr" {
+		meta = meta[4:] // Written as an ISO full box
+	}
+	keys, ilst := isoChildBox(meta, "keys"), isoChildBox(meta, "ilst")
+	if len(keys) < 8 {
+		return ""
+	}
+
+	// keys: version/flags, entry count, then (size, namespace, name) entries numbered from 1
+	index, found := uint32(0), false
+	pos := 8
+	for n := uint32(1); pos+8 <= len(keys); n++ {
+		size := int(binary.BigEndian.Uint32(keys[pos:]))
+		if size < 8 || pos+size > len(keys) {
+			return ""
+		}
+		if string(keys[pos+8:pos+size]) == key {
+			index, found = n, true
+			break
+		}
+		pos += size
+	}
+	if !found {
+		return ""
+	}
+
+	// ilst: one box per value, typed by its key's index, holding a 'data' box (type, locale, value)
+	value := ""
+	forEachISOBox(ilst, func(typ string, payload []byte) {
+		if value != "" || binary.BigEndian.Uint32([]byte(typ)) != index {
+			return
+		}
+		if data := isoChildBox(payload, "data"); len(data) > 8 {
+			value = strings.TrimRight(string(data[8:]), "\x00 ")
+		}
+	})
+	return value
+}
+
+// extractTrackCreationTime reads the creation time of an MP4/MOV's tracks, for files whose movie
+// header (mvhd) was zeroed when they were re-muxed. It tries each track's header (tkhd), then its
+// media header (mdhd), returning the box the time came from.
+func extractTrackCreationTime(path string) (time.Time, string, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	defer f.Close()
+	moov, err := readMoov(f)
+	if err != nil || moov == nil {
+		return time.Time{}, "", false
+	}
+	var ct time.Time
+	box := ""
+	forEachISOBox(moov, func(typ string, trak []byte) {
+		if box != "" || typ != "trak" {
+			return
+		}
+		if t, ok := isoCreationTime(isoChildBox(trak, "tkhd")); ok {
+			ct, box = t, "tkhd"
+		} else if t, ok := isoCreationTime(isoChildBox(isoChildBox(trak, "mdia"), "mdhd")); ok {
+			ct, box = t, "mdhd"
+		}
+	})
+	if box == "" {
+		return time.Time{}, "", false
+	}
+	log.Printf("Extracted creation time (%s) from %s: %s", box, filepath.Base(path), ct.Format(time.RFC3339))
+	return ct, box, true
+}
+
+// isoCreationTime reads the creation time at the start of an mvhd, tkhd or mdhd box: seconds since
+// 1904 in UTC, 32-bit in version 0 and 64-bit in version 1. Zero (unset) and times before 1970
+// are rejected.
+func isoCreationTime(header []byte) (time.Time, bool) {
+	const mp4Epoch = 2082844800 // Seconds between 1904-01-01 and 1970-01-01
+	var creation uint64
+	switch {
+	case len(header) >= 12 && header[0] == 1:
+		creation = binary.BigEndian.Uint64(header[4:12])
+	case len(header) >= 8 && header[0] == 0:
+		creation = uint64(binary.BigEndian.Uint32(header[4:8]))
+	default:
+		return time.Time{}, false
+	}
+	if creation <= mp4Epoch {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(creation-mp4Epoch), 0).UTC(), true
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// testMoov is a 'moov' box whose movie header and single track header carry the given creation
+// times, as seconds since 1904 (0 for unset)
+func testMoov(mvhd, tkhd uint32) []byte {
+	header := func(created uint32) []byte {
+		return binary.BigEndian.AppendUint32(make([]byte, 4), created) // Version 0, no flags
+	}
+	return isoBox("moov", isoBox("mvhd", header(mvhd), make([]byte, 92)), isoBox("trak", isoBox("tkhd", header(tkhd), make([]byte, 76))))
+}
+
+func TestMoovAfterMdat(t *testing.T) {
+	const mp4Epoch = 2082844800
+	taken := time.Date(2019, 7, 4, 10, 0, 0, 0, time.UTC)
+	created := uint32(taken.Unix() + mp4Epoch)
+	ftyp := isoBox("ftyp", []byte("isom\x00\x00\x02\x00isomiso2mp41"))
+	media := make([]byte, 4096)
+
+	// mdat sized as running to the end of the file, with the moov written after it anyway
+	toEnd := bytes.Join([][]byte{ftyp, []byte("\x00\x00\x00\x00mdat"), media}, nil)
+	// mdat whose size is past the end of the file, as an interrupted recording leaves it
+	tooLarge := bytes.Join([][]byte{ftyp, []byte("\x7F\x00\x00\x00mdat"), media}, nil)
+	// mdat holding the bytes "moov" without a movie header
+	decoy := isoBox("mdat", media, []byte("\x00\x00\x00\x10moov\x01\x02\x03\x04\x05\x06\x07\x08"))
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	tests := []struct {
+		name       string
+		data       []byte
+		mvhd, tkhd uint32
+		want       bool
+	}{
+		{"mdat sized to the end", join(toEnd, testMoov(created, 0)), created, 0, true},
+		{"mdat sized past the end", join(tooLarge, testMoov(created, 0)), created, 0, true},
+		{"zeroed mvhd, track time", join(toEnd, testMoov(0, created)), 0, created, true},
+		{"decoy in the media data", join(ftyp, decoy, testMoov(created, 0)), created, 0, true},
+		{"decoy after a cut-off mdat", join(toEnd, testMoov(created, 0), decoy), created, 0, true},
+		{"no moov", toEnd, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestFile(t, "VID_0001.mp4", tt.data)
+			got, ok := extractMP4CreationTime(path)
+			if tt.mvhd == 0 {
+				got, _, ok = extractTrackCreationTime(path)
+			}
+			if ok != tt.want || (ok && !got.Equal(taken)) {
+				t.Errorf("creation time %v, %v; want %v, %v", got, ok, taken, tt.want)
+			}
+			// A video whose date is recovered is not set apart as corrupt either
+			if damage := videoDamage(path, ".mp4"); (damage == "") != tt.want {
+				t.Errorf("damage %q, want damaged: %v", damage, !tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// recoveredDir holds the thumbnails recovered from damaged photos (--recover-thumbnails)
+var recoveredDir = filepath.Join(destDir, "recovered")
+
+// actionRecovered marks a thumbnail saved from a damaged photo; the destination is the thumbnail
+const actionRecovered = "recovered"
+
+// embeddedThumbnail returns the EXIF thumbnail of a photo, provided it decodes as a whole JPEG.
+// The EXIF block comes before the image data, so it often survives when the image is cut short.
+func embeddedThumbnail(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	x, _, err := decodeExif(f, mediaExt(path))
+	if x == nil {
+		return nil, fmt.Errorf("no readable EXIF: %v", err)
+	}
+	offset, err := x.Get(exif.ThumbJPEGInterchangeFormat)
+	if err != nil {
+		return nil, errors.New("no EXIF thumbnail")
+	}
+	length, err := x.Get(exif.ThumbJPEGInterchangeFormatLength)
+	if err != nil {
+		return nil, errors.New("no EXIF thumbnail")
+	}
+	start, err1 := offset.Int(0)
+	size, err2 := length.Int(0)
+	if err1 != nil || err2 != nil || start < 0 || size <= 0 || start+size > len(x.Raw) {
+		return nil, errors.New("thumbnail outside the EXIF data")
+	}
+	thumb := x.Raw[start : start+size]
+	if _, err := jpeg.Decode(bytes.NewReader(thumb)); err != nil {
+		return nil, fmt.Errorf("damaged thumbnail: %v", err)
+	}
+	return thumb, nil
+}
+
+// recoverThumbnail saves the EXIF thumbnail of a damaged photo (moved from origin to location) in
+// the recovered folder as <name>_thumbnail.jpg, dated like the photo, so at least a small version
+// of it survives
+func recoverThumbnail(origin, location string, date dateInfo) {
+	filename := filepath.Base(location)
+	thumb, err := embeddedThumbnail(location)
+	if err != nil {
+		log.Printf("No thumbnail to recover from damaged '%s': %v", filename, err)
+		return
+	}
+	if err := ensureDir(recoveredDir); err != nil {
+		log.Printf("Could not recover the thumbnail of '%s': %v", filename, err)
+		return
+	}
+	name := strings.TrimSuffix(filename, filepath.Ext(filename)) + "_thumbnail.jpg"
+	dest := uniquePath(filepath.Join(recoveredDir, name))
+	if err := os.WriteFile(dest, thumb, 0644); err != nil {
+		log.Printf("Could not recover the thumbnail of '%s': %v", filename, err)
+		return
+	}
+	if !date.Time.IsZero() {
+		os.Chtimes(dest, date.Time, date.Time)
+	}
+	log.Printf("🩹 Recovered the thumbnail of damaged '%s' to '%s'", filename, dest)
+	counterMu.Lock()
+	recoveredCount++
+	counterMu.Unlock()
+	recordOp(manifestEntry{Source: origin, Destination: dest, Year: date.Year, DateSource: date.Source, Taken: takenStamp(date), Action: actionRecovered})
+}
@@ -0,0 +1,8 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+// cloneFile creates dst as a copy-on-write clone of src (clonefile; APFS)
+func cloneFile(src, dst string) error {
+	return unix.Clonefile(src, dst, 0)
+}
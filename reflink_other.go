@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package main
+
+// cloneFile is unavailable here; duplicates fall back to full copies
+func cloneFile(src, dst string) error {
+	return errReflinkUnsupported
+}
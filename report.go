@@ -0,0 +1,209 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// reportFileName is the self-contained HTML report written to the destination root after each run
+const reportFileName = "report.html"
+
+// yearStats counts the media sorted into one year folder during this run
+type yearStats struct {
+	Photos int `json:"photos"`
+	Videos int `json:"videos"`
+}
+
+var (
+	statsMu    sync.Mutex
+	yearCounts = make(map[string]*yearStats)
+)
+
+// recordYear counts a file sorted into a year folder
+func recordYear(year, mediaType string) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	ys := yearCounts[year]
+	if ys == nil {
+		ys = &yearStats{}
+		yearCounts[year] = ys
+	}
+	if mediaType == "video" {
+		ys.Videos++
+	} else {
+		ys.Photos++
+	}
+}
+
+// unrecordYear withdraws a file counted by recordYear that has since left its year folder
+func unrecordYear(year, mediaType string) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	ys := yearCounts[year]
+	if ys == nil {
+		return
+	}
+	if mediaType == "video" {
+		ys.Videos--
+	} else {
+		ys.Photos--
+	}
+}
+
+// snapshotYearCounts returns a copy of the per-year counters
+func snapshotYearCounts() map[string]yearStats {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	out := make(map[string]yearStats, len(yearCounts))
+	for y, ys := range yearCounts {
+		out[y] = *ys
+	}
+	return out
+}
+
+// reportYearRow is one bar of the per-year chart
+type reportYearRow struct {
+	Year          string
+	Photos        int
+	Videos        int
+	PhotoPercent  float64 // Bar widths relative to the busiest year
+	VideosPercent float64
+}
+
+// reportData is everything the HTML template renders
+type reportData struct {
+	Summary runSummary
+	Years   []reportYearRow
+}
+
+// writeHTMLReport renders the run summary as a self-contained HTML page for non-technical review
+func writeHTMLReport(summary runSummary) {
+	data := reportData{Summary: summary}
+
+	years := snapshotYearCounts()
+	maxCount := 0
+	for _, ys := range years {
+		if ys.Photos+ys.Videos > maxCount {
+			maxCount = ys.Photos + ys.Videos
+		}
+	}
+	for year, ys := range years {
+		row := reportYearRow{Year: year, Photos: ys.Photos, Videos: ys.Videos}
+		if maxCount > 0 {
+			row.PhotoPercent = float64(ys.Photos) / float64(maxCount) * 100
+			row.VideosPercent = float64(ys.Videos) / float64(maxCount) * 100
+		}
+		data.Years = append(data.Years, row)
+	}
+	sort.Slice(data.Years, func(i, j int) bool { return data.Years[i].Year < data.Years[j].Year })
+
+	if _, err := os.Stat(destDir); err != nil {
+		return // Nothing was sorted; writeSummaryFile already logged why
+	}
+	path := filepath.Join(destDir, reportFileName)
+	f, err := os.Create(path)
+	if err != nil {
+		log.Printf("Could not write HTML report: %v", err)
+		return
+	}
+	defer f.Close()
+	if err := reportTemplate.Execute(f, data); err != nil {
+		log.Printf("Could not write HTML report: %v", err)
+		return
+	}
+	log.Printf("HTML report written to '%s'", path)
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{"formatBytes": formatBytes}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Photo Sorter Report</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Roboto, sans-serif; margin: 2em auto; max-width: 960px; color: #222; padding: 0 1em; }
+h1 { margin-bottom: 0.2em; }
+.muted { color: #777; }
+.status { display: inline-block; padding: 0.3em 0.8em; border-radius: 1em; font-weight: bold; }
+.status.completed { background: #d8f5d8; color: #1a6b1a; }
+.status.completed_with_errors { background: #fff1c9; color: #7a5a00; }
+.status.failed { background: #fbd5d5; color: #8a1c1c; }
+.status.interrupted { background: #e3e6ee; color: #3a4766; }
+.cards { display: flex; flex-wrap: wrap; gap: 1em; margin: 1.5em 0; }
+.card { flex: 1 1 140px; background: #f5f6f8; border-radius: 8px; padding: 1em; }
+.card .n { font-size: 1.8em; font-weight: bold; }
+table { border-collapse: collapse; width: 100%; margin: 1em 0 2em; }
+th, td { text-align: left; padding: 0.4em 0.6em; border-bottom: 1px solid #e3e3e3; vertical-align: top; }
+td.bar { width: 70%; }
+.bar span { display: inline-block; height: 1em; }
+.photos { background: #4a90d9; }
+.videos { background: #e38d3c; }
+code { font-size: 0.9em; word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>📷 Photo Sorter Report</h1>
+<p class="muted">Run {{.Summary.RunID}} · finished {{.Summary.FinishedAt.Format "2 Jan 2006 15:04"}} · took {{printf "%.0f" .Summary.DurationSeconds}}s</p>
+<p><span class="status {{.Summary.Status}}">{{.Summary.Status}}</span>{{if .Summary.Error}} {{.Summary.Error}}{{end}}</p>
+{{if eq .Summary.Status "interrupted"}}<p><strong>⏸️ This run was interrupted; the numbers below are partial. Run again with <code>--resume</code> to continue.</strong></p>{{end}}
+{{if .Summary.Counts.DeletionsBlocked}}<p><strong>🛡️ The deletion limit was reached: {{.Summary.Counts.DeletionsBlocked}} further deletions were skipped (files were quarantined or left in place).</strong></p>{{end}}
+{{if not .Summary.ContentDedupe}}<p><strong>⚠️ Content-level duplicate detection was off for this run.</strong></p>{{end}}
+
+<div class="cards">
+<div class="card"><div class="n">{{.Summary.Counts.PhotosSorted}}</div>photos sorted</div>
+<div class="card"><div class="n">{{.Summary.Counts.VideosSorted}}</div>videos sorted</div>
+<div class="card"><div class="n">{{.Summary.Counts.NoDate}}</div>without a date</div>
+<div class="card"><div class="n">{{.Summary.Counts.DuplicatesDeleted}}</div>duplicates removed</div>
+<div class="card"><div class="n">{{.Summary.Counts.Errors}}</div>errors</div>
+</div>
+
+<h2>Photos &amp; videos per year</h2>
+{{if .Years}}
+<table>
+<tr><th>Year</th><th>Photos</th><th>Videos</th><th></th></tr>
+{{range .Years}}<tr><td>{{.Year}}</td><td>{{.Photos}}</td><td>{{.Videos}}</td><td class="bar"><span class="photos" style="width: {{printf "%.1f" .PhotoPercent}}%"></span><span class="videos" style="width: {{printf "%.1f" .VideosPercent}}%"></span></td></tr>
+{{end}}</table>
+{{else}}<p class="muted">No files were sorted into year folders in this run.</p>{{end}}
+
+<h2>Errors triage</h2>
+{{if .Summary.Errors}}
+<table>
+<tr><th>Original location</th><th>Now</th><th>Code</th><th>Reason</th></tr>
+{{range .Summary.Errors}}<tr><td><code>{{.Origin}}</code></td><td>{{if .Location}}<code>{{.Location}}</code>{{else}}left in place{{end}}</td><td><code>{{.Code}}</code></td><td>{{.Reason}}</td></tr>
+{{end}}</table>
+{{else}}<p class="muted">No errors 🎉</p>{{end}}
+
+<h2>Dates to double-check</h2>
+{{if .Summary.DateReview}}
+<p class="muted">These files were sorted by their metadata date, but the date looks unusual (e.g. a camera clock that was reset).</p>
+<table>
+<tr><th>File</th><th>Date</th><th>Why</th></tr>
+{{range .Summary.DateReview}}<tr><td><code>{{.Destination}}</code></td><td>{{.Date}} <span class="muted">({{.DateSource}})</span></td><td>{{.Reason}}</td></tr>
+{{end}}</table>
+{{else}}<p class="muted">No suspicious dates.</p>{{end}}
+
+{{if .Summary.NearDuplicates}}
+<h2>Near-duplicates</h2>
+<p class="muted">These photos look the same as one that was kept, but their bytes differ (re-encoded, resized or stripped copies).</p>
+<table>
+<tr><th>File</th><th>Looks identical to</th><th>Distance</th></tr>
+{{range .Summary.NearDuplicates}}<tr><td><code>{{.Destination}}</code></td><td><code>{{.Matches}}</code></td><td>{{.Distance}}</td></tr>
+{{end}}</table>
+{{end}}
+
+<h2>Unrecognized formats</h2>
+{{if .Summary.UnknownFormats}}
+<p class="muted">{{if .Summary.KeptUnknown}}Kept in the other_files or quarantine folder, unless their extension is on the deletion list{{else}}Deleted{{end}}. Ranked by number of files; consider adding the common ones to the supported formats.</p>
+<table>
+<tr><th>Extension</th><th>Files</th><th>Size</th><th>Examples</th></tr>
+{{range .Summary.UnknownFormats}}<tr><td>{{.Ext}}</td><td>{{.Count}}</td><td>{{formatBytes .Bytes}}</td><td>{{range .Samples}}<code>{{.}}</code><br>{{end}}</td></tr>
+{{end}}</table>
+{{else}}<p class="muted">Every file was a recognized photo, video or archive.</p>{{end}}
+
+<p class="muted">Source: <code>{{.Summary.Source}}</code><br>Library: <code>{{.Summary.Destination}}</code></p>
+</body>
+</html>
+`))
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	resumeCheckpointEvery = 64 << 20 // Persist the copy offset after every 64MB
+	resumeMaxAttempts     = 5        // Attempts per copy before giving up
+	resumeRetryDelay      = 2 * time.Second
+)
+
+// partialDir holds in-progress resumable copies. Unlike the per-run temp namespace it survives
+// between runs, so a copy interrupted by a crash continues on the next run.
+var partialDir = filepath.Join(stateDir, "partial")
+
+// resumeState is persisted next to a .part file and describes how far the copy got
+type resumeState struct {
+	Source     string    `json:"source"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+	Offset     int64     `json:"offset"`      // Bytes safely written to the .part file
+	PrefixHash string    `json:"prefix_hash"` // SHA256 of the first Offset bytes of the .part file
+}
+
+// resumablePaths returns the .part and state file paths for a source, keyed on its path, size and mtime
+func resumablePaths(src string, info os.FileInfo) (string, string) {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d", src, info.Size(), info.ModTime().UnixNano())))
+	key := hex.EncodeToString(sum[:8])
+	return filepath.Join(partialDir, key+".part"), filepath.Join(partialDir, key+".json")
+}
+
+// copyFileResumable copies src to dst through a .part file, checkpointing the offset as it goes.
+// Transient errors retry from the last checkpoint instead of restarting, and a .part left by an
+// interrupted run is picked up again once its prefix hash has been verified.
+func copyFileResumable(src, dst string, info os.FileInfo) error {
+	if err := os.MkdirAll(partialDir, 0755); err != nil {
+		return err
+	}
+	partPath, statePath := resumablePaths(src, info)
+
+	var lastErr error
+	for attempt := 1; attempt <= resumeMaxAttempts; attempt++ {
+		err := resumeCopyAttempt(src, partPath, statePath, info)
+		if err == nil {
+			os.Chtimes(partPath, info.ModTime(), info.ModTime())
+			if err := os.Rename(partPath, dst); err != nil {
+				return err
+			}
+			os.Remove(statePath)
+			return nil
+		}
+		lastErr = err
+		log.Printf("Copy of '%s' interrupted (attempt %d/%d): %v", filepath.Base(src), attempt, resumeMaxAttempts, err)
+		if attempt < resumeMaxAttempts {
+			time.Sleep(resumeRetryDelay * time.Duration(attempt))
+		}
+	}
+	// The .part file and state are kept so a later run can resume
+	return fmt.Errorf("giving up after %d attempts: %w", resumeMaxAttempts, lastErr)
+}
+
+// resumeCopyAttempt continues (or starts) a single copy attempt from the last verified checkpoint
+func resumeCopyAttempt(src, partPath, statePath string, info os.FileInfo) error {
+	state := resumeState{Source: src, Size: info.Size(), ModTime: info.ModTime()}
+	hasher := sha256.New()
+
+	part, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer part.Close()
+
+	if offset, ok := verifyResumeState(part, statePath, state, hasher); ok {
+		state.Offset = offset
+		if offset > 0 {
+			log.Printf("Resuming copy of '%s' at %s of %s", filepath.Base(src), formatBytes(offset), formatBytes(info.Size()))
+		}
+	} else {
+		hasher.Reset()
+	}
+	// Discard anything written after the last checkpoint
+	if err := part.Truncate(state.Offset); err != nil {
+		return err
+	}
+	if _, err := part.Seek(state.Offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if _, err := in.Seek(state.Offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1<<20)
+	for state.Offset < state.Size {
+		chunk := state.Size - state.Offset
+		if chunk > resumeCheckpointEvery {
+			chunk = resumeCheckpointEvery
+		}
+		n, err := io.CopyBuffer(countCopy(src, io.MultiWriter(part, hasher)), io.LimitReader(in, chunk), buf)
+		if err != nil {
+			return err
+		}
+		if n < chunk {
+			return io.ErrUnexpectedEOF // Source shrank or the read was cut short
+		}
+		if err := part.Sync(); err != nil {
+			return err
+		}
+		state.Offset += n
+		state.PrefixHash = hex.EncodeToString(hasher.Sum(nil))
+		if err := writeResumeState(statePath, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyResumeState checks that a saved checkpoint belongs to the same source and that the .part
+// file's prefix still hashes to the recorded value. On success the hasher holds the prefix state.
+func verifyResumeState(part *os.File, statePath string, want resumeState, hasher hash.Hash) (int64, bool) {
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return 0, false
+	}
+	var saved resumeState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return 0, false
+	}
+	if saved.Source != want.Source || saved.Size != want.Size || !saved.ModTime.Equal(want.ModTime) || saved.Offset <= 0 {
+		return 0, false
+	}
+	if _, err := part.Seek(0, io.SeekStart); err != nil {
+		return 0, false
+	}
+	if n, err := io.Copy(hasher, io.LimitReader(part, saved.Offset)); err != nil || n != saved.Offset {
+		return 0, false
+	}
+	if hex.EncodeToString(hasher.Sum(nil)) != saved.PrefixHash {
+		log.Printf("Partial copy of '%s' failed verification, restarting from the beginning", filepath.Base(want.Source))
+		return 0, false
+	}
+	return saved.Offset, true
+}
+
+// writeResumeState atomically replaces the checkpoint file
+func writeResumeState(path string, state resumeState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// cleanupStalePartials removes resumable copies whose source has since changed or disappeared
+func cleanupStalePartials() {
+	entries, err := os.ReadDir(partialDir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		statePath := filepath.Join(partialDir, e.Name())
+		data, err := os.ReadFile(statePath)
+		var state resumeState
+		if err == nil {
+			err = json.Unmarshal(data, &state)
+		}
+		if err == nil {
+			info, statErr := os.Stat(state.Source)
+			if statErr == nil && info.Size() == state.Size && info.ModTime().Equal(state.ModTime) {
+				continue // Still resumable
+			}
+			if statErr != nil && !errors.Is(statErr, os.ErrNotExist) {
+				continue // Source temporarily unreachable (e.g. network share); keep it
+			}
+		}
+		os.Remove(strings.TrimSuffix(statePath, ".json") + ".part")
+		os.Remove(statePath)
+		log.Printf("Removed stale partial copy state: %s", e.Name())
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import "path/filepath"
+
+// fileRoute is what is to be done with a file, as far as that can be decided before it is hashed.
+// processFile carries it out, and planFile records it in a plan, so a plan shows what a sort does.
+type fileRoute struct {
+	op        string // A plan operation: opMove or opConvert for media headed for a folder
+	ext       string // The extension the file is handled by (mediaExt)
+	mediaType string
+	folder    string // Destination folder; "" for skip, junk, zero_byte, extract and delete
+	date      dateInfo
+	external  bool   // The date came from a catalog or a sidecar rather than the file's metadata
+	reason    string // Why the file is left alone, or sent to the errors folder
+	errCode   string // For opError and opCorrupt: the errors subfolder
+}
+
+// routeFile decides where a file goes: by its kind, then, for media, by its date and whether it is
+// readable. Runtime conditions (the deletion limit, a read-only source, duplicates) are left to
+// the caller.
+func routeFile(job fileJob) fileRoute {
+	path := job.path
+	r := fileRoute{ext: mediaExt(path)} // By content where the extension is wrong or missing
+	ext := r.ext
+
+	// With --since or --until, files without a date of their own are never touched
+	if dateRangeSet() && !imageExts[ext] && !videoExts[ext] && !(*audioFiles && audioExts[ext]) {
+		r.op, r.reason = opSkip, noDateToFilter
+		return r
+	}
+	// System junk is deleted on its own terms, before an AppleDouble ._IMG_1.jpg passes for a photo
+	if isJunk(path) {
+		r.op, r.mediaType = opJunk, "junk"
+		return r
+	}
+	// Empty files are set apart before they are hashed: they would all be duplicates of each other
+	if isZeroByte(path, ext) {
+		if dateRangeSet() {
+			r.op, r.reason = opSkip, noDateToFilter
+			return r
+		}
+		r.op, r.reason = opZeroByte, "zero-byte file"
+		if !*deleteZeroByte {
+			r.folder = zeroByteDir
+		}
+		return r
+	}
+
+	switch {
+	case imageExts[ext]:
+		r.mediaType = "image"
+	case videoExts[ext]:
+		r.mediaType = "video"
+	case *audioFiles && audioExts[ext]:
+		r.mediaType = "audio"
+	case archiveExts[ext] && *noExtract:
+		// Kept as they are: deliberate backups the user does not want unpacked (and deleted)
+		r.op, r.mediaType, r.folder = opArchive, "archive", archivesDir
+		return r
+	case archiveExts[ext]:
+		r.op, r.mediaType = opExtract, "archive"
+		return r
+	case isSidecar(path):
+		// Sidecars normally travel with their photo; this one's photo was not in the source
+		r.op, r.mediaType, r.folder = opSidecar, "sidecar", sidecarsDir
+		return r
+	case documentExts[ext]:
+		// Scanned receipts and letters are kept, not deleted as non-media
+		r.op, r.mediaType = opDocument, "document"
+		r.folder, r.date = documentFolder(path)
+		return r
+	default:
+		// Only junk extensions are deleted (any unknown file with --aggressive-delete); the rest is
+		// kept in other_files, or in quarantine with --keep-unknown
+		r.mediaType = "other"
+		switch {
+		case *keepUnknown:
+			r.op, r.folder = opQuarantine, filepath.Join(quarantineDir, getFileExtensionCategory(path))
+		case deletesUnknown(path):
+			r.op = opDelete
+		default:
+			r.op, r.folder = opOther, otherFilesDir
+		}
+		return r
+	}
+
+	// Date Taken or Media Created metadata first, then sidecars, catalogs and names (--date-sources)
+	r.date, r.external = fileDate(job, r.mediaType)
+	if reason := outOfDateRange(r.date); reason != "" {
+		r.op, r.reason = opSkip, reason
+		return r
+	}
+
+	// Damaged images and cut-short videos are set apart before they can be hidden in a year folder
+	damage := mediaDamage(path, ext, r.mediaType)
+	dated := r.date.Year != "" && r.date.Year != "none"
+	r.op = opMove
+	switch {
+	case r.date.Year == "error":
+		r.op, r.errCode, r.reason = opError, errExifRead, "metadata read failed (file not found while reading date)"
+		r.folder = errorFolder(r.errCode)
+		return r
+	case damage != "":
+		r.op, r.errCode, r.reason = opCorrupt, errCorrupt, "corrupt "+r.mediaType+": "+damage
+		r.folder = corruptDir
+		return r
+	case r.mediaType == "audio":
+		r.folder = audioFolder(r.date)
+	case *screenshots && r.mediaType == "image" && isScreenshot(path):
+		r.folder = screenshotFolder(r.date)
+	case dated:
+		r.folder = yearFolder(path, r.date)
+	default:
+		// No metadata found - sort by file extension (ignoring file system dates)
+		r.folder = filepath.Join(noDateDir, getFileExtensionCategory(sortedName(path, ext)))
+	}
+	if !dated {
+		r.date.Source = "none"
+	}
+	if r.mediaType == "image" && convertsToJPEG(ext) {
+		r.op = opConvert
+	}
+	return r
+}
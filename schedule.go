@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Values accepted by --schedule
+const (
+	scheduleWalk       = "walk"         // Directory walk order
+	scheduleSmallFirst = "small-first"  // Smallest files first, so most photos are sorted early
+	scheduleSizeClass  = "size-classes" // Round-robin across size classes, so large videos progress alongside photos
+)
+
+// sizeClassLimits are the upper bounds of the size classes used by round-robin scheduling
+var sizeClassLimits = []int64{10 << 20, 100 << 20, 1 << 30}
+
+// scheduleJobs reorders the scanned files according to the scheduling policy
+func scheduleJobs(jobs []fileJob, policy string) ([]fileJob, error) {
+	switch policy {
+	case scheduleWalk:
+		return jobs, nil
+	case scheduleSmallFirst:
+		sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].size < jobs[j].size })
+		return jobs, nil
+	case scheduleSizeClass:
+		return interleaveSizeClasses(jobs), nil
+	}
+	return nil, fmt.Errorf("unknown schedule %q (expected %s, %s or %s)", policy, scheduleWalk, scheduleSmallFirst, scheduleSizeClass)
+}
+
+// interleaveSizeClasses buckets files by size class (keeping walk order within a class) and takes
+// one file from each class in turn
+func interleaveSizeClasses(jobs []fileJob) []fileJob {
+	classes := make([][]fileJob, len(sizeClassLimits)+1)
+	for _, job := range jobs {
+		c := sort.Search(len(sizeClassLimits), func(i int) bool { return job.size < sizeClassLimits[i] })
+		classes[c] = append(classes[c], job)
+	}
+
+	out := make([]fileJob, 0, len(jobs))
+	for len(out) < len(jobs) {
+		for c := range classes {
+			if len(classes[c]) > 0 {
+				out = append(out, classes[c][0])
+				classes[c] = classes[c][1:]
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// screenshotsDir holds screenshots by year, apart from the photos (--screenshots)
+var screenshotsDir = filepath.Join(destDir, "screenshots")
+
+// screenshotName matches the names phones and desktops give screenshots: Screenshot_20220310-101010.png
+// (Android), Screen Shot 2019-01-01 at 10.10.10.png (macOS), Screenshot (12).png (Windows), and
+// their translations
+var screenshotName = regexp.MustCompile(`(?i)^(screenshot|screen[ _-]?shot|bildschirmfoto|capture d.écran|captura de pantalla|schermata|スクリーンショット)`)
+
+// screenResolutions are the sizes of common phone, tablet and computer screens, portrait; a PNG
+// of one of these sizes without a camera is taken to be a screenshot
+var screenResolutions = map[[2]int]bool{
+	// iPhone
+	{640, 1136}: true, {750, 1334}: true, {1242, 2208}: true, {1125, 2436}: true, {828, 1792}: true,
+	{1242, 2688}: true, {1080, 2340}: true, {1170, 2532}: true, {1284, 2778}: true, {1179, 2556}: true,
+	{1290, 2796}: true, {1206, 2622}: true, {1320, 2868}: true,
+	// Android
+	{720, 1280}: true, {720, 1600}: true, {1080, 1920}: true, {1080, 2160}: true, {1080, 2280}: true,
+	{1080, 2400}: true, {1080, 2408}: true, {1440, 2560}: true, {1440, 2960}: true, {1440, 3040}: true,
+	{1440, 3120}: true, {1440, 3200}: true,
+	// iPad
+	{768, 1024}: true, {1536, 2048}: true, {1620, 2160}: true, {1640, 2360}: true, {1668, 2224}: true,
+	{1668, 2388}: true, {2048, 2732}: true,
+	// Computers
+	{768, 1366}: true, {800, 1280}: true, {900, 1440}: true, {1050, 1680}: true, {1080, 1920}: true,
+	{1200, 1920}: true, {1440, 2560}: true, {1600, 2560}: true, {1800, 2880}: true, {1964, 3024}: true,
+	{2234, 3456}: true, {2160, 3840}: true,
+}
+
+// isScreenshot reports whether an image is a screenshot: named like one, marked as one by iOS
+// (EXIF UserComment "Screenshot"), or a PNG at a screen's resolution with no camera in its EXIF
+func isScreenshot(path string) bool {
+	if screenshotName.MatchString(filepath.Base(path)) {
+		return true
+	}
+	ext := mediaExt(path)
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	if x, _, err := decodeExif(f, ext); err == nil {
+		// UserComment is undefined-typed: a character code, then the text
+		if tag, err := x.Get(exif.UserComment); err == nil && strings.Contains(string(tag.Val), "Screenshot") {
+			return true
+		}
+		if exifString(x, exif.Make) != "" || exifString(x, exif.Model) != "" {
+			return false
+		}
+	}
+	if ext != ".png" {
+		return false
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return false
+	}
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil || format != "png" {
+		return false
+	}
+	w, h := cfg.Width, cfg.Height
+	if w > h {
+		w, h = h, w
+	}
+	return screenResolutions[[2]int{w, h}]
+}
+
+// screenshotFolder is the folder a screenshot goes to: screenshots/<year>, or screenshots/no_date
+func screenshotFolder(date dateInfo) string {
+	if date.Year == "" || date.Year == "none" {
+		return filepath.Join(screenshotsDir, "no_date")
+	}
+	return filepath.Join(screenshotsDir, date.Year)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// errInterrupted stops directory walks once a shutdown has been requested
+var errInterrupted = errors.New("interrupted by signal")
+
+// leftForResume holds source files a worker stopped on part-way (e.g. an archive whose entries were
+// not all processed); they are not journaled as processed, so --resume handles them again
+var leftForResume sync.Map
+
+// shutdownRequested is set by the first SIGINT/SIGTERM. The scanner stops feeding new files,
+// workers finish the file they are on and drop anything still queued.
+var shutdownRequested atomic.Bool
+
+// handleSignals traps SIGINT/SIGTERM for a graceful shutdown. A second signal exits immediately;
+// the journals are flushed on every write, so even then the run can be resumed.
+func handleSignals() {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		log.Printf("🛑 Received %v: finishing files in progress, then stopping (press Ctrl-C again to force quit)", sig)
+		shutdownRequested.Store(true)
+
+		<-sigs
+		log.Println("🛑 Forced exit. Run again with --resume to continue where this run stopped.")
+		os.Exit(exitFatal)
+	}()
+}
+
+// interrupted reports whether a graceful shutdown is in progress
+func interrupted() bool {
+	return shutdownRequested.Load()
+}
+
+// leaveForResume marks a source file as unfinished because of the shutdown
+func leaveForResume(path string) {
+	leftForResume.Store(path, true)
+}
+
+// isLeftForResume reports whether a source file was left unfinished by the shutdown
+func isLeftForResume(path string) bool {
+	_, ok := leftForResume.Load(path)
+	return ok
+}
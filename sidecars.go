@@ -0,0 +1,120 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sidecarExts are files that belong to a photo or video rather than being media of their own: XMP
+// edits (Lightroom, darktable and others), Apple's AAE adjustments, video thumbnails (.thm) and DJI
+// telemetry (.srt). Google Takeout's per-file JSON metadata is recognised by name (see takeoutMediaName).
+var sidecarExts = map[string]bool{".xmp": true, ".aae": true, ".thm": true, ".srt": true}
+
+// sidecarsDir keeps sidecars whose photo was not in the source, in case it turns up later
+var sidecarsDir = filepath.Join(destDir, "sidecars")
+
+// actionSidecar marks a sidecar kept in the sidecars folder because its photo was not found
+const actionSidecar = "sidecar"
+
+// xmpSidecarDate reads the capture date from an XMP sidecar
+func xmpSidecarDate(path string) (dateInfo, bool) {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > maxMetadataSize {
+		return dateInfo{}, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return dateInfo{}, false
+	}
+	d, ok := xmpDate(data)
+	d.Source = "sidecar " + d.Source
+	return d, ok
+}
+
+// isSidecar reports whether path is a sidecar
+func isSidecar(path string) bool {
+	if _, ok := takeoutMediaName(path); ok {
+		return true
+	}
+	return sidecarExts[strings.ToLower(filepath.Ext(path))]
+}
+
+// sidecarTarget is the file name a sidecar is named after: IMG_1 for IMG_1.xmp, IMG_1.CR2 for
+// IMG_1.CR2.xmp, IMG_1234 for IMG_O1234.AAE, IMG_1(1).jpg for IMG_1.jpg(1).json
+func sidecarTarget(path string) string {
+	if name, ok := takeoutMediaName(path); ok {
+		return name
+	}
+	name := filepath.Base(path)
+	return appleVariantBase(strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+// sidecarDate reads a date for a file that has none of its own from its sidecars: a video's
+// thumbnail or DJI telemetry, Google Takeout metadata, or exported XMP (e.g. Photos' "Export IPTC as XMP")
+func sidecarDate(job fileJob) (dateInfo, bool) {
+	for _, c := range job.companions {
+		if c.sidecarFor != job.path {
+			continue
+		}
+		var d dateInfo
+		ok := false
+		if thumbnailExts[strings.ToLower(filepath.Ext(c.path))] {
+			d = getExifDate(c.path)
+			d.Source = "thumbnail " + d.Source
+			ok = d.Year != "" && d.Year != "none" && d.Year != "error"
+		} else if telemetryExts[strings.ToLower(filepath.Ext(c.path))] {
+			d, ok = telemetryDate(c.path)
+		} else if _, takeout := takeoutMediaName(c.path); takeout {
+			d, ok = takeoutDate(c.path)
+		} else if strings.EqualFold(filepath.Ext(c.path), ".xmp") {
+			d, ok = xmpSidecarDate(c.path)
+		}
+		if ok {
+			log.Printf("Using the date from sidecar '%s' for '%s': %s", filepath.Base(c.path), filepath.Base(job.path), d.Year)
+			return d, true
+		}
+	}
+	return dateInfo{}, false
+}
+
+// sidecarOwner picks which of files (same folder and basename) a sidecar describes: the file it is
+// named after in full (darktable), else a video for a thumbnail or telemetry, else a RAW (Lightroom writes
+// sidecars for RAWs), else the first
+func sidecarOwner(sidecar string, files []string) string {
+	full := sidecarTarget(sidecar)
+	for _, f := range files {
+		if strings.EqualFold(filepath.Base(f), full) {
+			return f
+		}
+	}
+	// A sidecar of one version (IMG_E1234.xmp) is not one of another (IMG_1234.HEIC)
+	stem := strings.TrimSuffix(filepath.Base(sidecar), filepath.Ext(sidecar))
+	var sameStem []string
+	for _, f := range files {
+		if strings.EqualFold(strings.TrimSuffix(filepath.Base(f), filepath.Ext(f)), stem) {
+			sameStem = append(sameStem, f)
+		}
+	}
+	if len(sameStem) > 0 {
+		files = sameStem
+	}
+	if ext := strings.ToLower(filepath.Ext(sidecar)); thumbnailExts[ext] || telemetryExts[ext] {
+		for _, f := range files {
+			if videoExts[strings.ToLower(filepath.Ext(f))] {
+				return f
+			}
+		}
+		return "" // A thumbnail or telemetry of a photo is of no use
+	}
+	for _, f := range files {
+		if rawExts[strings.ToLower(filepath.Ext(f))] {
+			return f
+		}
+	}
+	if len(files) > 0 {
+		return files[0]
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// With --size-prefilter a file is only hashed when something of the same size could be its
+// duplicate: another source file, or a file in (or already sorted into) its target folder. Library
+// files are hashed lazily, the first time a file of their size heads for their folder.
+var (
+	sourceSizeCounts = make(map[int64]int) // Size -> number of scanned source files; read-only once processing starts
+
+	sizeMu        sync.Mutex
+	sizesInFolder = make(map[string]map[int64]bool)     // Sizes of every file known to be in each folder
+	pendingHashes = make(map[string]map[int64][]string) // Folder -> size -> library files not hashed yet
+)
+
+// prefilterEnabled reports whether hashing is skipped for unique sizes
+func prefilterEnabled() bool {
+	return *sizePrefilter && !*noHash
+}
+
+// countSourceSizes records the sizes of all scanned source files
+func countSourceSizes(jobs []fileJob) {
+	for _, job := range jobs {
+		sourceSizeCounts[job.size]++
+		for _, c := range job.companions {
+			sourceSizeCounts[c.size]++
+		}
+	}
+}
+
+// noteFolderFile records a file of the given size in a folder; unhashed files are queued so they
+// can be hashed if a file of the same size ever targets that folder
+func noteFolderFile(folder, path string, size int64, hashed bool) {
+	sizeMu.Lock()
+	defer sizeMu.Unlock()
+	if sizesInFolder[folder] == nil {
+		sizesInFolder[folder] = make(map[int64]bool)
+	}
+	sizesInFolder[folder][size] = true
+	if !hashed {
+		if pendingHashes[folder] == nil {
+			pendingHashes[folder] = make(map[int64][]string)
+		}
+		pendingHashes[folder][size] = append(pendingHashes[folder][size], path)
+	}
+}
+
+// needsHash decides whether a source file must be hashed before it goes to folder. Files extracted
+// from archives were not part of the scan, so they are always hashed.
+func needsHash(path, folder string) bool {
+	if !prefilterEnabled() {
+		return true
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return true // Let dedupKey report the error
+	}
+	size := info.Size()
+	mustHash := isRunTemp(path) || sourceSizeCounts[size] > 1
+
+	sizeMu.Lock()
+	if !sizesInFolder[folder][size] {
+		if sizesInFolder[folder] == nil {
+			sizesInFolder[folder] = make(map[int64]bool)
+		}
+		sizesInFolder[folder][size] = true // Later arrivals of this size will hash both sides
+		sizeMu.Unlock()
+		return mustHash
+	}
+	pending := pendingHashes[folder][size]
+	delete(pendingHashes[folder], size)
+	sizeMu.Unlock()
+
+	// A library file of the same size could be a duplicate; make sure its hash is known
+	hashPendingFiles(folder, pending)
+	return true
+}
+
+// hashPendingFiles hashes library files whose size just became ambiguous and registers their hashes
+func hashPendingFiles(folder string, paths []string) {
+	for _, p := range paths {
+		hash, err := dedupKey(p)
+		if err != nil {
+			log.Printf("Could not hash '%s' for duplicate detection: %v", p, err)
+			continue
+		}
+		registerHash(folder, hash, p)
+	}
+}
+
+// notePlacedUnhashed queues a file that was sorted without hashing, so it is hashed later if a file
+// of the same size arrives in its folder (e.g. from an archive)
+func notePlacedUnhashed(dest string) {
+	info, err := os.Stat(dest)
+	if err != nil {
+		return
+	}
+	noteFolderFile(filepath.Dir(dest), dest, info.Size(), false)
+}
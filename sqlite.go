@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// copySQLiteDatabase copies a database owned by another application (with its WAL files) into the
+// run's temp namespace, so the application can keep running and its lock can't interfere
+func copySQLiteDatabase(path, kind string) (string, error) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		return "", fmt.Errorf("the sqlite3 command-line tool is required to read %s", filepath.Base(path))
+	}
+	db := newTempPath(kind, filepath.Base(path))
+	if err := os.MkdirAll(filepath.Dir(db), 0755); err != nil {
+		return "", err
+	}
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if _, err := os.Stat(path + suffix); err == nil {
+			if err := copyFile(path+suffix, db+suffix); err != nil {
+				return "", err
+			}
+		}
+	}
+	return db, nil
+}
+
+// querySQLite runs a read-only query with the sqlite3 CLI and returns the rows. ASCII unit and
+// record separators are used so titles and file names may contain tabs or newlines.
+func querySQLite(db, query string) ([][]string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sqlite3", "-readonly", "-batch", "-noheader", "-separator", "\x1f", "-newline", "\x1e", db, query)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("sqlite3: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var rows [][]string
+	for _, line := range strings.Split(stdout.String(), "\x1e") {
+		if line == "" {
+			continue
+		}
+		rows = append(rows, strings.Split(line, "\x1f"))
+	}
+	return rows, nil
+}
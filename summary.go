@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// runStart records when the run began, for duration reporting
+var runStart = time.Now()
+
+// Process exit codes, so wrapping scripts can react without parsing the log
+const (
+	exitClean      = 0 // Every file was handled without errors
+	exitWithErrors = 1 // The run completed but some files ended up in the errors folder
+	exitFatal      = 2 // The run aborted or was interrupted
+)
+
+// summaryFileName is written to the destination root after every run
+const summaryFileName = "last_run_summary.json"
+
+// Run status values reported in summaries
+const (
+	statusCompleted           = "completed"
+	statusCompletedWithErrors = "completed_with_errors"
+	statusFailed              = "failed"
+	statusInterrupted         = "interrupted" // Stopped by SIGINT/SIGTERM; the summary is partial
+)
+
+// summaryCounts holds every counter of a run in machine-readable form
+type summaryCounts struct {
+	FilesFound        int64 `json:"files_found"`
+	FilesProcessed    int64 `json:"files_processed"`
+	BytesFound        int64 `json:"bytes_found"`
+	BytesProcessed    int64 `json:"bytes_processed"`
+	PhotosSorted      int   `json:"photos_sorted"`
+	VideosSorted      int   `json:"videos_sorted"`
+	HEICConverted     int   `json:"heic_converted"`
+	NoDate            int   `json:"no_date"`
+	ArchivesExtracted int   `json:"archives_extracted"`
+	ArchivesMoved     int   `json:"archives_moved"`
+	ArchivesEncrypted int   `json:"archives_encrypted,omitempty"`
+	NonMediaDeleted   int   `json:"non_media_deleted"`
+	Junk              int   `json:"junk"`
+	DuplicatesDeleted int   `json:"duplicates_deleted"`
+	DuplicatesLinked  int   `json:"duplicates_linked"`
+	DuplicatesCopied  int   `json:"duplicates_copied"`
+	DuplicatesKept    int   `json:"duplicates_kept"`
+	SourceKept        int   `json:"source_kept"` // Copied, not moved: the source is read-only or a linked folder
+	DeletionsBlocked  int   `json:"deletions_blocked"`
+	LogicalDuplicates int   `json:"logical_duplicates"`
+	Quarantined       int   `json:"quarantined"`
+	OtherFiles        int   `json:"other_files"`
+	SidecarsKept      int   `json:"sidecars_kept"`
+	Documents         int   `json:"documents"`
+	DatedByMtime      int   `json:"dated_by_mtime"`
+	DatesWritten      int   `json:"dates_written"`
+	Screenshots       int   `json:"screenshots"`
+	Audio             int   `json:"audio"`
+	Filtered          int   `json:"filtered"`
+	Corrupt           int   `json:"corrupt"`
+	ThumbsRecovered   int   `json:"thumbnails_recovered"`
+	ZeroByte          int   `json:"zero_byte"`
+	NearDuplicates    int   `json:"near_duplicates"`
+	Companions        int   `json:"companions"`
+	Skipped           int   `json:"skipped"`
+	Errors            int   `json:"errors"`
+}
+
+// runSummary is the final report of a run, shared by notifications and summary files
+type runSummary struct {
+	RunID           string               `json:"run_id"`
+	Status          string               `json:"status"`
+	Error           string               `json:"error,omitempty"`
+	Text            string               `json:"text"` // Human-readable one-liner (also what Slack-style webhooks display)
+	Source          string               `json:"source"`
+	Destination     string               `json:"destination"`
+	StartedAt       time.Time            `json:"started_at"`
+	FinishedAt      time.Time            `json:"finished_at"`
+	DurationSeconds float64              `json:"duration_seconds"`
+	ContentDedupe   bool                 `json:"content_dedupe"`
+	Counts          summaryCounts        `json:"counts"`
+	Years           map[string]yearStats `json:"years"`           // Files sorted into each year folder this run
+	Errors          []errorRecord        `json:"errors"`          // Errors triage: origin and reason of every failure
+	DateReview      []dateReviewItem     `json:"date_review"`     // Sorted, but with dates outside the soft thresholds
+	UnknownFormats  []unknownFormatStat  `json:"unknown_formats"` // Unrecognized extensions, most common first
+	KeptUnknown     bool                 `json:"kept_unknown"`    // Unrecognized files were kept rather than deleted, bar --delete-exts
+	NearDuplicates  []nearDuplicateItem  `json:"near_duplicates"` // Visually identical photos (--near-duplicates)
+}
+
+// buildSummary snapshots the counters into a runSummary. fatalErr is set when the run aborted.
+func buildSummary(fatalErr error) runSummary {
+	counterMu.Lock()
+	counts := summaryCounts{
+		FilesFound:        atomic.LoadInt64(&totalFiles),
+		FilesProcessed:    atomic.LoadInt64(&processedFiles),
+		BytesFound:        atomic.LoadInt64(&totalBytes),
+		BytesProcessed:    atomic.LoadInt64(&processedBytes),
+		PhotosSorted:      movedCount,
+		VideosSorted:      videoMovedCount,
+		HEICConverted:     heicConvertedCount,
+		NoDate:            noDateCount,
+		ArchivesExtracted: archiveExtractedCount,
+		ArchivesMoved:     archiveMovedCount,
+		ArchivesEncrypted: archiveEncryptedCount,
+		NonMediaDeleted:   deletedNonMediaCount,
+		Junk:              junkCount,
+		DuplicatesDeleted: duplicateDeletedCount,
+		DuplicatesLinked:  duplicateLinkedCount,
+		DuplicatesCopied:  duplicateCopiedCount,
+		DuplicatesKept:    duplicateKeptCount,
+		SourceKept:        sourceKeptCount,
+		DeletionsBlocked:  deletionsBlockedCount,
+		LogicalDuplicates: logicalDuplicateCount,
+		Quarantined:       quarantinedCount,
+		OtherFiles:        otherFilesCount,
+		SidecarsKept:      sidecarKeptCount,
+		Documents:         documentCount,
+		DatedByMtime:      mtimeDatedCount,
+		DatesWritten:      datesWrittenCount,
+		Screenshots:       screenshotCount,
+		Audio:             audioCount,
+		Filtered:          filteredCount,
+		Corrupt:           corruptCount,
+		ThumbsRecovered:   recoveredCount,
+		ZeroByte:          zeroByteCount,
+		NearDuplicates:    nearDuplicateCount,
+		Companions:        companionCount,
+		Skipped:           skippedCount,
+		Errors:            errorCount,
+	}
+	counterMu.Unlock()
+
+	finished := time.Now()
+	s := runSummary{
+		RunID:           runID,
+		Source:          sourceDir,
+		Destination:     destDir,
+		StartedAt:       runStart,
+		FinishedAt:      finished,
+		DurationSeconds: finished.Sub(runStart).Seconds(),
+		ContentDedupe:   !*noHash,
+		Counts:          counts,
+		Years:           snapshotYearCounts(),
+		Errors:          snapshotErrorRecords(),
+		DateReview:      snapshotDateReview(),
+		UnknownFormats:  snapshotUnknownFormats(),
+		KeptUnknown:     *keepUnknown || !*aggressiveDelete,
+		NearDuplicates:  snapshotNearDuplicates(),
+	}
+
+	switch {
+	case fatalErr != nil:
+		s.Status = statusFailed
+		s.Error = fatalErr.Error()
+		s.Text = fmt.Sprintf("photo-sorter run FAILED after %s: %v", finished.Sub(runStart).Round(time.Second), fatalErr)
+	case interrupted():
+		s.Status = statusInterrupted
+	case counts.Errors > 0:
+		s.Status = statusCompletedWithErrors
+	default:
+		s.Status = statusCompleted
+	}
+	if fatalErr == nil {
+		s.Text = fmt.Sprintf("photo-sorter run %s in %s: %d photos, %d videos, %d no-date, %d duplicates removed, %d errors",
+			s.Status, finished.Sub(runStart).Round(time.Second), counts.PhotosSorted, counts.VideosSorted, counts.NoDate, counts.DuplicatesDeleted, counts.Errors)
+	}
+	return s
+}
+
+// exitCode maps a summary's status to the process exit code
+func (s runSummary) exitCode() int {
+	switch s.Status {
+	case statusFailed, statusInterrupted:
+		return exitFatal
+	case statusCompletedWithErrors:
+		return exitWithErrors
+	default:
+		return exitClean
+	}
+}
+
+// writeSummaryFile writes the summary as JSON to the destination root, replacing the previous run's file
+func writeSummaryFile(summary runSummary) {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		log.Printf("Could not encode run summary: %v", err)
+		return
+	}
+	// A run that failed before it created the destination leaves no trace there; the exit code
+	// and the notification still report the failure
+	if _, err := os.Stat(destDir); err != nil {
+		log.Printf("Not writing run summary: %v", err)
+		return
+	}
+
+	// Write to a temporary file first so readers never see a half-written summary
+	path := filepath.Join(destDir, summaryFileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		log.Printf("Could not write run summary '%s': %v", path, err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		log.Printf("Could not write run summary '%s': %v", path, err)
+	}
+}
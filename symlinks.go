@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errSymlinkSource is returned by renameSource for a symlink, or a file in a linked folder: the
+// caller copies the file instead of moving it away from where the link points
+var errSymlinkSource = errors.New("source is a symlink")
+
+// isSymlink reports whether path is itself a symbolic link
+func isSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// inLinkedFolder reports whether a source file lies in a folder reached through a symlink
+// (--follow-symlinks). Such files are copied and never removed: they belong to where the link points.
+func inLinkedFolder(path string) bool {
+	rel, err := filepath.Rel(sourceDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	dir := sourceDir
+	parts := strings.Split(rel, string(filepath.Separator))
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		if isSymlink(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceLink decides what the walk does with a symlink in the source. Without --follow-symlinks
+// links are left alone. With it, a link to a file is sorted like the file (its target is copied
+// and only the link removed), and a link to a folder is walked unless it was walked before, its
+// files copied rather than moved. It returns the target's info, or ok false to skip the link.
+func sourceLink(path string) (target os.FileInfo, ok bool) {
+	if !*followSymlinks {
+		log.Printf("Skipping symlink '%s' (use --follow-symlinks to sort what it points to)", path)
+		counterMu.Lock()
+		skippedCount++
+		counterMu.Unlock()
+		return nil, false
+	}
+	target, err := os.Stat(path)
+	if err != nil {
+		log.Printf("Skipping broken symlink '%s': %v", path, err)
+		counterMu.Lock()
+		skippedCount++
+		counterMu.Unlock()
+		return nil, false
+	}
+	return target, true
+}
+
+// firstVisit records a folder the walk enters by its real path, and reports whether it is new.
+// A folder reached again through a symlink (a loop, or a second link to it) is walked only once.
+func firstVisit(visited map[string]bool, dir string) bool {
+	if !*followSymlinks {
+		return true
+	}
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return true
+	}
+	if visited[real] {
+		log.Printf("Skipping '%s': its folder was already walked as '%s' (symlink loop or second link)", dir, real)
+		return false
+	}
+	visited[real] = true
+	return true
+}
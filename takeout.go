@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Google Photos Takeout writes each file's metadata to a JSON file named after it:
+// IMG_1.jpg.json, or IMG_1.jpg.supplemental-metadata.json in newer exports. Long names are cut
+// to fit 51 characters (IMG_1.jpg.supplemental-met.json), and the copy number of a repeated name
+// moves to the end (IMG_1(1).jpg has IMG_1.jpg(1).json).
+var takeoutCopySuffix = regexp.MustCompile(`\(\d+\)$`)
+
+// takeoutSupplemental is the marker newer exports insert before .json
+const takeoutSupplemental = "supplemental-metadata"
+
+// takeoutMediaName returns the name of the media file a Takeout JSON file describes
+func takeoutMediaName(path string) (string, bool) {
+	name := filepath.Base(path)
+	if !strings.EqualFold(filepath.Ext(name), ".json") {
+		return "", false
+	}
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	copyNo := takeoutCopySuffix.FindString(name)
+	name = strings.TrimSuffix(name, copyNo)
+	if i := strings.LastIndex(name, "."); i >= 0 && i < len(name)-1 && strings.HasPrefix(takeoutSupplemental, strings.ToLower(name[i+1:])) {
+		name = name[:i] // A possibly truncated .supplemental-metadata
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	if !imageExts[ext] && !videoExts[ext] {
+		return "", false
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)) + copyNo + filepath.Ext(name), true
+}
+
+// takeoutDate reads the capture time from a Takeout JSON file
+func takeoutDate(path string) (dateInfo, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return dateInfo{}, false
+	}
+	var meta struct {
+		PhotoTakenTime struct {
+			Timestamp string `json:"timestamp"`
+		} `json:"photoTakenTime"`
+	}
+	if json.Unmarshal(data, &meta) != nil {
+		return dateInfo{}, false
+	}
+	seconds, err := strconv.ParseInt(meta.PhotoTakenTime.Timestamp, 10, 64)
+	if err != nil || seconds <= 0 {
+		return dateInfo{}, false
+	}
+	t := time.Unix(seconds, 0)
+	if t.Year() <= 1900 || t.Year() > time.Now().Year()+1 {
+		return dateInfo{}, false
+	}
+	return dateInfo{Year: t.Format("2006"), Source: "Google Takeout photoTakenTime", Time: t, Zoned: true}, true
+}
+
+// takeoutYearFolder matches the folders Takeout files every photo under; they are not albums
+var takeoutYearFolder = regexp.MustCompile(`^Photos from \d{4}$`)
+
+// loadTakeoutAlbums records the album of every file that sits in a Takeout album folder, i.e. a
+// folder whose metadata.json names an album. Returns how many memberships were found.
+func loadTakeoutAlbums(paths []string) int {
+	titles := make(map[string]string) // Folder -> album title, "" when it is not an album
+	found := 0
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		title, seen := titles[dir]
+		if !seen {
+			title = takeoutAlbumTitle(dir)
+			titles[dir] = title
+			if title != "" {
+				log.Printf("Google Takeout album '%s' in '%s'", title, dir)
+			}
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if title != "" && (imageExts[ext] || videoExts[ext]) {
+			sourceAlbums[path] = append(sourceAlbums[path], title)
+			found++
+		}
+	}
+	return found
+}
+
+// takeoutAlbumTitle reads the album title from a folder's metadata.json, or returns ""
+func takeoutAlbumTitle(dir string) string {
+	if takeoutYearFolder.MatchString(filepath.Base(dir)) {
+		return ""
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "metadata.json"))
+	if err != nil {
+		return ""
+	}
+	var meta struct {
+		Title     string `json:"title"`
+		AlbumData struct {
+			Title string `json:"title"`
+		} `json:"albumData"` // Older exports
+	}
+	if json.Unmarshal(data, &meta) != nil {
+		return ""
+	}
+	if meta.Title == "" {
+		meta.Title = meta.AlbumData.Title
+	}
+	return strings.TrimSpace(meta.Title)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// stateDirName is the hidden folder under the destination holding the tool's own files.
+// The walker and the cleanup logic never descend into it.
+const stateDirName = ".photo-sorter"
+
+var (
+	stateDir   = filepath.Join(destDir, stateDirName)
+	tmpRootDir = filepath.Join(stateDir, "tmp")
+
+	// runID uniquely identifies this run; all temporary artifacts live under runTmpDir
+	runID     = time.Now().Format("20060102-150405") + fmt.Sprintf("-%d", os.Getpid())
+	runTmpDir = filepath.Join(tmpRootDir, runID)
+
+	tempCounter int64 // Makes temporary names unique within the run
+)
+
+// initRunTemp removes temporary directories left behind by crashed runs and creates this run's namespace.
+// The namespace lives on the destination volume so staged files can be renamed into place atomically.
+// Namespaces of runs still going (a sort while plan or tier starts) are left alone.
+func initRunTemp() error {
+	if entries, err := os.ReadDir(tmpRootDir); err == nil {
+		for _, e := range entries {
+			if pid, ok := runPID(e.Name()); ok && processAlive(pid) {
+				continue
+			}
+			stale := filepath.Join(tmpRootDir, e.Name())
+			log.Printf("Removing leftover temporary data from a previous run: %s", stale)
+			if err := os.RemoveAll(stale); err != nil {
+				log.Printf("Warning: Could not remove leftover temporary data '%s': %v", stale, err)
+			}
+		}
+	}
+	return os.MkdirAll(runTmpDir, 0755)
+}
+
+// runPID returns the process ID a runID ends with
+func runPID(id string) (int, bool) {
+	i := strings.LastIndexByte(id, '-')
+	if i < 0 {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(id[i+1:])
+	return pid, err == nil && pid > 0
+}
+
+// cleanupRunTemp removes this run's temporary namespace
+func cleanupRunTemp() {
+	if err := os.RemoveAll(runTmpDir); err != nil {
+		log.Printf("Warning: Could not clean up temporary directory '%s': %v", runTmpDir, err)
+		return
+	}
+	os.Remove(tmpRootDir) // Only succeeds when no other run left anything behind
+}
+
+// newTempPath returns a unique path inside this run's namespace, grouped by kind (e.g. "extract", "parts")
+func newTempPath(kind, name string) string {
+	n := atomic.AddInt64(&tempCounter, 1)
+	return filepath.Join(runTmpDir, kind, fmt.Sprintf("%06d_%s", n, name))
+}
+
+// isStateDir reports whether a directory is the tool's own state/temporary folder
+func isStateDir(path string) bool {
+	return filepath.Base(path) == stateDirName
+}
+
+// isRunTemp reports whether a path lies inside this run's temporary namespace
+func isRunTemp(path string) bool {
+	return strings.HasPrefix(path, runTmpDir+string(filepath.Separator))
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestInitRunTempKeepsLiveRuns(t *testing.T) {
+	exited := exec.Command("go", "version")
+	if err := exited.Run(); err != nil {
+		t.Skip(err)
+	}
+	savedRoot, savedRun := tmpRootDir, runTmpDir
+	tmpRootDir = t.TempDir()
+	runTmpDir = filepath.Join(tmpRootDir, "20261016-120000-999999999")
+	t.Cleanup(func() { tmpRootDir, runTmpDir = savedRoot, savedRun })
+
+	live := fmt.Sprintf("20261016-110000-%d", os.Getpid()) // A sort still going
+	crashed := fmt.Sprintf("20261016-100000-%d", exited.Process.Pid)
+	for _, name := range []string{live, crashed, "leftover"} {
+		os.MkdirAll(filepath.Join(tmpRootDir, name, "extract"), 0755)
+	}
+
+	if err := initRunTemp(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{live: true, crashed: false, "leftover": false, filepath.Base(runTmpDir): true} {
+		if _, err := os.Stat(filepath.Join(tmpRootDir, name)); (err == nil) != want {
+			t.Errorf("%s kept: %v, want %v", name, err == nil, want)
+		}
+	}
+}
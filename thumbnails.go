@@ -0,0 +1,5 @@
+package main
+
+// thumbnailExts are the JPEG thumbnails cameras write next to their videos (MVI_1234.THM). They
+// are sidecars of the video and carry the EXIF date the video itself often lacks.
+var thumbnailExts = map[string]bool{".thm": true}
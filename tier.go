@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tiersPath records which year folders live on the archive volume (year -> folder)
+var tiersPath = filepath.Join(stateDir, "tiers.json")
+
+// tierLocations is loaded from tiersPath; year folders in it are indexed and counted where they
+// now live, and their hash index keys stay as if they were still in the destination
+var tierLocations = make(map[string]string)
+
+// actionTiered marks a file relocated to the archive volume by the tier command
+const actionTiered = "tiered"
+
+// runTier implements the tier subcommand: it moves year folders older than --older-than years to
+// the archive volume, optionally leaving symlinks behind, and updates the tool's catalogs
+func runTier(args []string) {
+	fs := flag.NewFlagSet("tier", flag.ExitOnError)
+	olderThan := fs.Int("older-than", 5, "Move year folders more than this many years old")
+	archive := fs.String("archive", "", "Folder on the archive volume that receives the year folders (required)")
+	symlink := fs.Bool("symlink", false, "Leave a symlink at each moved year folder's old location")
+	format := fs.String("manifest-format", "csv", "Format of the manifest recording the moved files: csv or json (JSON Lines)")
+	fs.Parse(args)
+	log.SetFlags(log.LstdFlags)
+
+	if *archive == "" {
+		log.Print("tier: --archive is required")
+		os.Exit(exitFatal)
+	}
+	archiveDir, err := filepath.Abs(*archive)
+	if err != nil || os.MkdirAll(archiveDir, 0755) != nil {
+		log.Printf("tier: cannot use archive folder '%s'", *archive)
+		os.Exit(exitFatal)
+	}
+	loadTiers()
+	if err := initRunTemp(); err != nil {
+		log.Printf("tier: failed to create temporary directory %s: %v", runTmpDir, err)
+		os.Exit(exitFatal)
+	}
+	defer cleanupRunTemp()
+	if err := openManifest(*format); err != nil {
+		log.Printf("tier: failed to create manifest: %v", err)
+		os.Exit(exitFatal)
+	}
+	defer closeManifest()
+
+	cutoff := time.Now().Year() - *olderThan
+	entries, err := os.ReadDir(destDir)
+	if err != nil {
+		log.Printf("tier: cannot read '%s': %v", destDir, err)
+		os.Exit(exitFatal)
+	}
+	log.Printf("Moving year folders before %d to '%s'...", cutoff, archiveDir)
+	var moved, failed int
+	var bytes int64
+	for _, e := range entries {
+		year, err := strconv.Atoi(e.Name())
+		if !e.IsDir() || !isYearFolder(e.Name()) || err != nil || year >= cutoff {
+			continue // Symlinks left by an earlier run are not directories here
+		}
+		target := tierLocations[e.Name()]
+		if target == "" {
+			target = filepath.Join(archiveDir, e.Name())
+		}
+		n, size, errs := tierYear(filepath.Join(destDir, e.Name()), target)
+		moved += n
+		bytes += size
+		failed += errs
+		tierLocations[e.Name()] = target
+		log.Printf("Year %s: moved %d files (%s) to '%s'", e.Name(), n, formatBytes(size), target)
+
+		if errs == 0 {
+			if *symlink {
+				if err := os.Symlink(target, filepath.Join(destDir, e.Name())); err != nil {
+					log.Printf("Could not leave a symlink for %s: %v", e.Name(), err)
+				}
+			} else {
+				relocateAlbumEntries(e.Name(), target)
+			}
+		}
+	}
+
+	saveTiers()
+	log.Printf("🧊 Tiering complete: %d files (%s) moved to the archive volume, %d failed", moved, formatBytes(bytes), failed)
+	if failed > 0 {
+		os.Exit(exitWithErrors)
+	}
+}
+
+// tierYear moves every file of a year folder into target, removing the folder once empty.
+// Files are renamed when possible and copied (then verified by size and removed) across volumes.
+func tierYear(yearDir, target string) (moved int, bytes int64, failed int) {
+	filepath.Walk(yearDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(yearDir, path)
+		dest := uniquePath(filepath.Join(target, rel))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			log.Printf("Could not move '%s': %v", path, err)
+			failed++
+			return nil
+		}
+		if err := os.Rename(path, dest); err != nil {
+			if err := copyToVolume(path, dest, info); err != nil {
+				log.Printf("Could not move '%s': %v", path, err)
+				failed++
+				return nil
+			}
+			os.Remove(path)
+		}
+		moved++
+		bytes += info.Size()
+		recordOp(manifestEntry{Source: path, Destination: dest, Year: filepath.Base(yearDir), Action: actionTiered})
+		return nil
+	})
+	if failed == 0 {
+		for removeEmptyDirsPass(yearDir) > 0 {
+		}
+		os.Remove(yearDir)
+	}
+	return moved, bytes, failed
+}
+
+// uniquePath returns path, or path with a _N suffix if that name is taken
+func uniquePath(path string) string {
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	for counter := 1; ; counter++ {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = fmt.Sprintf("%s_%d%s", stem, counter, ext)
+	}
+}
+
+// copyToVolume copies a file to another volume through a .part file next to the target, so an
+// interrupted copy never looks complete. The modification time is kept so the hash index stays valid.
+func copyToVolume(src, dst string, info os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	part := dst + ".part"
+	out, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	n, err := io.CopyBuffer(out, in, make([]byte, 1<<20))
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n != info.Size() {
+		err = fmt.Errorf("copied %d of %d bytes", n, info.Size())
+	}
+	if err != nil {
+		os.Remove(part)
+		return err
+	}
+	os.Chtimes(part, info.ModTime(), info.ModTime())
+	return os.Rename(part, dst)
+}
+
+// loadTiers reads the record of tiered year folders
+func loadTiers() {
+	data, err := os.ReadFile(tiersPath)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(data, &tierLocations); err != nil {
+		log.Printf("Warning: Could not read '%s': %v", tiersPath, err)
+	}
+}
+
+// saveTiers writes the record of tiered year folders
+func saveTiers() {
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		log.Printf("Could not save '%s': %v", tiersPath, err)
+		return
+	}
+	data, _ := json.MarshalIndent(tierLocations, "", "  ")
+	tmp := tiersPath + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		log.Printf("Could not save '%s': %v", tiersPath, err)
+		return
+	}
+	if err := os.Rename(tmp, tiersPath); err != nil {
+		os.Remove(tmp)
+		log.Printf("Could not save '%s': %v", tiersPath, err)
+	}
+}
+
+// tieredYears returns the tiered years in order, for deterministic walks
+func tieredYears() []string {
+	years := make([]string, 0, len(tierLocations))
+	for year := range tierLocations {
+		years = append(years, year)
+	}
+	sort.Strings(years)
+	return years
+}
+
+// tieredIndexKey maps a file in a tiered year folder to the hash index key it had in the
+// destination, or "" if the file is not in one
+func tieredIndexKey(path string) string {
+	for year, dir := range tierLocations {
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return year + "/" + filepath.ToSlash(rel)
+		}
+	}
+	return ""
+}
+
+// relocateAlbumEntries points albums.json at a year folder's new location, when no symlink was left
+func relocateAlbumEntries(year, target string) {
+	path := filepath.Join(destDir, albumsFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	catalog := make(map[string][]string)
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		log.Printf("Warning: Could not update album catalog '%s': %v", path, err)
+		return
+	}
+	prefix := year + "/"
+	for album, files := range catalog {
+		for i, f := range files {
+			if strings.HasPrefix(f, prefix) {
+				files[i] = filepath.ToSlash(filepath.Join(target, strings.TrimPrefix(f, prefix)))
+			}
+		}
+		catalog[album] = files
+	}
+	data, _ = json.MarshalIndent(catalog, "", "  ")
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		log.Printf("Warning: Could not update album catalog '%s': %v", path, err)
+	}
+}
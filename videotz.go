@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Values of --video-tz other than an offset or a zone name
+const (
+	videoTZUTC   = "utc"
+	videoTZLocal = "local"
+)
+
+// videoZone is the time zone video creation times stored as UTC are converted to before taking
+// their year (--video-tz); nil leaves them as stored
+var videoZone *time.Location
+
+// loadVideoTZ parses --video-tz: utc, local, an offset (+02:00) or a zone name (Europe/Berlin)
+func loadVideoTZ() error {
+	switch value := strings.TrimSpace(*videoTZ); strings.ToLower(value) {
+	case videoTZUTC:
+		videoZone = nil
+	case videoTZLocal:
+		videoZone = time.Local
+	default:
+		if t, err := time.Parse("-07:00", value); err == nil {
+			_, seconds := t.Zone()
+			videoZone = time.FixedZone(value, seconds)
+			return nil
+		}
+		loc, err := time.LoadLocation(value)
+		if err != nil || value == "" {
+			return fmt.Errorf("%q (expected utc, local, an offset like +02:00 or a zone name like Europe/Berlin)", value)
+		}
+		videoZone = loc
+	}
+	return nil
+}
+
+// inVideoZone converts a creation time a video stores as UTC (mvhd, MKV DateUTC, ASF) to
+// --video-tz, reporting whether it is now a known instant in that zone. Cameras that write their
+// local clock as UTC are read correctly with the default, utc.
+func inVideoZone(t time.Time) (time.Time, bool) {
+	if videoZone == nil {
+		return t, false
+	}
+	return t.In(videoZone), true
+}
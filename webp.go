@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// webpChunk returns the payload of the first RIFF chunk of the given type in a WebP file, or nil
+func webpChunk(f *os.File, want string) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 12)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WEBP" {
+		return nil, errors.New("not a WebP file")
+	}
+
+	// Chunks are a fourcc and a little-endian size, padded to an even length. EXIF and XMP come
+	// after the image data in extended (VP8X) files.
+	offset := int64(12)
+	for offset+8 <= info.Size() {
+		if _, err := f.ReadAt(header[:8], offset); err != nil {
+			return nil, err
+		}
+		typ := string(header[0:4])
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+		if offset+8+size > info.Size() {
+			return nil, errors.New("truncated WebP chunk")
+		}
+		if typ == want {
+			if size > maxMetadataSize {
+				return nil, errors.New("WebP metadata chunk unreasonably large")
+			}
+			data := make([]byte, size)
+			if _, err := f.ReadAt(data, offset+8); err != nil && err != io.EOF {
+				return nil, err
+			}
+			return data, nil
+		}
+		offset += 8 + size + size%2
+	}
+	return nil, nil
+}
+
+// webpExif decodes the EXIF chunk of a WebP file. Writers differ in whether it starts with
+// "Exif\0\0"; goexif accepts both.
+func webpExif(f *os.File) (*exif.Exif, error) {
+	data, err := webpChunk(f, "EXIF")
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, errors.New("no EXIF chunk")
+	}
+	return exif.Decode(bytes.NewReader(data))
+}
+
+// webpXMP returns the XMP chunk of a WebP file, or nil
+func webpXMP(f *os.File) []byte {
+	data, _ := webpChunk(f, "XMP ")
+	return data
+}
@@ -0,0 +1,34 @@
+package main
+
+import "sync"
+
+// workerSlots bounds how many files are processed at once. Pool workers hold a slot for each file
+// they process; an archive lends the free ones to its extracted files (see processExtracted).
+// It is nil outside the worker pool, where extracted files are processed in turn.
+var workerSlots chan struct{}
+
+// processExtracted processes the files extracted from an archive, handing each to a free worker
+// slot and processing it in the calling worker when none is free, so one large archive keeps idle
+// workers busy instead of being sorted file by file. Files are never queued for a slot, so an
+// archive cannot wait on workers that are themselves waiting.
+func processExtracted(jobs []fileJob) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, job := range jobs {
+		if interrupted() {
+			return errInterrupted
+		}
+		select {
+		case workerSlots <- struct{}{}:
+			wg.Add(1)
+			go func(job fileJob) {
+				defer wg.Done()
+				defer func() { <-workerSlots }()
+				processFile(job)
+			}(job)
+		default:
+			processFile(job)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// --write-dates modes
+const (
+	writeDatesXMP  = "xmp"  // Write an XMP sidecar next to the sorted file
+	writeDatesEXIF = "exif" // Write the date into the sorted file itself with exiftool
+)
+
+// xmpDatePacket is the sidecar written for a file's inferred date
+const xmpDatePacket = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:exif="http://ns.adobe.com/exif/1.0/"
+    xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+   exif:DateTimeOriginal="%[1]s"
+   photoshop:DateCreated="%[1]s"
+   xmp:CreateDate="%[1]s"/>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>
+`
+
+// checkWriteDates validates --write-dates
+func checkWriteDates() error {
+	switch *writeDates {
+	case "", writeDatesXMP:
+	case writeDatesEXIF:
+		if _, err := exec.LookPath("exiftool"); err != nil {
+			return errors.New("exif needs exiftool on the PATH")
+		}
+	default:
+		return fmt.Errorf("%q (expected xmp or exif)", *writeDates)
+	}
+	return nil
+}
+
+// writeInferredDate records a date the sorter inferred (from a name, sidecar, catalog or clock
+// correction) in a sorted file, so tools that read its metadata place it where the sorter did.
+// Nothing is written when the file's own metadata already held the date, or when the date is
+// only a year.
+func writeInferredDate(dest string, date dateInfo, companions []string) {
+	if *writeDates == "" || !date.Inferred || date.Time.IsZero() {
+		return
+	}
+	var err error
+	switch *writeDates {
+	case writeDatesXMP:
+		sidecar := strings.TrimSuffix(dest, filepath.Ext(dest)) + ".xmp"
+		for _, c := range companions {
+			if strings.EqualFold(filepath.Ext(c), ".xmp") {
+				log.Printf("Not writing the date of '%s' to an XMP sidecar: it has its own", filepath.Base(dest))
+				return
+			}
+		}
+		if _, statErr := os.Lstat(sidecar); statErr == nil {
+			log.Printf("Not writing the date of '%s': '%s' already exists", filepath.Base(dest), filepath.Base(sidecar))
+			return
+		}
+		value := date.Time.Format("2006-01-02T15:04:05")
+		if date.Zoned {
+			value = date.Time.Format(time.RFC3339)
+		}
+		err = os.WriteFile(sidecar, []byte(fmt.Sprintf(xmpDatePacket, value)), 0644)
+	case writeDatesEXIF:
+		err = exiftoolWriteDate(dest, date)
+	}
+	if err != nil {
+		log.Printf("⚠️  Could not write the date of '%s': %v", filepath.Base(dest), err)
+		return
+	}
+	log.Printf("Wrote date %s (%s) to '%s' (%s)", date.Time.Format("2006-01-02 15:04:05"), date.Source, filepath.Base(dest), *writeDates)
+	counterMu.Lock()
+	datesWrittenCount++
+	counterMu.Unlock()
+}
+
+// exiftoolWriteDate writes a capture date into a file's own metadata: EXIF DateTimeOriginal and
+// CreateDate (with their offsets when the zone is known) for images, QuickTime CreateDate for videos
+func exiftoolWriteDate(path string, date dateInfo) error {
+	args := []string{"-q", "-overwrite_original", "-P"}
+	clock := date.Time.Format("2006:01:02 15:04:05")
+	if videoExts[mediaExt(path)] {
+		// QuickTime dates are UTC; exiftool converts from the given offset, or from the local zone
+		if date.Zoned {
+			clock += date.Time.Format("-07:00")
+		}
+		args = append(args, "-api", "QuickTimeUTC", "-QuickTime:CreateDate="+clock)
+	} else {
+		args = append(args, "-DateTimeOriginal="+clock, "-CreateDate="+clock)
+		if date.Zoned {
+			offset := date.Time.Format("-07:00")
+			args = append(args, "-OffsetTimeOriginal="+offset, "-OffsetTimeDigitized="+offset)
+		}
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("exiftool", append(args, path)...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("exiftool: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// parseTaken reads a manifest/plan capture time back (see takenStamp)
+func parseTaken(s string) (t time.Time, zoned bool) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.Local(), true
+	}
+	if t, err := time.Parse("2006-01-02T15:04:05", s); err == nil {
+		return t, false
+	}
+	return time.Time{}, false
+}
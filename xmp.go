@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"regexp"
+	"time"
+)
+
+// xmpDateTags are the XMP properties holding a capture date, most reliable first. Properties may
+// be written as attributes (exif:DateTimeOriginal="...") or as elements (<exif:DateTimeOriginal>...<).
+var xmpDateTags = []string{"exif:DateTimeOriginal", "photoshop:DateCreated", "xmp:CreateDate"}
+
+var xmpDatePatterns = func() []*regexp.Regexp {
+	var res []*regexp.Regexp
+	for _, tag := range xmpDateTags {
+		res = append(res, regexp.MustCompile(regexp.QuoteMeta(tag)+`(?:\s*=\s*"([^"]*)"|>([^<]*)<)`))
+	}
+	return res
+}()
+
+// xmpDateLayouts are the ISO 8601 forms XMP dates take, most precise first
+var xmpDateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04Z07:00", "2006-01-02T15:04", "2006-01-02", "2006-01", "2006"}
+
+// xmpDate returns the capture date from an XMP packet
+func xmpDate(packet []byte) (dateInfo, bool) {
+	for i, re := range xmpDatePatterns {
+		tag := xmpDateTags[i]
+		m := re.FindSubmatch(packet)
+		if m == nil {
+			continue
+		}
+		value := string(m[1])
+		if value == "" {
+			value = string(m[2])
+		}
+		for _, layout := range xmpDateLayouts {
+			t, err := time.Parse(layout, value)
+			if err != nil {
+				continue
+			}
+			if t.Year() <= 1900 || t.Year() > time.Now().Year()+1 {
+				break
+			}
+			zoned := layout == time.RFC3339Nano || layout == "2006-01-02T15:04Z07:00"
+			return dateInfo{Year: t.Format("2006"), Source: "XMP " + tag, Time: t, Zoned: zoned}, true
+		}
+	}
+	return dateInfo{}, false
+}
+
+// jpegXMPHeader starts the APP1 segment holding a JPEG's XMP packet
+var jpegXMPHeader = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+// jpegXMP returns the XMP packet of a JPEG file's APP1 segment, or nil
+func jpegXMP(f *os.File) []byte {
+	return jpegSegment(f, 0xE1, jpegXMPHeader)
+}
+
+// jpegSegment returns the payload (after header) of a JPEG file's first APPn segment with the
+// given marker that starts with header, or nil
+func jpegSegment(f *os.File, app byte, header []byte) []byte {
+	r := io.NewSectionReader(f, 0, 1<<62)
+	marker := make([]byte, 4)
+	if _, err := io.ReadFull(r, marker[:2]); err != nil || marker[0] != 0xFF || marker[1] != 0xD8 {
+		return nil
+	}
+	// Segments are a marker and a big-endian length (which includes itself), up to the image data
+	for {
+		if _, err := io.ReadFull(r, marker); err != nil || marker[0] != 0xFF || marker[1] == 0xDA || marker[1] == 0xD9 {
+			return nil
+		}
+		size := int64(binary.BigEndian.Uint16(marker[2:])) - 2
+		if size < 0 {
+			return nil
+		}
+		if marker[1] != app || size < int64(len(header)) || size > maxMetadataSize {
+			if _, err := r.Seek(size, io.SeekCurrent); err != nil {
+				return nil
+			}
+			continue
+		}
+		segment := make([]byte, size)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil
+		}
+		if bytes.HasPrefix(segment, header) {
+			return segment[len(header):]
+		}
+	}
+}
+
+// mp4XMPUUID is the type of the top-level 'uuid' box holding XMP in MP4 files (Adobe, DJI)
+var mp4XMPUUID = []byte{0xBE, 0x7A, 0xCF, 0xCB, 0x97, 0xA9, 0x42, 0xE8, 0x9C, 0x71, 0x99, 0x94, 0x91, 0xE3, 0xAF, 0xAC}
+
+// mp4XMP returns the XMP packet of an MP4/MOV file, from the XMP 'uuid' box or QuickTime's
+// moov > udta > XMP_, or nil
+func mp4XMP(f *os.File) []byte {
+	if uuid, _ := readTopLevelBox(f, "uuid"); bytes.HasPrefix(uuid, mp4XMPUUID) {
+		return uuid[len(mp4XMPUUID):]
+	}
+	moov, _ := readMoov(f)
+	return isoChildBox(isoChildBox(moov, "udta"), "XMP_")
+}
+
+// extractMP4XMPDate reads the capture date from an MP4/MOV file's XMP
+func extractMP4XMPDate(path string) (dateInfo, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return dateInfo{}, false
+	}
+	defer f.Close()
+	return xmpDate(mp4XMP(f))
+}
+
+// tiffXMPTag is the TIFF tag holding an XMP packet
+const tiffXMPTag = 700
+
+// tiffXMP returns the XMP packet of a TIFF file's first IFD, or nil
+func tiffXMP(f *os.File) []byte {
+	header := make([]byte, 8)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		return nil
+	}
+	var order binary.ByteOrder
+	switch string(header[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+	ifd := int64(order.Uint32(header[4:]))
+	count := make([]byte, 2)
+	if _, err := f.ReadAt(count, ifd); err != nil {
+		return nil
+	}
+	entry := make([]byte, 12)
+	for i := int64(0); i < int64(order.Uint16(count)); i++ {
+		if _, err := f.ReadAt(entry, ifd+2+12*i); err != nil {
+			return nil
+		}
+		if order.Uint16(entry) != tiffXMPTag {
+			continue
+		}
+		// BYTE or UNDEFINED values; more than 4 bytes are stored at an offset
+		n := int64(order.Uint32(entry[4:]))
+		if n > maxMetadataSize {
+			return nil
+		}
+		if n <= 4 {
+			return entry[8 : 8+n]
+		}
+		packet := make([]byte, n)
+		if _, err := f.ReadAt(packet, int64(order.Uint32(entry[8:]))); err != nil {
+			return nil
+		}
+		return packet
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// zeroByteDir keeps empty photos, videos, archives and sidecars for review (--delete-zero-byte
+// deletes them instead)
+var zeroByteDir = filepath.Join(destDir, "zero_byte")
+
+// actionZeroByte marks an empty file moved to the zero_byte folder
+const actionZeroByte = "zero_byte"
+
+// isZeroByte reports whether a file the sorter would sort is empty. Empty files all hash alike, so
+// they would otherwise be sorted as one photo and "deduplicated" against each other. Unrecognized
+// files keep their own policy (--keep-unknown).
+func isZeroByte(path, ext string) bool {
+	if !imageExts[ext] && !videoExts[ext] && !archiveExts[ext] && !isSidecar(path) {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Size() == 0
+}
+
+// handleZeroByte moves an empty file to the zero_byte folder, or deletes it (--delete-zero-byte)
+func handleZeroByte(path string, remove bool) {
+	filename := filepath.Base(path)
+	fail := func(code, reason string) {
+		log.Printf("Could not handle empty file '%s': %s", filename, reason)
+		counterMu.Lock()
+		errorCount++
+		counterMu.Unlock()
+		recordError(path, "", code, reason)
+		recordOp(manifestEntry{Source: path, Action: actionFailed})
+	}
+	// Past the deletion limit, empty files are kept in the zero_byte folder as without --delete-zero-byte
+	if remove && sourceRemovable(path) && allowDeletion(path) {
+		if err := removeSource(path); err != nil {
+			fail(errDeleteFailed, fmt.Sprintf("could not delete empty file: %v", err))
+			return
+		}
+		log.Printf("Deleted '%s' (empty file)", filename)
+		counterMu.Lock()
+		zeroByteCount++
+		counterMu.Unlock()
+		recordOp(manifestEntry{Source: path, Action: actionDeleted, Note: "zero-byte file"})
+		return
+	}
+
+	if err := ensureDir(zeroByteDir); err != nil {
+		fail(errMoveFailed, fmt.Sprintf("could not create zero_byte folder: %v", err))
+		return
+	}
+	dest := uniquePath(filepath.Join(zeroByteDir, canonicalName(filename)))
+	if err := placeFile(path, dest); err != nil {
+		fail(errMoveFailed, fmt.Sprintf("move failed: %v", err))
+		return
+	}
+	log.Printf("⚠️  '%s' is empty; moved it to 'zero_byte'", filename)
+	counterMu.Lock()
+	zeroByteCount++
+	counterMu.Unlock()
+	recordOp(manifestEntry{Source: path, Destination: dest, Action: actionZeroByte})
+}
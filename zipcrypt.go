@@ -0,0 +1,383 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// zipPasswordsEnv lists passwords for encrypted ZIPs, one per line, for scripts that would rather
+// not keep them in a file (--zip-passwords)
+const zipPasswordsEnv = "PHOTO_SORTER_ZIP_PASSWORDS"
+
+// encryptedArchivesDir keeps encrypted archives that none of the passwords opened
+var encryptedArchivesDir = filepath.Join(archivesDir, "encrypted")
+
+// errWrongPassword is returned when a password does not decrypt a ZIP entry
+var errWrongPassword = errors.New("wrong password")
+
+var (
+	zipPasswordMu   sync.Mutex
+	zipPasswordList []string // Passwords to try, the last one that worked first
+
+	zipPromptMu      sync.Mutex
+	stdinReader      *bufio.Reader       // For --zip-password-prompt
+	zipPromptSkipped = map[string]bool{} // Archives the user gave no password for
+)
+
+// loadZipPasswords reads the passwords of --zip-passwords (one per line) and $PHOTO_SORTER_ZIP_PASSWORDS
+func loadZipPasswords(path string) error {
+	var lines []string
+	if env := os.Getenv(zipPasswordsEnv); env != "" {
+		lines = append(lines, strings.Split(env, "\n")...)
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, strings.Split(string(data), "\n")...)
+	}
+	for _, line := range lines {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			zipPasswordList = append(zipPasswordList, line)
+		}
+	}
+	return nil
+}
+
+// zipPasswordCandidates returns the passwords to try on an encrypted ZIP entry
+func zipPasswordCandidates() []string {
+	zipPasswordMu.Lock()
+	defer zipPasswordMu.Unlock()
+	return append([]string(nil), zipPasswordList...)
+}
+
+// rememberZipPassword moves a password that worked to the front of the list, where the next
+// entry (usually of the same archive) tries it first
+func rememberZipPassword(password string) {
+	zipPasswordMu.Lock()
+	defer zipPasswordMu.Unlock()
+	list := []string{password}
+	for _, p := range zipPasswordList {
+		if p != password {
+			list = append(list, p)
+		}
+	}
+	zipPasswordList = list
+}
+
+// canPromptZipPassword reports whether --zip-password-prompt can ask on a terminal
+func canPromptZipPassword() bool {
+	if !*zipPasswordPrompt || *filesFrom == "-" {
+		return false
+	}
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// promptZipPassword asks for the password of an archive on the terminal, returning "" when the
+// user skips it. Input is echoed. The caller holds zipPromptMu.
+func promptZipPassword(archiveName string) string {
+	if stdinReader == nil {
+		stdinReader = bufio.NewReader(os.Stdin)
+	}
+	fmt.Fprintf(os.Stderr, "\nPassword for encrypted ZIP '%s' (empty to skip): ", archiveName)
+	line, _ := stdinReader.ReadString('\n')
+	return strings.TrimRight(line, "\r\n")
+}
+
+// extractEncryptedEntry decrypts an encrypted ZIP entry to filePath with the first password that
+// opens it, asking for more with --zip-password-prompt. It reports false when none does.
+func extractEncryptedEntry(file *zip.File, filePath, zipPath string) bool {
+	tried := make(map[string]bool)
+	try := func(password string) bool {
+		if tried[password] {
+			return false
+		}
+		tried[password] = true
+		if err := decryptEntryTo(file, password, filePath); err != nil {
+			os.Remove(filePath)
+			return false
+		}
+		rememberZipPassword(password)
+		return true
+	}
+	tryListed := func() bool {
+		for _, password := range zipPasswordCandidates() {
+			if try(password) {
+				return true
+			}
+		}
+		return false
+	}
+	if tryListed() {
+		return true
+	}
+	if !canPromptZipPassword() {
+		return false
+	}
+
+	// Entries are extracted side by side; one question is on the screen at a time, and a
+	// password typed for another entry of the archive is tried before asking again
+	zipPromptMu.Lock()
+	defer zipPromptMu.Unlock()
+	if tryListed() {
+		return true
+	}
+	if zipPromptSkipped[zipPath] {
+		return false
+	}
+	for {
+		password := promptZipPassword(filepath.Base(zipPath))
+		if password == "" {
+			zipPromptSkipped[zipPath] = true
+			return false
+		}
+		if try(password) {
+			return true
+		}
+		fmt.Fprintf(os.Stderr, "Wrong password for '%s'\n", file.Name)
+	}
+}
+
+// decryptEntryTo writes the decrypted content of a ZIP entry to filePath. A wrong password is
+// caught by its check value, and otherwise by the entry's checksum or authentication code.
+func decryptEntryTo(file *zip.File, password, filePath string) error {
+	r, err := openEncryptedEntry(file, password)
+	if err != nil {
+		return err
+	}
+	outFile, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(outFile, r)
+	if cerr := outFile.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// openEncryptedEntry returns the content of a ZIP entry encrypted with traditional PKWARE
+// encryption (ZipCrypto) or WinZip AES, stored or deflated. The reader fails at its end if the
+// content does not check out.
+func openEncryptedEntry(file *zip.File, password string) (io.Reader, error) {
+	raw, err := file.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	method := file.Method
+	var data io.Reader
+	var verify func() error
+	checkCRC := true
+	if method == 99 {
+		aes, err := parseWinZipAES(file.Extra)
+		if err != nil {
+			return nil, err
+		}
+		method = aes.method
+		checkCRC = aes.version == 1 // AE-2 leaves the checksum out, relying on the authentication code
+		if data, verify, err = winzipAESReader(raw, int64(file.CompressedSize64), aes.strength, password); err != nil {
+			return nil, err
+		}
+	} else if data, err = zipCryptoReader(raw, file, password); err != nil {
+		return nil, err
+	}
+
+	switch method {
+	case zip.Store:
+	case zip.Deflate:
+		data = flate.NewReader(data)
+	default:
+		return nil, fmt.Errorf("compression method %d is not supported in encrypted entries", method)
+	}
+	// Like the ZIP reader, stop at the declared size, which the archive guard checked
+	data = io.LimitReader(data, int64(file.UncompressedSize64))
+	sum := crc32.NewIEEE()
+	return &checkedReader{r: io.TeeReader(data, sum), check: func() error {
+		if verify != nil {
+			if err := verify(); err != nil {
+				return err
+			}
+		}
+		if checkCRC && sum.Sum32() != file.CRC32 {
+			return errWrongPassword
+		}
+		return nil
+	}}, nil
+}
+
+// checkedReader runs a check once its reader is exhausted, returning its error instead of io.EOF
+type checkedReader struct {
+	r     io.Reader
+	check func() error
+}
+
+func (c *checkedReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err == io.EOF {
+		if cerr := c.check(); cerr != nil {
+			return n, cerr
+		}
+	} else if _, ok := err.(flate.CorruptInputError); ok {
+		return n, errWrongPassword // Garbage from a wrong password that got past the check value
+	}
+	return n, err
+}
+
+// zipCrypto holds the three keys of traditional PKWARE encryption
+type zipCrypto struct {
+	keys [3]uint32
+	r    io.Reader
+}
+
+func zipCryptoCRC(crc uint32, b byte) uint32 {
+	return crc>>8 ^ crc32.IEEETable[byte(crc)^b]
+}
+
+func (z *zipCrypto) update(b byte) {
+	z.keys[0] = zipCryptoCRC(z.keys[0], b)
+	z.keys[1] = (z.keys[1]+z.keys[0]&0xFF)*134775813 + 1
+	z.keys[2] = zipCryptoCRC(z.keys[2], byte(z.keys[1]>>24))
+}
+
+func (z *zipCrypto) decrypt(b byte) byte {
+	t := z.keys[2] | 2
+	b ^= byte(t * (t ^ 1) >> 8)
+	z.update(b)
+	return b
+}
+
+func (z *zipCrypto) Read(p []byte) (int, error) {
+	n, err := z.r.Read(p)
+	for i := range p[:n] {
+		p[i] = z.decrypt(p[i])
+	}
+	return n, err
+}
+
+// zipCryptoReader decrypts a ZipCrypto entry after checking the password against the last byte of
+// its 12-byte encryption header: the checksum's high byte, or for entries written with a trailing
+// data descriptor possibly the modification time's
+func zipCryptoReader(raw io.Reader, file *zip.File, password string) (io.Reader, error) {
+	z := &zipCrypto{keys: [3]uint32{0x12345678, 0x23456789, 0x34567890}, r: raw}
+	for i := 0; i < len(password); i++ {
+		z.update(password[i])
+	}
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(z, header); err != nil {
+		return nil, fmt.Errorf("truncated encryption header: %v", err)
+	}
+	check := byte(file.CRC32 >> 24)
+	if header[11] != check && (file.Flags&0x8 == 0 || header[11] != byte(file.ModifiedTime>>8)) {
+		return nil, errWrongPassword
+	}
+	return z, nil
+}
+
+// winzipAES is the WinZip AES extra field (0x9901) of an entry
+type winzipAES struct {
+	version  uint16 // AE-1 or AE-2
+	strength int    // 1, 2 or 3 for 128-, 192- or 256-bit keys
+	method   uint16 // The compression method under the encryption
+}
+
+func parseWinZipAES(extra []byte) (winzipAES, error) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:2])
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if 4+size > len(extra) {
+			break
+		}
+		if id == 0x9901 && size >= 7 {
+			field := extra[4 : 4+size]
+			aes := winzipAES{version: binary.LittleEndian.Uint16(field[0:2]), strength: int(field[4]), method: binary.LittleEndian.Uint16(field[5:7])}
+			if aes.strength < 1 || aes.strength > 3 {
+				return aes, fmt.Errorf("unknown AES strength %d", aes.strength)
+			}
+			return aes, nil
+		}
+		extra = extra[4+size:]
+	}
+	return winzipAES{}, errors.New("AES-encrypted entry without its WinZip AES field")
+}
+
+// winzipAESReader decrypts a WinZip AES entry: a salt and password check value, then the data in
+// AES-CTR (with a little-endian counter), then a 10-byte HMAC-SHA1 of the encrypted data that
+// verify checks
+func winzipAESReader(raw io.Reader, size int64, strength int, password string) (io.Reader, func() error, error) {
+	keyLen := 8 + 8*strength
+	saltLen := keyLen / 2
+	dataLen := size - int64(saltLen) - 2 - 10
+	if dataLen < 0 {
+		return nil, nil, errors.New("truncated AES entry")
+	}
+	head := make([]byte, saltLen+2)
+	if _, err := io.ReadFull(raw, head); err != nil {
+		return nil, nil, fmt.Errorf("truncated AES entry: %v", err)
+	}
+	keys, err := pbkdf2.Key(sha1.New, password, head[:saltLen], 1000, 2*keyLen+2)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !hmac.Equal(keys[2*keyLen:], head[saltLen:]) {
+		return nil, nil, errWrongPassword
+	}
+	block, err := aes.NewCipher(keys[:keyLen])
+	if err != nil {
+		return nil, nil, err
+	}
+	mac := hmac.New(sha1.New, keys[keyLen:2*keyLen])
+	ctr := &winzipCTR{r: io.TeeReader(io.LimitReader(raw, dataLen), mac), block: block, pos: aes.BlockSize}
+	verify := func() error {
+		code := make([]byte, 10)
+		if _, err := io.ReadFull(raw, code); err != nil || !hmac.Equal(code, mac.Sum(nil)[:10]) {
+			return errWrongPassword
+		}
+		return nil
+	}
+	return ctr, verify, nil
+}
+
+// winzipCTR is AES in counter mode as WinZip uses it: the counter starts at 1 and is incremented
+// as a little-endian number, unlike cipher.NewCTR's big-endian one
+type winzipCTR struct {
+	r       io.Reader
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	pos     int
+}
+
+func (c *winzipCTR) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	for i := range p[:n] {
+		if c.pos == aes.BlockSize {
+			for j := range c.counter {
+				if c.counter[j]++; c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.pos = 0
+		}
+		p[i] ^= c.stream[c.pos]
+		c.pos++
+	}
+	return n, err
+}
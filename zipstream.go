@@ -0,0 +1,89 @@
+package main
+
+import (
+	"archive/zip"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// streamedHashes holds the content hashes of ZIP entries hashed as they were extracted
+// (streamZip), by extracted path, so fileHash does not read them back
+var streamedHashes sync.Map
+
+// streamableZip reports whether a ZIP is sorted as it is read (streamZip): its contents total at
+// least --zip-stream-threshold, and none of its entries is encrypted. An encrypted archive is
+// extracted whole, so one that no password opens is kept whole rather than half sorted.
+func streamableZip(zipPath string) bool {
+	if zipStreamThreshold == 0 {
+		return false
+	}
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return false
+	}
+	defer reader.Close()
+	var total int64
+	for _, file := range reader.File {
+		if file.Flags&0x1 != 0 {
+			return false
+		}
+		total += int64(file.UncompressedSize64)
+	}
+	return total >= int64(zipStreamThreshold)
+}
+
+// streamZip sorts a large ZIP a folder at a time: the entries of each folder are extracted,
+// hashed as they are written, sorted and cleaned up before the next folder is read. A run then
+// needs temporary space for one folder rather than the whole archive, and never reads the
+// extracted files back to hash them. Pairs and sidecars share a folder, so they still move
+// together.
+func streamZip(zipPath, destDir string, g *archiveGuard) bool {
+	reader, filePaths, ok := openZip(zipPath, destDir, g)
+	if !ok {
+		return false
+	}
+	defer reader.Close()
+
+	// Folders in the order the archive lists them
+	var folders []string
+	entries := make(map[string][]*zip.File)
+	for _, file := range reader.File {
+		filePath, ok := filePaths[file]
+		if !ok {
+			continue
+		}
+		folder := filepath.Dir(filePath)
+		if entries[folder] == nil {
+			folders = append(folders, folder)
+		}
+		entries[folder] = append(entries[folder], file)
+	}
+
+	for i, folder := range folders {
+		if interrupted() {
+			return false
+		}
+		files := entries[folder]
+		extractZipFiles(files, filePaths, zipPath, true)
+		var jobs []fileJob
+		for _, file := range files {
+			if info, err := os.Stat(filePaths[file]); err == nil {
+				jobs = append(jobs, fileJob{path: filePaths[file], size: info.Size()})
+			}
+		}
+		log.Printf("Sorting folder %d of %d from '%s' (%d files)", i+1, len(folders), filepath.Base(zipPath), len(jobs))
+		err := processExtracted(pairCompanions(jobs))
+		// Whatever was not moved out (nothing, normally) goes before the next folder is extracted
+		for _, file := range files {
+			streamedHashes.Delete(filePaths[file])
+			os.Remove(filePaths[file])
+		}
+		if err != nil {
+			log.Printf("Error processing extracted files from '%s': %v", filepath.Base(zipPath), err)
+			return false
+		}
+	}
+	return true
+}